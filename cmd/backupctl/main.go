@@ -11,6 +11,9 @@ Usage:
 Global Options:
 
 	--kubeconfig string       (Optional) Path to kubeconfig file for out-of-cluster execution.
+	--context string          (Optional) Kubeconfig context to use instead of current-context.
+	--cluster string          (Optional) Named cluster to restore or upgrade in, from --clusters-file or the kubeconfig contexts.
+	--clusters-file string    (Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.
 	--backup-dir string       Root directory for storing chart backups (default "./chart_backups").
 	--output string           Output format for list command (text, json, yaml) (default "text").
 	--helm-namespace string   Default Kubernetes namespace for Helm operations if not specified
@@ -75,6 +78,17 @@ Commands:
 	  Options:
 	    --keep int: Number of recent backups to keep (default 5).
 
+Exit Status:
+
+	0  Success.
+	1  Any error not listed below.
+	3  Release, revision or backup not found.
+	4  Release name already in use.
+	5  Chart not found.
+	6  Chart repository or registry unreachable.
+	7  Another operation on the release is in progress.
+	8  Invalid values.
+
 Example Usage:
 
 	backupctl --backup-dir /mnt/backups backup --chart-path ./charts/myapp --values ./prod-values.yaml myapp
@@ -92,6 +106,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
@@ -120,6 +135,9 @@ func main() {
 
 	// Global flags
 	kubeconfig := flag.String("kubeconfig", "", "(Optional) Path to kubeconfig file for out-of-cluster execution.")
+	kubeContext := flag.String("context", "", "(Optional) Kubeconfig context to use instead of current-context.")
+	clusterName := flag.String("cluster", "", "(Optional) Named cluster to restore or upgrade in, from --clusters-file or the kubeconfig contexts.")
+	clustersFile := flag.String("clusters-file", "", "(Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.")
 	backupDir := flag.String("backup-dir", defaultBackupRoot, "Root directory for storing chart backups.")
 	outputFormat := flag.String("output", "text", "Output format for list command (text, json, yaml).")
 	helmNamespace := flag.String("helm-namespace", "", "Default Kubernetes namespace for Helm operations (uses current context or 'default' if empty).")
@@ -173,6 +191,10 @@ func main() {
 	command := args[0]
 	commandArgs := args[1:]
 
+	// Cancel in-flight Helm operations on Ctrl-C instead of abandoning them mid-way.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// Initialize Backup Manager
 	bm, err := backupmanager.NewFileSystemBackupManager(*backupDir, log.Printf)
 	if err != nil {
@@ -185,10 +207,22 @@ func main() {
 
 	// Initialize Kubernetes and Helm clients only if needed by the command
 	if command == "restore" || command == "upgrade" {
+		authOpts := k8sutils.AuthOptions{Context: *kubeContext, Namespace: *helmNamespace}
 		if *kubeconfig != "" {
-			os.Setenv("KUBECONFIG", *kubeconfig)
+			authOpts.KubeconfigPaths = filepath.SplitList(*kubeconfig)
+		}
+		if *clusterName != "" {
+			if *kubeContext != "" {
+				log.Fatal("--cluster and --context cannot be used together.")
+			}
+			clusters, errClusters := k8sutils.LoadClusterRegistry(*clustersFile, authOpts.KubeconfigPaths)
+			if errClusters != nil {
+				log.Fatalf("Failed to load clusters: %v", errClusters)
+			}
+			k8sAuth, err = clusters.Checker(*clusterName)
+		} else {
+			k8sAuth, err = k8sutils.NewAuthUtilWithOptions(authOpts)
 		}
-		k8sAuth, err = k8sutils.NewAuthUtil()
 		if err != nil {
 			log.Fatalf("Failed to initialize K8s auth: %v", err)
 		}
@@ -235,12 +269,12 @@ func main() {
 
 		values, err := loadValues(*backupValuesFile, *backupSetValues)
 		if err != nil {
-			log.Fatalf("Error loading values for backup: %v", err)
+			fatalf(err, "Error loading values for backup: %v", err)
 		}
 
 		backupID, err := bm.BackupRelease(releaseName, *backupChartPath, values)
 		if err != nil {
-			log.Fatalf("Error creating backup for release %s: %v", releaseName, err)
+			fatalf(err, "Error creating backup for release %s: %v", releaseName, err)
 		}
 		fmt.Printf("Successfully created backup for release '%s' with ID: %s\n", releaseName, backupID)
 
@@ -252,7 +286,7 @@ func main() {
 		releaseName := listCmd.Arg(0)
 		backups, err := bm.ListBackups(releaseName)
 		if err != nil {
-			log.Fatalf("Error listing backups for release %s: %v", releaseName, err)
+			fatalf(err, "Error listing backups for release %s: %v", releaseName, err)
 		}
 		if len(backups) == 0 {
 			fmt.Printf("No backups found for release '%s'.\n", releaseName)
@@ -290,9 +324,9 @@ func main() {
 			}
 		}
 
-		relInfo, err := bm.RestoreRelease(context.Background(), helmClient, nsForRestore, releaseName, backupID, *restoreCreateNamespace, *restoreWait, timeout)
+		relInfo, err := bm.RestoreRelease(ctx, helmClient, nsForRestore, releaseName, backupID, *restoreCreateNamespace, *restoreWait, timeout)
 		if err != nil {
-			log.Fatalf("Error restoring release %s from backup %s: %v", releaseName, backupID, err)
+			fatalf(err, "Error restoring release %s from backup %s: %v", releaseName, backupID, err)
 		}
 		fmt.Printf("Successfully restored release '%s' in namespace '%s' from backup ID '%s'. New revision: %d\n", relInfo.Name, relInfo.Namespace, backupID, relInfo.Revision)
 
@@ -326,9 +360,9 @@ func main() {
 			}
 		}
 
-		relInfo, err := bm.UpgradeToBackup(context.Background(), helmClient, nsForUpgrade, releaseName, backupID, *upgradeWait, timeout, *upgradeForce)
+		relInfo, err := bm.UpgradeToBackup(ctx, helmClient, nsForUpgrade, releaseName, backupID, *upgradeWait, timeout, *upgradeForce)
 		if err != nil {
-			log.Fatalf("Error upgrading release %s using backup %s: %v", releaseName, backupID, err)
+			fatalf(err, "Error upgrading release %s using backup %s: %v", releaseName, backupID, err)
 		}
 		fmt.Printf("Successfully upgraded release '%s' in namespace '%s' using backup ID '%s'. New revision: %d\n", relInfo.Name, relInfo.Namespace, backupID, relInfo.Revision)
 
@@ -342,7 +376,7 @@ func main() {
 
 		err := bm.DeleteBackup(releaseName, backupID)
 		if err != nil {
-			log.Fatalf("Error deleting backup ID '%s' for release '%s': %v", backupID, releaseName, err)
+			fatalf(err, "Error deleting backup ID '%s' for release '%s': %v", backupID, releaseName, err)
 		}
 		fmt.Printf("Successfully deleted backup ID '%s' for release '%s'.\n", backupID, releaseName)
 
@@ -355,7 +389,7 @@ func main() {
 
 		prunedCount, err := bm.PruneBackups(releaseName, *pruneKeepCount)
 		if err != nil {
-			log.Fatalf("Error pruning backups for release %s: %v", releaseName, err)
+			fatalf(err, "Error pruning backups for release %s: %v", releaseName, err)
 		}
 		fmt.Printf("Successfully pruned %d backup(s) for release '%s', keeping %d.\n", prunedCount, releaseName, *pruneKeepCount)
 
@@ -366,6 +400,13 @@ func main() {
 	}
 }
 
+// fatalf logs like log.Fatalf but exits with the code helmutils.ExitCode
+// assigns to err, so scripts can tell failures apart.
+func fatalf(err error, format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(helmutils.ExitCode(err))
+}
+
 // loadValues combines values from a file and --set flags.
 // This is a simplified version. For full Helm compatibility, consider helm.MergeValues.
 func loadValues(valuesFile string, setValues string) (map[string]interface{}, error) {
@@ -377,7 +418,7 @@ func loadValues(valuesFile string, setValues string) (map[string]interface{}, er
 			return nil, fmt.Errorf("failed to read values file %s: %w", valuesFile, err)
 		}
 		if err := yaml.Unmarshal(bytes, &base); err != nil {
-			return nil, fmt.Errorf("failed to parse values file %s: %w", valuesFile, err)
+			return nil, fmt.Errorf("failed to parse values file %s: %w: %w", valuesFile, helmutils.ErrInvalidValues, err)
 		}
 	}
 
@@ -387,7 +428,7 @@ func loadValues(valuesFile string, setValues string) (map[string]interface{}, er
 		for _, pair := range pairs {
 			kv := strings.SplitN(pair, "=", 2)
 			if len(kv) != 2 {
-				return nil, fmt.Errorf("invalid --set format: %s. Expected key=value", pair)
+				return nil, fmt.Errorf("invalid --set format: %s. Expected key=value: %w", pair, helmutils.ErrInvalidValues)
 			}
 			// This is a very basic parser. Helm's --set is more sophisticated.
 			// For simplicity, we'll treat all values as strings here.
@@ -404,7 +445,7 @@ func loadValues(valuesFile string, setValues string) (map[string]interface{}, er
 					var ok bool
 					currentMap, ok = currentMap[k].(map[string]interface{}) // Type assertion
 					if !ok {
-						return nil, fmt.Errorf("invalid --set key structure: %s creates conflict at %s", kv[0], k)
+						return nil, fmt.Errorf("invalid --set key structure: %s creates conflict at %s: %w", kv[0], k, helmutils.ErrInvalidValues)
 					}
 				}
 			}
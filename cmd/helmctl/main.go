@@ -18,6 +18,9 @@ Usage:
 Global Options:
 
 	--kubeconfig string       (Optional) Path to kubeconfig file for out-of-cluster execution.
+	--context string          (Optional) Kubeconfig context to use instead of current-context.
+	--cluster string          (Optional) Named cluster to use, from --clusters-file or the kubeconfig contexts.
+	--clusters-file string    (Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.
 	--helm-namespace string   Namespace for Helm operations (default: current kubeconfig context or 'default').
 	                          This namespace is used as the default for commands unless overridden
 	                          by command-specific flags (e.g., --all-namespaces for 'list').
@@ -25,14 +28,37 @@ Global Options:
 
 Commands:
 
-	list                      List Helm releases.
+	list                      List Helm releases, in one cluster or with --all-clusters in every one.
 	install                   Install a Helm chart.
 	uninstall <release-name>  Uninstall a Helm release.
 	upgrade <release-name>    Upgrade a Helm release.
+	rollback <release-name> [revision]
+	                          Roll a Helm release back to a previous revision.
+	diff upgrade <release-name>
+	                          Show what an upgrade would change, resource by resource.
 	details <release-name>    Get details of a Helm release.
+	status <release-name>     Show the status of a Helm release, or follow its progress with --watch.
+	test <release-name>       Run the chart tests of a Helm release; exits non-zero if any test fails.
 	history <release-name>    Get history of a Helm release.
+	get-values <release-name>
+	                          Show the user-supplied or, with --all, the computed values of a release revision.
+	resources <release-name>  List the Kubernetes objects of a release and the health of each.
+	apply -f <file>           Install or upgrade a group of releases in dependency order.
+	destroy -f <file>         Uninstall a group of releases, dependents first.
 	repo-add                  Add a Helm chart repository.
 	repo-update               Update Helm chart repositories.
+	repo-list                 List configured Helm chart repositories.
+	repo-remove <name>        Remove a Helm chart repository.
+	search <keyword>          Search configured repositories for charts.
+	registry-login <host>     Log in to an OCI registry.
+	registry-logout <host>    Log out of an OCI registry.
+	push <chart> <oci-ref>    Push a chart directory or archive to an OCI registry.
+	pull <chart-ref>          Download a chart (oci://, repo/chart or URL) to a local directory.
+	dep-update <chart-dir>    Resolve a chart's dependencies, vendor them into charts/ and write Chart.lock.
+	dep-build <chart-dir>     Vendor the dependency versions pinned in Chart.lock into charts/.
+	dep-list <chart-dir>      Show a chart's dependencies and whether each is missing, wrong or outdated.
+	package <chart-dir>       Package a chart directory into a versioned archive, optionally signed.
+	lint <chart>              Check a chart for problems; exits non-zero if any are errors.
 	ensure-chart              Ensures a chart is available locally, downloading if necessary.
 
 Examples:
@@ -44,30 +70,124 @@ Examples:
  2. List all deployed releases across all namespaces:
     ./helmctl list --all-namespaces --deployed
 
+    Page through releases, most recently deployed first:
+    ./helmctl list --all-namespaces --sort=date --limit=20 --offset=20
+
+    Select releases by label, as set with --labels on install and upgrade:
+    ./helmctl list --all-namespaces --selector="team=payments,env!=prod"
+
  3. Install a chart from a repository:
     ./helmctl --helm-namespace=production install --name=my-nginx --chart=bitnami/nginx --version=15.0.0 --wait
 
+    Label the release with its owning team and environment:
+    ./helmctl install --name=my-nginx --chart=bitnami/nginx --labels="team=payments,env=prod"
+
  4. Install a local chart with custom values:
     ./helmctl install --name=local-app --chart=./path/to/local-chart --values=./path/to/values.yaml --set="image.tag=latest,replicaCount=3"
 
  5. Upgrade an existing release:
     ./helmctl upgrade my-nginx --chart=bitnami/nginx --version=15.0.1
 
- 6. Get details of a release:
+    Move it to another team and drop its env label (other labels are kept):
+    ./helmctl upgrade --chart=bitnami/nginx --labels="team=platform,env=null" my-nginx
+
+ 6. Preview an upgrade without applying it, as a rendered release or as a per-resource diff:
+    ./helmctl upgrade --chart=bitnami/nginx --version=15.0.1 --dry-run my-nginx
+    ./helmctl --output=json diff upgrade --chart=bitnami/nginx --version=15.0.1 my-nginx
+
+ 7. Label every resource, pull images from a mirror and add a sidecar while installing, using a
+    kustomize-style patch file, then pipe the result through an external post-renderer:
+    ./helmctl install --name=my-app --chart=./path/to/local-chart --patch-file=./patch.yaml
+    ./helmctl upgrade --chart=./path/to/local-chart --patch-file=./patch.yaml --post-renderer=./hooks/inject.sh --post-renderer-args="--env prod" my-app
+
+    patch.yaml is kustomize-style: commonLabels to add, images to rewrite (name, newName, newTag,
+    digest) and patches, each a strategic merge patch with an optional target (kind, name, namespace).
+
+ 8. Roll a release back to revision 2 (omit the revision to go back one):
+    ./helmctl rollback --wait my-nginx 2
+
+ 9. Get details of a release:
     ./helmctl details my-nginx --output=yaml
 
- 7. Uninstall a release:
+ 10. Follow a release while it is being upgraded elsewhere, one JSON event per line, for at most 10 minutes:
+    ./helmctl status --watch --timeout=10m --output=json my-nginx
+
+ 11. Run a release's tests except the slow one, printing the test logs:
+    ./helmctl test --logs --filter='!my-nginx-load-test' my-nginx
+
+ 12. Show the values revision 2 of a release was rendered with, chart defaults included:
+    ./helmctl get-values --revision=2 --all --output=json my-nginx
+
+ 13. List the objects a release owns, with a health column (Healthy, Progressing, Failed, Missing or Unknown):
+    ./helmctl resources my-nginx
+
+ 14. Install or upgrade a group of releases that depend on each other, four at a time at most,
+    rolling every release back if one of them fails:
+    ./helmctl apply -f releases.yaml --parallel=4 --rollback-on-failure --wait
+
+    releases.yaml lists releases, each with a name, chart and optional version, namespace, valuesFile,
+    inline values and dependsOn, the names of releases it needs first. Local chart paths and values
+    files are relative to releases.yaml. Releases whose dependencies are deployed are installed in parallel.
+
+ 15. Remove the same group again, each release only after the releases that depend on it:
+    ./helmctl destroy -f releases.yaml --output=json
+
+ 16. Uninstall a release:
     ./helmctl uninstall my-nginx
 
- 8. Add a chart repository:
+ 17. Add a chart repository:
     ./helmctl repo-add --name=bitnami --url=https://charts.bitnami.com/bitnami
 
- 9. Update all chart repositories:
+ 18. Update all chart repositories:
     ./helmctl repo-update
 
- 10. Ensure a specific chart version is downloaded:
+ 19. Ensure a specific chart version is downloaded (semver constraints such as "^15.0" are allowed):
     ./helmctl ensure-chart --chart=bitnami/nginx --version=15.0.0
 
+ 20. Search configured repositories for nginx charts in the 15.x line:
+    ./helmctl search --version="~15" nginx
+
+ 21. List and remove chart repositories:
+    ./helmctl repo-list --output=json
+    ./helmctl repo-remove bitnami
+
+ 22. Vendor the dependencies of an umbrella chart, then check in CI that charts/ is complete and up to date:
+    ./helmctl dep-update ./path/to/umbrella-chart
+    ./helmctl dep-list --check ./path/to/umbrella-chart
+
+    Dependencies name their repository by URL, as "@repo-name" for a configured repository, or as
+    file://../other-chart for a chart directory next to this one.
+
+ 23. Lint a chart, then package it as version 1.4.0 and sign it with a key from a local keyring:
+    ./helmctl lint --strict --values=./ci-values.yaml ./path/to/local-chart
+    ./helmctl package --version=1.4.0 --destination=./dist --sign --key="Release Bot" --keyring=./secring.gpg ./path/to/local-chart
+
+ 24. Install or download a chart only if its provenance file is signed by a key in a public keyring:
+    ./helmctl install --name=my-app --chart=bitnami/nginx --version=15.0.0 --verify --keyring=./pubring.gpg
+    ./helmctl ensure-chart --chart=./dist/local-chart-1.4.0.tgz --verify
+
+    The .prov file is downloaded next to the archive. Chart directories cannot be verified.
+
+ 25. Publish a chart to an OCI registry and install it from there:
+    ./helmctl registry-login --username=ci --password-stdin registry.example.com < token.txt
+    ./helmctl push ./path/to/local-chart oci://registry.example.com/charts
+    ./helmctl install --name=my-app --chart=oci://registry.example.com/charts/local-chart --version="^1.0"
+    ./helmctl pull --version=1.0.0 --destination=./charts oci://registry.example.com/charts/local-chart
+
+Exit Status:
+
+	0  Success.
+	1  Any error not listed below, including a failed 'test'.
+	2  Invalid command-line flags.
+	3  Release or revision not found.
+	4  Release name already in use.
+	5  Chart not found.
+	6  Chart repository or registry unreachable.
+	7  Another operation on the release is in progress.
+	8  Invalid values.
+	9  Chart verification failed (--verify).
+	10 'diff --detailed-exitcode' found changes. This is not 2, which the flag parser exits with.
+
 Testing with the Umbrella Chart:
 This tool can be effectively tested using the 'umbrella-chart' provided within this project
 (see 'd:\WSL\repos\johngai19\go_k8s_helm\umbrella-chart\'). The umbrella-chart is designed
@@ -102,18 +222,26 @@ For detailed options for each command and global flags, run:
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"go_k8s_helm/internal/helmutils"
 	"go_k8s_helm/internal/k8sutils"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/yaml"
 )
 
@@ -123,11 +251,31 @@ var (
 	installCmd     *flag.FlagSet
 	uninstallCmd   *flag.FlagSet
 	upgradeCmd     *flag.FlagSet
+	rollbackCmd    *flag.FlagSet
+	diffCmd        *flag.FlagSet
 	detailsCmd     *flag.FlagSet
 	historyCmd     *flag.FlagSet
+	statusCmd      *flag.FlagSet
+	testCmd        *flag.FlagSet
+	getValuesCmd   *flag.FlagSet
+	resourcesCmd   *flag.FlagSet
+	applyCmd       *flag.FlagSet
+	destroyCmd     *flag.FlagSet
 	repoAddCmd     *flag.FlagSet
 	repoUpdateCmd  *flag.FlagSet
 	ensureChartCmd *flag.FlagSet
+	repoListCmd    *flag.FlagSet
+	repoRemoveCmd  *flag.FlagSet
+	searchCmd      *flag.FlagSet
+	loginCmd       *flag.FlagSet
+	logoutCmd      *flag.FlagSet
+	pushCmd        *flag.FlagSet
+	pullCmd        *flag.FlagSet
+	depUpdateCmd   *flag.FlagSet
+	depBuildCmd    *flag.FlagSet
+	depListCmd     *flag.FlagSet
+	packageCmd     *flag.FlagSet
+	lintCmd        *flag.FlagSet
 )
 
 func main() {
@@ -136,13 +284,16 @@ func main() {
 
 	// Common flags for Helm client initialization
 	kubeconfig := flag.String("kubeconfig", "", "(Optional) Path to kubeconfig file for out-of-cluster execution.")
+	kubeContext := flag.String("context", "", "(Optional) Kubeconfig context to use instead of current-context.")
+	clusterName := flag.String("cluster", "", "(Optional) Named cluster to use, from --clusters-file or the kubeconfig contexts.")
+	clustersFile := flag.String("clusters-file", "", "(Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.")
 	helmNamespace := flag.String("helm-namespace", "", "Namespace for Helm operations (default: current kubeconfig context or 'default').")
 	outputFormat := flag.String("output", "text", "Output format for lists and details (text, json, yaml).")
 
 	// List releases flags
 	listCmd = flag.NewFlagSet("list", flag.ExitOnError)
 	listAllNamespaces := listCmd.Bool("all-namespaces", false, "List releases in all namespaces.")
-	listFilter := listCmd.String("filter", "", "Filter releases by name (substring match).")
+	listFilter := listCmd.String("filter", "", "Filter releases by name (regular expression).")
 	listDeployed := listCmd.Bool("deployed", false, "Show deployed releases. If no status flags are set, all are shown.")
 	listUninstalled := listCmd.Bool("uninstalled", false, "Show uninstalled releases (if history is kept).")
 	listUninstalling := listCmd.Bool("uninstalling", false, "Show releases that are currently uninstalling.")
@@ -151,6 +302,12 @@ func main() {
 	listPendingRollback := listCmd.Bool("pending-rollback", false, "Show pending rollback releases.")
 	listFailed := listCmd.Bool("failed", false, "Show failed releases.")
 	listSuperseded := listCmd.Bool("superseded", false, "Show superseded releases.")
+	listSort := listCmd.String("sort", "name", "Sort releases by name, date or revision.")
+	listReverse := listCmd.Bool("reverse", false, "Reverse the sort order.")
+	listLimit := listCmd.Int("limit", 0, "Maximum number of releases to show (0 for no limit).")
+	listOffset := listCmd.Int("offset", 0, "Number of releases to skip before showing results.")
+	listSelector := listCmd.String("selector", "", "Label selector to filter releases by (e.g., team=payments,env!=prod).")
+	listAllClusters := listCmd.Bool("all-clusters", false, "List releases in every cluster of --clusters-file or the kubeconfig contexts.")
 
 	// Install chart flags
 	installCmd = flag.NewFlagSet("install", flag.ExitOnError)
@@ -162,6 +319,13 @@ func main() {
 	installCreateNs := installCmd.Bool("create-namespace", false, "Create the release namespace if not present.")
 	installWait := installCmd.Bool("wait", false, "Wait for resources to be ready.")
 	installTimeoutStr := installCmd.String("timeout", "5m", "Time to wait for any individual Kubernetes operation (e.g., 5m, 10s).")
+	installDryRun := installCmd.Bool("dry-run", false, "Render the release without installing it.")
+	installPostRenderer := installCmd.String("post-renderer", "", "Path to an executable the rendered manifest is piped through before it is installed.")
+	installPostRendererArgs := installCmd.String("post-renderer-args", "", "Space-separated arguments for the --post-renderer executable.")
+	installPatchFile := installCmd.String("patch-file", "", "Kustomize-style patch file (commonLabels, images, patches) applied to the rendered manifest.")
+	installLabels := installCmd.String("labels", "", "Labels to store with the release (e.g., team=payments,env=prod).")
+	installVerify := installCmd.Bool("verify", false, "Verify the chart's provenance file against --keyring before installing it.")
+	installKeyring := installCmd.String("keyring", defaultKeyring("pubring.gpg"), "Public keyring used by --verify.")
 
 	// Uninstall release flags
 	uninstallCmd = flag.NewFlagSet("uninstall", flag.ExitOnError)
@@ -178,13 +342,69 @@ func main() {
 	upgradeWait := upgradeCmd.Bool("wait", false, "Wait for resources to be ready after upgrade.")
 	upgradeTimeoutStr := upgradeCmd.String("timeout", "5m", "Time to wait for any individual Kubernetes operation.")
 	upgradeForce := upgradeCmd.Bool("force", false, "Force resource updates through a replacement strategy.")
+	upgradeDryRun := upgradeCmd.Bool("dry-run", false, "Render the upgraded release without applying it.")
+	upgradePostRenderer := upgradeCmd.String("post-renderer", "", "Path to an executable the rendered manifest is piped through before it is applied.")
+	upgradePostRendererArgs := upgradeCmd.String("post-renderer-args", "", "Space-separated arguments for the --post-renderer executable.")
+	upgradePatchFile := upgradeCmd.String("patch-file", "", "Kustomize-style patch file (commonLabels, images, patches) applied to the rendered manifest.")
+	upgradeLabels := upgradeCmd.String("labels", "", "Labels to add to or change on the release; key=null removes a label.")
+
+	// Rollback release flags
+	rollbackCmd = flag.NewFlagSet("rollback", flag.ExitOnError)
+	rollbackWait := rollbackCmd.Bool("wait", false, "Wait for resources to be ready after rollback.")
+	rollbackTimeoutStr := rollbackCmd.String("timeout", "5m", "Time to wait for any individual Kubernetes operation.")
+	rollbackForce := rollbackCmd.Bool("force", false, "Force resource updates through a replacement strategy.")
+
+	// Diff flags (currently only 'diff upgrade')
+	diffCmd = flag.NewFlagSet("diff", flag.ExitOnError)
+	diffChart := diffCmd.String("chart", "", "Chart to diff the release against. (Required)")
+	diffVersion := diffCmd.String("version", "", "Specify chart version to diff against.")
+	diffValuesFile := diffCmd.String("values", "", "Path to a YAML file with values for the upgrade.")
+	diffSetValues := diffCmd.String("set", "", "Set values for the upgrade.")
+	diffPostRenderer := diffCmd.String("post-renderer", "", "Path to an executable the rendered manifest is piped through, as for upgrade.")
+	diffPostRendererArgs := diffCmd.String("post-renderer-args", "", "Space-separated arguments for the --post-renderer executable.")
+	diffPatchFile := diffCmd.String("patch-file", "", "Kustomize-style patch file applied to the rendered manifest, as for upgrade.")
+	diffDetailedExitCode := diffCmd.Bool("detailed-exitcode", false, "Exit with code 10 when the upgrade would change any resource.")
 
 	// Get release details flags
 	detailsCmd = flag.NewFlagSet("details", flag.ExitOnError)
 
+	// Release status flags
+	statusCmd = flag.NewFlagSet("status", flag.ExitOnError)
+	statusWatch := statusCmd.Bool("watch", false, "Stream progress events until the release is no longer pending (deployed, failed or deleted).")
+	statusTimeoutStr := statusCmd.String("timeout", "0", "Give up watching after this long (e.g., 5m). 0 means no limit.")
+
+	// Release test flags
+	testCmd = flag.NewFlagSet("test", flag.ExitOnError)
+	testTimeoutStr := testCmd.String("timeout", "5m", "Time to wait for the tests to complete.")
+	testFilter := testCmd.String("filter", "", "Comma-separated test names to run. Prefix a name with '!' to skip it instead.")
+	testLogs := testCmd.Bool("logs", false, "Print the logs of each test.")
+
 	// Get release history flags
 	historyCmd = flag.NewFlagSet("history", flag.ExitOnError)
 
+	// Get release values flags
+	getValuesCmd = flag.NewFlagSet("get-values", flag.ExitOnError)
+	getValuesRevision := getValuesCmd.Int("revision", 0, "Revision to show the values of. 0 means the latest revision.")
+	getValuesAll := getValuesCmd.Bool("all", false, "Show all computed values, chart defaults included, instead of only the user-supplied ones.")
+
+	// Release resources flags
+	resourcesCmd = flag.NewFlagSet("resources", flag.ExitOnError)
+
+	// Release group apply flags
+	applyCmd = flag.NewFlagSet("apply", flag.ExitOnError)
+	applyFile := applyCmd.String("f", "", "Release group spec file (YAML). (Required)")
+	applyParallel := applyCmd.Int("parallel", 0, "Maximum number of releases installed or upgraded at once (0 for no limit).")
+	applyRollback := applyCmd.Bool("rollback-on-failure", false, "If any release fails, roll back upgraded releases and uninstall newly installed ones.")
+	applyWait := applyCmd.Bool("wait", false, "Wait for the resources of each release to be ready before starting its dependents.")
+	applyTimeoutStr := applyCmd.String("timeout", "5m", "Time to wait for each release operation.")
+
+	// Release group destroy flags
+	destroyCmd = flag.NewFlagSet("destroy", flag.ExitOnError)
+	destroyFile := destroyCmd.String("f", "", "Release group spec file (YAML). (Required)")
+	destroyParallel := destroyCmd.Int("parallel", 0, "Maximum number of releases uninstalled at once (0 for no limit).")
+	destroyKeepHistory := destroyCmd.Bool("keep-history", false, "Keep release history.")
+	destroyTimeoutStr := destroyCmd.String("timeout", "5m", "Time to wait for each release operation.")
+
 	// Repo add flags
 	repoAddCmd = flag.NewFlagSet("repo-add", flag.ExitOnError)
 	repoAddName := repoAddCmd.String("name", "", "Repository name. (Required)")
@@ -196,10 +416,64 @@ func main() {
 	// Repo update flags
 	repoUpdateCmd = flag.NewFlagSet("repo-update", flag.ExitOnError)
 
+	// Repo list flags
+	repoListCmd = flag.NewFlagSet("repo-list", flag.ExitOnError)
+
+	// Repo remove flags
+	repoRemoveCmd = flag.NewFlagSet("repo-remove", flag.ExitOnError)
+
+	// Search flags
+	searchCmd = flag.NewFlagSet("search", flag.ExitOnError)
+	searchVersion := searchCmd.String("version", "", "Semver constraint for chart versions (e.g., ^1.2, ~15). If empty, the latest stable version is shown.")
+
+	// Registry login flags
+	loginCmd = flag.NewFlagSet("registry-login", flag.ExitOnError)
+	loginUsername := loginCmd.String("username", "", "Registry username.")
+	loginPassword := loginCmd.String("password", "", "Registry password or identity token.")
+	loginPasswordStdin := loginCmd.Bool("password-stdin", false, "Read the password from stdin.")
+	loginInsecure := loginCmd.Bool("insecure", false, "Allow connections to registries without valid TLS (including plain HTTP).")
+
+	// Registry logout flags
+	logoutCmd = flag.NewFlagSet("registry-logout", flag.ExitOnError)
+
+	// Push flags
+	pushCmd = flag.NewFlagSet("push", flag.ExitOnError)
+	pushPlainHTTP := pushCmd.Bool("plain-http", false, "Use plain HTTP instead of HTTPS to talk to the registry.")
+
+	// Pull flags
+	pullCmd = flag.NewFlagSet("pull", flag.ExitOnError)
+	pullVersion := pullCmd.String("version", "", "Chart version or semver constraint. If empty, the latest version is used.")
+	pullDestination := pullCmd.String("destination", ".", "Directory to write the chart archive to.")
+	pullPlainHTTP := pullCmd.Bool("plain-http", false, "Use plain HTTP instead of HTTPS to talk to OCI registries.")
+
+	// Dependency flags
+	depUpdateCmd = flag.NewFlagSet("dep-update", flag.ExitOnError)
+	depBuildCmd = flag.NewFlagSet("dep-build", flag.ExitOnError)
+	depListCmd = flag.NewFlagSet("dep-list", flag.ExitOnError)
+	depListCheck := depListCmd.Bool("check", false, "Exit with code 1 if any dependency is not ok (missing, wrong-version or outdated).")
+
+	// Package flags
+	packageCmd = flag.NewFlagSet("package", flag.ExitOnError)
+	packageDestination := packageCmd.String("destination", ".", "Directory to write the chart archive to.")
+	packageVersion := packageCmd.String("version", "", "Set the chart version in the archive (semver).")
+	packageAppVersion := packageCmd.String("app-version", "", "Set the appVersion in the archive.")
+	packageSign := packageCmd.Bool("sign", false, "Sign the archive with a PGP key, writing a .prov file next to it.")
+	packageKey := packageCmd.String("key", "", "Name of the signing key in --keyring (a substring of its identity). Required with --sign.")
+	packageKeyring := packageCmd.String("keyring", defaultKeyring("secring.gpg"), "Secret keyring holding the signing key.")
+	packagePassphraseFile := packageCmd.String("passphrase-file", "", "File containing the passphrase of the signing key, if it is encrypted.")
+
+	// Lint flags
+	lintCmd = flag.NewFlagSet("lint", flag.ExitOnError)
+	lintValuesFile := lintCmd.String("values", "", "Path to a YAML file with values to render the templates with.")
+	lintSetValues := lintCmd.String("set", "", "Set values to render the templates with.")
+	lintStrict := lintCmd.Bool("strict", false, "Exit non-zero on warnings as well as errors.")
+
 	// Ensure chart flags
 	ensureChartCmd = flag.NewFlagSet("ensure-chart", flag.ExitOnError)
 	ensureChartName := ensureChartCmd.String("chart", "", "Chart name to ensure (e.g., repo/chart). (Required)")
 	ensureChartVersion := ensureChartCmd.String("version", "", "Chart version to ensure. If empty, latest is implied by Helm's LocateChart.")
+	ensureChartVerify := ensureChartCmd.Bool("verify", false, "Verify the chart's provenance file against --keyring.")
+	ensureChartKeyring := ensureChartCmd.String("keyring", defaultKeyring("pubring.gpg"), "Public keyring used by --verify.")
 
 	if len(os.Args) < 2 {
 		flag.Usage() // Calls printUsage
@@ -222,7 +496,7 @@ func main() {
 				// Check if this help flag is a global one (not for a subcommand)
 				// This simple check assumes help flags are not subcommand names.
 				isGlobalHelp := true
-				allCmdSets := []*flag.FlagSet{listCmd, installCmd, uninstallCmd, upgradeCmd, detailsCmd, historyCmd, repoAddCmd, repoUpdateCmd, ensureChartCmd}
+				allCmdSets := []*flag.FlagSet{listCmd, installCmd, uninstallCmd, upgradeCmd, rollbackCmd, diffCmd, detailsCmd, statusCmd, testCmd, historyCmd, getValuesCmd, resourcesCmd, applyCmd, destroyCmd, repoAddCmd, repoUpdateCmd, repoListCmd, repoRemoveCmd, searchCmd, loginCmd, logoutCmd, pushCmd, pullCmd, depUpdateCmd, depBuildCmd, depListCmd, packageCmd, lintCmd, ensureChartCmd}
 				for _, cmdSet := range allCmdSets {
 					if cmdSet != nil && cmdSet.Name() == arg { // Unlikely, but defensive
 						isGlobalHelp = false
@@ -248,11 +522,37 @@ func main() {
 	command := args[0]
 	commandArgs := args[1:]
 
+	// Cancel in-flight Helm operations on Ctrl-C instead of abandoning them mid-way.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// K8s and Helm Client Initialization
+	var kubeconfigPaths []string
 	if *kubeconfig != "" {
-		os.Setenv("KUBECONFIG", *kubeconfig)
+		kubeconfigPaths = filepath.SplitList(*kubeconfig)
+	}
+	// loadClusters reads the named clusters for --cluster and --all-clusters.
+	loadClusters := func() *k8sutils.ClusterRegistry {
+		clusters, errClusters := k8sutils.LoadClusterRegistry(*clustersFile, kubeconfigPaths)
+		if errClusters != nil {
+			log.Fatalf("Failed to load clusters: %v", errClusters)
+		}
+		return clusters
+	}
+	var k8sAuth k8sutils.K8sAuthChecker
+	var err error
+	if *clusterName != "" {
+		if *kubeContext != "" {
+			log.Fatal("--cluster and --context cannot be used together.")
+		}
+		k8sAuth, err = loadClusters().Checker(*clusterName)
+	} else {
+		k8sAuth, err = k8sutils.NewAuthUtilWithOptions(k8sutils.AuthOptions{
+			KubeconfigPaths: kubeconfigPaths,
+			Context:         *kubeContext,
+			Namespace:       *helmNamespace,
+		})
 	}
-	k8sAuth, err := k8sutils.NewAuthUtil()
 	if err != nil {
 		log.Fatalf("Failed to initialize K8s auth: %v", err)
 	}
@@ -310,11 +610,29 @@ func main() {
 			stateMask = action.ListAll
 		}
 
-		releases, err := helmClient.ListReleases(nsToList, stateMask)
+		listOpts := helmutils.ListOptions{
+			Namespace:   nsToList,
+			StateMask:   stateMask,
+			Filter:      *listFilter,
+			SortBy:      helmutils.ListSortBy(*listSort),
+			SortReverse: *listReverse,
+			Limit:       *listLimit,
+			Offset:      *listOffset,
+			Selector:    *listSelector,
+		}
+		if *listAllClusters {
+			releases, err := listClusterReleases(ctx, loadClusters(), *helmNamespace, *listAllNamespaces, listOpts)
+			printOutput(releases, *outputFormat, "")
+			if err != nil {
+				fatalf(err, "Error listing releases: %v", err)
+			}
+			break
+		}
+		releases, err := helmClient.ListReleasesWithOptionsContext(ctx, listOpts)
 		if err != nil {
-			log.Fatalf("Error listing releases: %v", err)
+			fatalf(err, "Error listing releases: %v", err)
 		}
-		printOutput(releases, *outputFormat, *listFilter)
+		printOutput(releases, *outputFormat, "")
 
 	case "install":
 		installCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
@@ -327,16 +645,42 @@ func main() {
 		}
 		vals, err := loadValues(*installValuesFile, *installSetValues)
 		if err != nil {
-			log.Fatalf("Error loading values for install: %v", err)
+			fatalf(err, "Error loading values for install: %v", err)
+		}
+		if err := setPostRenderers(helmClient, *installPatchFile, *installPostRenderer, *installPostRendererArgs); err != nil {
+			fatalf(err, "Error setting up post-renderers for install: %v", err)
+		}
+		if err := setVerify(helmClient, *installVerify, *installKeyring); err != nil {
+			log.Fatalf("Error setting up chart verification for install: %v", err)
+		}
+		releaseLabels, err := parseLabels(*installLabels)
+		if err != nil {
+			fatalf(err, "Invalid --labels for install: %v", err)
 		}
 		// Use effectiveHelmNs directly as it already considers the --helm-namespace flag
 		targetNs := effectiveHelmNs
 
-		rel, err := helmClient.InstallChart(targetNs, *installReleaseName, *installChart, *installVersion, vals, *installCreateNs, *installWait, installTimeout)
+		rel, err := helmClient.InstallChartWithOptionsContext(ctx, helmutils.InstallOptions{
+			Namespace:       targetNs,
+			ReleaseName:     *installReleaseName,
+			ChartName:       *installChart,
+			ChartVersion:    *installVersion,
+			Values:          vals,
+			CreateNamespace: *installCreateNs,
+			Wait:            *installWait,
+			Timeout:         installTimeout,
+			DryRun:          *installDryRun,
+			Labels:          releaseLabels,
+		})
 		if err != nil {
-			log.Fatalf("Error installing chart: %v", err)
+			fatalf(err, "Error installing chart: %v", err)
+		}
+		if *installDryRun {
+			fmt.Printf("Dry run of install for release: %s in namespace %s\n", rel.Name, rel.Namespace)
+			fmt.Println(rel.Manifest)
+		} else {
+			fmt.Printf("Installed release: %s in namespace %s\n", rel.Name, rel.Namespace)
 		}
-		fmt.Printf("Installed release: %s in namespace %s\n", rel.Name, rel.Namespace)
 		printOutput(rel, *outputFormat, "")
 
 	case "uninstall":
@@ -351,9 +695,9 @@ func main() {
 		}
 		targetNs := effectiveHelmNs
 
-		info, err := helmClient.UninstallRelease(targetNs, releaseToUninstall, *uninstallKeepHistory, uninstallTimeout)
+		info, err := helmClient.UninstallReleaseContext(ctx, targetNs, releaseToUninstall, *uninstallKeepHistory, uninstallTimeout)
 		if err != nil {
-			log.Fatalf("Error uninstalling release %s: %v", releaseToUninstall, err)
+			fatalf(err, "Error uninstalling release %s: %v", releaseToUninstall, err)
 		}
 		fmt.Println(info)
 
@@ -372,17 +716,97 @@ func main() {
 		}
 		vals, err := loadValues(*upgradeValuesFile, *upgradeSetValues)
 		if err != nil {
-			log.Fatalf("Error loading values for upgrade: %v", err)
+			fatalf(err, "Error loading values for upgrade: %v", err)
+		}
+		if err := setPostRenderers(helmClient, *upgradePatchFile, *upgradePostRenderer, *upgradePostRendererArgs); err != nil {
+			fatalf(err, "Error setting up post-renderers for upgrade: %v", err)
+		}
+		releaseLabels, err := parseLabels(*upgradeLabels)
+		if err != nil {
+			fatalf(err, "Invalid --labels for upgrade: %v", err)
+		}
+		targetNs := effectiveHelmNs
+
+		rel, err := helmClient.UpgradeReleaseWithOptionsContext(ctx, helmutils.UpgradeOptions{
+			Namespace:    targetNs,
+			ReleaseName:  releaseToUpgrade,
+			ChartName:    *upgradeChart,
+			ChartVersion: *upgradeVersion,
+			Values:       vals,
+			Wait:         *upgradeWait,
+			Timeout:      upgradeTimeout,
+			Install:      *upgradeInstall,
+			Force:        *upgradeForce,
+			DryRun:       *upgradeDryRun,
+			Labels:       releaseLabels,
+		})
+		if err != nil {
+			fatalf(err, "Error upgrading release: %v", err)
+		}
+		if *upgradeDryRun {
+			fmt.Printf("Dry run of upgrade for release: %s in namespace %s\n", rel.Name, rel.Namespace)
+			fmt.Println(rel.Manifest)
+		} else {
+			fmt.Printf("Upgraded release: %s in namespace %s\n", rel.Name, rel.Namespace)
+		}
+		printOutput(rel, *outputFormat, "")
+
+	case "rollback":
+		rollbackCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if rollbackCmd.NArg() == 0 {
+			log.Fatal("Missing release name for rollback command.")
+		}
+		releaseToRollback := rollbackCmd.Arg(0)
+		revision := 0 // 0 rolls back to the previous revision
+		if rollbackCmd.NArg() > 1 {
+			revision, err = strconv.Atoi(rollbackCmd.Arg(1))
+			if err != nil || revision < 1 {
+				log.Fatalf("Invalid revision %q for rollback: must be a positive integer", rollbackCmd.Arg(1))
+			}
+		}
+		rollbackTimeout, err := time.ParseDuration(*rollbackTimeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid rollback timeout duration: %v", err)
 		}
 		targetNs := effectiveHelmNs
 
-		rel, err := helmClient.UpgradeRelease(targetNs, releaseToUpgrade, *upgradeChart, *upgradeVersion, vals, *upgradeWait, upgradeTimeout, *upgradeInstall, *upgradeForce)
+		rel, err := helmClient.RollbackReleaseContext(ctx, targetNs, releaseToRollback, revision, *rollbackWait, rollbackTimeout, *rollbackForce)
 		if err != nil {
-			log.Fatalf("Error upgrading release: %v", err)
+			fatalf(err, "Error rolling back release %s: %v", releaseToRollback, err)
 		}
-		fmt.Printf("Upgraded release: %s in namespace %s\n", rel.Name, rel.Namespace)
+		fmt.Printf("Rolled back release: %s in namespace %s (now at revision %d)\n", rel.Name, rel.Namespace, rel.Revision)
 		printOutput(rel, *outputFormat, "")
 
+	case "diff":
+		if len(commandArgs) == 0 || commandArgs[0] != "upgrade" {
+			log.Fatal("Usage: helmctl diff upgrade --chart=<chart> [--version=...] [--values=...] [--set=...] <release-name>")
+		}
+		diffCmd.Parse(commandArgs[1:]) // Subcommand parsing handles its own --help
+		if diffCmd.NArg() == 0 {
+			log.Fatal("Missing release name for diff upgrade command.")
+		}
+		releaseToDiff := diffCmd.Arg(0)
+		if *diffChart == "" {
+			log.Fatal("Missing required flag for diff upgrade: --chart")
+		}
+		vals, err := loadValues(*diffValuesFile, *diffSetValues)
+		if err != nil {
+			fatalf(err, "Error loading values for diff: %v", err)
+		}
+		if err := setPostRenderers(helmClient, *diffPatchFile, *diffPostRenderer, *diffPostRendererArgs); err != nil {
+			fatalf(err, "Error setting up post-renderers for diff: %v", err)
+		}
+		targetNs := effectiveHelmNs
+
+		diff, err := helmClient.DiffReleaseContext(ctx, targetNs, releaseToDiff, *diffChart, *diffVersion, vals)
+		if err != nil {
+			fatalf(err, "Error diffing release %s: %v", releaseToDiff, err)
+		}
+		printOutput(diff, *outputFormat, "")
+		if *diffDetailedExitCode && diff.HasChanges() {
+			os.Exit(helmutils.ExitCodeChanges)
+		}
+
 	case "details":
 		detailsCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
 		if detailsCmd.NArg() == 0 {
@@ -391,12 +815,92 @@ func main() {
 		releaseToDetail := detailsCmd.Arg(0)
 		targetNs := effectiveHelmNs
 
-		details, err := helmClient.GetReleaseDetails(targetNs, releaseToDetail)
+		details, err := helmClient.GetReleaseDetailsContext(ctx, targetNs, releaseToDetail)
 		if err != nil {
-			log.Fatalf("Error getting details for release %s: %v", releaseToDetail, err)
+			fatalf(err, "Error getting details for release %s: %v", releaseToDetail, err)
 		}
 		printOutput(details, *outputFormat, "")
 
+	case "status":
+		statusCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if statusCmd.NArg() == 0 {
+			log.Fatal("Missing release name for status command.")
+		}
+		releaseName := statusCmd.Arg(0)
+		if !*statusWatch {
+			details, err := helmClient.GetReleaseDetailsContext(ctx, effectiveHelmNs, releaseName)
+			if err != nil {
+				fatalf(err, "Error getting status of release %s: %v", releaseName, err)
+			}
+			printOutput(details, *outputFormat, "")
+			break
+		}
+
+		timeout, err := time.ParseDuration(*statusTimeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid timeout duration %s: %v", *statusTimeoutStr, err)
+		}
+		watchCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			watchCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		// WatchRelease waits for a release that does not exist yet to be
+		// installed; from the command line that is almost always a typo.
+		if _, err := helmClient.GetReleaseDetailsContext(ctx, effectiveHelmNs, releaseName); err != nil {
+			fatalf(err, "Error getting status of release %s: %v", releaseName, err)
+		}
+		events, err := helmClient.WatchRelease(watchCtx, effectiveHelmNs, releaseName)
+		if err != nil {
+			fatalf(err, "Error watching release %s: %v", releaseName, err)
+		}
+		var last *helmutils.ReleaseEvent
+		for ev := range events {
+			printEvent(ev, *outputFormat)
+			if ev.Settled() {
+				last = &ev
+				break
+			}
+		}
+		if last == nil {
+			log.Fatalf("Stopped watching release %s before it settled: %v", releaseName, watchCtx.Err())
+		}
+		if last.Type == helmutils.ReleaseEventStatus && last.Status == release.StatusFailed {
+			os.Exit(1)
+		}
+
+	case "test":
+		testCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if testCmd.NArg() == 0 {
+			log.Fatal("Missing release name for test command.")
+		}
+		releaseToTest := testCmd.Arg(0)
+		timeout, err := time.ParseDuration(*testTimeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid timeout duration %s: %v", *testTimeoutStr, err)
+		}
+		var filter []string
+		if *testFilter != "" {
+			filter = strings.Split(*testFilter, ",")
+		}
+
+		results, err := helmClient.RunReleaseTestsContext(ctx, effectiveHelmNs, releaseToTest, timeout, filter)
+		if len(results) > 0 {
+			printTestResults(results, *outputFormat, *testLogs)
+		}
+		if err != nil {
+			fatalf(err, "Error testing release %s: %v", releaseToTest, err)
+		}
+		if len(results) == 0 {
+			fmt.Printf("Release %s has no tests to run.\n", releaseToTest)
+		}
+		for _, r := range results {
+			if !r.Passed() {
+				os.Exit(1)
+			}
+		}
+
 	case "history":
 		historyCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
 		if historyCmd.NArg() == 0 {
@@ -405,39 +909,296 @@ func main() {
 		releaseForHistory := historyCmd.Arg(0)
 		targetNs := effectiveHelmNs
 
-		history, err := helmClient.GetReleaseHistory(targetNs, releaseForHistory)
+		history, err := helmClient.GetReleaseHistoryContext(ctx, targetNs, releaseForHistory)
 		if err != nil {
-			log.Fatalf("Error getting history for release %s: %v", releaseForHistory, err)
+			fatalf(err, "Error getting history for release %s: %v", releaseForHistory, err)
 		}
 		printOutput(history, *outputFormat, "")
 
+	case "get-values":
+		getValuesCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if getValuesCmd.NArg() == 0 {
+			log.Fatal("Missing release name for get-values command.")
+		}
+		releaseForValues := getValuesCmd.Arg(0)
+		vals, err := helmClient.GetReleaseValuesContext(ctx, effectiveHelmNs, releaseForValues, *getValuesRevision, *getValuesAll)
+		if err != nil {
+			fatalf(err, "Error getting values for release %s: %v", releaseForValues, err)
+		}
+		printValues(vals, *outputFormat, *getValuesAll)
+
+	case "resources":
+		resourcesCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if resourcesCmd.NArg() == 0 {
+			log.Fatal("Missing release name for resources command.")
+		}
+		releaseForResources := resourcesCmd.Arg(0)
+		resources, err := helmClient.GetReleaseResourcesContext(ctx, effectiveHelmNs, releaseForResources)
+		if err != nil {
+			fatalf(err, "Error getting resources of release %s: %v", releaseForResources, err)
+		}
+		printOutput(resources, *outputFormat, "")
+
+	case "apply":
+		applyCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if *applyFile == "" {
+			log.Fatal("Missing required flag for apply: -f")
+		}
+		applyTimeout, err := time.ParseDuration(*applyTimeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid apply timeout duration: %v", err)
+		}
+		group, err := helmutils.LoadReleaseGroup(*applyFile)
+		if err != nil {
+			fatalf(err, "Error loading release group: %v", err)
+		}
+		results, err := helmutils.ApplyReleaseGroup(ctx, helmClient, group, helmutils.GroupOptions{
+			Namespace:         effectiveHelmNs,
+			Parallelism:       *applyParallel,
+			Wait:              *applyWait,
+			Timeout:           applyTimeout,
+			RollbackOnFailure: *applyRollback,
+		})
+		if results != nil {
+			printOutput(results, *outputFormat, "")
+		}
+		if err != nil {
+			fatalf(err, "Error applying release group %s: %v", *applyFile, err)
+		}
+
+	case "destroy":
+		destroyCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if *destroyFile == "" {
+			log.Fatal("Missing required flag for destroy: -f")
+		}
+		destroyTimeout, err := time.ParseDuration(*destroyTimeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid destroy timeout duration: %v", err)
+		}
+		group, err := helmutils.LoadReleaseGroup(*destroyFile)
+		if err != nil {
+			fatalf(err, "Error loading release group: %v", err)
+		}
+		results, err := helmutils.DestroyReleaseGroup(ctx, helmClient, group, helmutils.GroupOptions{
+			Namespace:   effectiveHelmNs,
+			Parallelism: *destroyParallel,
+			Timeout:     destroyTimeout,
+			KeepHistory: *destroyKeepHistory,
+		})
+		if results != nil {
+			printOutput(results, *outputFormat, "")
+		}
+		if err != nil {
+			fatalf(err, "Error destroying release group %s: %v", *destroyFile, err)
+		}
+
 	case "repo-add":
 		repoAddCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
 		if *repoAddName == "" || *repoAddURL == "" {
 			log.Fatal("For repo-add, --name and --url are required.")
 		}
-		err := helmClient.AddRepository(*repoAddName, *repoAddURL, *repoAddUsername, *repoAddPassword, *repoAddPassCreds)
+		err := helmClient.AddRepositoryContext(ctx, *repoAddName, *repoAddURL, *repoAddUsername, *repoAddPassword, *repoAddPassCreds)
 		if err != nil {
-			log.Fatalf("Error adding repository: %v", err)
+			fatalf(err, "Error adding repository: %v", err)
 		}
 		fmt.Printf("Repository %s added.\n", *repoAddName)
 
 	case "repo-update":
 		repoUpdateCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
-		err := helmClient.UpdateRepositories()
+		err := helmClient.UpdateRepositoriesContext(ctx)
 		if err != nil {
-			log.Fatalf("Error updating repositories: %v", err)
+			fatalf(err, "Error updating repositories: %v", err)
 		}
 		fmt.Println("Repositories updated.")
 
+	case "repo-list":
+		repoListCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		repos, err := helmClient.ListRepositoriesContext(ctx)
+		if err != nil {
+			fatalf(err, "Error listing repositories: %v", err)
+		}
+		printOutput(repos, *outputFormat, "")
+
+	case "repo-remove":
+		repoRemoveCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if repoRemoveCmd.NArg() == 0 {
+			log.Fatal("Missing repository name for repo-remove command.")
+		}
+		repoToRemove := repoRemoveCmd.Arg(0)
+		if err := helmClient.RemoveRepositoryContext(ctx, repoToRemove); err != nil {
+			fatalf(err, "Error removing repository %s: %v", repoToRemove, err)
+		}
+		fmt.Printf("Repository %s removed.\n", repoToRemove)
+
+	case "search":
+		searchCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		keyword := searchCmd.Arg(0)  // An empty keyword lists every chart
+		results, err := helmClient.SearchChartsContext(ctx, keyword, *searchVersion)
+		if err != nil {
+			fatalf(err, "Error searching charts: %v", err)
+		}
+		printOutput(results, *outputFormat, "")
+
+	case "registry-login":
+		loginCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if loginCmd.NArg() == 0 {
+			log.Fatal("Missing registry host for registry-login command.")
+		}
+		host := loginCmd.Arg(0)
+		password := *loginPassword
+		if *loginPasswordStdin {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("Error reading password from stdin: %v", err)
+			}
+			password = strings.TrimRight(string(data), "\r\n")
+		}
+		if err := helmClient.RegistryLoginContext(ctx, host, *loginUsername, password, *loginInsecure); err != nil {
+			fatalf(err, "Error logging in to registry %s: %v", host, err)
+		}
+		fmt.Println("Login Succeeded")
+
+	case "registry-logout":
+		logoutCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if logoutCmd.NArg() == 0 {
+			log.Fatal("Missing registry host for registry-logout command.")
+		}
+		host := logoutCmd.Arg(0)
+		if err := helmClient.RegistryLogoutContext(ctx, host); err != nil {
+			fatalf(err, "Error logging out of registry %s: %v", host, err)
+		}
+		fmt.Printf("Removed login credentials for %s\n", host)
+
+	case "push":
+		pushCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if pushCmd.NArg() < 2 {
+			log.Fatal("Usage: helmctl push [--plain-http] <chart-dir-or-tgz> <oci://registry/repository>")
+		}
+		setRegistryPlainHTTP(helmClient, *pushPlainHTTP)
+		ref, err := helmClient.PushChartContext(ctx, pushCmd.Arg(0), pushCmd.Arg(1))
+		if err != nil {
+			fatalf(err, "Error pushing chart %s: %v", pushCmd.Arg(0), err)
+		}
+		fmt.Printf("Pushed: %s\n", ref)
+
+	case "pull":
+		pullCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if pullCmd.NArg() == 0 {
+			log.Fatal("Missing chart reference for pull command.")
+		}
+		chartRef := pullCmd.Arg(0)
+		setRegistryPlainHTTP(helmClient, *pullPlainHTTP)
+		cachedPath, err := helmClient.EnsureChartContext(ctx, chartRef, *pullVersion)
+		if err != nil {
+			fatalf(err, "Error pulling chart %s: %v", chartRef, err)
+		}
+		dest, err := copyFileToDir(cachedPath, *pullDestination)
+		if err != nil {
+			fatalf(err, "Error saving chart %s: %v", chartRef, err)
+		}
+		fmt.Printf("Pulled: %s\n", dest)
+
+	case "dep-update", "dep-build":
+		depCmd := depUpdateCmd
+		if command == "dep-build" {
+			depCmd = depBuildCmd
+		}
+		depCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if depCmd.NArg() == 0 {
+			log.Fatalf("Missing chart directory for %s command.", command)
+		}
+		chartDir := depCmd.Arg(0)
+		var deps []*helmutils.ChartDependency
+		if command == "dep-build" {
+			deps, err = helmClient.BuildDependenciesContext(ctx, chartDir)
+		} else {
+			deps, err = helmClient.UpdateDependenciesContext(ctx, chartDir)
+		}
+		if err != nil {
+			fatalf(err, "Error vendoring dependencies of chart %s: %v", chartDir, err)
+		}
+		printOutput(deps, *outputFormat, "")
+
+	case "dep-list":
+		depListCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if depListCmd.NArg() == 0 {
+			log.Fatal("Missing chart directory for dep-list command.")
+		}
+		chartDir := depListCmd.Arg(0)
+		deps, err := helmClient.ListDependenciesContext(ctx, chartDir)
+		if err != nil {
+			fatalf(err, "Error listing dependencies of chart %s: %v", chartDir, err)
+		}
+		printOutput(deps, *outputFormat, "")
+		if *depListCheck {
+			for _, d := range deps {
+				if d.Status != helmutils.DependencyOK {
+					os.Exit(1)
+				}
+			}
+		}
+
+	case "package":
+		packageCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if packageCmd.NArg() == 0 {
+			log.Fatal("Missing chart directory for package command.")
+		}
+		if *packageSign && *packageKey == "" {
+			log.Fatal("Missing required flag for package --sign: --key")
+		}
+		archive, err := helmutils.PackageChart(packageCmd.Arg(0), *packageDestination, *packageVersion, *packageAppVersion)
+		if err != nil {
+			fatalf(err, "Error packaging chart: %v", err)
+		}
+		fmt.Printf("Packaged: %s\n", archive)
+		if *packageSign {
+			var passphrase []byte
+			if *packagePassphraseFile != "" {
+				if passphrase, err = os.ReadFile(*packagePassphraseFile); err != nil {
+					log.Fatalf("Error reading passphrase file: %v", err)
+				}
+				passphrase = []byte(strings.TrimRight(string(passphrase), "\r\n"))
+			}
+			prov, err := helmutils.SignChart(archive, *packageKeyring, *packageKey, passphrase)
+			if err != nil {
+				fatalf(err, "Error signing chart: %v", err)
+			}
+			fmt.Printf("Signed: %s\n", prov)
+		}
+
+	case "lint":
+		lintCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
+		if lintCmd.NArg() == 0 {
+			log.Fatal("Missing chart for lint command.")
+		}
+		vals, err := loadValues(*lintValuesFile, *lintSetValues)
+		if err != nil {
+			fatalf(err, "Error loading values for lint: %v", err)
+		}
+		messages, lintErr := helmutils.LintChart(lintCmd.Arg(0), vals)
+		printOutput(messages, *outputFormat, "")
+		if lintErr != nil {
+			fatalf(lintErr, "Error linting chart: %v", lintErr)
+		}
+		if *lintStrict {
+			for _, m := range messages {
+				if m.Severity == helmutils.LintWarning {
+					log.Fatalf("Chart %s has lint warnings (--strict)", lintCmd.Arg(0))
+				}
+			}
+		}
+
 	case "ensure-chart":
 		ensureChartCmd.Parse(commandArgs) // Subcommand parsing handles its own --help
 		if *ensureChartName == "" {
 			log.Fatal("Missing required flag for ensure-chart: --chart")
 		}
-		chartPath, err := helmClient.EnsureChart(*ensureChartName, *ensureChartVersion)
+		if err := setVerify(helmClient, *ensureChartVerify, *ensureChartKeyring); err != nil {
+			log.Fatalf("Error setting up chart verification for ensure-chart: %v", err)
+		}
+		chartPath, err := helmClient.EnsureChartContext(ctx, *ensureChartName, *ensureChartVersion)
 		if err != nil {
-			log.Fatalf("Error ensuring chart %s version %s: %v", *ensureChartName, *ensureChartVersion, err)
+			fatalf(err, "Error ensuring chart %s version %s: %v", *ensureChartName, *ensureChartVersion, err)
 		}
 		fmt.Printf("Chart %s version %s ensured/found at: %s\n", *ensureChartName, *ensureChartVersion, chartPath)
 
@@ -464,10 +1225,30 @@ func printUsage() {
 		{"install", "Install a Helm chart", installCmd},
 		{"uninstall", "Uninstall a Helm release. Args: <release-name>", uninstallCmd},
 		{"upgrade", "Upgrade a Helm release. Args: <release-name>", upgradeCmd},
+		{"rollback", "Roll a Helm release back to a previous revision. Args: <release-name> [revision]", rollbackCmd},
+		{"diff", "Show what an upgrade would change. Args: upgrade <release-name>", diffCmd},
 		{"details", "Get details of a Helm release. Args: <release-name>", detailsCmd},
+		{"status", "Show the status of a Helm release, or follow its progress with --watch. Args: <release-name>", statusCmd},
+		{"test", "Run the chart tests of a Helm release. Args: <release-name>", testCmd},
 		{"history", "Get history of a Helm release. Args: <release-name>", historyCmd},
+		{"get-values", "Show the values of a Helm release revision. Args: <release-name>", getValuesCmd},
+		{"resources", "List the Kubernetes objects of a Helm release and their health. Args: <release-name>", resourcesCmd},
+		{"apply", "Install or upgrade a group of releases in dependency order", applyCmd},
+		{"destroy", "Uninstall a group of releases, dependents first", destroyCmd},
 		{"repo-add", "Add a Helm chart repository", repoAddCmd},
 		{"repo-update", "Update Helm chart repositories", repoUpdateCmd},
+		{"repo-list", "List configured Helm chart repositories", repoListCmd},
+		{"repo-remove", "Remove a Helm chart repository. Args: <name>", repoRemoveCmd},
+		{"search", "Search configured repositories for charts. Args: [keyword]", searchCmd},
+		{"registry-login", "Log in to an OCI registry. Args: <host>", loginCmd},
+		{"registry-logout", "Log out of an OCI registry. Args: <host>", logoutCmd},
+		{"push", "Push a chart to an OCI registry. Args: <chart-dir-or-tgz> <oci://registry/repository>", pushCmd},
+		{"pull", "Download a chart to a local directory. Args: <chart-ref>", pullCmd},
+		{"dep-update", "Resolve chart dependencies, vendor them into charts/ and write Chart.lock. Args: <chart-dir>", depUpdateCmd},
+		{"dep-build", "Vendor the dependencies pinned in Chart.lock into charts/. Args: <chart-dir>", depBuildCmd},
+		{"dep-list", "List chart dependencies and their status. Args: <chart-dir>", depListCmd},
+		{"package", "Package a chart directory into an archive, optionally signed. Args: <chart-dir>", packageCmd},
+		{"lint", "Check a chart directory or archive for problems. Args: <chart>", lintCmd},
 		{"ensure-chart", "Ensures a chart is available locally, downloading if necessary", ensureChartCmd},
 	}
 
@@ -493,6 +1274,162 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "\nRun 'helmctl <command> --help' for more information on a command.")
 }
 
+// clusterRelease is a release found by list --all-clusters and the cluster
+// it was found in.
+type clusterRelease struct {
+	Cluster string `json:"cluster"`
+	*helmutils.ReleaseInfo
+}
+
+// listClusterReleases lists the releases opts selects in every cluster of
+// clusters. Unless allNamespaces is set, each cluster is listed in namespace
+// or, if that is empty, in the cluster's current namespace. A cluster that
+// cannot be listed is logged and skipped, and the first such error is
+// returned with the releases of the others.
+func listClusterReleases(ctx context.Context, clusters *k8sutils.ClusterRegistry, namespace string, allNamespaces bool, opts helmutils.ListOptions) ([]*clusterRelease, error) {
+	var all []*clusterRelease
+	var firstErr error
+	for _, name := range clusters.Names() {
+		releases, err := func() ([]*helmutils.ReleaseInfo, error) {
+			helmClient, err := helmutils.NewClientForCluster(clusters, name, namespace, log.Printf)
+			if err != nil {
+				return nil, err
+			}
+			opts := opts
+			opts.Namespace = ""
+			if !allNamespaces {
+				opts.Namespace = namespace
+				if opts.Namespace == "" {
+					checker, _ := clusters.Checker(name)
+					if opts.Namespace, err = checker.GetCurrentNamespace(); err != nil {
+						opts.Namespace = "default"
+					}
+				}
+			}
+			return helmClient.ListReleasesWithOptionsContext(ctx, opts)
+		}()
+		if err != nil {
+			log.Printf("Warning: could not list releases in cluster %s: %v", name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("cluster %s: %w", name, err)
+			}
+			continue
+		}
+		for _, r := range releases {
+			all = append(all, &clusterRelease{Cluster: name, ReleaseInfo: r})
+		}
+	}
+	return all, firstErr
+}
+
+// fatalf logs like log.Fatalf but exits with the code helmutils.ExitCode
+// assigns to err, so scripts can tell failures apart.
+func fatalf(err error, format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(helmutils.ExitCode(err))
+}
+
+// setRegistryPlainHTTP switches the client to plain HTTP for OCI registries
+// when requested. Only the helmutils client supports it.
+func setRegistryPlainHTTP(helmClient helmutils.HelmClient, plainHTTP bool) {
+	if !plainHTTP {
+		return
+	}
+	if c, ok := helmClient.(*helmutils.Client); ok {
+		c.RegistryPlainHTTP = true
+	}
+}
+
+// setPostRenderers configures the manifest post-rendering of an install,
+// upgrade or diff: the patch file is applied first, then the output is piped
+// through the post-renderer executable. Only the helmutils client supports it.
+func setPostRenderers(helmClient helmutils.HelmClient, patchFile, binary, args string) error {
+	if patchFile == "" && binary == "" {
+		return nil
+	}
+	c, ok := helmClient.(*helmutils.Client)
+	if !ok {
+		return fmt.Errorf("post-rendering is not supported by this Helm client")
+	}
+	var renderers []helmutils.PostRenderer
+	if patchFile != "" {
+		patch, err := helmutils.LoadManifestPatch(patchFile)
+		if err != nil {
+			return err
+		}
+		renderers = append(renderers, patch)
+	}
+	if binary != "" {
+		pr, err := helmutils.NewExecPostRenderer(binary, strings.Fields(args)...)
+		if err != nil {
+			return err
+		}
+		renderers = append(renderers, pr)
+	} else if args != "" {
+		return fmt.Errorf("--post-renderer-args requires --post-renderer")
+	}
+	c.PostRenderers = renderers
+	return nil
+}
+
+// parseLabels parses --labels, a comma-separated list of key=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	set, err := labels.ConvertSelectorToLabelsMap(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", helmutils.ErrInvalidValues, err)
+	}
+	return set, nil
+}
+
+// setVerify makes the client check chart provenance against keyring when
+// --verify is given. Only the helmutils client supports it.
+func setVerify(helmClient helmutils.HelmClient, verify bool, keyring string) error {
+	if !verify {
+		return nil
+	}
+	c, ok := helmClient.(*helmutils.Client)
+	if !ok {
+		return fmt.Errorf("chart verification is not supported by this Helm client")
+	}
+	if keyring == "" {
+		return fmt.Errorf("--verify requires --keyring")
+	}
+	c.VerifyKeyring = keyring
+	return nil
+}
+
+// defaultKeyring returns the path of a GnuPG keyring file in $GNUPGHOME, or
+// in ~/.gnupg when it is not set, as Helm does.
+func defaultKeyring(name string) string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return filepath.Join(home, name)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gnupg", name)
+}
+
+// copyFileToDir copies src into dir, keeping its base name, and returns the new path.
+func copyFileToDir(src, dir string) (string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, filepath.Base(src))
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
 func loadValues(valuesFile string, setValues string) (map[string]interface{}, error) {
 	mergedVals := make(map[string]interface{})
 
@@ -503,7 +1440,7 @@ func loadValues(valuesFile string, setValues string) (map[string]interface{}, er
 		}
 		var fileVals map[string]interface{}
 		if err := yaml.Unmarshal(bytes, &fileVals); err != nil {
-			return nil, fmt.Errorf("failed to parse values file %s: %w", valuesFile, err)
+			return nil, fmt.Errorf("failed to parse values file %s: %w: %w", valuesFile, helmutils.ErrInvalidValues, err)
 		}
 		mergedVals = fileVals // Initialize with file values
 	}
@@ -525,7 +1462,7 @@ func loadValues(valuesFile string, setValues string) (map[string]interface{}, er
 						}
 						nextMap, ok := currentMap[k].(map[string]interface{})
 						if !ok {
-							return nil, fmt.Errorf("error setting value for %s: %s is not a map (it's a %T)", kv[0], k, currentMap[k])
+							return nil, fmt.Errorf("error setting value for %s: %s is not a map (it's a %T): %w", kv[0], k, currentMap[k], helmutils.ErrInvalidValues)
 						}
 						currentMap = nextMap
 					}
@@ -543,6 +1480,62 @@ func printOutput(data interface{}, format string, nameFilter string) {
 	var singleItem *helmutils.ReleaseInfo
 
 	switch v := data.(type) {
+	case *helmutils.ReleaseDiff:
+		printDiff(v, format)
+		return
+	case []*helmutils.RepositoryInfo:
+		printTable(v, format, []string{"NAME", "URL"}, func(w io.Writer) {
+			for _, r := range v {
+				fmt.Fprintf(w, "%s\t%s\n", r.Name, r.URL)
+			}
+		})
+		return
+	case []*helmutils.ReleaseResource:
+		printTable(v, format, []string{"KIND", "NAMESPACE", "NAME", "HEALTH", "MESSAGE"}, func(w io.Writer) {
+			for _, r := range v {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Kind, r.Namespace, r.Name, r.Health, r.Message)
+			}
+		})
+		return
+	case []*helmutils.GroupReleaseResult:
+		printTable(v, format, []string{"NAME", "NAMESPACE", "STATUS", "REVISION", "ERROR"}, func(w io.Writer) {
+			for _, r := range v {
+				revision := ""
+				if r.Revision > 0 {
+					revision = strconv.Itoa(r.Revision)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Namespace, r.Status, revision, r.Error)
+			}
+		})
+		return
+	case []*helmutils.ChartDependency:
+		printTable(v, format, []string{"NAME", "VERSION", "REPOSITORY", "LOCKED", "VENDORED", "LATEST", "STATUS"}, func(w io.Writer) {
+			for _, d := range v {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Name, d.Version, d.Repository, d.Locked, d.Vendored, d.Latest, d.Status)
+			}
+		})
+		return
+	case []*helmutils.LintMessage:
+		printTable(v, format, []string{"SEVERITY", "PATH", "MESSAGE"}, func(w io.Writer) {
+			for _, m := range v {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", m.Severity, m.Path, m.Message)
+			}
+		})
+		return
+	case []*clusterRelease:
+		printTable(v, format, []string{"CLUSTER", "NAME", "NAMESPACE", "REVISION", "STATUS", "CHART", "APP VERSION"}, func(w io.Writer) {
+			for _, r := range v {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s-%s\t%s\n", r.Cluster, r.Name, r.Namespace, r.Revision, r.Status, r.ChartName, r.ChartVersion, r.AppVersion)
+			}
+		})
+		return
+	case []*helmutils.ChartSearchResult:
+		printTable(v, format, []string{"NAME", "CHART VERSION", "APP VERSION", "DESCRIPTION"}, func(w io.Writer) {
+			for _, r := range v {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.ChartVersion, r.AppVersion, r.Description)
+			}
+		})
+		return
 	case *helmutils.ReleaseInfo:
 		if v != nil {
 			if nameFilter == "" || strings.Contains(strings.ToLower(v.Name), strings.ToLower(nameFilter)) {
@@ -610,11 +1603,14 @@ func printOutput(data interface{}, format string, nameFilter string) {
 			if item.Description != "" {
 				fmt.Printf("  Description:  %s\n", item.Description)
 			}
+			if len(item.Labels) > 0 {
+				fmt.Printf("  Labels:       %s\n", labels.Set(item.Labels))
+			}
 			currentCommand := ""
 			if len(os.Args) > 1 {
 				currentCommand = os.Args[1]
 			}
-			if currentCommand == "details" || currentCommand == "install" || currentCommand == "upgrade" {
+			if currentCommand == "details" || currentCommand == "status" || currentCommand == "install" || currentCommand == "upgrade" || currentCommand == "rollback" {
 				if item.Notes != "" {
 					fmt.Printf("  Notes:        \n%s\n", indentString(item.Notes, "    "))
 				}
@@ -629,6 +1625,154 @@ func printOutput(data interface{}, format string, nameFilter string) {
 	}
 }
 
+// printTable prints data as JSON or YAML, or as a tab-aligned table whose rows
+// are written by rows when format is text.
+func printTable(data interface{}, format string, header []string, rows func(w io.Writer)) {
+	switch strings.ToLower(format) {
+	case "json":
+		bytes, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			log.Fatalf("Error marshalling to JSON: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "yaml":
+		bytes, err := yaml.Marshal(data)
+		if err != nil {
+			log.Fatalf("Error marshalling to YAML: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		rows(w)
+		w.Flush()
+	default:
+		log.Printf("Unknown output format: %s. Using text.", format)
+		printTable(data, "text", header, rows)
+	}
+}
+
+func printDiff(diff *helmutils.ReleaseDiff, format string) {
+	switch strings.ToLower(format) {
+	case "json":
+		bytes, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			log.Fatalf("Error marshalling to JSON: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "yaml":
+		bytes, err := yaml.Marshal(diff)
+		if err != nil {
+			log.Fatalf("Error marshalling to YAML: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "text":
+		fmt.Printf("Release: %s (namespace %s, revision %d)\n", diff.Name, diff.Namespace, diff.CurrentRevision)
+		fmt.Printf("  Chart:        %s -> %s\n", diff.CurrentChart, diff.TargetChart)
+		if !diff.HasChanges() {
+			fmt.Println("No changes.")
+			return
+		}
+		for _, r := range diff.Resources {
+			fmt.Printf("%s %s\n", r.Change, r.Key())
+			if r.Diff != "" {
+				fmt.Println(indentString(r.Diff, "    "))
+			}
+		}
+	default:
+		log.Printf("Unknown output format: %s. Using text.", format)
+		printDiff(diff, "text")
+	}
+}
+
+// printValues prints release values as JSON or YAML. Text output is YAML
+// under a heading saying which values are shown, as 'helm get values' does.
+func printValues(vals map[string]interface{}, format string, computed bool) {
+	switch strings.ToLower(format) {
+	case "json":
+		bytes, err := json.MarshalIndent(vals, "", "  ")
+		if err != nil {
+			log.Fatalf("Error marshalling to JSON: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "yaml":
+		bytes, err := yaml.Marshal(vals)
+		if err != nil {
+			log.Fatalf("Error marshalling to YAML: %v", err)
+		}
+		fmt.Print(string(bytes))
+	case "text":
+		if computed {
+			fmt.Println("COMPUTED VALUES:")
+		} else {
+			fmt.Println("USER-SUPPLIED VALUES:")
+		}
+		if len(vals) == 0 {
+			fmt.Println("null")
+			return
+		}
+		printValues(vals, "yaml", computed)
+	default:
+		log.Printf("Unknown output format: %s. Using text.", format)
+		printValues(vals, "text", computed)
+	}
+}
+
+// printTestResults prints the outcome of each release test, followed by its
+// logs when showLogs is set and the format is text.
+func printTestResults(results []*helmutils.ReleaseTestResult, format string, showLogs bool) {
+	printTable(results, format, []string{"TEST", "KIND", "PHASE", "STARTED", "COMPLETED"}, func(w io.Writer) {
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Kind, r.Phase, r.StartedAt.Format(time.RFC3339), r.CompletedAt.Format(time.RFC3339))
+		}
+	})
+	if !showLogs || !strings.EqualFold(format, "text") {
+		return
+	}
+	for _, r := range results {
+		if r.Logs != "" {
+			fmt.Printf("\nLogs of %s:\n%s\n", r.Name, indentString(r.Logs, "    "))
+		}
+	}
+}
+
+// printEvent prints one WatchRelease event: a line of text, a single-line JSON
+// object, or a YAML document.
+func printEvent(ev helmutils.ReleaseEvent, format string) {
+	switch strings.ToLower(format) {
+	case "json":
+		bytes, err := json.Marshal(ev)
+		if err != nil {
+			log.Fatalf("Error marshalling to JSON: %v", err)
+		}
+		fmt.Println(string(bytes))
+	case "yaml":
+		bytes, err := yaml.Marshal(ev)
+		if err != nil {
+			log.Fatalf("Error marshalling to YAML: %v", err)
+		}
+		fmt.Printf("---\n%s", bytes)
+	case "text":
+		detail := ev.Message
+		switch ev.Type {
+		case helmutils.ReleaseEventStatus:
+			detail = string(ev.Status)
+			if ev.PreviousStatus != "" {
+				detail = fmt.Sprintf("%s -> %s", ev.PreviousStatus, ev.Status)
+			}
+			if ev.Message != "" {
+				detail += ": " + ev.Message
+			}
+		case helmutils.ReleaseEventHookStarted, helmutils.ReleaseEventHookFinished:
+			detail = fmt.Sprintf("%s %s", ev.HookEvent, ev.Message)
+		}
+		fmt.Printf("%s  %-6s %-14s %s\n", ev.Time.Format(time.RFC3339), fmt.Sprintf("r%d", ev.Revision), ev.Type, detail)
+	default:
+		log.Printf("Unknown output format: %s. Using text.", format)
+		printEvent(ev, "text")
+	}
+}
+
 func indentString(s, indent string) string {
 	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
 	for i, line := range lines {
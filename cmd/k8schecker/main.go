@@ -5,8 +5,12 @@ and check various states and permissions.
 It can:
 - Determine if it's running inside a Kubernetes cluster.
 - Get the current Kubernetes namespace.
+- List the kubeconfig contexts and show which one is in use.
+- Report which of several named clusters are reachable, and their versions.
 - Check permissions for specific resources within a namespace.
 - Check permissions for cluster-level resources.
+- Check many resources and verbs across namespaces at once, as a permission matrix.
+- Simulate the permissions of a user, group or service account from RBAC YAML files.
 
 Build:
 
@@ -24,15 +28,24 @@ Examples:
  2. Get current namespace (will try in-cluster, then kubeconfig):
     ./k8schecker --get-current-namespace
     ./k8schecker --kubeconfig=/path/to/your/kubeconfig --get-current-namespace
+    ./k8schecker --kubeconfig=/path/to/your/kubeconfig --context=staging --get-current-namespace
 
- 3. Check namespace permissions for 'pods' in 'default' namespace for 'get' and 'list' verbs:
+ 3. List the contexts of a kubeconfig and show the one in use:
+    ./k8schecker --kubeconfig=/path/to/your/kubeconfig --list-contexts --get-current-context
+
+ 4. Check which clusters in clusters.yaml answer, then check a permission in 'prod':
+    ./k8schecker --clusters-file=clusters.yaml --cluster-status
+    ./k8schecker --clusters-file=clusters.yaml --cluster=prod \
+    --check-cluster-perm --cluster-perm-resource=namespaces --cluster-perm-verb=list
+
+ 5. Check namespace permissions for 'pods' in 'default' namespace for 'get' and 'list' verbs:
     ./k8schecker --check-ns-perms \
     --perm-namespace=default \
     --perm-resource=pods \
     --perm-verbs=get,list
     (This uses core group "" and version "v1" by default for pods)
 
- 4. Check namespace permissions for 'deployments' in 'kube-system' namespace for 'create':
+ 6. Check namespace permissions for 'deployments' in 'kube-system' namespace for 'create':
     ./k8schecker --check-ns-perms \
     --perm-namespace=kube-system \
     --perm-resource=deployments \
@@ -40,20 +53,44 @@ Examples:
     --perm-version=v1 \
     --perm-verbs=create
 
- 5. Check cluster-level permission to 'create' 'namespaces':
+ 7. Check cluster-level permission to 'create' 'namespaces':
     ./k8schecker --check-cluster-perm \
     --cluster-perm-resource=namespaces \
     --cluster-perm-verb=create
     (This uses core group "" and version "v1" by default for namespaces)
 
- 6. Check cluster-level permission to 'list' 'nodes':
+ 8. Check cluster-level permission to 'list' 'nodes':
     ./k8schecker --check-cluster-perm \
     --cluster-perm-resource=nodes \
     --cluster-perm-verb=list
 
+ 9. Print which CRUD verbs are allowed on pods, deployments and pod logs in
+    two namespaces and cluster-wide (the empty namespace), as JSON:
+    ./k8schecker --perm-matrix \
+    --perm-namespaces=team-a,team-b, \
+    --perm-resources=pods,deployments.apps,pods/log \
+    --perm-verbs=get,list,watch,create,update,patch,delete \
+    --output=json
+
+ 10. Check what the 'deployer' service account in 'team-a' may do with pod logs,
+    according to the Roles and bindings in rbac.yaml:
+    ./k8schecker --rbac-file=rbac.yaml \
+    --as=system:serviceaccount:team-a:deployer \
+    --check-ns-perms \
+    --perm-namespace=team-a \
+    --perm-resource=pods/log \
+    --perm-verbs=get
+
 Common Flags:
 
-	--kubeconfig string   (Optional) Path to kubeconfig file. Only used if not in cluster and KUBECONFIG env var is not set.
+	--kubeconfig string    (Optional) Path to kubeconfig file, or a list of files separated like KUBECONFIG entries. Overrides KUBECONFIG.
+	--context string       (Optional) Kubeconfig context to use instead of current-context.
+	--cluster string       (Optional) Named cluster to use, from --clusters-file or the kubeconfig contexts.
+	--clusters-file string (Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.
+	--rbac-file string     (Optional) Comma-separated RBAC YAML files; permission checks evaluate them locally for --as and --as-group.
+	--as string            (Optional) User to check permissions for with --rbac-file, or to impersonate without it.
+	--as-group string      (Optional) Comma-separated groups of the --as user.
+	--output string        (Optional) Output format for --perm-matrix and --cluster-status: table (default) or json.
 
 For more details on flags, run:
 
@@ -63,11 +100,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"go_k8s_helm/internal/k8sutils" // Adjust this import path based on your go.mod module name
 
@@ -76,11 +117,20 @@ import (
 
 func main() {
 	// Common flags
-	kubeconfig := flag.String("kubeconfig", "", "(Optional) Path to kubeconfig file. Only used if not in cluster and KUBECONFIG env var is not set.")
+	kubeconfig := flag.String("kubeconfig", "", "(Optional) Path to kubeconfig file, or a list of files separated like KUBECONFIG entries. Overrides KUBECONFIG.")
+	kubeContext := flag.String("context", "", "(Optional) Kubeconfig context to use instead of current-context.")
+	clusterName := flag.String("cluster", "", "(Optional) Named cluster to use, from --clusters-file or the kubeconfig contexts.")
+	clustersFile := flag.String("clusters-file", "", "(Optional) YAML file listing named clusters; defaults to one cluster per kubeconfig context.")
+	rbacFiles := flag.String("rbac-file", "", "(Optional) Comma-separated RBAC YAML files (Roles, ClusterRoles and bindings). Permission checks evaluate them locally for --as and --as-group.")
+	asUser := flag.String("as", "", "(Optional) User to check permissions for with --rbac-file, e.g. alice or system:serviceaccount:<namespace>:<name>. Without --rbac-file, the user to impersonate.")
+	asGroups := flag.String("as-group", "", "(Optional) Comma-separated groups of the --as user.")
 
 	// Sub-commands or modes using flags
 	checkInCluster := flag.Bool("check-in-cluster", false, "Check if running inside a Kubernetes cluster.")
 	getCurrentNs := flag.Bool("get-current-namespace", false, "Get the current Kubernetes namespace.")
+	listContexts := flag.Bool("list-contexts", false, "List the contexts in the kubeconfig.")
+	getCurrentContext := flag.Bool("get-current-context", false, "Get the kubeconfig context in use.")
+	clusterStatus := flag.Bool("cluster-status", false, "Report whether each named cluster is reachable, and its version.")
 
 	// Namespace permission check flags
 	checkNsPerms := flag.Bool("check-ns-perms", false, "Check permissions for specified verbs on a resource within a namespace.")
@@ -90,6 +140,12 @@ func main() {
 	permVersion := flag.String("perm-version", "v1", "API version for the resource (e.g., v1). Default is 'v1'.")
 	permVerbsStr := flag.String("perm-verbs", "get,list,watch", "Comma-separated verbs (e.g., get,list,create) for permission check. Default is 'get,list,watch'.")
 
+	// Permission matrix flags
+	permMatrix := flag.Bool("perm-matrix", false, "Check every verb in --perm-verbs on every resource in --perm-resources in every namespace in --perm-namespaces.")
+	permNamespaces := flag.String("perm-namespaces", "", "Comma-separated namespaces for --perm-matrix; an empty entry checks cluster-wide. Default is --perm-namespace, or the current namespace.")
+	permResources := flag.String("perm-resources", "pods,services,configmaps,secrets,deployments.apps,statefulsets.apps,daemonsets.apps", "Comma-separated resources for --perm-matrix, as <resource>[.<group>][/<subresource>].")
+	outputFormat := flag.String("output", "table", "Output format for --perm-matrix and --cluster-status: table or json.")
+
 	// Cluster permission check flags
 	checkClusterPerm := flag.Bool("check-cluster-perm", false, "Check a cluster-level permission for a specific verb on a resource.")
 	clusterPermResource := flag.String("cluster-perm-resource", "namespaces", "Cluster resource type (e.g., namespaces, nodes). Default is 'namespaces'.")
@@ -99,25 +155,73 @@ func main() {
 
 	flag.Parse()
 
-	// If a kubeconfig path is provided via flag, set it as an environment variable
-	// so that client-go can pick it up if NewAuthUtil relies on KUBECONFIG env var.
-	// Note: NewAuthUtil in the provided snippet already checks KUBECONFIG env var.
+	authOpts := k8sutils.AuthOptions{Context: *kubeContext}
 	if *kubeconfig != "" {
-		// It's generally better for NewAuthUtil to directly accept a kubeconfig path
-		// or for the user to set KUBECONFIG env var themselves.
-		// However, to keep NewAuthUtil simple for this example, we'll set the env var.
-		err := os.Setenv("KUBECONFIG", *kubeconfig)
-		if err != nil {
-			log.Printf("Warning: Could not set KUBECONFIG environment variable: %v", err)
-		}
+		authOpts.KubeconfigPaths = filepath.SplitList(*kubeconfig)
 		log.Printf("Using kubeconfig from flag: %s", *kubeconfig)
 	}
+	// Without RBAC files to evaluate locally, --as and --as-group impersonate,
+	// as they do for kubectl.
+	if *rbacFiles == "" {
+		authOpts.Impersonate.UserName = *asUser
+		if *asGroups != "" {
+			if *asUser == "" {
+				log.Fatal("Error: --as-group requires --as.")
+			}
+			authOpts.Impersonate.Groups = strings.Split(*asGroups, ",")
+		}
+	}
+
+	var clusters *k8sutils.ClusterRegistry
+	if *clusterName != "" || *clusterStatus {
+		var errClusters error
+		clusters, errClusters = k8sutils.LoadClusterRegistry(*clustersFile, authOpts.KubeconfigPaths)
+		if errClusters != nil {
+			log.Fatalf("Error loading clusters: %v", errClusters)
+		}
+		clusters.NewChecker = func(e k8sutils.ClusterEntry) (k8sutils.K8sAuthChecker, error) {
+			opts := e.AuthOptions()
+			opts.Impersonate = authOpts.Impersonate
+			return k8sutils.NewAuthUtilWithOptions(opts)
+		}
+	}
 
-	authUtil, err := k8sutils.NewAuthUtil()
+	var authUtil k8sutils.K8sAuthChecker
+	var err error
+	if *clusterName != "" {
+		if *kubeContext != "" {
+			log.Fatal("Error: --cluster and --context cannot be used together.")
+		}
+		authUtil, err = clusters.Checker(*clusterName)
+	} else {
+		authUtil, err = k8sutils.NewAuthUtilWithOptions(authOpts)
+	}
 	if err != nil {
 		log.Fatalf("Error initializing K8s auth utilities: %v", err)
 	}
 
+	if *rbacFiles != "" {
+		subject := k8sutils.RBACSubject{User: *asUser}
+		if *asGroups != "" {
+			subject.Groups = strings.Split(*asGroups, ",")
+		}
+		authz, errAuthz := k8sutils.NewRBACAuthorizer(subject)
+		if errAuthz != nil {
+			log.Fatalf("Error initializing RBAC authorizer: %v", errAuthz)
+		}
+		for _, path := range strings.Split(*rbacFiles, ",") {
+			if errLoad := authz.LoadFile(path); errLoad != nil {
+				log.Fatalf("Error loading RBAC policy: %v", errLoad)
+			}
+		}
+		au, ok := authUtil.(*k8sutils.AuthUtil)
+		if !ok {
+			log.Fatalf("--rbac-file is not supported by the %T auth checker", authUtil)
+		}
+		au.Authorizer = authz
+		log.Printf("Evaluating permissions of %s against %s", subject, *rbacFiles)
+	}
+
 	var actionTaken bool
 	ctx := context.Background() // Create a background context for API calls
 
@@ -142,6 +246,34 @@ func main() {
 		}
 	}
 
+	if *listContexts {
+		actionTaken = true
+		contexts, errCtx := authUtil.ListContexts()
+		if errCtx != nil {
+			log.Fatalf("Error listing contexts: %v", errCtx)
+		}
+		fmt.Println("Result: Contexts in kubeconfig:")
+		for _, name := range contexts {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+
+	if *getCurrentContext {
+		actionTaken = true
+		name, errCtx := authUtil.CurrentContext()
+		if errCtx != nil {
+			log.Fatalf("Error getting current context: %v", errCtx)
+		}
+		fmt.Printf("Result: Current context is '%s'.\n", name)
+	}
+
+	if *clusterStatus {
+		actionTaken = true
+		if errPrint := printClusterStatus(os.Stdout, *outputFormat, clusters.Status(ctx)); errPrint != nil {
+			log.Fatalf("Error: %v", errPrint)
+		}
+	}
+
 	if *checkNsPerms {
 		actionTaken = true
 		if *permNs == "" || *permResource == "" {
@@ -182,8 +314,98 @@ func main() {
 		fmt.Printf("Result: Permission to '%s' cluster resource '%s' (GVR: %s): %t\n", *clusterPermVerb, gvr.Resource, gvr.String(), allowed)
 	}
 
+	if *permMatrix {
+		actionTaken = true
+		var namespaces []string
+		switch {
+		case *permNamespaces != "":
+			namespaces = strings.Split(*permNamespaces, ",")
+		case *permNs != "":
+			namespaces = []string{*permNs}
+		default:
+			ns, errNs := authUtil.GetCurrentNamespace()
+			if errNs != nil {
+				log.Printf("Info: Attempting to get current namespace: %v", errNs)
+			}
+			namespaces = []string{ns}
+		}
+		var resources []schema.GroupVersionResource
+		for _, key := range strings.Split(*permResources, ",") {
+			gvr, errKey := k8sutils.ParseResourceKey(key)
+			if errKey != nil {
+				log.Fatalf("Error: %v", errKey)
+			}
+			resources = append(resources, gvr)
+		}
+		verbs := strings.Split(*permVerbsStr, ",")
+		matrix, errMatrix := authUtil.CheckPermissionMatrix(ctx, namespaces, resources, verbs)
+		if errMatrix != nil {
+			log.Fatalf("Error checking permission matrix: %v", errMatrix)
+		}
+		if errPrint := printPermissionMatrix(os.Stdout, *outputFormat, matrix, namespaces, resources, verbs); errPrint != nil {
+			log.Fatalf("Error: %v", errPrint)
+		}
+	}
+
 	if !actionTaken {
 		fmt.Println("No action specified. Use -h or --help for options.")
 		flag.Usage() // Prints default usage message to stderr
 	}
 }
+
+// printPermissionMatrix writes matrix as JSON, or as a table with one row per
+// namespace and resource and one column per verb, in the order requested.
+func printPermissionMatrix(w io.Writer, format string, matrix k8sutils.PermissionMatrix, namespaces []string, resources []schema.GroupVersionResource, verbs []string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matrix)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "NAMESPACE\tRESOURCE\t%s\n", strings.ToUpper(strings.Join(verbs, "\t")))
+		for _, ns := range namespaces {
+			name := ns
+			if name == "" {
+				name = "(cluster)"
+			}
+			for _, res := range resources {
+				cols := make([]string, len(verbs))
+				for i, verb := range verbs {
+					cols[i] = "no"
+					if matrix.Allowed(ns, res, verb) {
+						cols[i] = "yes"
+					}
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", name, k8sutils.ResourceKey(res), strings.Join(cols, "\t"))
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q (expected table or json)", format)
+	}
+}
+
+// printClusterStatus writes statuses as JSON, or as a table with one row
+// per cluster.
+func printClusterStatus(w io.Writer, format string, statuses []k8sutils.ClusterStatus) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tCONTEXT\tSERVER\tREACHABLE\tVERSION\tERROR")
+		for _, st := range statuses {
+			reachable := "no"
+			if st.Reachable {
+				reachable = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", st.Name, st.Context, st.Server, reachable, st.Version, st.Error)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q (expected table or json)", format)
+	}
+}
@@ -7,6 +7,17 @@ import (
 	"time"
 )
 
+// ErrBackupNotFound means the release has no backup with the requested ID.
+// It matches helmutils.ErrReleaseNotFound, so helmutils.ExitCode gives it the
+// not-found exit code.
+var ErrBackupNotFound error = backupNotFoundError{}
+
+type backupNotFoundError struct{}
+
+func (backupNotFoundError) Error() string { return "backup not found" }
+
+func (backupNotFoundError) Is(target error) bool { return target == helmutils.ErrReleaseNotFound }
+
 // BackupMetadata defines the structure for backup metadata.
 type BackupMetadata struct {
 	BackupID     string                 `json:"backup_id" yaml:"backup_id"`
@@ -99,7 +110,7 @@ func (m *FileSystemBackupManager) GetBackupDetails(releaseName string, backupID
 		return m.GetBackupDetailsFunc(releaseName, backupID)
 	}
 	if releaseName == "non-existent-release" || backupID == "non-existent-backup-id" {
-		return "", "", BackupMetadata{}, fmt.Errorf("backup %s/%s not found", releaseName, backupID)
+		return "", "", BackupMetadata{}, fmt.Errorf("backup %s/%s: %w", releaseName, backupID, ErrBackupNotFound)
 	}
 	chartName := "detailschart"
 	if releaseName != "details-test-release" {
@@ -142,7 +153,7 @@ func (m *FileSystemBackupManager) RestoreRelease(ctx context.Context, helmClient
 
 	// 1. Uninstall existing release (if it exists)
 	// The original might check if release exists first. Mock client's Uninstall might not error if not found.
-	_, err = helmClient.UninstallRelease(namespace, releaseName, false, timeout)
+	_, err = helmClient.UninstallReleaseContext(ctx, namespace, releaseName, false, timeout)
 	if err != nil {
 		// Log or handle error, but for mock, test might expect it to proceed
 		m.logger("Mock Restore: UninstallRelease failed (continuing for mock): %v", err)
@@ -151,7 +162,7 @@ func (m *FileSystemBackupManager) RestoreRelease(ctx context.Context, helmClient
 	// 2. Install the backed-up chart
 	// The original RestoreRelease uses values from the backup, not the ones passed to BackupRelease initially.
 	// So, metadata.Values should be used here.
-	return helmClient.InstallChart(namespace, releaseName, chartPath, metadata.ChartVersion, metadata.Values, createNamespace, wait, timeout)
+	return helmClient.InstallChartContext(ctx, namespace, releaseName, chartPath, metadata.ChartVersion, metadata.Values, createNamespace, wait, timeout)
 }
 
 func (m *FileSystemBackupManager) UpgradeToBackup(ctx context.Context, helmClient helmutils.HelmClient, namespace string, releaseName string, backupID string, wait bool, timeout time.Duration, force bool) (*helmutils.ReleaseInfo, error) {
@@ -167,7 +178,7 @@ func (m *FileSystemBackupManager) UpgradeToBackup(ctx context.Context, helmClien
 
 	// The original UpgradeToBackup uses values from the backup.
 	// installIfMissing is often true for upgrades that might also be initial installs.
-	return helmClient.UpgradeRelease(namespace, releaseName, chartPath, metadata.ChartVersion, metadata.Values, wait, timeout, true /* installIfMissing */, force)
+	return helmClient.UpgradeReleaseContext(ctx, namespace, releaseName, chartPath, metadata.ChartVersion, metadata.Values, wait, timeout, true /* installIfMissing */, force)
 }
 
 func (m *FileSystemBackupManager) DeleteBackup(releaseName string, backupID string) error {
@@ -175,7 +186,7 @@ func (m *FileSystemBackupManager) DeleteBackup(releaseName string, backupID stri
 		return m.DeleteBackupFunc(releaseName, backupID)
 	}
 	if releaseName == "non-existent-release-del" || backupID == "non-existent-id-del" {
-		return fmt.Errorf("mock error: backup not found for deletion")
+		return fmt.Errorf("mock error: deleting backup %s/%s: %w", releaseName, backupID, ErrBackupNotFound)
 	}
 	return nil
 }
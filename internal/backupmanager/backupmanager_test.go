@@ -3,6 +3,7 @@ package backupmanager
 import (
 	"context"
 	// "encoding/json" // Removed as unused in mock tests
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	helmutils "go_k8s_helm/internal/helmutils"
+	"go_k8s_helm/internal/k8sutils"
 
 	// "gopkg.in/yaml.v2" // Removed as unused in mock tests
 	"helm.sh/helm/v3/pkg/action"
@@ -27,16 +29,32 @@ const (
 
 // mockHelmClient is a mock implementation of the helmutils.HelmClient interface for testing.
 type mockHelmClient struct {
-	ListReleasesFunc       func(namespace string, stateMask action.ListStates) ([]*helmutils.ReleaseInfo, error)
-	InstallChartFunc       func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*helmutils.ReleaseInfo, error)
-	UninstallReleaseFunc   func(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
-	UpgradeReleaseFunc     func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*helmutils.ReleaseInfo, error)
-	GetReleaseDetailsFunc  func(namespace, releaseName string) (*helmutils.ReleaseInfo, error)
-	GetReleaseHistoryFunc  func(namespace, releaseName string) ([]*helmutils.ReleaseInfo, error)
-	AddRepositoryFunc      func(name, url, username, password string, passCredentials bool) error
-	UpdateRepositoriesFunc func() error
-	EnsureChartFunc        func(chartName, version string) (string, error)
-	testingT               *testing.T
+	ListReleasesFunc            func(namespace string, stateMask action.ListStates) ([]*helmutils.ReleaseInfo, error)
+	ListReleasesWithOptionsFunc func(opts helmutils.ListOptions) ([]*helmutils.ReleaseInfo, error)
+	InstallChartFunc            func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*helmutils.ReleaseInfo, error)
+	UninstallReleaseFunc        func(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
+	UpgradeReleaseFunc          func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*helmutils.ReleaseInfo, error)
+	RollbackReleaseFunc         func(namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*helmutils.ReleaseInfo, error)
+	GetReleaseDetailsFunc       func(namespace, releaseName string) (*helmutils.ReleaseInfo, error)
+	GetReleaseHistoryFunc       func(namespace, releaseName string) ([]*helmutils.ReleaseInfo, error)
+	AddRepositoryFunc           func(name, url, username, password string, passCredentials bool) error
+	UpdateRepositoriesFunc      func() error
+	EnsureChartFunc             func(chartName, version string) (string, error)
+	ListRepositoriesFunc        func() ([]*helmutils.RepositoryInfo, error)
+	RemoveRepositoryFunc        func(name string) error
+	SearchChartsFunc            func(keyword, versionConstraint string) ([]*helmutils.ChartSearchResult, error)
+	RegistryLoginFunc           func(host, username, password string, insecure bool) error
+	RegistryLogoutFunc          func(host string) error
+	PushChartFunc               func(chartPath, ociRef string) (string, error)
+	DiffReleaseFunc             func(namespace, releaseName, chartName, version string, vals map[string]interface{}) (*helmutils.ReleaseDiff, error)
+	GetReleaseValuesFunc        func(namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error)
+	GetReleaseResourcesFunc     func(namespace, releaseName string) ([]*helmutils.ReleaseResource, error)
+	UpdateDependenciesFunc      func(chartPath string) ([]*helmutils.ChartDependency, error)
+	BuildDependenciesFunc       func(chartPath string) ([]*helmutils.ChartDependency, error)
+	ListDependenciesFunc        func(chartPath string) ([]*helmutils.ChartDependency, error)
+	RunReleaseTestsFunc         func(namespace, releaseName string, timeout time.Duration, filter []string) ([]*helmutils.ReleaseTestResult, error)
+	WatchReleaseFunc            func(ctx context.Context, namespace, releaseName string) (<-chan helmutils.ReleaseEvent, error)
+	testingT                    *testing.T
 }
 
 var _ helmutils.HelmClient = &mockHelmClient{}
@@ -48,6 +66,13 @@ func (m *mockHelmClient) ListReleases(namespace string, stateMask action.ListSta
 	return nil, fmt.Errorf("ListReleasesFunc not implemented")
 }
 
+func (m *mockHelmClient) ListReleasesWithOptions(opts helmutils.ListOptions) ([]*helmutils.ReleaseInfo, error) {
+	if m.ListReleasesWithOptionsFunc != nil {
+		return m.ListReleasesWithOptionsFunc(opts)
+	}
+	return nil, fmt.Errorf("ListReleasesWithOptionsFunc not implemented")
+}
+
 func (m *mockHelmClient) InstallChart(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*helmutils.ReleaseInfo, error) {
 	if m.InstallChartFunc != nil {
 		return m.InstallChartFunc(namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
@@ -69,6 +94,13 @@ func (m *mockHelmClient) UpgradeRelease(namespace, releaseName, chartName string
 	return &helmutils.ReleaseInfo{Name: releaseName, Namespace: namespace, Revision: 2, Status: "deployed"}, nil
 }
 
+func (m *mockHelmClient) RollbackRelease(namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*helmutils.ReleaseInfo, error) {
+	if m.RollbackReleaseFunc != nil {
+		return m.RollbackReleaseFunc(namespace, releaseName, revision, wait, timeout, force)
+	}
+	return &helmutils.ReleaseInfo{Name: releaseName, Namespace: namespace, Revision: 3, Status: "deployed"}, nil
+}
+
 func (m *mockHelmClient) GetReleaseDetails(namespace, releaseName string) (*helmutils.ReleaseInfo, error) {
 	if m.GetReleaseDetailsFunc != nil {
 		return m.GetReleaseDetailsFunc(namespace, releaseName)
@@ -107,6 +139,221 @@ func (m *mockHelmClient) EnsureChart(chartName, version string) (string, error)
 	return "/mock/chartpath/" + chartName, nil
 }
 
+func (m *mockHelmClient) ListRepositories() ([]*helmutils.RepositoryInfo, error) {
+	if m.ListRepositoriesFunc != nil {
+		return m.ListRepositoriesFunc()
+	}
+	return nil, nil
+}
+
+func (m *mockHelmClient) RemoveRepository(name string) error {
+	if m.RemoveRepositoryFunc != nil {
+		return m.RemoveRepositoryFunc(name)
+	}
+	return nil
+}
+
+func (m *mockHelmClient) SearchCharts(keyword, versionConstraint string) ([]*helmutils.ChartSearchResult, error) {
+	if m.SearchChartsFunc != nil {
+		return m.SearchChartsFunc(keyword, versionConstraint)
+	}
+	return nil, nil
+}
+
+func (m *mockHelmClient) RegistryLogin(host, username, password string, insecure bool) error {
+	if m.RegistryLoginFunc != nil {
+		return m.RegistryLoginFunc(host, username, password, insecure)
+	}
+	return nil
+}
+
+func (m *mockHelmClient) RegistryLogout(host string) error {
+	if m.RegistryLogoutFunc != nil {
+		return m.RegistryLogoutFunc(host)
+	}
+	return nil
+}
+
+func (m *mockHelmClient) PushChart(chartPath, ociRef string) (string, error) {
+	if m.PushChartFunc != nil {
+		return m.PushChartFunc(chartPath, ociRef)
+	}
+	return "", fmt.Errorf("PushChartFunc not implemented")
+}
+
+func (m *mockHelmClient) GetReleaseValues(namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error) {
+	if m.GetReleaseValuesFunc != nil {
+		return m.GetReleaseValuesFunc(namespace, releaseName, revision, allValues)
+	}
+	return nil, fmt.Errorf("GetReleaseValuesFunc not implemented")
+}
+
+func (m *mockHelmClient) GetReleaseResources(namespace, releaseName string) ([]*helmutils.ReleaseResource, error) {
+	if m.GetReleaseResourcesFunc != nil {
+		return m.GetReleaseResourcesFunc(namespace, releaseName)
+	}
+	return nil, fmt.Errorf("GetReleaseResourcesFunc not implemented")
+}
+
+func (m *mockHelmClient) UpdateDependencies(chartPath string) ([]*helmutils.ChartDependency, error) {
+	if m.UpdateDependenciesFunc != nil {
+		return m.UpdateDependenciesFunc(chartPath)
+	}
+	return nil, fmt.Errorf("UpdateDependenciesFunc not implemented")
+}
+
+func (m *mockHelmClient) BuildDependencies(chartPath string) ([]*helmutils.ChartDependency, error) {
+	if m.BuildDependenciesFunc != nil {
+		return m.BuildDependenciesFunc(chartPath)
+	}
+	return nil, fmt.Errorf("BuildDependenciesFunc not implemented")
+}
+
+func (m *mockHelmClient) ListDependencies(chartPath string) ([]*helmutils.ChartDependency, error) {
+	if m.ListDependenciesFunc != nil {
+		return m.ListDependenciesFunc(chartPath)
+	}
+	return nil, fmt.Errorf("ListDependenciesFunc not implemented")
+}
+
+func (m *mockHelmClient) RunReleaseTests(namespace, releaseName string, timeout time.Duration, filter []string) ([]*helmutils.ReleaseTestResult, error) {
+	if m.RunReleaseTestsFunc != nil {
+		return m.RunReleaseTestsFunc(namespace, releaseName, timeout, filter)
+	}
+	return nil, fmt.Errorf("RunReleaseTestsFunc not implemented")
+}
+
+func (m *mockHelmClient) WatchRelease(ctx context.Context, namespace, releaseName string) (<-chan helmutils.ReleaseEvent, error) {
+	if m.WatchReleaseFunc != nil {
+		return m.WatchReleaseFunc(ctx, namespace, releaseName)
+	}
+	return nil, fmt.Errorf("WatchReleaseFunc not implemented")
+}
+
+// The options-based variants delegate to the positional methods.
+
+func (m *mockHelmClient) InstallChartWithOptions(opts helmutils.InstallOptions) (*helmutils.ReleaseInfo, error) {
+	return m.InstallChart(opts.Namespace, opts.ReleaseName, opts.ChartName, opts.ChartVersion, opts.Values, opts.CreateNamespace, opts.Wait, opts.Timeout)
+}
+
+func (m *mockHelmClient) UpgradeReleaseWithOptions(opts helmutils.UpgradeOptions) (*helmutils.ReleaseInfo, error) {
+	return m.UpgradeRelease(opts.Namespace, opts.ReleaseName, opts.ChartName, opts.ChartVersion, opts.Values, opts.Wait, opts.Timeout, opts.Install, opts.Force)
+}
+
+func (m *mockHelmClient) DiffRelease(namespace, releaseName, chartName, version string, vals map[string]interface{}) (*helmutils.ReleaseDiff, error) {
+	if m.DiffReleaseFunc != nil {
+		return m.DiffReleaseFunc(namespace, releaseName, chartName, version, vals)
+	}
+	return nil, fmt.Errorf("DiffReleaseFunc not implemented")
+}
+
+// The context-first variants delegate to the plain methods so tests only need
+// to set the non-context function fields.
+
+func (m *mockHelmClient) ListReleasesContext(ctx context.Context, namespace string, stateMask action.ListStates) ([]*helmutils.ReleaseInfo, error) {
+	return m.ListReleases(namespace, stateMask)
+}
+
+func (m *mockHelmClient) ListReleasesWithOptionsContext(ctx context.Context, opts helmutils.ListOptions) ([]*helmutils.ReleaseInfo, error) {
+	return m.ListReleasesWithOptions(opts)
+}
+
+func (m *mockHelmClient) InstallChartContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*helmutils.ReleaseInfo, error) {
+	return m.InstallChart(namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
+}
+
+func (m *mockHelmClient) UninstallReleaseContext(ctx context.Context, namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error) {
+	return m.UninstallRelease(namespace, releaseName, keepHistory, timeout)
+}
+
+func (m *mockHelmClient) UpgradeReleaseContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*helmutils.ReleaseInfo, error) {
+	return m.UpgradeRelease(namespace, releaseName, chartName, chartVersion, vals, wait, timeout, installIfMissing, force)
+}
+
+func (m *mockHelmClient) RollbackReleaseContext(ctx context.Context, namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*helmutils.ReleaseInfo, error) {
+	return m.RollbackRelease(namespace, releaseName, revision, wait, timeout, force)
+}
+
+func (m *mockHelmClient) GetReleaseDetailsContext(ctx context.Context, namespace, releaseName string) (*helmutils.ReleaseInfo, error) {
+	return m.GetReleaseDetails(namespace, releaseName)
+}
+
+func (m *mockHelmClient) GetReleaseHistoryContext(ctx context.Context, namespace, releaseName string) ([]*helmutils.ReleaseInfo, error) {
+	return m.GetReleaseHistory(namespace, releaseName)
+}
+
+func (m *mockHelmClient) AddRepositoryContext(ctx context.Context, name, url, username, password string, passCredentials bool) error {
+	return m.AddRepository(name, url, username, password, passCredentials)
+}
+
+func (m *mockHelmClient) UpdateRepositoriesContext(ctx context.Context) error {
+	return m.UpdateRepositories()
+}
+
+func (m *mockHelmClient) EnsureChartContext(ctx context.Context, chartName, version string) (string, error) {
+	return m.EnsureChart(chartName, version)
+}
+
+func (m *mockHelmClient) InstallChartWithOptionsContext(ctx context.Context, opts helmutils.InstallOptions) (*helmutils.ReleaseInfo, error) {
+	return m.InstallChartWithOptions(opts)
+}
+
+func (m *mockHelmClient) UpgradeReleaseWithOptionsContext(ctx context.Context, opts helmutils.UpgradeOptions) (*helmutils.ReleaseInfo, error) {
+	return m.UpgradeReleaseWithOptions(opts)
+}
+
+func (m *mockHelmClient) DiffReleaseContext(ctx context.Context, namespace, releaseName, chartName, version string, vals map[string]interface{}) (*helmutils.ReleaseDiff, error) {
+	return m.DiffRelease(namespace, releaseName, chartName, version, vals)
+}
+
+func (m *mockHelmClient) ListRepositoriesContext(ctx context.Context) ([]*helmutils.RepositoryInfo, error) {
+	return m.ListRepositories()
+}
+
+func (m *mockHelmClient) RemoveRepositoryContext(ctx context.Context, name string) error {
+	return m.RemoveRepository(name)
+}
+
+func (m *mockHelmClient) SearchChartsContext(ctx context.Context, keyword, versionConstraint string) ([]*helmutils.ChartSearchResult, error) {
+	return m.SearchCharts(keyword, versionConstraint)
+}
+
+func (m *mockHelmClient) RegistryLoginContext(ctx context.Context, host, username, password string, insecure bool) error {
+	return m.RegistryLogin(host, username, password, insecure)
+}
+
+func (m *mockHelmClient) RegistryLogoutContext(ctx context.Context, host string) error {
+	return m.RegistryLogout(host)
+}
+
+func (m *mockHelmClient) PushChartContext(ctx context.Context, chartPath, ociRef string) (string, error) {
+	return m.PushChart(chartPath, ociRef)
+}
+
+func (m *mockHelmClient) GetReleaseValuesContext(ctx context.Context, namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error) {
+	return m.GetReleaseValues(namespace, releaseName, revision, allValues)
+}
+
+func (m *mockHelmClient) GetReleaseResourcesContext(ctx context.Context, namespace, releaseName string) ([]*helmutils.ReleaseResource, error) {
+	return m.GetReleaseResources(namespace, releaseName)
+}
+
+func (m *mockHelmClient) UpdateDependenciesContext(ctx context.Context, chartPath string) ([]*helmutils.ChartDependency, error) {
+	return m.UpdateDependencies(chartPath)
+}
+
+func (m *mockHelmClient) BuildDependenciesContext(ctx context.Context, chartPath string) ([]*helmutils.ChartDependency, error) {
+	return m.BuildDependencies(chartPath)
+}
+
+func (m *mockHelmClient) ListDependenciesContext(ctx context.Context, chartPath string) ([]*helmutils.ChartDependency, error) {
+	return m.ListDependencies(chartPath)
+}
+
+func (m *mockHelmClient) RunReleaseTestsContext(ctx context.Context, namespace, releaseName string, timeout time.Duration, filter []string) ([]*helmutils.ReleaseTestResult, error) {
+	return m.RunReleaseTests(namespace, releaseName, timeout, filter)
+}
+
 func createTempChart(t *testing.T, chartName, chartVersion, appVersion string) string {
 	t.Helper()
 	tempDir := t.TempDir()
@@ -425,6 +672,31 @@ func TestFileSystemBackupManager_RestoreRelease(t *testing.T) {
 	})
 }
 
+func TestFileSystemBackupManager_RestoreReleasePropagatesContext(t *testing.T) {
+	mgr, err := NewFileSystemBackupManager(t.TempDir(), log.Printf)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	authUtil, err := k8sutils.NewAuthUtil()
+	if err != nil {
+		t.Fatalf("Failed to create auth util: %v", err)
+	}
+	hc, err := helmutils.NewClient(authUtil, "test-ns", log.Printf)
+	if err != nil {
+		t.Fatalf("Failed to create helm client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mgr.RestoreRelease(ctx, hc, "test-ns", "restore-test-release", "mock-restore-backup-id", false, false, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RestoreRelease() with cancelled context error = %v, want context.Canceled", err)
+	}
+	if _, err := hc.GetReleaseDetails("test-ns", "restore-test-release"); err == nil {
+		t.Error("release was installed despite the cancelled context")
+	}
+}
+
 func TestFileSystemBackupManager_UpgradeToBackup(t *testing.T) {
 	tempBaseDir := t.TempDir()
 	mgr, err := NewFileSystemBackupManager(tempBaseDir, log.Printf)
@@ -519,4 +791,22 @@ func TestFileSystemBackupManager_DefaultListAndGetDetails(t *testing.T) {
 			t.Errorf("Expected meta.Values[\"mockKey\"]=\"mockValueFromGetDetails\", got %v", meta.Values)
 		}
 	})
+
+	t.Run("unknown backups are not found", func(t *testing.T) {
+		mgr.GetBackupDetailsFunc = nil
+		mgr.RestoreReleaseFunc = nil
+		mgr.DeleteBackupFunc = nil
+
+		_, _, _, errDetails := mgr.GetBackupDetails("some-release", "non-existent-backup-id")
+		_, errRestore := mgr.RestoreRelease(context.Background(), &mockHelmClient{testingT: t}, "default", "some-release", "non-existent-backup-id", false, false, time.Minute)
+		errDelete := mgr.DeleteBackup("some-release", "non-existent-id-del")
+		for name, err := range map[string]error{"GetBackupDetails": errDetails, "RestoreRelease": errRestore, "DeleteBackup": errDelete} {
+			if !errors.Is(err, ErrBackupNotFound) {
+				t.Errorf("%s error = %v, want ErrBackupNotFound", name, err)
+			}
+			if code := helmutils.ExitCode(err); code != helmutils.ExitCodeReleaseNotFound {
+				t.Errorf("ExitCode(%s error) = %d, want %d", name, code, helmutils.ExitCodeReleaseNotFound)
+			}
+		}
+	})
 }
@@ -1,18 +1,35 @@
 package helmutils
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	k8sutils "go_k8s_helm/internal/k8sutils"
 
+	"github.com/Masterminds/semver/v3"
+
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	helmtime "helm.sh/helm/v3/pkg/time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
@@ -25,14 +42,63 @@ import (
 // HelmClient defines the interface for Helm operations.
 type HelmClient interface {
 	ListReleases(namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error)
+	ListReleasesWithOptions(opts ListOptions) ([]*ReleaseInfo, error)
 	InstallChart(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error)
 	UninstallRelease(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
 	UpgradeRelease(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error)
+	RollbackRelease(namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error)
 	GetReleaseDetails(namespace, releaseName string) (*ReleaseInfo, error)
 	GetReleaseHistory(namespace, releaseName string) ([]*ReleaseInfo, error)
 	AddRepository(name, url, username, password string, passCredentials bool) error
 	UpdateRepositories() error
 	EnsureChart(chartName, version string) (string, error)
+	InstallChartWithOptions(opts InstallOptions) (*ReleaseInfo, error)
+	UpgradeReleaseWithOptions(opts UpgradeOptions) (*ReleaseInfo, error)
+	DiffRelease(namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error)
+	ListRepositories() ([]*RepositoryInfo, error)
+	RemoveRepository(name string) error
+	SearchCharts(keyword, versionConstraint string) ([]*ChartSearchResult, error)
+	RegistryLogin(host, username, password string, insecure bool) error
+	RegistryLogout(host string) error
+	PushChart(chartPath, ociRef string) (string, error)
+	RunReleaseTests(namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error)
+	GetReleaseValues(namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error)
+	GetReleaseResources(namespace, releaseName string) ([]*ReleaseResource, error)
+	UpdateDependencies(chartPath string) ([]*ChartDependency, error)
+	BuildDependencies(chartPath string) ([]*ChartDependency, error)
+	ListDependencies(chartPath string) ([]*ChartDependency, error)
+
+	// WatchRelease streams progress events for a release until ctx is done.
+	WatchRelease(ctx context.Context, namespace, releaseName string) (<-chan ReleaseEvent, error)
+
+	// Context-first variants of the methods above. Cancelling ctx or passing
+	// its deadline aborts the operation with ctx.Err().
+	ListReleasesContext(ctx context.Context, namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error)
+	ListReleasesWithOptionsContext(ctx context.Context, opts ListOptions) ([]*ReleaseInfo, error)
+	InstallChartContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error)
+	UninstallReleaseContext(ctx context.Context, namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
+	UpgradeReleaseContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error)
+	RollbackReleaseContext(ctx context.Context, namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error)
+	GetReleaseDetailsContext(ctx context.Context, namespace, releaseName string) (*ReleaseInfo, error)
+	GetReleaseHistoryContext(ctx context.Context, namespace, releaseName string) ([]*ReleaseInfo, error)
+	AddRepositoryContext(ctx context.Context, name, url, username, password string, passCredentials bool) error
+	UpdateRepositoriesContext(ctx context.Context) error
+	EnsureChartContext(ctx context.Context, chartName, version string) (string, error)
+	InstallChartWithOptionsContext(ctx context.Context, opts InstallOptions) (*ReleaseInfo, error)
+	UpgradeReleaseWithOptionsContext(ctx context.Context, opts UpgradeOptions) (*ReleaseInfo, error)
+	DiffReleaseContext(ctx context.Context, namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error)
+	ListRepositoriesContext(ctx context.Context) ([]*RepositoryInfo, error)
+	RemoveRepositoryContext(ctx context.Context, name string) error
+	SearchChartsContext(ctx context.Context, keyword, versionConstraint string) ([]*ChartSearchResult, error)
+	RegistryLoginContext(ctx context.Context, host, username, password string, insecure bool) error
+	RegistryLogoutContext(ctx context.Context, host string) error
+	PushChartContext(ctx context.Context, chartPath, ociRef string) (string, error)
+	RunReleaseTestsContext(ctx context.Context, namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error)
+	GetReleaseValuesContext(ctx context.Context, namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error)
+	GetReleaseResourcesContext(ctx context.Context, namespace, releaseName string) ([]*ReleaseResource, error)
+	UpdateDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error)
+	BuildDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error)
+	ListDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error)
 }
 
 // ReleaseInfo holds summarized information about a Helm release.
@@ -50,28 +116,182 @@ type ReleaseInfo struct {
 	Config       map[string]interface{} `json:"config,omitempty"`
 	Manifest     string                 `json:"manifest,omitempty"`
 	Values       map[string]interface{} `json:"values,omitempty"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+}
+
+// ListSortBy selects the field ListReleasesWithOptions orders results by.
+type ListSortBy string
+
+const (
+	// ListSortByName orders releases lexicographically by name (the default).
+	ListSortByName ListSortBy = "name"
+	// ListSortByDate orders releases by last deployment, most recent first.
+	ListSortByDate ListSortBy = "date"
+	// ListSortByRevision orders releases by revision number, highest first.
+	ListSortByRevision ListSortBy = "revision"
+)
+
+// ListOptions controls which releases ListReleasesWithOptions returns and in what order.
+type ListOptions struct {
+	// Namespace restricts the listing to one namespace. Empty lists all namespaces.
+	Namespace string
+	// StateMask selects releases by status. Zero means deployed and failed, as with 'helm list'.
+	StateMask action.ListStates
+	// Filter is a regular expression matched against release names.
+	Filter string
+	// SortBy selects the sort field. Empty means ListSortByName.
+	SortBy ListSortBy
+	// SortReverse inverts the order chosen by SortBy.
+	SortReverse bool
+	// Limit caps the number of releases returned. Zero or less means no limit.
+	Limit int
+	// Offset skips that many releases after filtering and sorting.
+	Offset int
+	// Selector is a label selector, such as "team=payments,env!=prod",
+	// matched against release labels. Empty matches every release.
+	Selector string
+}
+
+// InstallOptions describes an install for InstallChartWithOptions.
+type InstallOptions struct {
+	Namespace       string
+	ReleaseName     string // Generated from the chart name when empty.
+	ChartName       string
+	ChartVersion    string
+	Values          map[string]interface{}
+	CreateNamespace bool
+	Wait            bool
+	Timeout         time.Duration
+	// DryRun renders the release without recording it, like 'helm install --dry-run'.
+	DryRun bool
+	// Labels are stored with the release record, for ListOptions.Selector.
+	Labels map[string]string
+}
+
+// UpgradeOptions describes an upgrade for UpgradeReleaseWithOptions.
+type UpgradeOptions struct {
+	Namespace    string
+	ReleaseName  string
+	ChartName    string
+	ChartVersion string
+	Values       map[string]interface{}
+	Wait         bool
+	Timeout      time.Duration
+	// Install installs the chart when the release does not exist yet.
+	Install bool
+	Force   bool
+	// DryRun renders the next revision without recording it, like 'helm upgrade --dry-run'.
+	DryRun bool
+	// Labels are merged over those of the previous revision; a value of
+	// "null" removes a label.
+	Labels map[string]string
 }
 
 // MockHelmClientFields holds the mockable functions for HelmClient methods.
 type MockHelmClientFields struct {
-	ListReleasesFunc       func(namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error)
-	InstallChartFunc       func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error)
-	UninstallReleaseFunc   func(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
-	UpgradeReleaseFunc     func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error)
-	GetReleaseDetailsFunc  func(namespace, releaseName string) (*ReleaseInfo, error)
-	GetReleaseHistoryFunc  func(namespace, releaseName string) ([]*ReleaseInfo, error)
-	AddRepositoryFunc      func(name, url, username, password string, passCredentials bool) error
-	UpdateRepositoriesFunc func() error
-	EnsureChartFunc        func(chartName, version string) (string, error)
-}
-
-// Client is the mock implementation of HelmClient.
+	ListReleasesFunc              func(namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error)
+	ListReleasesWithOptionsFunc   func(opts ListOptions) ([]*ReleaseInfo, error)
+	InstallChartFunc              func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error)
+	UninstallReleaseFunc          func(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
+	UpgradeReleaseFunc            func(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error)
+	RollbackReleaseFunc           func(namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error)
+	GetReleaseDetailsFunc         func(namespace, releaseName string) (*ReleaseInfo, error)
+	GetReleaseHistoryFunc         func(namespace, releaseName string) ([]*ReleaseInfo, error)
+	AddRepositoryFunc             func(name, url, username, password string, passCredentials bool) error
+	UpdateRepositoriesFunc        func() error
+	EnsureChartFunc               func(chartName, version string) (string, error)
+	InstallChartWithOptionsFunc   func(opts InstallOptions) (*ReleaseInfo, error)
+	UpgradeReleaseWithOptionsFunc func(opts UpgradeOptions) (*ReleaseInfo, error)
+	DiffReleaseFunc               func(namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error)
+	ListRepositoriesFunc          func() ([]*RepositoryInfo, error)
+	RemoveRepositoryFunc          func(name string) error
+	SearchChartsFunc              func(keyword, versionConstraint string) ([]*ChartSearchResult, error)
+	RegistryLoginFunc             func(host, username, password string, insecure bool) error
+	RegistryLogoutFunc            func(host string) error
+	PushChartFunc                 func(chartPath, ociRef string) (string, error)
+	RunReleaseTestsFunc           func(namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error)
+	GetReleaseValuesFunc          func(namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error)
+	GetReleaseResourcesFunc       func(namespace, releaseName string) ([]*ReleaseResource, error)
+	UpdateDependenciesFunc        func(chartPath string) ([]*ChartDependency, error)
+	BuildDependenciesFunc         func(chartPath string) ([]*ChartDependency, error)
+	ListDependenciesFunc          func(chartPath string) ([]*ChartDependency, error)
+
+	ListReleasesContextFunc              func(ctx context.Context, namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error)
+	ListReleasesWithOptionsContextFunc   func(ctx context.Context, opts ListOptions) ([]*ReleaseInfo, error)
+	InstallChartContextFunc              func(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error)
+	UninstallReleaseContextFunc          func(ctx context.Context, namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error)
+	UpgradeReleaseContextFunc            func(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error)
+	RollbackReleaseContextFunc           func(ctx context.Context, namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error)
+	GetReleaseDetailsContextFunc         func(ctx context.Context, namespace, releaseName string) (*ReleaseInfo, error)
+	GetReleaseHistoryContextFunc         func(ctx context.Context, namespace, releaseName string) ([]*ReleaseInfo, error)
+	AddRepositoryContextFunc             func(ctx context.Context, name, url, username, password string, passCredentials bool) error
+	UpdateRepositoriesContextFunc        func(ctx context.Context) error
+	EnsureChartContextFunc               func(ctx context.Context, chartName, version string) (string, error)
+	InstallChartWithOptionsContextFunc   func(ctx context.Context, opts InstallOptions) (*ReleaseInfo, error)
+	UpgradeReleaseWithOptionsContextFunc func(ctx context.Context, opts UpgradeOptions) (*ReleaseInfo, error)
+	DiffReleaseContextFunc               func(ctx context.Context, namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error)
+	ListRepositoriesContextFunc          func(ctx context.Context) ([]*RepositoryInfo, error)
+	RemoveRepositoryContextFunc          func(ctx context.Context, name string) error
+	SearchChartsContextFunc              func(ctx context.Context, keyword, versionConstraint string) ([]*ChartSearchResult, error)
+	RegistryLoginContextFunc             func(ctx context.Context, host, username, password string, insecure bool) error
+	RegistryLogoutContextFunc            func(ctx context.Context, host string) error
+	PushChartContextFunc                 func(ctx context.Context, chartPath, ociRef string) (string, error)
+	RunReleaseTestsContextFunc           func(ctx context.Context, namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error)
+	GetReleaseValuesContextFunc          func(ctx context.Context, namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error)
+	GetReleaseResourcesContextFunc       func(ctx context.Context, namespace, releaseName string) ([]*ReleaseResource, error)
+	UpdateDependenciesContextFunc        func(ctx context.Context, chartPath string) ([]*ChartDependency, error)
+	BuildDependenciesContextFunc         func(ctx context.Context, chartPath string) ([]*ChartDependency, error)
+	ListDependenciesContextFunc          func(ctx context.Context, chartPath string) ([]*ChartDependency, error)
+
+	WatchReleaseFunc func(ctx context.Context, namespace, releaseName string) (<-chan ReleaseEvent, error)
+}
+
+// Client is the mock implementation of HelmClient. Releases installed through
+// it are kept in an in-memory store so subsequent calls observe the same state.
 type Client struct {
 	settings       *cli.EnvSettings
 	authChecker    k8sutils.K8sAuthChecker
 	baseKubeConfig *rest.Config
 	Log            func(format string, v ...interface{})
 	*MockHelmClientFields
+
+	// OperationDelay simulates how long install, upgrade, rollback and
+	// uninstall take to apply. While it elapses the release sits in the
+	// matching pending state, and cancelling the context leaves it there.
+	OperationDelay time.Duration
+
+	// OperationLockTimeout is how long an install, upgrade, rollback or
+	// uninstall waits for another operation on the same release to finish.
+	// When zero it fails straight away with ErrPendingOperation, as Helm does.
+	OperationLockTimeout time.Duration
+
+	// RegistryPlainHTTP talks to OCI registries over plain HTTP instead of
+	// HTTPS, for local and test registries.
+	RegistryPlainHTTP bool
+
+	// PostRenderers rewrite the manifest of every install, upgrade and dry
+	// run, in order, after the chart is rendered. Hooks are not post-rendered,
+	// as in Helm.
+	PostRenderers []PostRenderer
+
+	// VerifyKeyring, when set, makes EnsureChart and every install, upgrade
+	// and dry run check the chart's provenance file against this public
+	// keyring before using it. Chart directories cannot be verified.
+	VerifyKeyring string
+
+	// ValuesTransform, when set, rewrites the values of every install,
+	// upgrade and dry run before the chart is rendered with them.
+	ValuesTransform ValuesTransform
+
+	// TestOutcomes scripts the result of each chart test hook, keyed by hook
+	// name, for RunReleaseTests. Tests without an entry pass immediately.
+	TestOutcomes map[string]ReleaseTestOutcome
+
+	store     *releaseStore
+	storeOnce sync.Once
+
+	// repoMu serializes access to the repositories file and cache.
+	repoMu sync.Mutex
 }
 
 // NewClient returns a new mock HelmClient.
@@ -106,84 +326,1563 @@ func NewClient(authChecker k8sutils.K8sAuthChecker, defaultNamespace string, log
 		baseKubeConfig:       kubeConfig,
 		Log:                  actualLogger,
 		MockHelmClientFields: &MockHelmClientFields{},
+		store:                newReleaseStore(),
+	}
+	// Releases only live in the client unless a storage driver is chosen. A
+	// driver that cannot be used leaves them there rather than failing.
+	if name := os.Getenv("HELM_DRIVER"); name != "" {
+		d, err := ParseStorageDriver(name)
+		if err == nil {
+			err = mc.UseStorageDriver(d)
+		}
+		if err != nil {
+			mc.Log("Ignoring HELM_DRIVER=%s, keeping releases in memory: %v", name, err)
+		}
 	}
 	return mc, nil
 }
 
+// NewClientForCluster returns a new mock HelmClient for the cluster called
+// cluster in registry, as NewClient does with that cluster's checker. An
+// empty defaultNamespace means the cluster's current namespace.
+func NewClientForCluster(registry *k8sutils.ClusterRegistry, cluster string, defaultNamespace string, logger func(format string, v ...interface{})) (HelmClient, error) {
+	authChecker, err := registry.Checker(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(authChecker, defaultNamespace, logger)
+}
+
 // --- Mock implementations for HelmClient interface methods ---
+// The methods without a context delegate to their Context variants using
+// context.Background(). A Context variant honours an override for either
+// form in MockHelmClientFields, preferring the Context one.
+
 func (c *Client) ListReleases(namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.ListReleasesFunc != nil {
-		return c.ListReleasesFunc(namespace, stateMask)
+	return c.ListReleasesContext(context.Background(), namespace, stateMask)
+}
+
+func (c *Client) ListReleasesContext(ctx context.Context, namespace string, stateMask action.ListStates) ([]*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.ListReleasesContextFunc != nil {
+			return f.ListReleasesContextFunc(ctx, namespace, stateMask)
+		}
+		if f.ListReleasesFunc != nil {
+			return f.ListReleasesFunc(namespace, stateMask)
+		}
+	}
+	return c.ListReleasesWithOptionsContext(ctx, ListOptions{Namespace: namespace, StateMask: stateMask})
+}
+
+func (c *Client) ListReleasesWithOptions(opts ListOptions) ([]*ReleaseInfo, error) {
+	return c.ListReleasesWithOptionsContext(context.Background(), opts)
+}
+
+func (c *Client) ListReleasesWithOptionsContext(ctx context.Context, opts ListOptions) ([]*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.ListReleasesWithOptionsContextFunc != nil {
+			return f.ListReleasesWithOptionsContextFunc(ctx, opts)
+		}
+		if f.ListReleasesWithOptionsFunc != nil {
+			return f.ListReleasesWithOptionsFunc(opts)
+		}
+	}
+	c.Log("Mock ListReleases called for namespace: %s", opts.Namespace)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var filter *regexp.Regexp
+	if opts.Filter != "" {
+		var err error
+		filter, err = regexp.Compile(opts.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid release name filter %q: %w", opts.Filter, err)
+		}
+	}
+	selector, err := parseReleaseSelector(opts.Selector)
+	if err != nil {
+		return nil, err
+	}
+	stateMask := opts.StateMask
+	if stateMask == 0 {
+		stateMask = action.ListDeployed | action.ListFailed
+	}
+
+	rels := c.releases().list(opts.Namespace)
+	// Superseded revisions are never the latest one, so a superseded-only
+	// mask has to look at the whole history, as 'helm list --superseded' does.
+	if stateMask != action.ListSuperseded {
+		rels = filterLatestReleases(rels)
+	}
+
+	matched := make([]*release.Release, 0, len(rels))
+	for _, rel := range rels {
+		if filter != nil && !filter.MatchString(rel.Name) {
+			continue
+		}
+		if stateMask&stateMask.FromName(rel.Info.Status.String()) == 0 {
+			continue
+		}
+		if !selector.Matches(labels.Set(rel.Labels)) {
+			continue
+		}
+		matched = append(matched, rel)
+	}
+	if err := sortReleases(matched, opts.SortBy, opts.SortReverse); err != nil {
+		return nil, err
+	}
+
+	infos := []*ReleaseInfo{}
+	if opts.Offset >= len(matched) {
+		return infos, nil
+	}
+	if opts.Offset > 0 {
+		matched = matched[opts.Offset:]
 	}
-	c.Log("Mock ListReleases called for namespace: %s", namespace)
-	return []*ReleaseInfo{{Name: "mocked-release", Namespace: namespace, Status: release.StatusDeployed}}, nil
+	if opts.Limit > 0 && opts.Limit < len(matched) {
+		matched = matched[:opts.Limit]
+	}
+	for _, rel := range matched {
+		infos = append(infos, convertReleaseToInfo(rel))
+	}
+	return infos, nil
 }
 
 func (c *Client) InstallChart(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.InstallChartFunc != nil {
-		return c.InstallChartFunc(namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
+	return c.InstallChartContext(context.Background(), namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
+}
+
+func (c *Client) InstallChartContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, createNamespace bool, wait bool, timeout time.Duration) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.InstallChartContextFunc != nil {
+			return f.InstallChartContextFunc(ctx, namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
+		}
+		if f.InstallChartFunc != nil {
+			return f.InstallChartFunc(namespace, releaseName, chartName, chartVersion, vals, createNamespace, wait, timeout)
+		}
+	}
+	return c.installChart(ctx, InstallOptions{
+		Namespace:       namespace,
+		ReleaseName:     releaseName,
+		ChartName:       chartName,
+		ChartVersion:    chartVersion,
+		Values:          vals,
+		CreateNamespace: createNamespace,
+		Wait:            wait,
+		Timeout:         timeout,
+	})
+}
+
+func (c *Client) InstallChartWithOptions(opts InstallOptions) (*ReleaseInfo, error) {
+	return c.InstallChartWithOptionsContext(context.Background(), opts)
+}
+
+// InstallChartWithOptionsContext installs a chart as described by opts. With
+// opts.DryRun set the chart is rendered and returned but nothing is recorded.
+func (c *Client) InstallChartWithOptionsContext(ctx context.Context, opts InstallOptions) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.InstallChartWithOptionsContextFunc != nil {
+			return f.InstallChartWithOptionsContextFunc(ctx, opts)
+		}
+		if f.InstallChartWithOptionsFunc != nil {
+			return f.InstallChartWithOptionsFunc(opts)
+		}
+	}
+	return c.installChart(ctx, opts)
+}
+
+func (c *Client) installChart(ctx context.Context, opts InstallOptions) (*ReleaseInfo, error) {
+	namespace := c.resolveNamespace(opts.Namespace)
+	releaseName := opts.ReleaseName
+	c.Log("Mock InstallChart called for release: %s, chart: %s", releaseName, opts.ChartName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.ChartName == "" {
+		return nil, fmt.Errorf("chart name cannot be empty")
+	}
+	if err := validateReleaseLabels(opts.Labels); err != nil {
+		return nil, err
+	}
+	ch, err := c.loadChartRef(ctx, opts.ChartName, opts.ChartVersion)
+	if err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		releaseName = fmt.Sprintf("%s-%d", ch.Metadata.Name, time.Now().Unix())
+	}
+	if !opts.DryRun {
+		unlock, err := c.lockRelease(ctx, namespace, releaseName, "install")
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	return c.recordInstall(ctx, namespace, releaseName, ch, opts)
+}
+
+// recordInstall records ch as a new release, or only renders it with
+// opts.DryRun set. Unless it is a dry run the caller must hold the release lock.
+func (c *Client) recordInstall(ctx context.Context, namespace, releaseName string, ch *chart.Chart, opts InstallOptions) (*ReleaseInfo, error) {
+	// nextInstallVersion validates that the name is free and returns the
+	// revision the install will be recorded as.
+	nextInstallVersion := func(revs []*release.Release) (int, error) {
+		if len(revs) == 0 {
+			return 1, nil
+		}
+		last := revs[len(revs)-1]
+		if last.Info.Status != release.StatusUninstalled {
+			return 0, &ReleaseError{Op: "install", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("cannot re-use a name that is still in use: %w", ErrReleaseExists)}
+		}
+		return last.Version + 1, nil
+	}
+
+	if opts.DryRun {
+		version, err := nextInstallVersion(c.releases().history(namespace, releaseName))
+		if err != nil {
+			return nil, err
+		}
+		rel := newMockRelease(namespace, releaseName, version, ch, opts.Values, "Dry run complete")
+		rel.Labels = copyLabels(opts.Labels)
+		rel.Info.Status = release.StatusPendingInstall
+		if err := c.renderInto(rel, false); err != nil {
+			return nil, err
+		}
+		return convertReleaseToInfo(rel), nil
+	}
+
+	var version int
+	err := c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		var err error
+		if version, err = nextInstallVersion(revs); err != nil {
+			return nil, err
+		}
+		rel := newMockRelease(namespace, releaseName, version, ch, opts.Values, "Initial install underway")
+		rel.Labels = copyLabels(opts.Labels)
+		rel.Info.Status = release.StatusPendingInstall
+		if err := c.renderInto(rel, false); err != nil {
+			return nil, err
+		}
+		return append(revs, rel), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.awaitOperation(ctx, opts.Timeout); err != nil {
+		return nil, fmt.Errorf("install of release %q interrupted, left in %s state: %w", releaseName, release.StatusPendingInstall, err)
 	}
-	c.Log("Mock InstallChart called for release: %s, chart: %s", releaseName, chartName)
-	return &ReleaseInfo{Name: releaseName, Namespace: namespace, Status: release.StatusDeployed}, nil
+	return c.finalizeRevision(namespace, releaseName, version, "Install complete")
 }
 
 func (c *Client) UninstallRelease(namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.UninstallReleaseFunc != nil {
-		return c.UninstallReleaseFunc(namespace, releaseName, keepHistory, timeout)
+	return c.UninstallReleaseContext(context.Background(), namespace, releaseName, keepHistory, timeout)
+}
+
+func (c *Client) UninstallReleaseContext(ctx context.Context, namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.UninstallReleaseContextFunc != nil {
+			return f.UninstallReleaseContextFunc(ctx, namespace, releaseName, keepHistory, timeout)
+		}
+		if f.UninstallReleaseFunc != nil {
+			return f.UninstallReleaseFunc(namespace, releaseName, keepHistory, timeout)
+		}
 	}
+	namespace = c.resolveNamespace(namespace)
 	c.Log("Mock UninstallRelease called for release: %s", releaseName)
-	return "uninstalled", nil
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	unlock, err := c.lockRelease(ctx, namespace, releaseName, "uninstall")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	err = c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		if len(revs) == 0 {
+			return nil, &ReleaseError{Op: "uninstall", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+		}
+		last := revs[len(revs)-1]
+		if keepHistory && last.Info.Status == release.StatusUninstalled {
+			return nil, &ReleaseError{Op: "uninstall", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("already uninstalled")}
+		}
+		last.Info.Status = release.StatusUninstalling
+		last.Info.Description = "Deletion in progress (or silently failed)"
+		return revs, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.awaitOperation(ctx, timeout); err != nil {
+		return "", fmt.Errorf("uninstall of release %q interrupted, left in %s state: %w", releaseName, release.StatusUninstalling, err)
+	}
+
+	err = c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		if !keepHistory || len(revs) == 0 {
+			return nil, nil
+		}
+		last := revs[len(revs)-1]
+		last.Info.Status = release.StatusUninstalled
+		last.Info.Deleted = helmtime.Now()
+		last.Info.Description = "Uninstallation complete"
+		return revs, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("release \"%s\" uninstalled", releaseName), nil
 }
 
 func (c *Client) UpgradeRelease(namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.UpgradeReleaseFunc != nil {
-		return c.UpgradeReleaseFunc(namespace, releaseName, chartName, chartVersion, vals, wait, timeout, installIfMissing, force)
+	return c.UpgradeReleaseContext(context.Background(), namespace, releaseName, chartName, chartVersion, vals, wait, timeout, installIfMissing, force)
+}
+
+func (c *Client) UpgradeReleaseContext(ctx context.Context, namespace, releaseName, chartName string, chartVersion string, vals map[string]interface{}, wait bool, timeout time.Duration, installIfMissing bool, force bool) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.UpgradeReleaseContextFunc != nil {
+			return f.UpgradeReleaseContextFunc(ctx, namespace, releaseName, chartName, chartVersion, vals, wait, timeout, installIfMissing, force)
+		}
+		if f.UpgradeReleaseFunc != nil {
+			return f.UpgradeReleaseFunc(namespace, releaseName, chartName, chartVersion, vals, wait, timeout, installIfMissing, force)
+		}
+	}
+	return c.upgradeRelease(ctx, UpgradeOptions{
+		Namespace:    namespace,
+		ReleaseName:  releaseName,
+		ChartName:    chartName,
+		ChartVersion: chartVersion,
+		Values:       vals,
+		Wait:         wait,
+		Timeout:      timeout,
+		Install:      installIfMissing,
+		Force:        force,
+	})
+}
+
+func (c *Client) UpgradeReleaseWithOptions(opts UpgradeOptions) (*ReleaseInfo, error) {
+	return c.UpgradeReleaseWithOptionsContext(context.Background(), opts)
+}
+
+// UpgradeReleaseWithOptionsContext upgrades a release as described by opts.
+// With opts.DryRun set the new revision is rendered and returned but not recorded.
+func (c *Client) UpgradeReleaseWithOptionsContext(ctx context.Context, opts UpgradeOptions) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.UpgradeReleaseWithOptionsContextFunc != nil {
+			return f.UpgradeReleaseWithOptionsContextFunc(ctx, opts)
+		}
+		if f.UpgradeReleaseWithOptionsFunc != nil {
+			return f.UpgradeReleaseWithOptionsFunc(opts)
+		}
+	}
+	return c.upgradeRelease(ctx, opts)
+}
+
+func (c *Client) upgradeRelease(ctx context.Context, opts UpgradeOptions) (*ReleaseInfo, error) {
+	namespace := c.resolveNamespace(opts.Namespace)
+	releaseName := opts.ReleaseName
+	c.Log("Mock UpgradeRelease called for release: %s, chart: %s", releaseName, opts.ChartName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name cannot be empty for upgrade")
+	}
+	if opts.ChartName == "" {
+		return nil, fmt.Errorf("chart name cannot be empty")
+	}
+	if err := validateReleaseLabels(opts.Labels); err != nil {
+		return nil, err
+	}
+	// Hold the lock from the existence check on, so that concurrent upgrades
+	// with Install set cannot both decide to install.
+	if !opts.DryRun {
+		unlock, err := c.lockRelease(ctx, namespace, releaseName, "upgrade")
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	ch, err := c.loadChartRef(ctx, opts.ChartName, opts.ChartVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if last := c.releases().last(namespace, releaseName); last == nil || last.Info.Status == release.StatusUninstalled {
+		if opts.Install {
+			c.Log("Release %s not found in namespace %s, installing instead", releaseName, namespace)
+			return c.recordInstall(ctx, namespace, releaseName, ch, InstallOptions{
+				Namespace:    namespace,
+				ReleaseName:  releaseName,
+				ChartName:    opts.ChartName,
+				ChartVersion: opts.ChartVersion,
+				Values:       opts.Values,
+				Wait:         opts.Wait,
+				Timeout:      opts.Timeout,
+				DryRun:       opts.DryRun,
+				Labels:       opts.Labels,
+			})
+		}
+		return nil, &ReleaseError{Op: "upgrade", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("has no deployed releases: %w", ErrReleaseNotFound)}
+	}
+
+	// nextUpgrade checks the release can be upgraded and renders the revision
+	// that would follow the latest one.
+	nextUpgrade := func(revs []*release.Release, description string) (*release.Release, error) {
+		if len(revs) == 0 || revs[len(revs)-1].Info.Status == release.StatusUninstalled {
+			return nil, &ReleaseError{Op: "upgrade", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("has no deployed releases: %w", ErrReleaseNotFound)}
+		}
+		last := revs[len(revs)-1]
+		if last.Info.Status.IsPending() {
+			return nil, &ReleaseError{Op: "upgrade", Namespace: namespace, Name: releaseName, Err: ErrPendingOperation}
+		}
+		rel := newMockRelease(namespace, releaseName, last.Version+1, ch, opts.Values, description)
+		rel.Labels = mergeReleaseLabels(last.Labels, opts.Labels)
+		rel.Info.FirstDeployed = last.Info.FirstDeployed
+		rel.Info.Status = release.StatusPendingUpgrade
+		if err := c.renderInto(rel, true); err != nil {
+			return nil, err
+		}
+		return rel, nil
+	}
+
+	if opts.DryRun {
+		rel, err := nextUpgrade(c.releases().history(namespace, releaseName), "Dry run complete")
+		if err != nil {
+			return nil, err
+		}
+		return convertReleaseToInfo(rel), nil
+	}
+
+	var version int
+	err = c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		rel, err := nextUpgrade(revs, "Preparing upgrade")
+		if err != nil {
+			return nil, err
+		}
+		version = rel.Version
+		return append(revs, rel), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.awaitOperation(ctx, opts.Timeout); err != nil {
+		return nil, fmt.Errorf("upgrade of release %q interrupted, left in %s state: %w", releaseName, release.StatusPendingUpgrade, err)
+	}
+	return c.finalizeRevision(namespace, releaseName, version, "Upgrade complete")
+}
+
+func (c *Client) RollbackRelease(namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error) {
+	return c.RollbackReleaseContext(context.Background(), namespace, releaseName, revision, wait, timeout, force)
+}
+
+// RollbackReleaseContext rolls a release back to a previous revision, recording
+// the result as a new revision. A revision of 0 rolls back to the one before
+// the current revision.
+func (c *Client) RollbackReleaseContext(ctx context.Context, namespace, releaseName string, revision int, wait bool, timeout time.Duration, force bool) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.RollbackReleaseContextFunc != nil {
+			return f.RollbackReleaseContextFunc(ctx, namespace, releaseName, revision, wait, timeout, force)
+		}
+		if f.RollbackReleaseFunc != nil {
+			return f.RollbackReleaseFunc(namespace, releaseName, revision, wait, timeout, force)
+		}
+	}
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock RollbackRelease called for release: %s, revision: %d", releaseName, revision)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name cannot be empty for rollback")
+	}
+	if revision < 0 {
+		return nil, fmt.Errorf("rollback: invalid revision %d: must be 0 (previous) or a revision number: %w", revision, ErrInvalidValues)
+	}
+	unlock, err := c.lockRelease(ctx, namespace, releaseName, "rollback")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Like Helm, record the target revision as pending-rollback first and only
+	// supersede the current revision once the rollback has been applied.
+	var newVersion int
+	var description string
+	err = c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		if len(revs) == 0 {
+			return nil, &ReleaseError{Op: "rollback", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+		}
+		last := revs[len(revs)-1]
+		target := revision
+		if target == 0 {
+			target = last.Version - 1
+		}
+		if target < 1 {
+			return nil, fmt.Errorf("rollback: release %q has no revision to roll back to", releaseName)
+		}
+		var prev *release.Release
+		for _, rel := range revs {
+			if rel.Version == target {
+				prev = rel
+				break
+			}
+		}
+		if prev == nil {
+			return nil, &ReleaseError{Op: "rollback", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("no revision %d: %w", target, ErrReleaseNotFound)}
+		}
+
+		description = fmt.Sprintf("Rollback to %d", target)
+		rel := newMockRelease(namespace, releaseName, last.Version+1, prev.Chart, prev.Config, description)
+		rel.Manifest = prev.Manifest
+		rel.Hooks = prev.Hooks
+		rel.Labels = copyLabels(prev.Labels)
+		rel.Info.Notes = prev.Info.Notes
+		rel.Info.FirstDeployed = last.Info.FirstDeployed
+		rel.Info.Status = release.StatusPendingRollback
+		newVersion = rel.Version
+		return append(revs, rel), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.awaitOperation(ctx, timeout); err != nil {
+		return nil, fmt.Errorf("rollback of release %q interrupted, left in %s state: %w", releaseName, release.StatusPendingRollback, err)
 	}
-	c.Log("Mock UpgradeRelease called for release: %s, chart: %s", releaseName, chartName)
-	return &ReleaseInfo{Name: releaseName, Namespace: namespace, Status: release.StatusDeployed}, nil
+	return c.finalizeRevision(namespace, releaseName, newVersion, description)
 }
 
 func (c *Client) GetReleaseDetails(namespace, releaseName string) (*ReleaseInfo, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.GetReleaseDetailsFunc != nil {
-		return c.GetReleaseDetailsFunc(namespace, releaseName)
+	return c.GetReleaseDetailsContext(context.Background(), namespace, releaseName)
+}
+
+func (c *Client) GetReleaseDetailsContext(ctx context.Context, namespace, releaseName string) (*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.GetReleaseDetailsContextFunc != nil {
+			return f.GetReleaseDetailsContextFunc(ctx, namespace, releaseName)
+		}
+		if f.GetReleaseDetailsFunc != nil {
+			return f.GetReleaseDetailsFunc(namespace, releaseName)
+		}
 	}
+	namespace = c.resolveNamespace(namespace)
 	c.Log("Mock GetReleaseDetails called for release: %s", releaseName)
-	if releaseName == "non-existent-release" {
-		return nil, fmt.Errorf("release: not found")
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return &ReleaseInfo{Name: releaseName, Namespace: namespace, Status: release.StatusDeployed}, nil
+	last := c.releases().last(namespace, releaseName)
+	if last == nil {
+		return nil, &ReleaseError{Op: "get", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	return convertReleaseToInfo(last), nil
 }
 
 func (c *Client) GetReleaseHistory(namespace, releaseName string) ([]*ReleaseInfo, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.GetReleaseHistoryFunc != nil {
-		return c.GetReleaseHistoryFunc(namespace, releaseName)
+	return c.GetReleaseHistoryContext(context.Background(), namespace, releaseName)
+}
+
+func (c *Client) GetReleaseHistoryContext(ctx context.Context, namespace, releaseName string) ([]*ReleaseInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.GetReleaseHistoryContextFunc != nil {
+			return f.GetReleaseHistoryContextFunc(ctx, namespace, releaseName)
+		}
+		if f.GetReleaseHistoryFunc != nil {
+			return f.GetReleaseHistoryFunc(namespace, releaseName)
+		}
 	}
+	namespace = c.resolveNamespace(namespace)
 	c.Log("Mock GetReleaseHistory called for release: %s", releaseName)
-	return []*ReleaseInfo{{Name: releaseName, Namespace: namespace, Status: release.StatusDeployed}}, nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	revs := c.releases().history(namespace, releaseName)
+	if len(revs) == 0 {
+		return nil, &ReleaseError{Op: "get", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	infos := make([]*ReleaseInfo, 0, len(revs))
+	for _, rel := range revs {
+		infos = append(infos, convertReleaseToInfo(rel))
+	}
+	return infos, nil
 }
 
-func (c *Client) AddRepository(name, url, username, password string, passCredentials bool) error {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.AddRepositoryFunc != nil {
-		return c.AddRepositoryFunc(name, url, username, password, passCredentials)
-	}
-	c.Log("Mock AddRepository called for repo: %s", name)
-	return nil
+func (c *Client) GetReleaseValues(namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error) {
+	return c.GetReleaseValuesContext(context.Background(), namespace, releaseName, revision, allValues)
 }
 
-func (c *Client) UpdateRepositories() error {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.UpdateRepositoriesFunc != nil {
-		return c.UpdateRepositoriesFunc()
+// GetReleaseValuesContext returns the values of a release revision, like
+// 'helm get values'. revision 0 selects the latest revision. Without
+// allValues only the user-supplied values are returned; with it they are
+// coalesced over the chart defaults the way Helm does when rendering: null
+// user values delete defaults and globals propagate into subcharts.
+func (c *Client) GetReleaseValuesContext(ctx context.Context, namespace, releaseName string, revision int, allValues bool) (map[string]interface{}, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.GetReleaseValuesContextFunc != nil {
+			return f.GetReleaseValuesContextFunc(ctx, namespace, releaseName, revision, allValues)
+		}
+		if f.GetReleaseValuesFunc != nil {
+			return f.GetReleaseValuesFunc(namespace, releaseName, revision, allValues)
+		}
 	}
-	c.Log("Mock UpdateRepositories called")
-	return nil
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock GetReleaseValues called for release: %s, revision: %d, all: %t", releaseName, revision, allValues)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if revision < 0 {
+		return nil, fmt.Errorf("invalid revision %d: must be 0 (latest) or greater", revision)
+	}
+
+	revs := c.releases().history(namespace, releaseName)
+	if len(revs) == 0 {
+		return nil, &ReleaseError{Op: "get", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	rel := revs[len(revs)-1]
+	if revision > 0 {
+		rel = nil
+		for _, r := range revs {
+			if r.Version == revision {
+				rel = r
+				break
+			}
+		}
+		if rel == nil {
+			return nil, &ReleaseError{Op: "get values", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("no revision %d: %w", revision, ErrReleaseNotFound)}
+		}
+	}
+	if !allValues {
+		if rel.Config == nil {
+			return map[string]interface{}{}, nil
+		}
+		return rel.Config, nil
+	}
+	return computeValues(rel.Chart, rel.Config)
 }
 
-func (c *Client) EnsureChart(chartName, version string) (string, error) {
-	if c.MockHelmClientFields != nil && c.MockHelmClientFields.EnsureChartFunc != nil {
-		return c.EnsureChartFunc(chartName, version)
+func (c *Client) GetReleaseResources(namespace, releaseName string) ([]*ReleaseResource, error) {
+	return c.GetReleaseResourcesContext(context.Background(), namespace, releaseName)
+}
+
+// GetReleaseResourcesContext lists the Kubernetes objects in the manifest of
+// the latest revision of a release and reports the health of each, read
+// through the auth checker's clientset. Deployments, StatefulSets,
+// DaemonSets, Jobs, Services and PersistentVolumeClaims are checked for
+// readiness; other kinds are reported with ResourceUnknown health.
+func (c *Client) GetReleaseResourcesContext(ctx context.Context, namespace, releaseName string) ([]*ReleaseResource, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.GetReleaseResourcesContextFunc != nil {
+			return f.GetReleaseResourcesContextFunc(ctx, namespace, releaseName)
+		}
+		if f.GetReleaseResourcesFunc != nil {
+			return f.GetReleaseResourcesFunc(namespace, releaseName)
+		}
+	}
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock GetReleaseResources called for release: %s", releaseName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rel := c.releases().last(namespace, releaseName)
+	if rel == nil {
+		return nil, &ReleaseError{Op: "get resources", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	resources, err := releaseResources(rel.Manifest, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("release %q: %w", releaseName, err)
+	}
+	if len(resources) == 0 {
+		return resources, nil
+	}
+	if c.authChecker == nil {
+		return nil, fmt.Errorf("cannot check resources of release %q: no Kubernetes auth checker configured", releaseName)
+	}
+	clientset, err := c.authChecker.GetClientset()
+	if err != nil {
+		return nil, fmt.Errorf("cannot check resources of release %q: %w", releaseName, err)
+	}
+	for _, r := range resources {
+		if err := checkResourceHealth(ctx, clientset, r); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+func (c *Client) AddRepository(name, url, username, password string, passCredentials bool) error {
+	return c.AddRepositoryContext(context.Background(), name, url, username, password, passCredentials)
+}
+
+func (c *Client) AddRepositoryContext(ctx context.Context, name, url, username, password string, passCredentials bool) error {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.AddRepositoryContextFunc != nil {
+			return f.AddRepositoryContextFunc(ctx, name, url, username, password, passCredentials)
+		}
+		if f.AddRepositoryFunc != nil {
+			return f.AddRepositoryFunc(name, url, username, password, passCredentials)
+		}
+	}
+	c.Log("Mock AddRepository called for repo: %s", name)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if name == "" || url == "" {
+		return fmt.Errorf("repository name and URL are required")
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("repository name (%s) contains '/', please specify a different name without '/'", name)
+	}
+
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return err
+	}
+	entry := &repo.Entry{Name: name, URL: strings.TrimSuffix(url, "/"), Username: username, Password: password, PassCredentialsAll: passCredentials}
+	if existing := f.Get(name); existing != nil {
+		if *existing == *entry {
+			c.Log("Repository %s already exists with the same configuration, skipping", name)
+			return nil
+		}
+		return fmt.Errorf("repository name (%s) already exists, please specify a different name", name)
+	}
+	if _, err := c.downloadIndex(ctx, entry); err != nil {
+		return err
+	}
+	f.Add(entry)
+	return c.writeRepoFile(f)
+}
+
+func (c *Client) UpdateRepositories() error {
+	return c.UpdateRepositoriesContext(context.Background())
+}
+
+func (c *Client) UpdateRepositoriesContext(ctx context.Context) error {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.UpdateRepositoriesContextFunc != nil {
+			return f.UpdateRepositoriesContextFunc(ctx)
+		}
+		if f.UpdateRepositoriesFunc != nil {
+			return f.UpdateRepositoriesFunc()
+		}
+	}
+	c.Log("Mock UpdateRepositories called")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return err
+	}
+	if len(f.Repositories) == 0 {
+		return fmt.Errorf("no repositories found. You must add one before updating")
+	}
+	var failed []string
+	var errs []error
+	for _, entry := range f.Repositories {
+		if _, err := c.downloadIndex(ctx, entry); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.Log("Unable to get an update from the %q chart repository (%s): %v", entry.Name, entry.URL, err)
+			failed = append(failed, entry.URL)
+			errs = append(errs, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to update the following repositories: %v: %w", failed, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c *Client) EnsureChart(chartName, version string) (string, error) {
+	return c.EnsureChartContext(context.Background(), chartName, version)
+}
+
+func (c *Client) EnsureChartContext(ctx context.Context, chartName, version string) (string, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.EnsureChartContextFunc != nil {
+			return f.EnsureChartContextFunc(ctx, chartName, version)
+		}
+		if f.EnsureChartFunc != nil {
+			return f.EnsureChartFunc(chartName, version)
+		}
+	}
+	c.Log("Mock EnsureChart called for chart: %s, version: %s", chartName, version)
+	return c.ensureChart(ctx, chartName, version)
+}
+
+// ensureChart returns a local path for chartName: local paths are returned as
+// is, oci:// references, archive URLs and <repo>/<chart> references are
+// downloaded into the repository cache. version may be a semver constraint.
+// With VerifyKeyring set the chart's provenance is checked as well.
+func (c *Client) ensureChart(ctx context.Context, chartName, version string) (string, error) {
+	chartPath, err := c.locateChart(ctx, chartName, version)
+	if err != nil {
+		return "", err
+	}
+	if err := c.verifyChart(chartPath); err != nil {
+		return "", err
+	}
+	return chartPath, nil
+}
+
+func (c *Client) locateChart(ctx context.Context, chartName, version string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if chartName == "" {
+		return "", fmt.Errorf("chart name cannot be empty")
+	}
+	if _, err := os.Stat(chartName); err == nil {
+		return chartName, nil
+	}
+
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	if registry.IsOCI(chartName) {
+		return c.pullOCIChart(ctx, chartName, version)
+	}
+	if strings.HasPrefix(chartName, "http://") || strings.HasPrefix(chartName, "https://") || strings.HasPrefix(chartName, "file://") {
+		return c.downloadArchive(ctx, chartName)
+	}
+
+	repoName, name, ok := strings.Cut(chartName, "/")
+	if !ok {
+		return "", fmt.Errorf("chart %q: %w: use <repo>/<chart> or a local chart path", chartName, ErrChartNotFound)
+	}
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return "", err
+	}
+	entry := f.Get(repoName)
+	if entry == nil {
+		return "", fmt.Errorf("chart %q: repo %s not found: %w", chartName, repoName, ErrChartNotFound)
+	}
+	idx, err := c.loadIndex(ctx, entry)
+	if err != nil {
+		return "", err
+	}
+	cv, err := idx.Get(name, version)
+	if err != nil {
+		return "", fmt.Errorf("chart %q version %q not found in repository %s: %w: %w", name, version, repoName, ErrChartNotFound, err)
+	}
+	return c.downloadChart(ctx, entry, cv)
+}
+
+func (c *Client) RegistryLogin(host, username, password string, insecure bool) error {
+	return c.RegistryLoginContext(context.Background(), host, username, password, insecure)
+}
+
+// RegistryLoginContext verifies the credentials against an OCI registry and
+// stores them in the registry config file. insecure allows plain HTTP and
+// unverified TLS for the login.
+func (c *Client) RegistryLoginContext(ctx context.Context, host, username, password string, insecure bool) error {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.RegistryLoginContextFunc != nil {
+			return f.RegistryLoginContextFunc(ctx, host, username, password, insecure)
+		}
+		if f.RegistryLoginFunc != nil {
+			return f.RegistryLoginFunc(host, username, password, insecure)
+		}
+	}
+	c.Log("Mock RegistryLogin called for host: %s", host)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("registry host cannot be empty")
+	}
+	rc, err := c.newRegistryClient()
+	if err != nil {
+		return err
+	}
+	if err := rc.Login(host, registry.LoginOptBasicAuth(username, password), registry.LoginOptInsecure(insecure)); err != nil {
+		return fmt.Errorf("login to registry %s failed: %w", host, err)
+	}
+	return nil
+}
+
+func (c *Client) RegistryLogout(host string) error {
+	return c.RegistryLogoutContext(context.Background(), host)
+}
+
+func (c *Client) RegistryLogoutContext(ctx context.Context, host string) error {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.RegistryLogoutContextFunc != nil {
+			return f.RegistryLogoutContextFunc(ctx, host)
+		}
+		if f.RegistryLogoutFunc != nil {
+			return f.RegistryLogoutFunc(host)
+		}
+	}
+	c.Log("Mock RegistryLogout called for host: %s", host)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rc, err := c.newRegistryClient()
+	if err != nil {
+		return err
+	}
+	if err := rc.Logout(host); err != nil {
+		return fmt.Errorf("logout from registry %s failed: %w", host, err)
+	}
+	return nil
+}
+
+func (c *Client) PushChart(chartPath, ociRef string) (string, error) {
+	return c.PushChartContext(context.Background(), chartPath, ociRef)
+}
+
+// PushChartContext uploads a chart directory or archive to an OCI registry
+// under ociRef (for example oci://registry.example.com/charts), tagged with
+// the chart version, and returns the full reference it was pushed to.
+func (c *Client) PushChartContext(ctx context.Context, chartPath, ociRef string) (string, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.PushChartContextFunc != nil {
+			return f.PushChartContextFunc(ctx, chartPath, ociRef)
+		}
+		if f.PushChartFunc != nil {
+			return f.PushChartFunc(chartPath, ociRef)
+		}
+	}
+	c.Log("Mock PushChart called for chart: %s, ref: %s", chartPath, ociRef)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !registry.IsOCI(ociRef) {
+		return "", fmt.Errorf("push destination %q must be an %s:// reference", ociRef, registry.OCIScheme)
+	}
+	data, err := packageForPush(chartPath)
+	if err != nil {
+		return "", err
+	}
+	ch, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart %s: %w", chartPath, err)
+	}
+	rc, err := c.newRegistryClient()
+	if err != nil {
+		return "", err
+	}
+	ref := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(strings.TrimPrefix(ociRef, registry.OCIScheme+"://"), "/"), ch.Metadata.Name, ch.Metadata.Version)
+	result, err := rc.Push(data, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to push chart %s to %s: %w", chartPath, ociRef, err)
+	}
+	return registry.OCIScheme + "://" + result.Ref, nil
+}
+
+func (c *Client) UpdateDependencies(chartPath string) ([]*ChartDependency, error) {
+	return c.UpdateDependenciesContext(context.Background(), chartPath)
+}
+
+// UpdateDependenciesContext resolves the dependencies in the Chart.yaml of a
+// chart directory to the newest versions their constraints allow, vendors
+// them into charts/ and records them in Chart.lock, like 'helm dependency
+// update'. Repositories are referred to by URL, "@name" or "alias:name";
+// file:// dependencies are packaged from the local directory.
+func (c *Client) UpdateDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.UpdateDependenciesContextFunc != nil {
+			return f.UpdateDependenciesContextFunc(ctx, chartPath)
+		}
+		if f.UpdateDependenciesFunc != nil {
+			return f.UpdateDependenciesFunc(chartPath)
+		}
+	}
+	c.Log("Mock UpdateDependencies called for chart: %s", chartPath)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	meta, lock, _, err := readChartDependencies(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.vendorChartDependencies(ctx, chartPath, meta, nil, lock)
+}
+
+func (c *Client) BuildDependencies(chartPath string) ([]*ChartDependency, error) {
+	return c.BuildDependenciesContext(context.Background(), chartPath)
+}
+
+// BuildDependenciesContext vendors the dependency versions pinned in
+// Chart.lock into charts/, like 'helm dependency build'. Without a Chart.lock
+// it updates the dependencies instead; a Chart.lock that no longer matches
+// Chart.yaml is an error.
+func (c *Client) BuildDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.BuildDependenciesContextFunc != nil {
+			return f.BuildDependenciesContextFunc(ctx, chartPath)
+		}
+		if f.BuildDependenciesFunc != nil {
+			return f.BuildDependenciesFunc(chartPath)
+		}
+	}
+	c.Log("Mock BuildDependencies called for chart: %s", chartPath)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	meta, lock, stale, err := readChartDependencies(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		return nil, fmt.Errorf("the %s of chart %s is out of sync with the dependencies in Chart.yaml: update the dependencies", lockfileName, chartPath)
+	}
+	if lock == nil {
+		c.Log("No %s found for chart %s, updating dependencies", lockfileName, chartPath)
+	}
+	return c.vendorChartDependencies(ctx, chartPath, meta, lock, lock)
+}
+
+// vendorChartDependencies resolves the dependencies of meta, pinned to
+// pinned when it is set, vendors them and writes Chart.lock unless it
+// already matches old.
+func (c *Client) vendorChartDependencies(ctx context.Context, chartPath string, meta *chart.Metadata, pinned, old *chart.Lock) ([]*ChartDependency, error) {
+	if len(meta.Dependencies) == 0 {
+		return []*ChartDependency{}, nil
+	}
+	resolved, err := c.resolveDependencies(ctx, chartPath, meta.Dependencies, pinned)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := vendorDependencies(chartPath, resolved); err != nil {
+		return nil, err
+	}
+	if _, err := writeLockfile(chartPath, meta.Dependencies, resolved, old); err != nil {
+		return nil, err
+	}
+	return vendoredResults(resolved), nil
+}
+
+func (c *Client) ListDependencies(chartPath string) ([]*ChartDependency, error) {
+	return c.ListDependenciesContext(context.Background(), chartPath)
+}
+
+// ListDependenciesContext reports each dependency in the Chart.yaml of a
+// chart directory as ok, missing from charts/, vendored at the wrong version,
+// or outdated when its repository has a newer version the constraint allows.
+// Nothing is downloaded except repository indexes that were never fetched.
+func (c *Client) ListDependenciesContext(ctx context.Context, chartPath string) ([]*ChartDependency, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.ListDependenciesContextFunc != nil {
+			return f.ListDependenciesContextFunc(ctx, chartPath)
+		}
+		if f.ListDependenciesFunc != nil {
+			return f.ListDependenciesFunc(chartPath)
+		}
+	}
+	c.Log("Mock ListDependencies called for chart: %s", chartPath)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	meta, lock, _, err := readChartDependencies(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := vendoredCharts(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	results := make([]*ChartDependency, 0, len(meta.Dependencies))
+	for _, dep := range meta.Dependencies {
+		d := &ChartDependency{
+			Name:       dep.Name,
+			Alias:      dep.Alias,
+			Version:    dep.Version,
+			Repository: dep.Repository,
+			Locked:     lockedVersion(lock, dep),
+		}
+		d.Vendored = pickVendored(existing[dep.Name], dep.Version, d.Locked)
+		d.Latest = c.latestDependencyVersion(ctx, chartPath, dep)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d.Status = dependencyStatus(d)
+		results = append(results, d)
+	}
+	return results, nil
+}
+
+func (c *Client) ListRepositories() ([]*RepositoryInfo, error) {
+	return c.ListRepositoriesContext(context.Background())
+}
+
+func (c *Client) ListRepositoriesContext(ctx context.Context) ([]*RepositoryInfo, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.ListRepositoriesContextFunc != nil {
+			return f.ListRepositoriesContextFunc(ctx)
+		}
+		if f.ListRepositoriesFunc != nil {
+			return f.ListRepositoriesFunc()
+		}
+	}
+	c.Log("Mock ListRepositories called")
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*RepositoryInfo, 0, len(f.Repositories))
+	for _, entry := range f.Repositories {
+		infos = append(infos, &RepositoryInfo{Name: entry.Name, URL: entry.URL})
+	}
+	return infos, nil
+}
+
+func (c *Client) RemoveRepository(name string) error {
+	return c.RemoveRepositoryContext(context.Background(), name)
+}
+
+// RemoveRepositoryContext removes a repository from the repositories file and
+// drops its cached index.
+func (c *Client) RemoveRepositoryContext(ctx context.Context, name string) error {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.RemoveRepositoryContextFunc != nil {
+			return f.RemoveRepositoryContextFunc(ctx, name)
+		}
+		if f.RemoveRepositoryFunc != nil {
+			return f.RemoveRepositoryFunc(name)
+		}
+	}
+	c.Log("Mock RemoveRepository called for repo: %s", name)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return err
+	}
+	if !f.Remove(name) {
+		return fmt.Errorf("no repo named %q found", name)
+	}
+	if err := c.writeRepoFile(f); err != nil {
+		return err
+	}
+	if err := os.Remove(c.indexCachePath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cached index for repository %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *Client) SearchCharts(keyword, versionConstraint string) ([]*ChartSearchResult, error) {
+	return c.SearchChartsContext(context.Background(), keyword, versionConstraint)
+}
+
+// SearchChartsContext searches the cached indexes of all configured
+// repositories. keyword is matched case-insensitively against the chart name,
+// description and keywords; for every matching chart the newest version
+// satisfying versionConstraint (latest stable when empty) is returned.
+func (c *Client) SearchChartsContext(ctx context.Context, keyword, versionConstraint string) ([]*ChartSearchResult, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.SearchChartsContextFunc != nil {
+			return f.SearchChartsContextFunc(ctx, keyword, versionConstraint)
+		}
+		if f.SearchChartsFunc != nil {
+			return f.SearchChartsFunc(keyword, versionConstraint)
+		}
+	}
+	c.Log("Mock SearchCharts called for keyword: %s, version: %s", keyword, versionConstraint)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var constraint *semver.Constraints
+	if versionConstraint != "" {
+		var err error
+		if constraint, err = semver.NewConstraint(versionConstraint); err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", versionConstraint, err)
+		}
+	}
+
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return nil, err
+	}
+	results := []*ChartSearchResult{}
+	for _, entry := range f.Repositories {
+		idx, err := c.loadIndex(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, searchIndex(entry.Name, idx, keyword, constraint)...)
+	}
+	sortSearchResults(results)
+	return results, nil
+}
+
+func (c *Client) DiffRelease(namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error) {
+	return c.DiffReleaseContext(context.Background(), namespace, releaseName, chartName, version, vals)
+}
+
+// DiffReleaseContext renders chartName at version with vals as the next
+// revision of a release and compares it, object by object, with the manifest
+// of the currently deployed revision. Nothing is recorded.
+func (c *Client) DiffReleaseContext(ctx context.Context, namespace, releaseName, chartName, version string, vals map[string]interface{}) (*ReleaseDiff, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.DiffReleaseContextFunc != nil {
+			return f.DiffReleaseContextFunc(ctx, namespace, releaseName, chartName, version, vals)
+		}
+		if f.DiffReleaseFunc != nil {
+			return f.DiffReleaseFunc(namespace, releaseName, chartName, version, vals)
+		}
+	}
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock DiffRelease called for release: %s, chart: %s", releaseName, chartName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name cannot be empty for diff")
+	}
+	if chartName == "" {
+		return nil, fmt.Errorf("chart name cannot be empty")
+	}
+
+	revs := c.releases().history(namespace, releaseName)
+	if len(revs) == 0 {
+		return nil, &ReleaseError{Op: "diff", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	var current *release.Release
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].Info.Status == release.StatusDeployed {
+			current = revs[i]
+			break
+		}
+	}
+	if current == nil {
+		return nil, &ReleaseError{Op: "diff", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("has no deployed releases")}
+	}
+
+	ch, err := c.loadChartRef(ctx, chartName, version)
+	if err != nil {
+		return nil, err
+	}
+	target := newMockRelease(namespace, releaseName, revs[len(revs)-1].Version+1, ch, vals, "Dry run complete")
+	if err := c.renderInto(target, true); err != nil {
+		return nil, err
+	}
+	resources, err := diffManifests(current.Manifest, target.Manifest, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("diff: release %q: %w", releaseName, err)
+	}
+	return &ReleaseDiff{
+		Name:            releaseName,
+		Namespace:       namespace,
+		CurrentRevision: current.Version,
+		CurrentChart:    current.Chart.Metadata.Name + "-" + current.Chart.Metadata.Version,
+		TargetChart:     ch.Metadata.Name + "-" + ch.Metadata.Version,
+		Resources:       resources,
+	}, nil
+}
+
+func (c *Client) RunReleaseTests(namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error) {
+	return c.RunReleaseTestsContext(context.Background(), namespace, releaseName, timeout, filter)
+}
+
+// RunReleaseTestsContext runs the test hooks of a release's latest revision
+// one at a time, like 'helm test', and records each run on the revision. See
+// selectTestHooks for filter. A failing test is reported through its result,
+// not as an error; an error means the tests could not be run to completion,
+// in which case the results gathered so far are returned with it.
+func (c *Client) RunReleaseTestsContext(ctx context.Context, namespace, releaseName string, timeout time.Duration, filter []string) ([]*ReleaseTestResult, error) {
+	if f := c.MockHelmClientFields; f != nil {
+		if f.RunReleaseTestsContextFunc != nil {
+			return f.RunReleaseTestsContextFunc(ctx, namespace, releaseName, timeout, filter)
+		}
+		if f.RunReleaseTestsFunc != nil {
+			return f.RunReleaseTestsFunc(namespace, releaseName, timeout, filter)
+		}
+	}
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock RunReleaseTests called for release: %s, filter: %v", releaseName, filter)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name cannot be empty for test")
+	}
+
+	rel := c.releases().last(namespace, releaseName)
+	if rel == nil {
+		return nil, &ReleaseError{Op: "test", Namespace: namespace, Name: releaseName, Err: ErrReleaseNotFound}
+	}
+	if rel.Info.Status.IsPending() {
+		return nil, &ReleaseError{Op: "test", Namespace: namespace, Name: releaseName, Err: fmt.Errorf("%w (%s)", ErrPendingOperation, rel.Info.Status)}
+	}
+	hooks, err := selectTestHooks(rel.Hooks, filter)
+	if err != nil {
+		return nil, fmt.Errorf("test: release %q: %w", releaseName, err)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	results := []*ReleaseTestResult{}
+	var runErr error
+	for _, h := range hooks {
+		res, err := c.runTestHook(ctx, h)
+		results = append(results, res)
+		if err != nil {
+			runErr = fmt.Errorf("test: release %q: test %s did not complete: %w", releaseName, h.Name, err)
+			break
+		}
+	}
+	if err := c.recordTestRuns(namespace, releaseName, rel.Version, results); err != nil && runErr == nil {
+		runErr = err
+	}
+	return results, runErr
+}
+
+// WatchRelease streams progress events for a release until ctx is done, at
+// which point the channel is closed. The first events describe the current
+// revision, if any; a release that does not exist yet is reported once it is
+// installed. Hook and readiness events are derived from the rendered release,
+// since no workload actually runs.
+func (c *Client) WatchRelease(ctx context.Context, namespace, releaseName string) (<-chan ReleaseEvent, error) {
+	if f := c.MockHelmClientFields; f != nil && f.WatchReleaseFunc != nil {
+		return f.WatchReleaseFunc(ctx, namespace, releaseName)
+	}
+	namespace = c.resolveNamespace(namespace)
+	c.Log("Mock WatchRelease called for release: %s", releaseName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name cannot be empty for watch")
+	}
+
+	w, current, stop := c.releases().watch(namespace, releaseName)
+	out := make(chan ReleaseEvent, 16)
+	go func() {
+		defer close(out)
+		defer stop()
+		send := func(events []ReleaseEvent) bool {
+			for _, ev := range events {
+				select {
+				case <-ctx.Done():
+					return false
+				case out <- ev:
+				}
+			}
+			return true
+		}
+
+		prev := latestRevision(current)
+		if !send(releaseEvents(nil, prev)) {
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			}
+			for _, snapshot := range w.drain() {
+				cur := latestRevision(snapshot)
+				if !send(releaseEvents(prev, cur)) {
+					return
+				}
+				prev = cur
+			}
+		}
+	}()
+	return out, nil
+}
+
+// --- Helpers backing the in-memory release store ---
+
+// awaitOperation stands in for the time Helm spends applying resources. It
+// waits for OperationDelay, bounded by timeout, and returns the context error
+// if ctx is cancelled or the deadline passes first.
+func (c *Client) awaitOperation(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if c.OperationDelay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(c.OperationDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// lockRelease claims a release for op until the returned func is called,
+// waiting at most OperationLockTimeout for an operation already running.
+func (c *Client) lockRelease(ctx context.Context, namespace, releaseName, op string) (func(), error) {
+	return c.releases().lock(ctx, namespace, releaseName, op, c.OperationLockTimeout)
+}
+
+// finalizeRevision marks a pending revision as deployed and supersedes any
+// previously deployed revision of the same release.
+func (c *Client) finalizeRevision(namespace, releaseName string, version int, description string) (*ReleaseInfo, error) {
+	var info *ReleaseInfo
+	err := c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		for _, rel := range revs {
+			switch {
+			case rel.Version == version:
+				rel.Info.Status = release.StatusDeployed
+				rel.Info.Description = description
+				rel.Info.LastDeployed = helmtime.Now()
+				info = convertReleaseToInfo(cloneRelease(rel))
+			case rel.Info.Status == release.StatusDeployed:
+				rel.Info.Status = release.StatusSuperseded
+				rel.Info.Description = "Superseded"
+			}
+		}
+		if info == nil {
+			return nil, fmt.Errorf("revision %d of release %q in namespace %q disappeared before it was deployed", version, releaseName, namespace)
+		}
+		return revs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// releases returns the client's release store, creating it on first use so
+// that a zero-value Client is still usable.
+func (c *Client) releases() *releaseStore {
+	c.storeOnce.Do(func() {
+		if c.store == nil {
+			c.store = newReleaseStore()
+		}
+	})
+	return c.store
+}
+
+// resolveNamespace falls back to the client's default namespace when none is given.
+func (c *Client) resolveNamespace(namespace string) string {
+	if namespace == "" && c.settings != nil {
+		return c.settings.Namespace()
+	}
+	return namespace
+}
+
+// filterLatestReleases keeps only the highest revision of each release.
+func filterLatestReleases(rels []*release.Release) []*release.Release {
+	latest := make(map[string]*release.Release)
+	for _, rel := range rels {
+		key := storeKey(rel.Namespace, rel.Name)
+		if cur, ok := latest[key]; ok && cur.Version > rel.Version {
+			continue
+		}
+		latest[key] = rel
+	}
+	out := make([]*release.Release, 0, len(latest))
+	for _, rel := range latest {
+		out = append(out, rel)
+	}
+	return out
+}
+
+// sortReleases orders releases in place. Ties are broken by namespace, name
+// and revision so the result is stable across calls.
+func sortReleases(rels []*release.Release, sortBy ListSortBy, reverse bool) error {
+	byName := func(a, b *release.Release) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Version < b.Version
+	}
+	var less func(a, b *release.Release) bool
+	switch sortBy {
+	case "", ListSortByName:
+		less = byName
+	case ListSortByDate:
+		less = func(a, b *release.Release) bool {
+			if !a.Info.LastDeployed.Equal(b.Info.LastDeployed) {
+				return a.Info.LastDeployed.After(b.Info.LastDeployed)
+			}
+			return byName(a, b)
+		}
+	case ListSortByRevision:
+		less = func(a, b *release.Release) bool {
+			if a.Version != b.Version {
+				return a.Version > b.Version
+			}
+			return byName(a, b)
+		}
+	default:
+		return fmt.Errorf("unsupported sort field %q (expected name, date or revision)", sortBy)
+	}
+	sort.SliceStable(rels, func(i, j int) bool {
+		if reverse {
+			return less(rels[j], rels[i])
+		}
+		return less(rels[i], rels[j])
+	})
+	return nil
+}
+
+// mockChart builds chart metadata from a chart reference such as "repo/chart",
+// "./path/to/chart" or "https://example.com/chart-1.0.0.tgz".
+func mockChart(chartName, chartVersion string) *chart.Chart {
+	name := strings.TrimSuffix(path.Base(filepath.ToSlash(chartName)), ".tgz")
+	if chartVersion == "" {
+		chartVersion = "0.1.0"
+	}
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       name,
+			Version:    chartVersion,
+		},
+	}
+}
+
+// newMockRelease builds a deployed release record for the given revision.
+func newMockRelease(namespace, releaseName string, version int, ch *chart.Chart, vals map[string]interface{}, description string) *release.Release {
+	now := helmtime.Now()
+	return &release.Release{
+		Name:      releaseName,
+		Namespace: namespace,
+		Version:   version,
+		Chart:     ch,
+		Config:    copyValues(vals),
+		Info: &release.Info{
+			FirstDeployed: now,
+			LastDeployed:  now,
+			Status:        release.StatusDeployed,
+			Description:   description,
+		},
 	}
-	c.Log("Mock EnsureChart called for chart: %s, version: %s", chartName, version)
-	return "/mocked/chart/path", nil
 }
 
 // --- Mock implementation for non-interface methods called by tests ---
@@ -269,6 +1968,7 @@ func convertReleaseToInfo(rel *release.Release) *ReleaseInfo {
 		Revision:  rel.Version,
 		Values:    rel.Config,
 		Manifest:  rel.Manifest,
+		Labels:    rel.Labels,
 	}
 	if rel.Info != nil {
 		info.Status = rel.Info.Status
@@ -2,11 +2,15 @@ package helmutils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,21 +18,32 @@ import (
 
 	helmtime "helm.sh/helm/v3/pkg/time"
 
+	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 // MockLogger is a simple logger for tests that stores log messages.
-var mockLogMessages []string
+var (
+	mockLogMessages []string
+	mockLogMu       sync.Mutex
+)
 
 func mockLogger(format string, v ...interface{}) {
+	mockLogMu.Lock()
+	defer mockLogMu.Unlock()
 	mockLogMessages = append(mockLogMessages, fmt.Sprintf(format, v...))
 }
 
 func resetMockLogger() {
+	mockLogMu.Lock()
+	defer mockLogMu.Unlock()
 	mockLogMessages = []string{}
 }
 
@@ -40,6 +55,10 @@ type MockK8sAuthChecker struct {
 	MockGetCurrentNamespace       func() (string, error)
 	MockCheckNamespacePermissions func(ctx context.Context, namespace string, resource schema.GroupVersionResource, verbs []string) (map[string]bool, error)
 	MockCanPerformClusterAction   func(ctx context.Context, resource schema.GroupVersionResource, verb string) (bool, error)
+	MockCheckPermissionMatrix     func(ctx context.Context, namespaces []string, resources []schema.GroupVersionResource, verbs []string) (k8sutils.PermissionMatrix, error)
+	MockListContexts              func() ([]string, error)
+	MockCurrentContext            func() (string, error)
+	MockSwitchContext             func(name string) error
 }
 
 func (m *MockK8sAuthChecker) GetKubeConfig() (*rest.Config, error) {
@@ -84,6 +103,34 @@ func (m *MockK8sAuthChecker) CanPerformClusterAction(ctx context.Context, resour
 	return false, fmt.Errorf("CanPerformClusterAction not mocked")
 }
 
+func (m *MockK8sAuthChecker) CheckPermissionMatrix(ctx context.Context, namespaces []string, resources []schema.GroupVersionResource, verbs []string) (k8sutils.PermissionMatrix, error) {
+	if m.MockCheckPermissionMatrix != nil {
+		return m.MockCheckPermissionMatrix(ctx, namespaces, resources, verbs)
+	}
+	return nil, fmt.Errorf("CheckPermissionMatrix not mocked")
+}
+
+func (m *MockK8sAuthChecker) ListContexts() ([]string, error) {
+	if m.MockListContexts != nil {
+		return m.MockListContexts()
+	}
+	return nil, fmt.Errorf("ListContexts not mocked")
+}
+
+func (m *MockK8sAuthChecker) CurrentContext() (string, error) {
+	if m.MockCurrentContext != nil {
+		return m.MockCurrentContext()
+	}
+	return "", fmt.Errorf("CurrentContext not mocked")
+}
+
+func (m *MockK8sAuthChecker) SwitchContext(name string) error {
+	if m.MockSwitchContext != nil {
+		return m.MockSwitchContext(name)
+	}
+	return fmt.Errorf("SwitchContext not mocked")
+}
+
 // Ensure MockK8sAuthChecker implements k8sutils.K8sAuthChecker
 var _ k8sutils.K8sAuthChecker = &MockK8sAuthChecker{}
 
@@ -229,6 +276,46 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+func TestNewClientForCluster(t *testing.T) {
+	registry, err := k8sutils.NewClusterRegistry(
+		k8sutils.ClusterEntry{Name: "dev"},
+		k8sutils.ClusterEntry{Name: "prod"},
+	)
+	if err != nil {
+		t.Fatalf("NewClusterRegistry() error: %v", err)
+	}
+	registry.NewChecker = func(e k8sutils.ClusterEntry) (k8sutils.K8sAuthChecker, error) {
+		return &MockK8sAuthChecker{
+			MockGetKubeConfig: func() (*rest.Config, error) {
+				return &rest.Config{Host: "https://" + e.Name + ".cluster.local"}, nil
+			},
+			MockGetCurrentNamespace: func() (string, error) {
+				return e.Name + "-ns", nil
+			},
+		}, nil
+	}
+
+	client, err := NewClientForCluster(registry, "prod", "", mockLogger)
+	if err != nil {
+		t.Fatalf("NewClientForCluster(prod) error: %v", err)
+	}
+	concreteClient := client.(*Client)
+	if concreteClient.baseKubeConfig.Host != "https://prod.cluster.local" {
+		t.Errorf("baseKubeConfig.Host = %q, want the prod cluster", concreteClient.baseKubeConfig.Host)
+	}
+	if ns := concreteClient.settings.Namespace(); ns != "prod-ns" {
+		t.Errorf("settings.Namespace() = %q, want %q", ns, "prod-ns")
+	}
+	checker, _ := registry.Checker("prod")
+	if concreteClient.authChecker != checker {
+		t.Error("NewClientForCluster() did not use the registry's cached checker")
+	}
+
+	if _, err := NewClientForCluster(registry, "uat", "", mockLogger); err == nil {
+		t.Error("NewClientForCluster(uat) expected error for unknown cluster, got nil")
+	}
+}
+
 func TestConvertReleaseToInfo(t *testing.T) {
 
 	tests := []struct {
@@ -389,12 +476,244 @@ func TestClient_GetActionConfig(t *testing.T) {
 	}
 }
 
-// The following tests are skipped as they require significant mocking of Helm's internal action execution
-// or live Kubernetes/Helm environment for meaningful testing.
-// For unit testing the client logic itself, one would typically mock the Helm action clients (e.g., action.List, action.Install).
+// newStoreTestClient returns a Client backed by a fresh in-memory release store.
+func newStoreTestClient(t *testing.T) *Client {
+	t.Helper()
+	resetMockLogger()
+	clientInterface, err := NewClient(getMockAuthChecker(), "store-ns", mockLogger)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error: %v", err)
+	}
+	return clientInterface.(*Client)
+}
 
 func TestClient_ListReleases(t *testing.T) {
-	t.Skip("ListReleases requires mocking Helm action.List.Run() or integration testing.")
+	client := newStoreTestClient(t)
+
+	releases, err := client.ListReleases("store-ns", action.ListAll)
+	if err != nil {
+		t.Fatalf("ListReleases() on empty store error: %v", err)
+	}
+	if len(releases) != 0 {
+		t.Fatalf("ListReleases() on empty store = %d releases, want 0", len(releases))
+	}
+
+	for _, name := range []string{"beta", "alpha"} {
+		if _, err := client.InstallChart("store-ns", name, "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart(%s) error: %v", name, err)
+		}
+	}
+	if _, err := client.InstallChart("other-ns", "gamma", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart(gamma) error: %v", err)
+	}
+	if _, err := client.UpgradeRelease("store-ns", "alpha", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease(alpha) error: %v", err)
+	}
+
+	releases, err = client.ListReleases("store-ns", action.ListAll)
+	if err != nil {
+		t.Fatalf("ListReleases() error: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("ListReleases() = %d releases, want 2", len(releases))
+	}
+	if releases[0].Name != "alpha" || releases[1].Name != "beta" {
+		t.Errorf("ListReleases() order = [%s %s], want [alpha beta]", releases[0].Name, releases[1].Name)
+	}
+	if releases[0].Revision != 2 || releases[0].ChartVersion != "1.1.0" {
+		t.Errorf("ListReleases() alpha = revision %d chart %s, want revision 2 chart 1.1.0", releases[0].Revision, releases[0].ChartVersion)
+	}
+
+	// An empty namespace lists releases across all namespaces.
+	releases, err = client.ListReleases("", action.ListAll)
+	if err != nil {
+		t.Fatalf("ListReleases(\"\") error: %v", err)
+	}
+	if len(releases) != 3 {
+		t.Errorf("ListReleases(\"\") = %d releases, want 3 across all namespaces", len(releases))
+	}
+}
+
+func TestClient_ListReleasesWithOptions(t *testing.T) {
+	client := newStoreTestClient(t)
+
+	// app-a: deployed at revision 2 (revision 1 superseded)
+	// app-b: deployed at revision 1
+	// app-c: uninstalled with history kept
+	// web-d: deployed in another namespace
+	steps := []func() error{
+		func() error {
+			_, err := client.InstallChart("store-ns", "app-a", "repo/app", "1.0.0", nil, false, false, time.Minute)
+			return err
+		},
+		func() error {
+			_, err := client.InstallChart("store-ns", "app-b", "repo/app", "1.0.0", nil, false, false, time.Minute)
+			return err
+		},
+		func() error {
+			_, err := client.InstallChart("store-ns", "app-c", "repo/app", "1.0.0", nil, false, false, time.Minute)
+			return err
+		},
+		func() error {
+			_, err := client.InstallChart("other-ns", "web-d", "repo/web", "1.0.0", nil, false, false, time.Minute)
+			return err
+		},
+		func() error {
+			_, err := client.UpgradeRelease("store-ns", "app-a", "repo/app", "1.1.0", nil, false, time.Minute, false, false)
+			return err
+		},
+		func() error {
+			_, err := client.UninstallRelease("store-ns", "app-c", true, time.Minute)
+			return err
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("setup step %d error: %v", i, err)
+		}
+	}
+
+	names := func(infos []*ReleaseInfo) []string {
+		out := []string{}
+		for _, info := range infos {
+			out = append(out, fmt.Sprintf("%s@%d", info.Name, info.Revision))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "default mask shows deployed and failed", opts: ListOptions{Namespace: "store-ns"}, want: []string{"app-a@2", "app-b@1"}},
+		{name: "all states", opts: ListOptions{Namespace: "store-ns", StateMask: action.ListAll}, want: []string{"app-a@2", "app-b@1", "app-c@1"}},
+		{name: "uninstalled only", opts: ListOptions{Namespace: "store-ns", StateMask: action.ListUninstalled}, want: []string{"app-c@1"}},
+		{name: "superseded only looks at history", opts: ListOptions{Namespace: "store-ns", StateMask: action.ListSuperseded}, want: []string{"app-a@1"}},
+		{name: "pending states match nothing", opts: ListOptions{Namespace: "store-ns", StateMask: action.ListPendingInstall | action.ListPendingUpgrade}, want: []string{}},
+		{name: "all namespaces", opts: ListOptions{StateMask: action.ListDeployed}, want: []string{"app-a@2", "app-b@1", "web-d@1"}},
+		{name: "name filter", opts: ListOptions{Filter: "^app-[ab]$"}, want: []string{"app-a@2", "app-b@1"}},
+		{name: "sort by name reversed", opts: ListOptions{SortBy: ListSortByName, SortReverse: true}, want: []string{"web-d@1", "app-b@1", "app-a@2"}},
+		{name: "sort by revision", opts: ListOptions{SortBy: ListSortByRevision}, want: []string{"app-a@2", "app-b@1", "web-d@1"}},
+		{name: "limit", opts: ListOptions{Limit: 2}, want: []string{"app-a@2", "app-b@1"}},
+		{name: "offset and limit", opts: ListOptions{Offset: 1, Limit: 1}, want: []string{"app-b@1"}},
+		{name: "offset past end", opts: ListOptions{Offset: 10}, want: []string{}},
+		{name: "invalid filter", opts: ListOptions{Filter: "("}, wantErr: true},
+		{name: "invalid sort", opts: ListOptions{SortBy: "size"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.ListReleasesWithOptions(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ListReleasesWithOptions(%+v) expected error, got nil", tt.opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListReleasesWithOptions(%+v) error: %v", tt.opts, err)
+			}
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Errorf("ListReleasesWithOptions(%+v) = %v, want %v", tt.opts, names(got), tt.want)
+			}
+		})
+	}
+
+	t.Run("sort by date", func(t *testing.T) {
+		got, err := client.ListReleasesWithOptions(ListOptions{StateMask: action.ListAll, SortBy: ListSortByDate})
+		if err != nil {
+			t.Fatalf("ListReleasesWithOptions() error: %v", err)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].Updated.After(got[i-1].Updated) {
+				t.Errorf("releases not ordered by date: %s (%v) after %s (%v)", got[i].Name, got[i].Updated, got[i-1].Name, got[i-1].Updated)
+			}
+		}
+	})
+}
+
+func TestClient_ReleaseLabels(t *testing.T) {
+	client := newStoreTestClient(t)
+	install := func(name string, lbls map[string]string) {
+		t.Helper()
+		opts := InstallOptions{Namespace: "store-ns", ReleaseName: name, ChartName: "repo/app", ChartVersion: "1.0.0", Labels: lbls}
+		if _, err := client.InstallChartWithOptions(opts); err != nil {
+			t.Fatalf("InstallChartWithOptions(%s) error: %v", name, err)
+		}
+	}
+	install("payments-api", map[string]string{"team": "payments", "env": "prod"})
+	install("payments-worker", map[string]string{"team": "payments", "env": "staging"})
+	install("search", map[string]string{"team": "search", "env": "prod"})
+	install("unlabelled", nil)
+
+	selected := func(selector string) []string {
+		t.Helper()
+		infos, err := client.ListReleasesWithOptions(ListOptions{Selector: selector})
+		if err != nil {
+			t.Fatalf("ListReleasesWithOptions(selector %q) error: %v", selector, err)
+		}
+		out := []string{}
+		for _, info := range infos {
+			out = append(out, info.Name)
+		}
+		return out
+	}
+	for selector, want := range map[string][]string{
+		"":                        {"payments-api", "payments-worker", "search", "unlabelled"},
+		"team=payments":           {"payments-api", "payments-worker"},
+		"team=payments,env!=prod": {"payments-worker"},
+		"env in (prod)":           {"payments-api", "search"},
+		"!team":                   {"unlabelled"},
+	} {
+		if got := selected(selector); !reflect.DeepEqual(got, want) {
+			t.Errorf("selector %q = %v, want %v", selector, got, want)
+		}
+	}
+	if _, err := client.ListReleasesWithOptions(ListOptions{Selector: "team in (payments"}); err == nil {
+		t.Error("ListReleasesWithOptions() with an invalid selector expected error, got nil")
+	}
+
+	// Upgrades merge labels into those of the previous revision; "null" drops one.
+	info, err := client.UpgradeReleaseWithOptions(UpgradeOptions{
+		Namespace: "store-ns", ReleaseName: "payments-worker", ChartName: "repo/app", ChartVersion: "1.1.0",
+		Labels: map[string]string{"env": "prod", "team": "null", "tier": "backend"},
+	})
+	if err != nil {
+		t.Fatalf("UpgradeReleaseWithOptions() error: %v", err)
+	}
+	if want := map[string]string{"env": "prod", "tier": "backend"}; !reflect.DeepEqual(info.Labels, want) {
+		t.Errorf("upgraded release labels = %v, want %v", info.Labels, want)
+	}
+	if got := selected("tier=backend"); !reflect.DeepEqual(got, []string{"payments-worker"}) {
+		t.Errorf("selector tier=backend after upgrade = %v, want [payments-worker]", got)
+	}
+	if info, err := client.UpgradeRelease("store-ns", "payments-worker", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err != nil || info.Labels["tier"] != "backend" {
+		t.Errorf("upgrade without labels = %+v, %v, want the previous labels kept", info, err)
+	}
+
+	info, err = client.RollbackRelease("store-ns", "payments-worker", 1, false, time.Minute, false)
+	if err != nil {
+		t.Fatalf("RollbackRelease() error: %v", err)
+	}
+	if want := map[string]string{"team": "payments", "env": "staging"}; !reflect.DeepEqual(info.Labels, want) {
+		t.Errorf("rolled back release labels = %v, want %v", info.Labels, want)
+	}
+	if details, _ := client.GetReleaseDetails("store-ns", "payments-api"); details == nil || details.Labels["team"] != "payments" {
+		t.Errorf("GetReleaseDetails() labels = %v, want team=payments", details)
+	}
+
+	for name, lbls := range map[string]map[string]string{
+		"reserved name": {"owner": "me"},
+		"invalid key":   {"not a key": "x"},
+		"invalid value": {"team": "payments/api"},
+	} {
+		opts := InstallOptions{Namespace: "store-ns", ReleaseName: "bad", ChartName: "repo/app", Labels: lbls}
+		if _, err := client.InstallChartWithOptions(opts); !errors.Is(err, ErrInvalidValues) {
+			t.Errorf("%s: InstallChartWithOptions() error = %v, want ErrInvalidValues", name, err)
+		}
+	}
 }
 
 func TestClient_InstallChart(t *testing.T) {
@@ -417,63 +736,970 @@ func TestClient_InstallChart(t *testing.T) {
 		t.Fatalf("Failed to write dummy template: %v", err)
 	}
 
-	t.Skip("InstallChart requires extensive mocking of Helm action.Install.Run() or integration testing.")
+	client := newStoreTestClient(t)
+	vals := map[string]interface{}{"replicaCount": 2}
+
+	info, err := client.InstallChart("store-ns", "my-release", dummyChartDir, "0.1.0", vals, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if info.Name != "my-release" || info.Namespace != "store-ns" {
+		t.Errorf("InstallChart() = %s/%s, want store-ns/my-release", info.Namespace, info.Name)
+	}
+	if info.Revision != 1 || info.Status != release.StatusDeployed {
+		t.Errorf("InstallChart() = revision %d status %s, want revision 1 status deployed", info.Revision, info.Status)
+	}
+	if info.ChartName != "mychart" || info.ChartVersion != "0.1.0" {
+		t.Errorf("InstallChart() chart = %s-%s, want mychart-0.1.0", info.ChartName, info.ChartVersion)
+	}
+	if info.Updated.IsZero() {
+		t.Error("InstallChart() did not set Updated")
+	}
+
+	// Mutating the caller's values must not leak into the stored release.
+	vals["replicaCount"] = 5
+	details, err := client.GetReleaseDetails("store-ns", "my-release")
+	if err != nil {
+		t.Fatalf("GetReleaseDetails() error: %v", err)
+	}
+	if details.Values["replicaCount"] != 2 {
+		t.Errorf("stored values replicaCount = %v, want 2", details.Values["replicaCount"])
+	}
+
+	if _, err := client.InstallChart("store-ns", "my-release", dummyChartDir, "0.1.0", nil, false, false, time.Minute); err == nil {
+		t.Error("InstallChart() over an existing release expected error, got nil")
+	}
+
+	generated, err := client.InstallChart("store-ns", "", "repo/nginx", "", nil, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart() with generated name error: %v", err)
+	}
+	if !strings.HasPrefix(generated.Name, "nginx-") {
+		t.Errorf("InstallChart() generated name = %q, want nginx- prefix", generated.Name)
+	}
+}
+
+// writeTestChart creates a small chart with default values, a templated
+// ConfigMap, a hook and NOTES.txt, and returns its directory.
+func writeTestChart(t *testing.T, dir string) string {
+	t.Helper()
+	chartDir := filepath.Join(dir, "webapp")
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: webapp\nversion: 1.2.3\nappVersion: \"4.5.6\"\n",
+		"values.yaml": "replicaCount: 1\nimage:\n  repository: nginx\n  tag: stable\n",
+		"templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+  namespace: {{ .Release.Namespace }}
+data:
+  image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+  replicas: "{{ .Values.replicaCount }}"
+  revision: "{{ .Release.Revision }}"
+`,
+		"templates/hook.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    "helm.sh/hook": pre-install
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+        - name: migrate
+          image: busybox
+`,
+		"templates/NOTES.txt": "Thank you for installing {{ .Chart.Name }} as {{ .Release.Name }}.\n",
+	}
+	for name, content := range files {
+		full := filepath.Join(chartDir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", full, err)
+		}
+	}
+	return chartDir
+}
+
+func TestClient_InstallChartRendersLocalChart(t *testing.T) {
+	tempDir := t.TempDir()
+	chartDir := writeTestChart(t, tempDir)
+	client := newStoreTestClient(t)
+
+	info, err := client.InstallChart("store-ns", "web", chartDir, "", map[string]interface{}{"image": map[string]interface{}{"tag": "1.25"}}, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if info.ChartName != "webapp" || info.ChartVersion != "1.2.3" || info.AppVersion != "4.5.6" {
+		t.Errorf("InstallChart() chart metadata = %s %s %s, want webapp 1.2.3 4.5.6", info.ChartName, info.ChartVersion, info.AppVersion)
+	}
+	if info.Config["replicaCount"] != float64(1) {
+		t.Errorf("InstallChart() Config = %v, want chart defaults", info.Config)
+	}
+	for _, want := range []string{
+		"# Source: webapp/templates/configmap.yaml",
+		"name: web-config",
+		"namespace: store-ns",
+		`image: "nginx:1.25"`,
+		`replicas: "1"`,
+		`revision: "1"`,
+	} {
+		if !strings.Contains(info.Manifest, want) {
+			t.Errorf("manifest missing %q:\n%s", want, info.Manifest)
+		}
+	}
+	if strings.Contains(info.Manifest, "web-migrate") {
+		t.Errorf("hook resources should not be part of the manifest:\n%s", info.Manifest)
+	}
+	if info.Notes != "Thank you for installing webapp as web.\n" {
+		t.Errorf("InstallChart() Notes = %q", info.Notes)
+	}
+
+	upgraded, err := client.UpgradeRelease("store-ns", "web", chartDir, "", map[string]interface{}{"replicaCount": 3}, false, time.Minute, false, false)
+	if err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	if !strings.Contains(upgraded.Manifest, `replicas: "3"`) || !strings.Contains(upgraded.Manifest, `revision: "2"`) {
+		t.Errorf("upgraded manifest not re-rendered:\n%s", upgraded.Manifest)
+	}
+	if !strings.Contains(upgraded.Manifest, `image: "nginx:stable"`) {
+		t.Errorf("upgraded manifest should fall back to chart default image tag:\n%s", upgraded.Manifest)
+	}
+
+	t.Run("packaged chart", func(t *testing.T) {
+		ch, err := loader.Load(chartDir)
+		if err != nil {
+			t.Fatalf("loader.Load() error: %v", err)
+		}
+		archive, err := chartutil.Save(ch, tempDir)
+		if err != nil {
+			t.Fatalf("chartutil.Save() error: %v", err)
+		}
+		info, err := client.InstallChart("store-ns", "web-tgz", archive, "", nil, false, false, time.Minute)
+		if err != nil {
+			t.Fatalf("InstallChart(%s) error: %v", archive, err)
+		}
+		if info.ChartName != "webapp" || !strings.Contains(info.Manifest, "name: web-tgz-config") {
+			t.Errorf("InstallChart() from archive = chart %s manifest:\n%s", info.ChartName, info.Manifest)
+		}
+	})
+
+	t.Run("template errors are reported and nothing is recorded", func(t *testing.T) {
+		badDir := filepath.Join(tempDir, "bad")
+		if err := os.MkdirAll(filepath.Join(badDir, "templates"), 0755); err != nil {
+			t.Fatalf("Failed to create bad chart: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(badDir, "Chart.yaml"), []byte("apiVersion: v2\nname: bad\nversion: 0.1.0\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Chart.yaml: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(badDir, "templates", "cm.yaml"), []byte("{{ .Values.missing.key }}"), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+		if _, err := client.InstallChart("store-ns", "bad", badDir, "", nil, false, false, time.Minute); err == nil {
+			t.Fatal("InstallChart() with a broken template expected error, got nil")
+		}
+		if _, err := client.GetReleaseDetails("store-ns", "bad"); err == nil {
+			t.Error("a release was recorded although rendering failed")
+		}
+	})
+}
+
+func TestClient_DryRun(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	client := newStoreTestClient(t)
+
+	info, err := client.InstallChartWithOptions(InstallOptions{Namespace: "store-ns", ReleaseName: "web", ChartName: chartDir, DryRun: true})
+	if err != nil {
+		t.Fatalf("InstallChartWithOptions(DryRun) error: %v", err)
+	}
+	if info.Status != release.StatusPendingInstall || info.Revision != 1 || !strings.Contains(info.Manifest, "name: web-config") {
+		t.Errorf("dry-run install = status %s revision %d manifest:\n%s", info.Status, info.Revision, info.Manifest)
+	}
+	if _, err := client.GetReleaseDetails("store-ns", "web"); err == nil {
+		t.Fatal("dry-run install recorded a release")
+	}
+
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if _, err := client.InstallChartWithOptions(InstallOptions{Namespace: "store-ns", ReleaseName: "web", ChartName: chartDir, DryRun: true}); err == nil {
+		t.Error("dry-run install of an existing release expected error, got nil")
+	}
+
+	info, err = client.UpgradeReleaseWithOptions(UpgradeOptions{Namespace: "store-ns", ReleaseName: "web", ChartName: chartDir, Values: map[string]interface{}{"replicaCount": 2}, DryRun: true})
+	if err != nil {
+		t.Fatalf("UpgradeReleaseWithOptions(DryRun) error: %v", err)
+	}
+	if info.Status != release.StatusPendingUpgrade || info.Revision != 2 || !strings.Contains(info.Manifest, `replicas: "2"`) {
+		t.Errorf("dry-run upgrade = status %s revision %d manifest:\n%s", info.Status, info.Revision, info.Manifest)
+	}
+	history, err := client.GetReleaseHistory("store-ns", "web")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() error: %v", err)
+	}
+	if len(history) != 1 || history[0].Status != release.StatusDeployed {
+		t.Errorf("dry-run upgrade changed history: %+v", history)
+	}
+
+	info, err = client.UpgradeReleaseWithOptions(UpgradeOptions{Namespace: "store-ns", ReleaseName: "absent", ChartName: chartDir, Install: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("UpgradeReleaseWithOptions(Install, DryRun) error: %v", err)
+	}
+	if info.Status != release.StatusPendingInstall {
+		t.Errorf("dry-run upgrade --install status = %s, want %s", info.Status, release.StatusPendingInstall)
+	}
+	if _, err := client.GetReleaseDetails("store-ns", "absent"); err == nil {
+		t.Error("dry-run upgrade --install recorded a release")
+	}
+}
+
+func TestClient_DiffRelease(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	extra := "{{- if .Values.extra }}\napiVersion: v1\nkind: Secret\nmetadata:\n  name: {{ .Release.Name }}-extra\n{{- end }}\n"
+	if err := os.WriteFile(filepath.Join(chartDir, "templates", "extra.yaml"), []byte(extra), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	client := newStoreTestClient(t)
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", map[string]interface{}{"extra": true}, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	diff, err := client.DiffRelease("store-ns", "web", chartDir, "", map[string]interface{}{"extra": true})
+	if err != nil {
+		t.Fatalf("DiffRelease() error: %v", err)
+	}
+	// Only .Release.Revision changes between revisions of the same input.
+	if len(diff.Resources) != 1 || diff.Resources[0].Key() != "ConfigMap/store-ns/web-config" {
+		t.Errorf("DiffRelease() with same values = %+v, want only the revision-dependent ConfigMap", diff.Resources)
+	}
+
+	service := "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .Release.Name }}-svc\nspec:\n  ports:\n    - port: 80\n"
+	if err := os.WriteFile(filepath.Join(chartDir, "templates", "service.yaml"), []byte(service), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	diff, err = client.DiffRelease("store-ns", "web", chartDir, "", map[string]interface{}{"replicaCount": 3})
+	if err != nil {
+		t.Fatalf("DiffRelease() error: %v", err)
+	}
+	if diff.CurrentRevision != 1 || diff.CurrentChart != "webapp-1.2.3" || diff.TargetChart != "webapp-1.2.3" || !diff.HasChanges() {
+		t.Errorf("DiffRelease() = %+v", diff)
+	}
+	want := map[string]ResourceChange{
+		"ConfigMap/store-ns/web-config": ResourceChanged,
+		"Secret/store-ns/web-extra":     ResourceRemoved,
+		"Service/store-ns/web-svc":      ResourceAdded,
+	}
+	if len(diff.Resources) != len(want) {
+		t.Fatalf("DiffRelease() returned %d resources, want %d: %+v", len(diff.Resources), len(want), diff.Resources)
+	}
+	for _, r := range diff.Resources {
+		if want[r.Key()] != r.Change {
+			t.Errorf("resource %s change = %q, want %q", r.Key(), r.Change, want[r.Key()])
+		}
+		if r.Key() == "ConfigMap/store-ns/web-config" && (!strings.Contains(r.Diff, `-  replicas: "1"`) || !strings.Contains(r.Diff, `+  replicas: "3"`)) {
+			t.Errorf("ConfigMap diff does not show the replica change:\n%s", r.Diff)
+		}
+	}
+
+	history, err := client.GetReleaseHistory("store-ns", "web")
+	if err != nil || len(history) != 1 {
+		t.Errorf("DiffRelease() must not record revisions, history = %v, err = %v", history, err)
+	}
+	if _, err := client.DiffRelease("store-ns", "missing", chartDir, "", nil); err == nil {
+		t.Error("DiffRelease() of a missing release expected error, got nil")
+	}
 }
 
 func TestClient_UninstallRelease(t *testing.T) {
-	t.Skip("UninstallRelease requires mocking Helm action.Uninstall.Run() or integration testing.")
+	client := newStoreTestClient(t)
+
+	if _, err := client.UninstallRelease("store-ns", "missing", false, time.Minute); err == nil {
+		t.Error("UninstallRelease() of unknown release expected error, got nil")
+	}
+
+	if _, err := client.InstallChart("store-ns", "purged", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	msg, err := client.UninstallRelease("store-ns", "purged", false, time.Minute)
+	if err != nil {
+		t.Fatalf("UninstallRelease() error: %v", err)
+	}
+	if !strings.Contains(msg, "purged") {
+		t.Errorf("UninstallRelease() message = %q, want it to name the release", msg)
+	}
+	if _, err := client.GetReleaseDetails("store-ns", "purged"); err == nil {
+		t.Error("GetReleaseDetails() after uninstall without history expected error, got nil")
+	}
+
+	if _, err := client.InstallChart("store-ns", "kept", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if _, err := client.UninstallRelease("store-ns", "kept", true, time.Minute); err != nil {
+		t.Fatalf("UninstallRelease(keepHistory) error: %v", err)
+	}
+	details, err := client.GetReleaseDetails("store-ns", "kept")
+	if err != nil {
+		t.Fatalf("GetReleaseDetails() after uninstall with history error: %v", err)
+	}
+	if details.Status != release.StatusUninstalled {
+		t.Errorf("status after uninstall with history = %s, want uninstalled", details.Status)
+	}
+	if _, err := client.UninstallRelease("store-ns", "kept", true, time.Minute); err == nil {
+		t.Error("UninstallRelease() of an already uninstalled release expected error, got nil")
+	}
+
+	// The name can be re-used once the release is uninstalled; revisions continue.
+	reinstalled, err := client.InstallChart("store-ns", "kept", "repo/app", "1.0.0", nil, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart() over uninstalled release error: %v", err)
+	}
+	if reinstalled.Revision != 2 {
+		t.Errorf("reinstalled revision = %d, want 2", reinstalled.Revision)
+	}
 }
 
 func TestClient_UpgradeRelease(t *testing.T) {
-	t.Skip("UpgradeRelease requires mocking Helm action.Upgrade.Run() or integration testing.")
+	client := newStoreTestClient(t)
+
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.0.0", nil, false, time.Minute, false, false); err == nil {
+		t.Error("UpgradeRelease() of unknown release expected error, got nil")
+	}
+
+	installed, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.0.0", nil, false, time.Minute, true, false)
+	if err != nil {
+		t.Fatalf("UpgradeRelease(installIfMissing) error: %v", err)
+	}
+	if installed.Revision != 1 || installed.Status != release.StatusDeployed {
+		t.Errorf("UpgradeRelease(installIfMissing) = revision %d status %s, want revision 1 deployed", installed.Revision, installed.Status)
+	}
+
+	upgraded, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.1.0", map[string]interface{}{"image": "v2"}, false, time.Minute, false, false)
+	if err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	if upgraded.Revision != 2 || upgraded.Status != release.StatusDeployed || upgraded.ChartVersion != "1.1.0" {
+		t.Errorf("UpgradeRelease() = revision %d status %s chart %s, want revision 2 deployed 1.1.0", upgraded.Revision, upgraded.Status, upgraded.ChartVersion)
+	}
+	if upgraded.Values["image"] != "v2" {
+		t.Errorf("UpgradeRelease() values = %v, want image=v2", upgraded.Values)
+	}
+
+	history, err := client.GetReleaseHistory("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() error: %v", err)
+	}
+	if history[0].Status != release.StatusSuperseded {
+		t.Errorf("revision 1 status after upgrade = %s, want superseded", history[0].Status)
+	}
+}
+
+func TestClient_RollbackRelease(t *testing.T) {
+	client := newStoreTestClient(t)
+
+	if _, err := client.RollbackRelease("store-ns", "app", 1, false, time.Minute, false); err == nil {
+		t.Error("RollbackRelease() of unknown release expected error, got nil")
+	}
+
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", map[string]interface{}{"tag": "v1"}, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if _, err := client.RollbackRelease("store-ns", "app", 0, false, time.Minute, false); err == nil {
+		t.Error("RollbackRelease() with only one revision expected error, got nil")
+	}
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "2.0.0", map[string]interface{}{"tag": "v2"}, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	if _, err := client.RollbackRelease("store-ns", "app", 7, false, time.Minute, false); err == nil {
+		t.Error("RollbackRelease() to a missing revision expected error, got nil")
+	}
+	if _, err := client.RollbackRelease("store-ns", "app", -1, false, time.Minute, false); !errors.Is(err, ErrInvalidValues) {
+		t.Errorf("RollbackRelease() to revision -1 error = %v, want ErrInvalidValues", err)
+	}
+
+	rolled, err := client.RollbackRelease("store-ns", "app", 1, false, time.Minute, false)
+	if err != nil {
+		t.Fatalf("RollbackRelease() error: %v", err)
+	}
+	if rolled.Revision != 3 || rolled.Status != release.StatusDeployed {
+		t.Errorf("RollbackRelease() = revision %d status %s, want revision 3 deployed", rolled.Revision, rolled.Status)
+	}
+	if rolled.ChartVersion != "1.0.0" || rolled.Values["tag"] != "v1" {
+		t.Errorf("RollbackRelease() = chart %s values %v, want chart 1.0.0 with tag=v1", rolled.ChartVersion, rolled.Values)
+	}
+	if rolled.Description != "Rollback to 1" {
+		t.Errorf("RollbackRelease() description = %q, want %q", rolled.Description, "Rollback to 1")
+	}
+
+	// Revision 0 rolls back to the previous revision (2).
+	previous, err := client.RollbackRelease("store-ns", "app", 0, false, time.Minute, false)
+	if err != nil {
+		t.Fatalf("RollbackRelease(0) error: %v", err)
+	}
+	if previous.Revision != 4 || previous.ChartVersion != "2.0.0" {
+		t.Errorf("RollbackRelease(0) = revision %d chart %s, want revision 4 chart 2.0.0", previous.Revision, previous.ChartVersion)
+	}
+
+	history, err := client.GetReleaseHistory("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() error: %v", err)
+	}
+	deployed := 0
+	for _, rev := range history {
+		if rev.Status == release.StatusDeployed {
+			deployed++
+		}
+	}
+	if deployed != 1 || history[len(history)-1].Status != release.StatusDeployed {
+		t.Errorf("expected exactly the latest revision to be deployed, history statuses: %v", history)
+	}
+}
+
+func TestClient_ContextCancellation(t *testing.T) {
+	t.Run("already cancelled context makes no changes", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := client.InstallChartContext(ctx, "store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); !errors.Is(err, context.Canceled) {
+			t.Errorf("InstallChartContext() error = %v, want context.Canceled", err)
+		}
+		if _, err := client.ListReleasesContext(ctx, "store-ns", action.ListAll); !errors.Is(err, context.Canceled) {
+			t.Errorf("ListReleasesContext() error = %v, want context.Canceled", err)
+		}
+		if _, err := client.GetReleaseDetails("store-ns", "app"); err == nil {
+			t.Error("release was recorded despite the cancelled context")
+		}
+	})
+
+	tests := []struct {
+		name       string
+		setup      func(c *Client) error
+		run        func(ctx context.Context, c *Client) error
+		wantStatus release.Status
+	}{
+		{
+			name: "install",
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.InstallChartContext(ctx, "store-ns", "app", "repo/app", "1.0.0", nil, false, true, time.Minute)
+				return err
+			},
+			wantStatus: release.StatusPendingInstall,
+		},
+		{
+			name: "upgrade",
+			setup: func(c *Client) error {
+				_, err := c.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute)
+				return err
+			},
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.UpgradeReleaseContext(ctx, "store-ns", "app", "repo/app", "2.0.0", nil, true, time.Minute, false, false)
+				return err
+			},
+			wantStatus: release.StatusPendingUpgrade,
+		},
+		{
+			name: "rollback",
+			setup: func(c *Client) error {
+				if _, err := c.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+					return err
+				}
+				_, err := c.UpgradeRelease("store-ns", "app", "repo/app", "2.0.0", nil, false, time.Minute, false, false)
+				return err
+			},
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.RollbackReleaseContext(ctx, "store-ns", "app", 1, true, time.Minute, false)
+				return err
+			},
+			wantStatus: release.StatusPendingRollback,
+		},
+		{
+			name: "uninstall",
+			setup: func(c *Client) error {
+				_, err := c.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute)
+				return err
+			},
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.UninstallReleaseContext(ctx, "store-ns", "app", true, time.Minute)
+				return err
+			},
+			wantStatus: release.StatusUninstalling,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" cancelled mid-operation", func(t *testing.T) {
+			client := newStoreTestClient(t)
+			if tt.setup != nil {
+				if err := tt.setup(client); err != nil {
+					t.Fatalf("setup error: %v", err)
+				}
+			}
+			client.OperationDelay = time.Hour
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- tt.run(ctx, client) }()
+
+			// Wait until the operation has recorded its pending state, then cancel.
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				details, err := client.GetReleaseDetails("store-ns", "app")
+				if err == nil && details.Status == tt.wantStatus {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("release never reached %s", tt.wantStatus)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+
+			if err := <-done; !errors.Is(err, context.Canceled) {
+				t.Fatalf("error = %v, want context.Canceled", err)
+			}
+			details, err := client.GetReleaseDetails("store-ns", "app")
+			if err != nil {
+				t.Fatalf("GetReleaseDetails() error: %v", err)
+			}
+			if details.Status != tt.wantStatus {
+				t.Errorf("status after cancel = %s, want %s", details.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	t.Run("timeout shorter than the operation", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = time.Hour
+		_, err := client.InstallChart("store-ns", "slow", "repo/app", "1.0.0", nil, false, true, 10*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("InstallChart() error = %v, want context.DeadlineExceeded", err)
+		}
+		details, err := client.GetReleaseDetails("store-ns", "slow")
+		if err != nil {
+			t.Fatalf("GetReleaseDetails() error: %v", err)
+		}
+		if details.Status != release.StatusPendingInstall {
+			t.Errorf("status after timeout = %s, want %s", details.Status, release.StatusPendingInstall)
+		}
+		if _, err := client.UpgradeRelease("store-ns", "slow", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err == nil {
+			t.Error("UpgradeRelease() of a pending release expected error, got nil")
+		}
+	})
+
+	t.Run("context override takes precedence", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		var gotCtx context.Context
+		client.GetReleaseDetailsFunc = func(namespace, releaseName string) (*ReleaseInfo, error) {
+			t.Error("plain override called although a context override is set")
+			return nil, nil
+		}
+		client.GetReleaseDetailsContextFunc = func(ctx context.Context, namespace, releaseName string) (*ReleaseInfo, error) {
+			gotCtx = ctx
+			return &ReleaseInfo{Name: releaseName}, nil
+		}
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "marker")
+		if _, err := client.GetReleaseDetailsContext(ctx, "store-ns", "app"); err != nil {
+			t.Fatalf("GetReleaseDetailsContext() error: %v", err)
+		}
+		if gotCtx == nil || gotCtx.Value(ctxKey{}) != "marker" {
+			t.Error("context override did not receive the caller's context")
+		}
+	})
 }
 
 func TestClient_GetReleaseDetails(t *testing.T) {
-	t.Skip("GetReleaseDetails requires mocking Helm action.Get.Run() or integration testing.")
+	client := newStoreTestClient(t)
+
+	if _, err := client.GetReleaseDetails("store-ns", "non-existent-release"); err == nil {
+		t.Error("GetReleaseDetails() of unknown release expected error, got nil")
+	}
+
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "2.0.0", nil, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	details, err := client.GetReleaseDetails("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseDetails() error: %v", err)
+	}
+	if details.Revision != 2 || details.ChartVersion != "2.0.0" {
+		t.Errorf("GetReleaseDetails() = revision %d chart %s, want latest revision 2 chart 2.0.0", details.Revision, details.ChartVersion)
+	}
+	if _, err := client.GetReleaseDetails("other-ns", "app"); err == nil {
+		t.Error("GetReleaseDetails() in another namespace expected error, got nil")
+	}
 }
 
 func TestClient_GetReleaseHistory(t *testing.T) {
-	t.Skip("GetReleaseHistory requires mocking Helm action.History.Run() or integration testing.")
+	client := newStoreTestClient(t)
+
+	if _, err := client.GetReleaseHistory("store-ns", "app"); err == nil {
+		t.Error("GetReleaseHistory() of unknown release expected error, got nil")
+	}
+
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	for _, v := range []string{"1.1.0", "1.2.0"} {
+		if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", v, nil, false, time.Minute, false, false); err != nil {
+			t.Fatalf("UpgradeRelease(%s) error: %v", v, err)
+		}
+	}
+	if _, err := client.UninstallRelease("store-ns", "app", true, time.Minute); err != nil {
+		t.Fatalf("UninstallRelease() error: %v", err)
+	}
+
+	history, err := client.GetReleaseHistory("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() error: %v", err)
+	}
+	wantStatuses := []release.Status{release.StatusSuperseded, release.StatusSuperseded, release.StatusUninstalled}
+	if len(history) != len(wantStatuses) {
+		t.Fatalf("GetReleaseHistory() = %d revisions, want %d", len(history), len(wantStatuses))
+	}
+	for i, rev := range history {
+		if rev.Revision != i+1 {
+			t.Errorf("history[%d].Revision = %d, want %d", i, rev.Revision, i+1)
+		}
+		if rev.Status != wantStatuses[i] {
+			t.Errorf("history[%d].Status = %s, want %s", i, rev.Status, wantStatuses[i])
+		}
+	}
+	if history[2].Updated.Before(history[0].Updated) {
+		t.Errorf("history timestamps not ascending: %v before %v", history[2].Updated, history[0].Updated)
+	}
+}
+
+func TestClient_GetReleaseValues(t *testing.T) {
+	client := newStoreTestClient(t)
+	chartDir := writeTestChart(t, t.TempDir())
+	// Add a subchart so global propagation can be checked.
+	subDir := filepath.Join(chartDir, "charts", "db")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: db\nversion: 0.1.0\n",
+		"values.yaml": "port: 5432\nglobal:\n  region: eu\n",
+	} {
+		if err := os.WriteFile(filepath.Join(subDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.GetReleaseValues("store-ns", "web", 0, false); err == nil {
+		t.Error("GetReleaseValues() of unknown release expected error, got nil")
+	}
+	rev1 := map[string]interface{}{"replicaCount": 2}
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", rev1, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	rev2 := map[string]interface{}{
+		"image":  map[string]interface{}{"tag": nil},
+		"global": map[string]interface{}{"env": "prod"},
+		"db":     map[string]interface{}{"port": 6432},
+	}
+	if _, err := client.UpgradeRelease("store-ns", "web", chartDir, "", rev2, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+
+	t.Run("user-supplied values", func(t *testing.T) {
+		got, err := client.GetReleaseValues("store-ns", "web", 0, false)
+		if err != nil {
+			t.Fatalf("GetReleaseValues() error: %v", err)
+		}
+		if !reflect.DeepEqual(got, rev2) {
+			t.Errorf("GetReleaseValues(latest) = %v, want %v", got, rev2)
+		}
+		got, err = client.GetReleaseValues("store-ns", "web", 1, false)
+		if err != nil {
+			t.Fatalf("GetReleaseValues(1) error: %v", err)
+		}
+		if !reflect.DeepEqual(got, rev1) {
+			t.Errorf("GetReleaseValues(1) = %v, want %v", got, rev1)
+		}
+	})
+
+	t.Run("computed values", func(t *testing.T) {
+		got, err := client.GetReleaseValues("store-ns", "web", 0, true)
+		if err != nil {
+			t.Fatalf("GetReleaseValues() error: %v", err)
+		}
+		want := map[string]interface{}{
+			"replicaCount": float64(1),
+			"image":        map[string]interface{}{"repository": "nginx"},
+			"global":       map[string]interface{}{"env": "prod"},
+			"db": map[string]interface{}{
+				"port":   6432,
+				"global": map[string]interface{}{"env": "prod", "region": "eu"},
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetReleaseValues(all) = %#v, want %#v", got, want)
+		}
+
+		got, err = client.GetReleaseValues("store-ns", "web", 1, true)
+		if err != nil {
+			t.Fatalf("GetReleaseValues(1, all) error: %v", err)
+		}
+		if got["replicaCount"] != 2 || got["image"].(map[string]interface{})["tag"] != "stable" {
+			t.Errorf("GetReleaseValues(1, all) = %v, want replicaCount 2 and the default image tag", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := client.GetReleaseValues("store-ns", "web", 3, false); err == nil {
+			t.Error("GetReleaseValues() of a missing revision expected error, got nil")
+		}
+		if _, err := client.GetReleaseValues("store-ns", "web", -1, false); err == nil {
+			t.Error("GetReleaseValues() with a negative revision expected error, got nil")
+		}
+	})
+}
+
+// newRepoTestClient returns a client whose repositories file and cache live
+// in a temporary directory.
+func newRepoTestClient(t *testing.T) *Client {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(dir, "config", "repositories.yaml"))
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(dir, "cache"))
+	hc, err := NewClient(getMockAuthChecker(), "store-ns", mockLogger)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	return hc.(*Client)
+}
+
+// writeTestRepo packages the given versions of a "webapp" chart into dir and
+// writes an index.yaml whose chart URLs are relative to the repository.
+func writeTestRepo(t *testing.T, dir string, versions ...string) {
+	t.Helper()
+	src := writeTestChart(t, t.TempDir())
+	ch, err := loader.Load(src)
+	if err != nil {
+		t.Fatalf("loader.Load() error: %v", err)
+	}
+	for _, v := range versions {
+		ch.Metadata.Version = v
+		if _, err := chartutil.Save(ch, dir); err != nil {
+			t.Fatalf("chartutil.Save() error: %v", err)
+		}
+	}
+	idx, err := repo.IndexDirectory(dir, "")
+	if err != nil {
+		t.Fatalf("repo.IndexDirectory() error: %v", err)
+	}
+	if err := idx.WriteFile(filepath.Join(dir, "index.yaml"), 0644); err != nil {
+		t.Fatalf("Failed to write index.yaml: %v", err)
+	}
 }
 
 func TestClient_AddRepository(t *testing.T) {
-	tempDir := t.TempDir()
-	tempRepoFile := filepath.Join(tempDir, "repositories.yaml")
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0")
+	client := newRepoTestClient(t)
+	repoURL := "file://" + repoDir
+
+	if err := client.AddRepository("local", repoURL, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+	f, err := repo.LoadFile(client.settings.RepositoryConfig)
+	if err != nil {
+		t.Fatalf("repositories file not written: %v", err)
+	}
+	if e := f.Get("local"); e == nil || e.URL != repoURL {
+		t.Errorf("repositories file entry = %+v, want local -> %s", e, repoURL)
+	}
+	if _, err := os.Stat(filepath.Join(client.settings.RepositoryCache, "local-index.yaml")); err != nil {
+		t.Errorf("index not cached: %v", err)
+	}
+
+	if err := client.AddRepository("local", repoURL, "", "", false); err != nil {
+		t.Errorf("re-adding an identical repository should be a no-op, got %v", err)
+	}
+	if err := client.AddRepository("local", "file:///elsewhere", "", "", false); err == nil {
+		t.Error("AddRepository() with an existing name and different URL expected error, got nil")
+	}
+	if err := client.AddRepository("bad", "file://"+t.TempDir(), "", "", false); err == nil {
+		t.Error("AddRepository() without index.yaml expected error, got nil")
+	}
+	if err := client.AddRepository("a/b", repoURL, "", "", false); err == nil {
+		t.Error("AddRepository() with '/' in the name expected error, got nil")
+	}
 
-	originalRepoConfig := os.Getenv("HELM_REPOSITORY_CONFIG")
-	os.Setenv("HELM_REPOSITORY_CONFIG", tempRepoFile)
-	defer os.Setenv("HELM_REPOSITORY_CONFIG", originalRepoConfig)
-	if originalRepoConfig == "" {
-		defer os.Unsetenv("HELM_REPOSITORY_CONFIG")
+	repos, err := client.ListRepositories()
+	if err != nil {
+		t.Fatalf("ListRepositories() error: %v", err)
+	}
+	if len(repos) != 1 || repos[0].Name != "local" {
+		t.Errorf("ListRepositories() = %+v, want only local", repos)
 	}
 
-	t.Skip("AddRepository requires mocking network calls (DownloadIndexFile) and potentially file system interactions beyond HELM_REPOSITORY_CONFIG.")
+	if err := client.RemoveRepository("local"); err != nil {
+		t.Fatalf("RemoveRepository() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(client.settings.RepositoryCache, "local-index.yaml")); !os.IsNotExist(err) {
+		t.Errorf("cached index should be removed, stat error = %v", err)
+	}
+	if err := client.RemoveRepository("local"); err == nil {
+		t.Error("RemoveRepository() of an unknown repository expected error, got nil")
+	}
 }
 
 func TestClient_UpdateRepositories(t *testing.T) {
-	tempDir := t.TempDir()
-	tempRepoFile := filepath.Join(tempDir, "repositories.yaml")
-	originalRepoConfig := os.Getenv("HELM_REPOSITORY_CONFIG")
-	os.Setenv("HELM_REPOSITORY_CONFIG", tempRepoFile)
-	defer os.Setenv("HELM_REPOSITORY_CONFIG", originalRepoConfig)
-	if originalRepoConfig == "" {
-		defer os.Unsetenv("HELM_REPOSITORY_CONFIG")
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0")
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		http.FileServer(http.Dir(repoDir)).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	client := newRepoTestClient(t)
+
+	if err := client.UpdateRepositories(); err == nil {
+		t.Error("UpdateRepositories() without repositories expected error, got nil")
+	}
+	if err := client.AddRepository("web", server.URL, "user", "secret", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+	if authHeader == "" {
+		t.Error("repository credentials were not sent with the index request")
+	}
+	if results, _ := client.SearchCharts("webapp", ""); len(results) != 1 || results[0].ChartVersion != "1.0.0" {
+		t.Fatalf("SearchCharts() before update = %+v", results)
 	}
 
-	initialRepoContent := `
-apiVersion: ""
-generated: "0001-01-01T00:00:00Z"
-repositories:
-- name: stable
-  url: https://charts.helm.sh/stable
-`
-	if err := os.WriteFile(tempRepoFile, []byte(initialRepoContent), 0644); err != nil {
-		t.Fatalf("Failed to write initial temp repo file: %v", err)
+	writeTestRepo(t, repoDir, "1.1.0")
+	if err := client.UpdateRepositories(); err != nil {
+		t.Fatalf("UpdateRepositories() error: %v", err)
+	}
+	results, err := client.SearchCharts("webapp", "")
+	if err != nil {
+		t.Fatalf("SearchCharts() error: %v", err)
+	}
+	if len(results) != 1 || results[0].ChartVersion != "1.1.0" {
+		t.Errorf("SearchCharts() after update = %+v, want 1.1.0", results)
 	}
 
-	t.Skip("UpdateRepositories requires mocking network calls (DownloadIndexFile).")
+	server.Close()
+	if err := client.UpdateRepositories(); err == nil {
+		t.Error("UpdateRepositories() with an unreachable repository expected error, got nil")
+	}
+}
+
+func TestClient_SearchCharts(t *testing.T) {
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0", "1.4.2", "2.0.0", "3.0.0-rc.1")
+	client := newRepoTestClient(t)
+	if err := client.AddRepository("local", "file://"+repoDir, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+
+	tests := []struct {
+		keyword, constraint string
+		wantVersion         string // empty means no result
+		wantErr             bool
+	}{
+		{keyword: "", wantVersion: "2.0.0"},
+		{keyword: "WEBAPP", wantVersion: "2.0.0"},
+		{keyword: "local/web", wantVersion: "2.0.0"},
+		{keyword: "webapp", constraint: "^1.0", wantVersion: "1.4.2"},
+		{keyword: "webapp", constraint: "~1.0.0", wantVersion: "1.0.0"},
+		{keyword: "webapp", constraint: ">=3.0.0-0", wantVersion: "3.0.0-rc.1"},
+		{keyword: "webapp", constraint: ">5"},
+		{keyword: "postgres"},
+		{keyword: "webapp", constraint: "not-a-version", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyword+" "+tt.constraint, func(t *testing.T) {
+			results, err := client.SearchCharts(tt.keyword, tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SearchCharts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantVersion == "" {
+				if len(results) != 0 {
+					t.Errorf("SearchCharts() = %+v, want no results", results)
+				}
+				return
+			}
+			if len(results) != 1 || results[0].Name != "local/webapp" || results[0].ChartVersion != tt.wantVersion || results[0].AppVersion != "4.5.6" {
+				t.Errorf("SearchCharts() = %+v, want local/webapp %s", results, tt.wantVersion)
+			}
+		})
+	}
 }
 
 func TestClient_EnsureChart(t *testing.T) {
-	t.Skip("EnsureChart requires mocking action.ChartPathOptions.LocateChart and potentially UpdateRepositories if the chart is not found initially.")
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0", "1.2.0", "2.0.0")
+	client := newRepoTestClient(t)
+	if err := client.AddRepository("local", "file://"+repoDir, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+
+	tests := []struct {
+		version, want string
+	}{
+		{"", "2.0.0"},
+		{"1.0.0", "1.0.0"},
+		{"^1.0.0", "1.2.0"},
+	}
+	for _, tt := range tests {
+		chartPath, err := client.EnsureChart("local/webapp", tt.version)
+		if err != nil {
+			t.Fatalf("EnsureChart(%q) error: %v", tt.version, err)
+		}
+		ch, err := loader.Load(chartPath)
+		if err != nil {
+			t.Fatalf("EnsureChart(%q) returned an unloadable chart %s: %v", tt.version, chartPath, err)
+		}
+		if ch.Metadata.Version != tt.want {
+			t.Errorf("EnsureChart(%q) version = %s, want %s", tt.version, ch.Metadata.Version, tt.want)
+		}
+	}
+
+	if _, err := client.EnsureChart("local/webapp", ">3"); err == nil {
+		t.Error("EnsureChart() with an unsatisfiable constraint expected error, got nil")
+	}
+	if _, err := client.EnsureChart("missing/webapp", ""); err == nil {
+		t.Error("EnsureChart() with an unknown repository expected error, got nil")
+	}
+	local := writeTestChart(t, t.TempDir())
+	if got, err := client.EnsureChart(local, ""); err != nil || got != local {
+		t.Errorf("EnsureChart(local path) = %q, %v; want %q", got, err, local)
+	}
+
+	// Installing from a configured repository renders the downloaded chart.
+	info, err := client.InstallChart("store-ns", "from-repo", "local/webapp", "~1.0", nil, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart(local/webapp) error: %v", err)
+	}
+	if info.ChartVersion != "1.0.0" || !strings.Contains(info.Manifest, "name: from-repo-config") {
+		t.Errorf("InstallChart(local/webapp) = version %s, manifest:\n%s", info.ChartVersion, info.Manifest)
+	}
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		archive := filepath.Join(repoDir, "webapp-1.0.0.tgz")
+		if err := os.WriteFile(archive, []byte("tampered"), 0644); err != nil {
+			t.Fatalf("Failed to tamper with archive: %v", err)
+		}
+		if err := os.Remove(filepath.Join(client.settings.RepositoryCache, "webapp-1.0.0.tgz")); err != nil {
+			t.Fatalf("Failed to clear cached archive: %v", err)
+		}
+		if _, err := client.EnsureChart("local/webapp", "1.0.0"); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+			t.Errorf("EnsureChart() of a tampered archive error = %v, want digest mismatch", err)
+		}
+	})
 }
@@ -0,0 +1,531 @@
+package helmutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// DependencyStatus describes how a chart dependency vendored in charts/
+// compares with Chart.yaml, Chart.lock and its repository.
+type DependencyStatus string
+
+const (
+	// DependencyOK means the vendored chart matches the lock and no newer
+	// version satisfying the constraint is known.
+	DependencyOK DependencyStatus = "ok"
+	// DependencyMissing means the dependency is not vendored in charts/.
+	DependencyMissing DependencyStatus = "missing"
+	// DependencyWrongVersion means the vendored chart does not satisfy the
+	// constraint in Chart.yaml or differs from the version in Chart.lock.
+	DependencyWrongVersion DependencyStatus = "wrong-version"
+	// DependencyOutdated means the repository has a newer version that
+	// satisfies the constraint, so updating the dependencies would change it.
+	DependencyOutdated DependencyStatus = "outdated"
+)
+
+// ChartDependency reports the state of one dependency of a chart.
+type ChartDependency struct {
+	Name       string `json:"name"`
+	Alias      string `json:"alias,omitempty"`
+	Version    string `json:"version,omitempty"` // constraint from Chart.yaml
+	Repository string `json:"repository,omitempty"`
+	Locked     string `json:"locked,omitempty"`   // version pinned in Chart.lock
+	Vendored   string `json:"vendored,omitempty"` // version found in charts/
+	// Latest is the newest version satisfying the constraint, when the
+	// repository could be checked.
+	Latest string           `json:"latest,omitempty"`
+	Status DependencyStatus `json:"status"`
+}
+
+const lockfileName = "Chart.lock"
+
+// resolvedDependency is a dependency chart fetched for vendoring. archive
+// is nil for dependencies without a repository, which must already be in
+// charts/.
+type resolvedDependency struct {
+	dep     *chart.Dependency
+	version string
+	archive []byte
+}
+
+// readChartDependencies reads Chart.yaml and, if present and in sync with
+// it, Chart.lock from a chart directory. A stale lock is returned as nil
+// with stale set.
+func readChartDependencies(chartPath string) (meta *chart.Metadata, lock *chart.Lock, stale bool, err error) {
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read chart %s: %w", chartPath, err)
+	}
+	if !fi.IsDir() {
+		return nil, nil, false, fmt.Errorf("chart %s is not a directory: dependencies can only be managed for unpacked charts", chartPath)
+	}
+	meta, err = chartutil.LoadChartfile(filepath.Join(chartPath, chartutil.ChartfileName))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to load %s of chart %s: %w", chartutil.ChartfileName, chartPath, err)
+	}
+	data, err := os.ReadFile(filepath.Join(chartPath, lockfileName))
+	if os.IsNotExist(err) {
+		return meta, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read %s of chart %s: %w", lockfileName, chartPath, err)
+	}
+	lock = &chart.Lock{}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to parse %s of chart %s: %w", lockfileName, chartPath, err)
+	}
+	if digest, err := hashDependencies(meta.Dependencies, lock.Dependencies); err != nil || digest != lock.Digest {
+		return meta, nil, true, nil
+	}
+	return meta, lock, false, nil
+}
+
+// hashDependencies computes the Chart.lock digest the same way Helm does, so
+// lock files are interchangeable with 'helm dependency'.
+func hashDependencies(req, locked []*chart.Dependency) (string, error) {
+	data, err := json.Marshal([2][]*chart.Dependency{req, locked})
+	if err != nil {
+		return "", err
+	}
+	s, err := provenance.Digest(bytes.NewBuffer(data))
+	return "sha256:" + s, err
+}
+
+// lockedVersion returns the version Chart.lock pins dep to, or "".
+func lockedVersion(lock *chart.Lock, dep *chart.Dependency) string {
+	if lock == nil {
+		return ""
+	}
+	for _, l := range lock.Dependencies {
+		if l.Name == dep.Name && l.Repository == dep.Repository {
+			return l.Version
+		}
+	}
+	return ""
+}
+
+// versionConstraint parses the version field of a dependency. An empty
+// version accepts any release.
+func versionConstraint(version string) (*semver.Constraints, error) {
+	if version == "" {
+		version = "*"
+	}
+	return semver.NewConstraint(version)
+}
+
+// satisfies reports whether version meets constraint.
+func satisfies(version, constraint string) bool {
+	c, err := versionConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	return err == nil && c.Check(v)
+}
+
+// isLocalDependency reports whether dep refers to a chart directory on disk
+// rather than to a repository.
+func isLocalDependency(dep *chart.Dependency) bool {
+	return strings.HasPrefix(dep.Repository, "file://")
+}
+
+// localDependencyDir returns the directory of a file:// dependency, which is
+// relative to the chart unless absolute.
+func localDependencyDir(chartPath string, dep *chart.Dependency) string {
+	dir := strings.TrimPrefix(dep.Repository, "file://")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(chartPath, dir)
+	}
+	return dir
+}
+
+// dependencyRepo returns the repository entry a dependency is fetched from:
+// a configured repository named with "@name" or "alias:name", a configured
+// repository with the same URL, or otherwise an unnamed entry for the URL.
+// The caller holds repoMu.
+func (c *Client) dependencyRepo(dep *chart.Dependency) (*repo.Entry, error) {
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := strings.CutPrefix(dep.Repository, "@"); ok || strings.HasPrefix(dep.Repository, "alias:") {
+		if !ok {
+			name = strings.TrimPrefix(dep.Repository, "alias:")
+		}
+		entry := f.Get(name)
+		if entry == nil {
+			return nil, fmt.Errorf("dependency %s: repository %q is not configured: %w", dep.Name, name, ErrChartNotFound)
+		}
+		return entry, nil
+	}
+	url := strings.TrimSuffix(dep.Repository, "/")
+	for _, entry := range f.Repositories {
+		if entry.URL == url {
+			return entry, nil
+		}
+	}
+	// Cache the index of an unconfigured repository under a name derived
+	// from its URL.
+	sum := sha256.Sum256([]byte(url))
+	return &repo.Entry{Name: "dep-" + hex.EncodeToString(sum[:6]), URL: url}, nil
+}
+
+// resolveDependency fetches dep at the newest version satisfying version,
+// which may be an exact locked version or a constraint. It returns the
+// version chosen and the chart archive. The caller holds repoMu.
+func (c *Client) resolveDependency(ctx context.Context, chartPath string, dep *chart.Dependency, version string) (*resolvedDependency, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case isLocalDependency(dep) && !c.isRepoURL(dep.Repository):
+		dir := localDependencyDir(chartPath, dep)
+		ch, err := loader.LoadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: failed to load chart from %s: %w: %w", dep.Name, dir, ErrChartNotFound, err)
+		}
+		if ch.Metadata.Name != dep.Name {
+			return nil, fmt.Errorf("dependency %s: chart at %s is named %s: %w", dep.Name, dir, ch.Metadata.Name, ErrChartNotFound)
+		}
+		if !satisfies(ch.Metadata.Version, version) {
+			return nil, fmt.Errorf("dependency %s: local chart version %s does not satisfy %q: %w", dep.Name, ch.Metadata.Version, version, ErrChartNotFound)
+		}
+		tmpDir, err := os.MkdirTemp("", "helmutils-dep-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		archive, err := chartutil.Save(ch, tmpDir)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: failed to package %s: %w", dep.Name, dir, err)
+		}
+		data, err := os.ReadFile(archive)
+		if err != nil {
+			return nil, err
+		}
+		return &resolvedDependency{dep: dep, version: ch.Metadata.Version, archive: data}, nil
+
+	case registry.IsOCI(dep.Repository):
+		path, err := c.pullOCIChart(ctx, strings.TrimSuffix(dep.Repository, "/")+"/"+dep.Name, version)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+		}
+		return readResolved(dep, path)
+
+	default:
+		entry, err := c.dependencyRepo(dep)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := c.loadIndex(ctx, entry)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+		}
+		cv, err := idx.Get(dep.Name, version)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: version %q not found in repository %s: %w: %w", dep.Name, version, dep.Repository, ErrChartNotFound, err)
+		}
+		path, err := c.downloadChart(ctx, entry, cv)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+		}
+		return readResolved(dep, path)
+	}
+}
+
+func readResolved(dep *chart.Dependency, path string) (*resolvedDependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+	}
+	ch, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s: failed to load %s: %w", dep.Name, path, err)
+	}
+	return &resolvedDependency{dep: dep, version: ch.Metadata.Version, archive: data}, nil
+}
+
+// isRepoURL reports whether url is the URL of a configured repository, so a
+// file:// repository index is not mistaken for a local chart directory.
+func (c *Client) isRepoURL(url string) bool {
+	f, err := c.loadRepoFile()
+	if err != nil {
+		return false
+	}
+	url = strings.TrimSuffix(url, "/")
+	for _, entry := range f.Repositories {
+		if entry.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// latestDependencyVersion returns the newest version dep could be updated
+// to, or "" if that cannot be told without contacting a registry. The caller
+// holds repoMu.
+func (c *Client) latestDependencyVersion(ctx context.Context, chartPath string, dep *chart.Dependency) string {
+	switch {
+	case dep.Repository == "" || registry.IsOCI(dep.Repository):
+		return ""
+	case isLocalDependency(dep) && !c.isRepoURL(dep.Repository):
+		dir := localDependencyDir(chartPath, dep)
+		meta, err := chartutil.LoadChartfile(filepath.Join(dir, chartutil.ChartfileName))
+		if err != nil || !satisfies(meta.Version, dep.Version) {
+			return ""
+		}
+		return meta.Version
+	}
+	entry, err := c.dependencyRepo(dep)
+	if err != nil {
+		return ""
+	}
+	idx, err := c.loadIndex(ctx, entry)
+	if err != nil {
+		c.Log("Cannot check repository %s for newer versions of %s: %v", dep.Repository, dep.Name, err)
+		return ""
+	}
+	cv, err := idx.Get(dep.Name, dep.Version)
+	if err != nil {
+		return ""
+	}
+	return cv.Version
+}
+
+// vendoredChart is a chart archive or directory found in charts/.
+type vendoredChart struct {
+	path    string
+	version string
+	dir     bool
+}
+
+// vendoredCharts lists the charts in chartPath/charts by chart name. Files
+// Helm ignores, starting with "." or "_", are skipped.
+func vendoredCharts(chartPath string) (map[string][]vendoredChart, error) {
+	chartsDir := filepath.Join(chartPath, "charts")
+	entries, err := os.ReadDir(chartsDir)
+	if os.IsNotExist(err) {
+		return map[string][]vendoredChart{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", chartsDir, err)
+	}
+	found := make(map[string][]vendoredChart)
+	for _, e := range entries {
+		if strings.IndexAny(e.Name(), "._") == 0 {
+			continue
+		}
+		path := filepath.Join(chartsDir, e.Name())
+		var meta *chart.Metadata
+		switch {
+		case e.IsDir():
+			if meta, err = chartutil.LoadChartfile(filepath.Join(path, chartutil.ChartfileName)); err != nil {
+				continue
+			}
+		case strings.HasSuffix(e.Name(), ".tgz"):
+			ch, err := loader.LoadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chart archive %s: %w", path, err)
+			}
+			meta = ch.Metadata
+		default:
+			continue
+		}
+		found[meta.Name] = append(found[meta.Name], vendoredChart{path: path, version: meta.Version, dir: e.IsDir()})
+	}
+	return found, nil
+}
+
+// vendorDependencies writes the resolved archives into chartPath/charts and
+// removes older archives of the same charts. New archives are written under
+// hidden names first, so a failure leaves charts/ as it was.
+func vendorDependencies(chartPath string, resolved []*resolvedDependency) error {
+	existing, err := vendoredCharts(chartPath)
+	if err != nil {
+		return err
+	}
+	chartsDir := filepath.Join(chartPath, "charts")
+	if err := os.MkdirAll(chartsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", chartsDir, err)
+	}
+
+	written := make(map[string]string, len(resolved)) // final path -> temporary path
+	defer func() {
+		for _, tmp := range written {
+			os.Remove(tmp)
+		}
+	}()
+	for _, r := range resolved {
+		if r.archive == nil {
+			continue
+		}
+		final := filepath.Join(chartsDir, fmt.Sprintf("%s-%s.tgz", r.dep.Name, r.version))
+		if _, ok := written[final]; ok {
+			continue // the same chart under two aliases
+		}
+		tmp := filepath.Join(chartsDir, "."+filepath.Base(final)+".tmp")
+		if err := os.WriteFile(tmp, r.archive, 0644); err != nil {
+			return fmt.Errorf("failed to vendor dependency %s: %w", r.dep.Name, err)
+		}
+		written[final] = tmp
+	}
+
+	for _, r := range resolved {
+		if r.archive == nil {
+			continue
+		}
+		for _, v := range existing[r.dep.Name] {
+			if v.dir {
+				continue // unpacked charts are the author's, not ours to remove
+			}
+			if _, replaced := written[v.path]; replaced {
+				continue
+			}
+			if err := os.Remove(v.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove outdated dependency %s: %w", v.path, err)
+			}
+		}
+	}
+	for final, tmp := range written {
+		if err := os.Rename(tmp, final); err != nil {
+			return fmt.Errorf("failed to vendor dependency %s: %w", filepath.Base(final), err)
+		}
+		delete(written, final)
+	}
+	return nil
+}
+
+// writeLockfile writes Chart.lock for the resolved dependencies. An
+// existing lock with the same digest is left alone, as Helm does, so
+// re-running an update does not touch the file.
+func writeLockfile(chartPath string, deps []*chart.Dependency, resolved []*resolvedDependency, old *chart.Lock) (*chart.Lock, error) {
+	locked := make([]*chart.Dependency, 0, len(resolved))
+	for _, r := range resolved {
+		locked = append(locked, &chart.Dependency{Name: r.dep.Name, Version: r.version, Repository: r.dep.Repository})
+	}
+	digest, err := hashDependencies(deps, locked)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && old.Digest == digest {
+		return old, nil
+	}
+	lock := &chart.Lock{Generated: time.Now(), Digest: digest, Dependencies: locked}
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(chartPath, lockfileName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return lock, nil
+}
+
+// resolveDependencies fetches every dependency, at the version pinned in
+// lock when one is given and otherwise at the newest version its constraint
+// allows.
+func (c *Client) resolveDependencies(ctx context.Context, chartPath string, deps []*chart.Dependency, lock *chart.Lock) ([]*resolvedDependency, error) {
+	existing, err := vendoredCharts(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	c.repoMu.Lock()
+	defer c.repoMu.Unlock()
+	resolved := make([]*resolvedDependency, 0, len(deps))
+	for _, dep := range deps {
+		if dep.Repository == "" {
+			v := pickVendored(existing[dep.Name], dep.Version, lockedVersion(lock, dep))
+			if v == "" {
+				return nil, fmt.Errorf("dependency %s has no repository and is not in charts/: %w", dep.Name, ErrChartNotFound)
+			}
+			resolved = append(resolved, &resolvedDependency{dep: dep, version: v})
+			continue
+		}
+		version := dep.Version
+		if v := lockedVersion(lock, dep); v != "" {
+			version = v
+		}
+		r, err := c.resolveDependency(ctx, chartPath, dep, version)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, r)
+	}
+	return resolved, nil
+}
+
+// pickVendored returns the version of the vendored copy of a chart that
+// matches the locked version, or else the constraint, or else the first one.
+func pickVendored(copies []vendoredChart, constraint, locked string) string {
+	if len(copies) == 0 {
+		return ""
+	}
+	for _, v := range copies {
+		if locked != "" && v.version == locked {
+			return v.version
+		}
+	}
+	for _, v := range copies {
+		if satisfies(v.version, constraint) {
+			return v.version
+		}
+	}
+	return copies[0].version
+}
+
+// dependencyStatus classifies a dependency from its vendored, locked and
+// latest versions.
+func dependencyStatus(d *ChartDependency) DependencyStatus {
+	switch {
+	case d.Vendored == "":
+		return DependencyMissing
+	case !satisfies(d.Vendored, d.Version), d.Locked != "" && d.Locked != d.Vendored:
+		return DependencyWrongVersion
+	case d.Latest != "" && newerVersion(d.Latest, d.Vendored):
+		return DependencyOutdated
+	}
+	return DependencyOK
+}
+
+// newerVersion reports whether semver a is greater than b.
+func newerVersion(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	return errA == nil && errB == nil && va.GreaterThan(vb)
+}
+
+// vendoredResults reports the dependencies of meta as vendored at their
+// resolved versions.
+func vendoredResults(resolved []*resolvedDependency) []*ChartDependency {
+	results := make([]*ChartDependency, 0, len(resolved))
+	for _, r := range resolved {
+		results = append(results, &ChartDependency{
+			Name:       r.dep.Name,
+			Alias:      r.dep.Alias,
+			Version:    r.dep.Version,
+			Repository: r.dep.Repository,
+			Locked:     r.version,
+			Vendored:   r.version,
+			Status:     DependencyOK,
+		})
+	}
+	return results
+}
@@ -0,0 +1,226 @@
+package helmutils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// writeParentChart writes an umbrella chart depending on webapp from the
+// "local" repository, on a sibling chart directory "lib", and on a chart
+// vendored unpacked under charts/. It returns the chart directory.
+func writeParentChart(t *testing.T, dir, webappVersion string) string {
+	t.Helper()
+	chartDir := filepath.Join(dir, "parent")
+	files := map[string]string{
+		"Chart.yaml": `apiVersion: v2
+name: parent
+version: 0.1.0
+dependencies:
+  - name: webapp
+    version: "` + webappVersion + `"
+    repository: "@local"
+  - name: lib
+    version: ">=0.1.0"
+    repository: file://../lib
+  - name: bundled
+    version: 2.0.0
+`,
+		"templates/configmap.yaml":        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: parent\n",
+		"charts/bundled/Chart.yaml":       "apiVersion: v2\nname: bundled\nversion: 2.0.0\n",
+		"../lib/Chart.yaml":               "apiVersion: v2\nname: lib\nversion: 0.1.0\n",
+		"../lib/templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: lib\n",
+	}
+	for name, content := range files {
+		full := filepath.Join(chartDir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chartDir
+}
+
+// dependencyStatuses maps dependency names to "status vendored latest".
+func dependencyStatuses(deps []*ChartDependency) map[string]string {
+	m := make(map[string]string, len(deps))
+	for _, d := range deps {
+		m[d.Name] = string(d.Status) + " " + d.Vendored + " " + d.Latest
+	}
+	return m
+}
+
+func checkStatuses(t *testing.T, what string, deps []*ChartDependency, want map[string]string) {
+	t.Helper()
+	got := dependencyStatuses(deps)
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s: %s = %q, want %q", what, name, got[name], w)
+		}
+	}
+}
+
+func TestClient_Dependencies(t *testing.T) {
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0", "1.0.1", "1.1.0")
+	client := newRepoTestClient(t)
+	if err := client.AddRepository("local", "file://"+repoDir, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+	chartDir := writeParentChart(t, t.TempDir(), "~1.0.0")
+	chartsDir := filepath.Join(chartDir, "charts")
+
+	deps, err := client.ListDependencies(chartDir)
+	if err != nil {
+		t.Fatalf("ListDependencies() error: %v", err)
+	}
+	checkStatuses(t, "before update", deps, map[string]string{
+		"webapp":  "missing  1.0.1",
+		"lib":     "missing  0.1.0",
+		"bundled": "ok 2.0.0 ",
+	})
+
+	deps, err = client.UpdateDependencies(chartDir)
+	if err != nil {
+		t.Fatalf("UpdateDependencies() error: %v", err)
+	}
+	checkStatuses(t, "update result", deps, map[string]string{"webapp": "ok 1.0.1 ", "lib": "ok 0.1.0 ", "bundled": "ok 2.0.0 "})
+	for _, archive := range []string{"webapp-1.0.1.tgz", "lib-0.1.0.tgz"} {
+		if _, err := os.Stat(filepath.Join(chartsDir, archive)); err != nil {
+			t.Errorf("%s not vendored: %v", archive, err)
+		}
+	}
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("loader.Load() of the updated chart error: %v", err)
+	}
+	if len(ch.Dependencies()) != 3 || ch.Lock == nil || len(ch.Lock.Dependencies) != 3 {
+		t.Fatalf("updated chart has %d dependencies and lock %+v, want 3 of each", len(ch.Dependencies()), ch.Lock)
+	}
+	if _, lock, stale, err := readChartDependencies(chartDir); err != nil || stale || lock == nil {
+		t.Errorf("Chart.lock digest does not match Chart.yaml: lock %v, stale %v, err %v", lock, stale, err)
+	}
+
+	lockPath := filepath.Join(chartDir, "Chart.lock")
+	lockData, _ := os.ReadFile(lockPath)
+	if _, err := client.UpdateDependencies(chartDir); err != nil {
+		t.Fatalf("second UpdateDependencies() error: %v", err)
+	}
+	if again, _ := os.ReadFile(lockPath); !bytes.Equal(again, lockData) {
+		t.Errorf("Chart.lock rewritten although nothing changed:\n%s\nwas\n%s", again, lockData)
+	}
+
+	// A new patch release shows up as outdated. Build keeps the locked
+	// version; update moves to the new one and drops the old archive.
+	writeTestRepo(t, repoDir, "1.0.2")
+	if err := client.UpdateRepositories(); err != nil {
+		t.Fatalf("UpdateRepositories() error: %v", err)
+	}
+	deps, _ = client.ListDependencies(chartDir)
+	checkStatuses(t, "after a new release", deps, map[string]string{"webapp": "outdated 1.0.1 1.0.2", "lib": "ok 0.1.0 0.1.0"})
+
+	os.Remove(filepath.Join(chartsDir, "webapp-1.0.1.tgz"))
+	deps, _ = client.ListDependencies(chartDir)
+	checkStatuses(t, "after deleting an archive", deps, map[string]string{"webapp": "missing  1.0.2"})
+	if _, err := client.BuildDependencies(chartDir); err != nil {
+		t.Fatalf("BuildDependencies() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chartsDir, "webapp-1.0.1.tgz")); err != nil {
+		t.Errorf("BuildDependencies() did not restore the locked version: %v", err)
+	}
+
+	if _, err := client.UpdateDependencies(chartDir); err != nil {
+		t.Fatalf("UpdateDependencies() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chartsDir, "webapp-1.0.1.tgz")); !os.IsNotExist(err) {
+		t.Errorf("old webapp archive still vendored: %v", err)
+	}
+	deps, _ = client.ListDependencies(chartDir)
+	checkStatuses(t, "after update", deps, map[string]string{"webapp": "ok 1.0.2 1.0.2"})
+	for _, d := range deps {
+		if d.Name == "webapp" && d.Locked != "1.0.2" {
+			t.Errorf("webapp locked at %q, want 1.0.2", d.Locked)
+		}
+	}
+
+	// Tightening the constraint leaves the vendored chart and the lock behind.
+	chartDir = writeParentChart(t, filepath.Dir(chartDir), "~1.1.0")
+	deps, _ = client.ListDependencies(chartDir)
+	checkStatuses(t, "after changing the constraint", deps, map[string]string{"webapp": "wrong-version 1.0.2 1.1.0"})
+	if _, err := client.BuildDependencies(chartDir); err == nil {
+		t.Error("BuildDependencies() with a stale Chart.lock expected error, got nil")
+	}
+	if _, err := client.UpdateDependencies(chartDir); err != nil {
+		t.Fatalf("UpdateDependencies() error: %v", err)
+	}
+	deps, _ = client.ListDependencies(chartDir)
+	checkStatuses(t, "after updating to the new constraint", deps, map[string]string{"webapp": "ok 1.1.0 1.1.0"})
+}
+
+func TestClient_DependencyErrors(t *testing.T) {
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0")
+	client := newRepoTestClient(t)
+	repoURL := "file://" + repoDir
+	if err := client.AddRepository("local", repoURL, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+
+	write := func(t *testing.T, deps string) string {
+		dir := filepath.Join(t.TempDir(), "parent")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: parent\nversion: 0.1.0\ndependencies:\n"+deps), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	t.Run("repository by URL", func(t *testing.T) {
+		dir := write(t, "  - name: webapp\n    version: 1.0.0\n    repository: "+repoURL+"/\n")
+		if _, err := client.UpdateDependencies(dir); err != nil {
+			t.Fatalf("UpdateDependencies() error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "charts", "webapp-1.0.0.tgz")); err != nil {
+			t.Errorf("webapp not vendored from the configured repository URL: %v", err)
+		}
+	})
+
+	for name, deps := range map[string]string{
+		"unknown repository":    "  - name: webapp\n    version: 1.0.0\n    repository: \"@nope\"\n",
+		"unavailable version":   "  - name: webapp\n    version: ~9.0.0\n    repository: \"@local\"\n",
+		"unvendored local only": "  - name: bundled\n    version: 1.0.0\n",
+		"missing local chart":   "  - name: lib\n    repository: file://../lib\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := write(t, deps)
+			if _, err := client.UpdateDependencies(dir); !errors.Is(err, ErrChartNotFound) {
+				t.Errorf("UpdateDependencies() error = %v, want ErrChartNotFound", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "Chart.lock")); !os.IsNotExist(err) {
+				t.Error("Chart.lock written although the update failed")
+			}
+		})
+	}
+
+	t.Run("not a chart directory", func(t *testing.T) {
+		if _, err := client.ListDependencies(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("ListDependencies() of a missing chart expected error, got nil")
+		}
+	})
+
+	t.Run("no dependencies", func(t *testing.T) {
+		dir := write(t, "")
+		deps, err := client.UpdateDependencies(dir)
+		if err != nil || len(deps) != 0 {
+			t.Errorf("UpdateDependencies() = %v, %v, want no dependencies", deps, err)
+		}
+	})
+}
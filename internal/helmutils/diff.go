@@ -0,0 +1,174 @@
+package helmutils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// ResourceChange describes how a Kubernetes object differs between two manifests.
+type ResourceChange string
+
+const (
+	// ResourceAdded marks an object only present in the new manifest.
+	ResourceAdded ResourceChange = "added"
+	// ResourceRemoved marks an object only present in the current manifest.
+	ResourceRemoved ResourceChange = "removed"
+	// ResourceChanged marks an object present in both manifests with different content.
+	ResourceChanged ResourceChange = "changed"
+)
+
+// ResourceDiff is the difference for a single Kubernetes object.
+type ResourceDiff struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace,omitempty"`
+	Name      string         `json:"name"`
+	Change    ResourceChange `json:"change"`
+	// Diff is a unified diff of the object's YAML, current first.
+	Diff string `json:"diff,omitempty"`
+}
+
+// Key identifies the object as kind/namespace/name. Cluster-scoped objects
+// have an empty namespace segment.
+func (d ResourceDiff) Key() string {
+	return resourceKey(d.Kind, d.Namespace, d.Name)
+}
+
+// ReleaseDiff is the per-resource difference between a release's current
+// revision and the manifest a proposed upgrade would apply.
+type ReleaseDiff struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	CurrentRevision int    `json:"currentRevision"`
+	CurrentChart    string `json:"currentChart"`
+	TargetChart     string `json:"targetChart"`
+	// Resources lists only added, removed and changed objects, ordered by key.
+	Resources []ResourceDiff `json:"resources"`
+}
+
+// HasChanges reports whether any resource would be added, removed or changed.
+func (d *ReleaseDiff) HasChanges() bool {
+	return d != nil && len(d.Resources) > 0
+}
+
+// clusterScopedKinds lists the built-in kinds that never carry a namespace.
+// Without a cluster to ask, every other kind is assumed to be namespaced.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"IngressClass":                   true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"PersistentVolume":               true,
+	"PriorityClass":                  true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// manifestObject is one object parsed from a rendered manifest.
+type manifestObject struct {
+	apiVersion            string
+	kind, namespace, name string
+	yaml                  string // normalized so formatting and comments don't show up as changes
+}
+
+func resourceKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// parseManifest splits a rendered release manifest into objects keyed by
+// kind/namespace/name. Objects without a namespace are placed in
+// defaultNamespace unless their kind is cluster-scoped.
+func parseManifest(manifest, defaultNamespace string) (map[string]manifestObject, error) {
+	objects := make(map[string]manifestObject)
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest document: %w", err)
+		}
+		if len(obj) == 0 {
+			continue // comment-only or empty document
+		}
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if kind == "" || name == "" {
+			return nil, fmt.Errorf("manifest document is missing kind or metadata.name:\n%s", doc)
+		}
+		namespace, _ := metadata["namespace"].(string)
+		if namespace == "" && !clusterScopedKinds[kind] {
+			namespace = defaultNamespace
+		}
+		normalized, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize %s %q: %w", kind, name, err)
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		objects[resourceKey(kind, namespace, name)] = manifestObject{apiVersion: apiVersion, kind: kind, namespace: namespace, name: name, yaml: string(normalized)}
+	}
+	return objects, nil
+}
+
+// diffManifests compares two rendered manifests object by object.
+func diffManifests(current, target, defaultNamespace string) ([]ResourceDiff, error) {
+	before, err := parseManifest(current, defaultNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("current manifest: %w", err)
+	}
+	after, err := parseManifest(target, defaultNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("target manifest: %w", err)
+	}
+
+	diffs := []ResourceDiff{}
+	for key, old := range before {
+		d := ResourceDiff{Kind: old.kind, Namespace: old.namespace, Name: old.name}
+		cur, ok := after[key]
+		switch {
+		case !ok:
+			d.Change = ResourceRemoved
+			d.Diff = unifiedDiff(key, old.yaml, "")
+		case cur.yaml != old.yaml:
+			d.Change = ResourceChanged
+			d.Diff = unifiedDiff(key, old.yaml, cur.yaml)
+		default:
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+	for key, obj := range after {
+		if _, ok := before[key]; ok {
+			continue
+		}
+		diffs = append(diffs, ResourceDiff{
+			Kind:      obj.kind,
+			Namespace: obj.namespace,
+			Name:      obj.name,
+			Change:    ResourceAdded,
+			Diff:      unifiedDiff(key, "", obj.yaml),
+		})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key() < diffs[j].Key() })
+	return diffs, nil
+}
+
+func unifiedDiff(key, before, after string) string {
+	out, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: "current/" + key,
+		ToFile:   "target/" + key,
+		Context:  3,
+	})
+	if err != nil {
+		// Writing to an in-memory buffer does not fail; fall back to no diff text.
+		return ""
+	}
+	return strings.TrimRight(out, "\n")
+}
@@ -0,0 +1,105 @@
+package helmutils
+
+import (
+	"errors"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Errors returned by HelmClient implementations, wrapped with context about
+// the failed call. Test for them with errors.Is.
+var (
+	// ErrReleaseNotFound means the release, or the requested revision of it,
+	// does not exist. It is Helm's own storage error, so errors from Helm
+	// actions match it too.
+	ErrReleaseNotFound = driver.ErrReleaseNotFound
+	// ErrReleaseExists means an install used a name that is still in use.
+	ErrReleaseExists = driver.ErrReleaseExists
+	// ErrChartNotFound means a chart reference could not be resolved: an
+	// unknown repository, or no chart or version matching the request.
+	ErrChartNotFound = errors.New("chart not found")
+	// ErrRepoUnreachable means a chart repository or OCI registry could not
+	// be fetched from.
+	ErrRepoUnreachable = errors.New("repository unreachable")
+	// ErrPendingOperation means another install, upgrade, rollback or
+	// uninstall of the release has not finished.
+	ErrPendingOperation = errors.New("another operation (install/upgrade/rollback) is in progress")
+	// ErrInvalidValues means the supplied values could not be parsed or do
+	// not satisfy the chart's values schema.
+	ErrInvalidValues = errors.New("invalid values")
+	// ErrVerificationFailed means a chart's provenance file is missing, not
+	// signed by a trusted key, or does not match the chart archive.
+	ErrVerificationFailed = errors.New("chart verification failed")
+)
+
+// ReleaseError is returned for failed operations on a named release. Use
+// errors.As to find out which release an error is about; Err usually wraps
+// one of the sentinel errors above.
+type ReleaseError struct {
+	Op        string // install, upgrade, rollback, uninstall, ...
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *ReleaseError) Error() string {
+	return fmt.Sprintf("%s: release %q in namespace %q: %v", e.Op, e.Name, e.Namespace, e.Err)
+}
+
+func (e *ReleaseError) Unwrap() error { return e.Err }
+
+// OperationInProgressError is returned, wrapped in a *ReleaseError, when an
+// install, upgrade, rollback or uninstall is refused because another one is
+// still changing the same release. It matches ErrPendingOperation.
+type OperationInProgressError struct {
+	Op string // the operation holding the release
+}
+
+func (e *OperationInProgressError) Error() string {
+	return fmt.Sprintf("%v: %s still running", ErrPendingOperation, e.Op)
+}
+
+func (e *OperationInProgressError) Is(target error) bool { return target == ErrPendingOperation }
+
+// Exit codes used by the command-line tools, so scripts can tell failures
+// apart without parsing messages. 2 is not used: the flag package exits with
+// it on invalid flags.
+const (
+	ExitCodeError              = 1
+	ExitCodeReleaseNotFound    = 3
+	ExitCodeReleaseExists      = 4
+	ExitCodeChartNotFound      = 5
+	ExitCodeRepoUnreachable    = 6
+	ExitCodePendingOperation   = 7
+	ExitCodeInvalidValues      = 8
+	ExitCodeVerificationFailed = 9
+	// ExitCodeChanges reports a condition rather than an error: 'helmctl
+	// diff --detailed-exitcode' found changes.
+	ExitCodeChanges = 10
+)
+
+// ExitCode maps err to the exit code a command-line tool should finish with.
+// Errors that are not part of the taxonomy map to ExitCodeError.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrReleaseNotFound):
+		return ExitCodeReleaseNotFound
+	case errors.Is(err, ErrReleaseExists):
+		return ExitCodeReleaseExists
+	case errors.Is(err, ErrChartNotFound):
+		return ExitCodeChartNotFound
+	case errors.Is(err, ErrRepoUnreachable):
+		return ExitCodeRepoUnreachable
+	case errors.Is(err, ErrPendingOperation):
+		return ExitCodePendingOperation
+	case errors.Is(err, ErrInvalidValues):
+		return ExitCodeInvalidValues
+	case errors.Is(err, ErrVerificationFailed):
+		return ExitCodeVerificationFailed
+	default:
+		return ExitCodeError
+	}
+}
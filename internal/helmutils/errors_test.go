@@ -0,0 +1,143 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestClient_ErrorTaxonomy(t *testing.T) {
+	client := newRepoTestClient(t)
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"details of missing release", func() error {
+			_, err := client.GetReleaseDetails("store-ns", "missing")
+			return err
+		}, ErrReleaseNotFound},
+		{"history of missing release", func() error {
+			_, err := client.GetReleaseHistory("store-ns", "missing")
+			return err
+		}, ErrReleaseNotFound},
+		{"uninstall of missing release", func() error {
+			_, err := client.UninstallRelease("store-ns", "missing", false, time.Minute)
+			return err
+		}, ErrReleaseNotFound},
+		{"upgrade of missing release", func() error {
+			_, err := client.UpgradeRelease("store-ns", "missing", "repo/app", "", nil, false, time.Minute, false, false)
+			return err
+		}, ErrReleaseNotFound},
+		{"rollback to missing revision", func() error {
+			_, err := client.RollbackRelease("store-ns", "app", 7, false, time.Minute, false)
+			return err
+		}, ErrReleaseNotFound},
+		{"values of missing revision", func() error {
+			_, err := client.GetReleaseValues("store-ns", "app", 7, false)
+			return err
+		}, ErrReleaseNotFound},
+		{"install over existing release", func() error {
+			_, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute)
+			return err
+		}, ErrReleaseExists},
+		{"chart without repository", func() error {
+			_, err := client.EnsureChart("nginx", "")
+			return err
+		}, ErrChartNotFound},
+		{"chart in unknown repository", func() error {
+			_, err := client.EnsureChart("nowhere/nginx", "")
+			return err
+		}, ErrChartNotFound},
+		{"unreachable repository", func() error {
+			return client.AddRepository("down", "http://127.0.0.1:1/charts", "", "", false)
+		}, ErrRepoUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want errors.Is(%v)", err, tt.want)
+			}
+			if got, want := ExitCode(err), ExitCode(tt.want); got != want {
+				t.Errorf("ExitCode() = %d, want %d", got, want)
+			}
+		})
+	}
+
+	t.Run("release errors identify the release", func(t *testing.T) {
+		_, err := client.UninstallRelease("store-ns", "missing", false, time.Minute)
+		var relErr *ReleaseError
+		if !errors.As(err, &relErr) {
+			t.Fatalf("error %v is not a *ReleaseError", err)
+		}
+		if relErr.Op != "uninstall" || relErr.Namespace != "store-ns" || relErr.Name != "missing" {
+			t.Errorf("ReleaseError = %+v, want uninstall of store-ns/missing", relErr)
+		}
+		if !errors.Is(err, driver.ErrReleaseNotFound) {
+			t.Error("ErrReleaseNotFound should match Helm's storage driver error")
+		}
+	})
+
+	t.Run("pending operation", func(t *testing.T) {
+		client.OperationDelay = time.Hour
+		defer func() { client.OperationDelay = 0 }()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := client.UpgradeReleaseContext(ctx, "store-ns", "app", "repo/app", "1.1.0", nil, false, time.Minute, false, false); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("UpgradeRelease() error = %v, want context.DeadlineExceeded", err)
+		}
+		_, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.2.0", nil, false, time.Minute, false, false)
+		if !errors.Is(err, ErrPendingOperation) || ExitCode(err) != ExitCodePendingOperation {
+			t.Errorf("UpgradeRelease() of a pending release error = %v, want ErrPendingOperation", err)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		chartDir := writeTestChart(t, t.TempDir())
+		schema := `{"type": "object", "properties": {"replicaCount": {"type": "integer"}}}`
+		if err := os.WriteFile(filepath.Join(chartDir, "values.schema.json"), []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := client.InstallChart("store-ns", "schema", chartDir, "", map[string]interface{}{"replicaCount": "three"}, false, false, time.Minute)
+		if !errors.Is(err, ErrInvalidValues) || ExitCode(err) != ExitCodeInvalidValues {
+			t.Errorf("InstallChart() with values violating the schema error = %v, want ErrInvalidValues", err)
+		}
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("boom"), ExitCodeError},
+		{fmt.Errorf("wrapped: %w", ErrReleaseNotFound), ExitCodeReleaseNotFound},
+		{&ReleaseError{Op: "install", Err: ErrReleaseExists}, ExitCodeReleaseExists},
+		{fmt.Errorf("a: %w", ErrChartNotFound), ExitCodeChartNotFound},
+		{errors.Join(errors.New("other"), ErrRepoUnreachable), ExitCodeRepoUnreachable},
+		{ErrPendingOperation, ExitCodePendingOperation},
+		{ErrInvalidValues, ExitCodeInvalidValues},
+	}
+	seen := make(map[int]bool)
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+		if seen[tt.want] {
+			t.Errorf("exit code %d is used for more than one error", tt.want)
+		}
+		seen[tt.want] = true
+	}
+}
@@ -0,0 +1,450 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	"sigs.k8s.io/yaml"
+)
+
+// ReleaseGroup is a declarative set of releases that are installed, upgraded
+// and removed together, in the order their dependencies require.
+type ReleaseGroup struct {
+	Releases []GroupRelease `json:"releases"`
+}
+
+// GroupRelease is one release of a ReleaseGroup.
+type GroupRelease struct {
+	// Name is the release name. It must be unique within the group, since
+	// DependsOn refers to releases by name.
+	Name string `json:"name"`
+	// Namespace defaults to GroupOptions.Namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Chart is a chart reference as for install. LoadReleaseGroup resolves
+	// relative chart directories and archives against the spec file.
+	Chart   string `json:"chart"`
+	Version string `json:"version,omitempty"`
+	// ValuesFile is read by LoadReleaseGroup, relative to the spec file.
+	ValuesFile string `json:"valuesFile,omitempty"`
+	// Values are merged over those from ValuesFile.
+	Values map[string]interface{} `json:"values,omitempty"`
+	// DependsOn names the releases that must be deployed before this one
+	// and removed after it.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// GroupOptions controls ApplyReleaseGroup and DestroyReleaseGroup.
+type GroupOptions struct {
+	// Namespace is used for releases that do not set one. When empty the
+	// client's default namespace applies.
+	Namespace string
+	// Parallelism caps how many releases are changed at once. Zero means
+	// no limit beyond what the dependencies allow.
+	Parallelism int
+	Wait        bool
+	// Timeout applies to each release operation.
+	Timeout time.Duration
+	// RollbackOnFailure reverts every release changed by a failed apply:
+	// upgraded releases are rolled back to their previous revision and
+	// newly installed ones are uninstalled.
+	RollbackOnFailure bool
+	// KeepHistory keeps the history of releases removed by DestroyReleaseGroup.
+	KeepHistory bool
+}
+
+// GroupReleaseStatus is the outcome of one release of a group operation.
+type GroupReleaseStatus string
+
+const (
+	GroupReleaseInstalled   GroupReleaseStatus = "installed"
+	GroupReleaseUpgraded    GroupReleaseStatus = "upgraded"
+	GroupReleaseUninstalled GroupReleaseStatus = "uninstalled"
+	GroupReleaseNotFound    GroupReleaseStatus = "not-found"   // destroy of a release that was not installed
+	GroupReleaseFailed      GroupReleaseStatus = "failed"      // the operation on this release failed
+	GroupReleaseSkipped     GroupReleaseStatus = "skipped"     // not attempted because an earlier release failed
+	GroupReleaseRolledBack  GroupReleaseStatus = "rolled-back" // reverted after another release failed
+)
+
+// GroupReleaseResult reports what a group operation did to one release.
+type GroupReleaseResult struct {
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace"`
+	Status    GroupReleaseStatus `json:"status"`
+	Revision  int                `json:"revision,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// LoadReleaseGroup reads a release group spec from a YAML file, loads the
+// values files it refers to, resolves local chart paths and validates it.
+func LoadReleaseGroup(path string) (*ReleaseGroup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release group %s: %w", path, err)
+	}
+	group := &ReleaseGroup{}
+	if err := yaml.UnmarshalStrict(data, group); err != nil {
+		return nil, fmt.Errorf("failed to parse release group %s: %w", path, err)
+	}
+	for i := range group.Releases {
+		r := &group.Releases[i]
+		r.Chart = resolveGroupChart(filepath.Dir(path), r.Chart)
+		if r.ValuesFile == "" {
+			continue
+		}
+		valuesPath := r.ValuesFile
+		if !filepath.IsAbs(valuesPath) {
+			valuesPath = filepath.Join(filepath.Dir(path), valuesPath)
+		}
+		raw, err := os.ReadFile(valuesPath)
+		if err != nil {
+			return nil, fmt.Errorf("release %q: failed to read values file: %w", r.Name, err)
+		}
+		fileVals := map[string]interface{}{}
+		if err := yaml.Unmarshal(raw, &fileVals); err != nil {
+			return nil, fmt.Errorf("release %q: failed to parse values file %s: %w: %w", r.Name, valuesPath, ErrInvalidValues, err)
+		}
+		r.Values = mergePatch(fileVals, copyValues(r.Values)).(map[string]interface{})
+	}
+	if err := group.Validate(); err != nil {
+		return nil, fmt.Errorf("release group %s: %w", path, err)
+	}
+	return group, nil
+}
+
+// resolveGroupChart returns chart relative to dir when it names a local chart:
+// a path that exists there, or one starting with ./ or ../. Absolute paths,
+// URLs and <repo>/<chart> references are returned unchanged.
+func resolveGroupChart(dir, chart string) string {
+	if chart == "" || filepath.IsAbs(chart) || strings.Contains(chart, "://") {
+		return chart
+	}
+	local := filepath.Join(dir, chart)
+	if _, err := os.Stat(local); err == nil || strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "../") {
+		return local
+	}
+	return chart
+}
+
+// Validate checks that release names are unique, every release has a chart,
+// and dependencies name releases of the group without forming a cycle.
+func (g *ReleaseGroup) Validate() error {
+	if len(g.Releases) == 0 {
+		return fmt.Errorf("no releases defined")
+	}
+	byName := make(map[string]*GroupRelease, len(g.Releases))
+	for i := range g.Releases {
+		r := &g.Releases[i]
+		if r.Name == "" {
+			return fmt.Errorf("release %d has no name", i)
+		}
+		if r.Chart == "" {
+			return fmt.Errorf("release %q has no chart", r.Name)
+		}
+		if byName[r.Name] != nil {
+			return fmt.Errorf("release %q is defined more than once", r.Name)
+		}
+		byName[r.Name] = r
+	}
+	for _, r := range g.Releases {
+		for _, dep := range r.DependsOn {
+			if byName[dep] == nil {
+				return fmt.Errorf("release %q depends on unknown release %q", r.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first search for cycles: a release reached again while it is
+	// still on the path depends on itself.
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int, len(g.Releases))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case onPath:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case done:
+			return nil
+		}
+		state[name] = onPath
+		for _, dep := range byName[name].DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, r := range g.Releases {
+		if err := visit(r.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyReleaseGroup installs or upgrades every release of the group. A
+// release starts once all releases it depends on are deployed; independent
+// releases run in parallel. After the first failure no further releases are
+// started, and with opts.RollbackOnFailure the releases changed so far are
+// reverted. The result lists every release in spec order; the error joins
+// the failures.
+func ApplyReleaseGroup(ctx context.Context, client HelmClient, group *ReleaseGroup, opts GroupOptions) ([]*GroupReleaseResult, error) {
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	results, byName := newGroupResults(group, opts)
+
+	// previous records the revision each release was at before it was
+	// changed, or nil if it was not installed, for rolling back.
+	var mu sync.Mutex
+	previous := make(map[string]*ReleaseInfo)
+	var changed []string // in the order releases were attempted
+
+	prereqs := make(map[string][]string, len(group.Releases))
+	for _, r := range group.Releases {
+		prereqs[r.Name] = r.DependsOn
+	}
+	errs := runInOrder(ctx, releaseNames(group), prereqs, opts.Parallelism, func(ctx context.Context, name string) error {
+		spec, res := byName[name], results[indexOf(group, name)]
+		prev, err := client.GetReleaseDetailsContext(ctx, res.Namespace, name)
+		switch {
+		case errors.Is(err, ErrReleaseNotFound):
+			prev = nil
+		case err != nil:
+			return err
+		case prev.Status == release.StatusUninstalled:
+			prev = nil
+		}
+		mu.Lock()
+		previous[name] = prev
+		changed = append(changed, name)
+		mu.Unlock()
+
+		info, err := client.UpgradeReleaseWithOptionsContext(ctx, UpgradeOptions{
+			Namespace:    res.Namespace,
+			ReleaseName:  name,
+			ChartName:    spec.Chart,
+			ChartVersion: spec.Version,
+			Values:       copyValues(spec.Values),
+			Wait:         opts.Wait,
+			Timeout:      opts.Timeout,
+			Install:      true,
+		})
+		if err != nil {
+			return err
+		}
+		res.Revision = info.Revision
+		res.Status = GroupReleaseUpgraded
+		if prev == nil {
+			res.Status = GroupReleaseInstalled
+		}
+		return nil
+	})
+
+	failure := collectGroupErrors(ctx, group, results, errs)
+	if failure == nil || !opts.RollbackOnFailure {
+		return results, failure
+	}
+
+	// Revert newest first, so dependents are reverted before what they
+	// depend on. The failure may have been a cancelled ctx, so reverting
+	// must not depend on it.
+	revertCtx := context.WithoutCancel(ctx)
+	var revertErrs []error
+	for i := len(changed) - 1; i >= 0; i-- {
+		name := changed[i]
+		res := results[indexOf(group, name)]
+		status, err := revertRelease(revertCtx, client, res.Namespace, name, previous[name], opts)
+		if err != nil {
+			revertErrs = append(revertErrs, fmt.Errorf("rolling back release %q: %w", name, err))
+			continue
+		}
+		if status == "" {
+			continue
+		}
+		if res.Status != GroupReleaseFailed {
+			res.Status = status
+		}
+		res.Revision = 0
+		if status == GroupReleaseRolledBack {
+			if info, err := client.GetReleaseDetailsContext(revertCtx, res.Namespace, name); err == nil {
+				res.Revision = info.Revision
+			}
+		}
+	}
+	return results, errors.Join(append([]error{failure}, revertErrs...)...)
+}
+
+// revertRelease undoes an apply of one release: it rolls back to prev, or
+// uninstalls the release if prev is nil. It returns an empty status when
+// there is nothing to undo.
+func revertRelease(ctx context.Context, client HelmClient, namespace, name string, prev *ReleaseInfo, opts GroupOptions) (GroupReleaseStatus, error) {
+	cur, err := client.GetReleaseDetailsContext(ctx, namespace, name)
+	if errors.Is(err, ErrReleaseNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if prev == nil {
+		if cur.Status == release.StatusUninstalled {
+			return "", nil
+		}
+		if _, err := client.UninstallReleaseContext(ctx, namespace, name, false, opts.Timeout); err != nil {
+			return "", err
+		}
+		return GroupReleaseUninstalled, nil
+	}
+	if cur.Revision == prev.Revision {
+		return "", nil
+	}
+	if _, err := client.RollbackReleaseContext(ctx, namespace, name, prev.Revision, opts.Wait, opts.Timeout, false); err != nil {
+		return "", err
+	}
+	return GroupReleaseRolledBack, nil
+}
+
+// DestroyReleaseGroup uninstalls every release of the group, each only
+// after the releases that depend on it are gone. Releases that are not
+// installed are reported as not found rather than as failures. After the
+// first failure no further releases are removed.
+func DestroyReleaseGroup(ctx context.Context, client HelmClient, group *ReleaseGroup, opts GroupOptions) ([]*GroupReleaseResult, error) {
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	results, _ := newGroupResults(group, opts)
+
+	// Reverse the dependencies: a release waits for its dependents.
+	prereqs := make(map[string][]string, len(group.Releases))
+	for _, r := range group.Releases {
+		for _, dep := range r.DependsOn {
+			prereqs[dep] = append(prereqs[dep], r.Name)
+		}
+	}
+	errs := runInOrder(ctx, releaseNames(group), prereqs, opts.Parallelism, func(ctx context.Context, name string) error {
+		res := results[indexOf(group, name)]
+		_, err := client.UninstallReleaseContext(ctx, res.Namespace, name, opts.KeepHistory, opts.Timeout)
+		switch {
+		case errors.Is(err, ErrReleaseNotFound):
+			res.Status = GroupReleaseNotFound
+		case err != nil:
+			return err
+		default:
+			res.Status = GroupReleaseUninstalled
+		}
+		return nil
+	})
+	return results, collectGroupErrors(ctx, group, results, errs)
+}
+
+func newGroupResults(group *ReleaseGroup, opts GroupOptions) ([]*GroupReleaseResult, map[string]*GroupRelease) {
+	results := make([]*GroupReleaseResult, len(group.Releases))
+	byName := make(map[string]*GroupRelease, len(group.Releases))
+	for i := range group.Releases {
+		r := &group.Releases[i]
+		ns := r.Namespace
+		if ns == "" {
+			ns = opts.Namespace
+		}
+		results[i] = &GroupReleaseResult{Name: r.Name, Namespace: ns, Status: GroupReleaseSkipped}
+		byName[r.Name] = r
+	}
+	return results, byName
+}
+
+// collectGroupErrors marks failed releases in results and joins their
+// errors. Releases skipped only because ctx ended report ctx.Err().
+func collectGroupErrors(ctx context.Context, group *ReleaseGroup, results []*GroupReleaseResult, errs map[string]error) error {
+	var failures []error
+	skipped := false
+	for i, r := range group.Releases {
+		if err := errs[r.Name]; err != nil {
+			results[i].Status = GroupReleaseFailed
+			results[i].Error = err.Error()
+			failures = append(failures, fmt.Errorf("release %q: %w", r.Name, err))
+		}
+		skipped = skipped || results[i].Status == GroupReleaseSkipped
+	}
+	if len(failures) == 0 && skipped && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(failures...)
+}
+
+func releaseNames(group *ReleaseGroup) []string {
+	names := make([]string, len(group.Releases))
+	for i, r := range group.Releases {
+		names[i] = r.Name
+	}
+	return names
+}
+
+func indexOf(group *ReleaseGroup, name string) int {
+	for i, r := range group.Releases {
+		if r.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// runInOrder calls fn for every name once all of its prerequisites have
+// succeeded, running at most parallelism calls at a time (no limit when
+// zero or less). After the first failure, or once ctx is done, no new calls
+// are started. It returns the errors of the calls that failed; names that
+// were never started have no entry.
+func runInOrder(ctx context.Context, names []string, prereqs map[string][]string, parallelism int, fn func(ctx context.Context, name string) error) map[string]error {
+	unmet := make(map[string]int, len(names))
+	dependents := make(map[string][]string)
+	var ready []string
+	for _, name := range names {
+		unmet[name] = len(prereqs[name])
+		for _, p := range prereqs[name] {
+			dependents[p] = append(dependents[p], name)
+		}
+		if unmet[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	type outcome struct {
+		name string
+		err  error
+	}
+	outcomes := make(chan outcome)
+	errs := make(map[string]error)
+	running := 0
+	for {
+		for len(errs) == 0 && ctx.Err() == nil && len(ready) > 0 && (parallelism <= 0 || running < parallelism) {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func() { outcomes <- outcome{name, fn(ctx, name)} }()
+		}
+		if running == 0 {
+			return errs
+		}
+		o := <-outcomes
+		running--
+		if o.err != nil {
+			errs[o.name] = o.err
+			continue
+		}
+		for _, d := range dependents[o.name] {
+			if unmet[d]--; unmet[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+}
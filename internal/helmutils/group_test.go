@@ -0,0 +1,350 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// productGroup is the release group used by the tests: app needs the
+// database, IAM and ingress; IAM needs the database.
+func productGroup() *ReleaseGroup {
+	return &ReleaseGroup{Releases: []GroupRelease{
+		{Name: "app", Chart: "repo/app", Version: "1.0.0", DependsOn: []string{"db", "iam", "ingress"}},
+		{Name: "db", Chart: "repo/postgres", Version: "1.0.0"},
+		{Name: "iam", Chart: "repo/keycloak", Version: "1.0.0", DependsOn: []string{"db"}},
+		{Name: "ingress", Namespace: "edge", Chart: "repo/nginx", Version: "1.0.0"},
+	}}
+}
+
+// groupRecorder wraps a Client's upgrades and uninstalls to record the order
+// and concurrency of the calls a group operation makes, optionally failing
+// some releases.
+type groupRecorder struct {
+	mu            sync.Mutex
+	started       []string
+	finished      map[string]time.Time
+	startedAt     map[string]time.Time
+	running, peak int
+	fail          map[string]error
+}
+
+func recordGroupCalls(client *Client) *groupRecorder {
+	rec := &groupRecorder{finished: map[string]time.Time{}, startedAt: map[string]time.Time{}, fail: map[string]error{}}
+	track := func(name string) func() {
+		rec.mu.Lock()
+		rec.started = append(rec.started, name)
+		rec.startedAt[name] = time.Now()
+		rec.running++
+		if rec.running > rec.peak {
+			rec.peak = rec.running
+		}
+		rec.mu.Unlock()
+		return func() {
+			rec.mu.Lock()
+			rec.running--
+			rec.finished[name] = time.Now()
+			rec.mu.Unlock()
+		}
+	}
+	client.UpgradeReleaseWithOptionsContextFunc = func(ctx context.Context, opts UpgradeOptions) (*ReleaseInfo, error) {
+		defer track(opts.ReleaseName)()
+		rec.mu.Lock()
+		err := rec.fail[opts.ReleaseName]
+		rec.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return client.upgradeRelease(ctx, opts)
+	}
+	return rec
+}
+
+func (rec *groupRecorder) before(t *testing.T, first, then string) {
+	t.Helper()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !rec.finished[first].Before(rec.startedAt[then]) {
+		t.Errorf("%s started before %s finished", then, first)
+	}
+}
+
+func TestReleaseGroup_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(g *ReleaseGroup)
+		wantErr string
+	}{
+		{"valid", func(g *ReleaseGroup) {}, ""},
+		{"empty", func(g *ReleaseGroup) { g.Releases = nil }, "no releases"},
+		{"missing chart", func(g *ReleaseGroup) { g.Releases[1].Chart = "" }, `"db" has no chart`},
+		{"duplicate", func(g *ReleaseGroup) { g.Releases[2].Name = "db"; g.Releases[2].DependsOn = nil }, "more than once"},
+		{"unknown dependency", func(g *ReleaseGroup) { g.Releases[3].DependsOn = []string{"cache"} }, `unknown release "cache"`},
+		{"cycle", func(g *ReleaseGroup) { g.Releases[1].DependsOn = []string{"app"} }, "dependency cycle: app -> db -> app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := productGroup()
+			tt.mutate(g)
+			err := g.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadReleaseGroup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "values"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "values", "db.yaml"), []byte("auth:\n  user: app\n  password: file\nreplicas: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spec := `releases:
+  - name: db
+    chart: repo/postgres
+    valuesFile: values/db.yaml
+    values:
+      auth:
+        password: inline
+      replicas: null
+  - name: app
+    chart: repo/app
+    dependsOn: [db]
+  - name: web
+    chart: charts/webapp
+`
+	chartDir := writeTestChart(t, filepath.Join(dir, "charts"))
+	specPath := filepath.Join(dir, "releases.yaml")
+	if err := os.WriteFile(specPath, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	group, err := LoadReleaseGroup(specPath)
+	if err != nil {
+		t.Fatalf("LoadReleaseGroup() error: %v", err)
+	}
+	vals := group.Releases[0].Values
+	auth, _ := vals["auth"].(map[string]interface{})
+	if auth["user"] != "app" || auth["password"] != "inline" {
+		t.Errorf("db values = %v, want inline values merged over the values file", vals)
+	}
+	if _, ok := vals["replicas"]; ok {
+		t.Errorf("db values = %v, want replicas removed by the inline null", vals)
+	}
+
+	// Local charts are found next to the spec, not in the working directory.
+	if got := group.Releases[0].Chart; got != "repo/postgres" {
+		t.Errorf("db chart = %q, want the repository reference unchanged", got)
+	}
+	if got := group.Releases[2].Chart; got != chartDir {
+		t.Errorf("web chart = %q, want %q", got, chartDir)
+	}
+	client := newStoreTestClient(t)
+	web := &ReleaseGroup{Releases: group.Releases[2:]}
+	if _, err := ApplyReleaseGroup(context.Background(), client, web, GroupOptions{Namespace: "store-ns", Timeout: time.Minute}); err != nil {
+		t.Errorf("ApplyReleaseGroup() with a local chart error: %v", err)
+	}
+
+	if err := os.WriteFile(specPath, []byte(spec+"    chartVersion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReleaseGroup(specPath); err == nil {
+		t.Error("LoadReleaseGroup() with an unknown field expected error, got nil")
+	}
+}
+
+func TestApplyReleaseGroup(t *testing.T) {
+	t.Run("dependency order with parallelism", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = 20 * time.Millisecond
+		rec := recordGroupCalls(client)
+
+		results, err := ApplyReleaseGroup(context.Background(), client, productGroup(), GroupOptions{Namespace: "store-ns", Timeout: time.Minute})
+		if err != nil {
+			t.Fatalf("ApplyReleaseGroup() error: %v", err)
+		}
+		for _, r := range results {
+			if r.Status != GroupReleaseInstalled || r.Revision != 1 {
+				t.Errorf("result %+v, want installed at revision 1", r)
+			}
+		}
+		if results[3].Namespace != "edge" || results[0].Namespace != "store-ns" {
+			t.Errorf("namespaces = %s, %s, want the release's own or the group default", results[3].Namespace, results[0].Namespace)
+		}
+		rec.before(t, "db", "iam")
+		for _, dep := range []string{"db", "iam", "ingress"} {
+			rec.before(t, dep, "app")
+		}
+		if rec.peak < 2 {
+			t.Errorf("at most %d releases ran at once, want db and ingress in parallel", rec.peak)
+		}
+
+		// Applying again upgrades every release.
+		results, err = ApplyReleaseGroup(context.Background(), client, productGroup(), GroupOptions{Namespace: "store-ns", Timeout: time.Minute})
+		if err != nil {
+			t.Fatalf("second ApplyReleaseGroup() error: %v", err)
+		}
+		for _, r := range results {
+			if r.Status != GroupReleaseUpgraded || r.Revision != 2 {
+				t.Errorf("result %+v, want upgraded to revision 2", r)
+			}
+		}
+	})
+
+	t.Run("parallelism limit", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = 5 * time.Millisecond
+		rec := recordGroupCalls(client)
+		if _, err := ApplyReleaseGroup(context.Background(), client, productGroup(), GroupOptions{Namespace: "store-ns", Parallelism: 1}); err != nil {
+			t.Fatalf("ApplyReleaseGroup() error: %v", err)
+		}
+		if rec.peak != 1 {
+			t.Errorf("%d releases ran at once, want 1", rec.peak)
+		}
+	})
+
+	t.Run("failure stops and rolls back", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		// db is already deployed; the rest of the group is new.
+		if _, err := client.InstallChart("store-ns", "db", "repo/postgres", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart() error: %v", err)
+		}
+		rec := recordGroupCalls(client)
+		rec.fail["ingress"] = ErrChartNotFound
+
+		group := productGroup()
+		group.Releases[3].DependsOn = []string{"iam"} // ingress now runs after db and iam
+		results, err := ApplyReleaseGroup(context.Background(), client, group, GroupOptions{Namespace: "store-ns", RollbackOnFailure: true, Parallelism: 1})
+		if !errors.Is(err, ErrChartNotFound) || !strings.Contains(err.Error(), `release "ingress"`) {
+			t.Fatalf("ApplyReleaseGroup() error = %v, want the ingress failure", err)
+		}
+		want := map[string]GroupReleaseStatus{
+			"app":     GroupReleaseSkipped,
+			"db":      GroupReleaseRolledBack,
+			"iam":     GroupReleaseUninstalled,
+			"ingress": GroupReleaseFailed,
+		}
+		for _, r := range results {
+			if r.Status != want[r.Name] {
+				t.Errorf("%s status = %s, want %s", r.Name, r.Status, want[r.Name])
+			}
+		}
+		for _, name := range rec.started {
+			if name == "app" {
+				t.Error("app was started although one of its dependencies failed")
+			}
+		}
+
+		db, err := client.GetReleaseDetails("store-ns", "db")
+		if err != nil || db.Revision != 3 || db.Status != release.StatusDeployed {
+			t.Errorf("db after rollback = %+v, %v, want revision 3 deployed", db, err)
+		}
+		if results[1].Revision != 3 {
+			t.Errorf("db result revision = %d, want 3", results[1].Revision)
+		}
+		if _, err := client.GetReleaseDetails("store-ns", "iam"); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("iam after rollback error = %v, want ErrReleaseNotFound", err)
+		}
+	})
+
+	t.Run("failure without rollback", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		rec := recordGroupCalls(client)
+		rec.fail["db"] = errors.New("boom")
+		results, err := ApplyReleaseGroup(context.Background(), client, productGroup(), GroupOptions{Namespace: "store-ns", Parallelism: 1})
+		if err == nil {
+			t.Fatal("ApplyReleaseGroup() expected error, got nil")
+		}
+		if results[1].Status != GroupReleaseFailed || results[1].Error != "boom" || results[2].Status != GroupReleaseSkipped {
+			t.Errorf("results db = %+v, iam = %+v, want db failed and iam skipped", results[1], results[2])
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results, err := ApplyReleaseGroup(ctx, client, productGroup(), GroupOptions{Namespace: "store-ns"})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("ApplyReleaseGroup() error = %v, want context.Canceled", err)
+		}
+		for _, r := range results {
+			if r.Status != GroupReleaseSkipped {
+				t.Errorf("%s status = %s, want skipped", r.Name, r.Status)
+			}
+		}
+	})
+}
+
+// uninstallRecorder records when each uninstall of the wrapped client starts
+// and finishes.
+type uninstallRecorder struct {
+	*Client
+	mu                sync.Mutex
+	started, finished map[string]time.Time
+}
+
+func (r *uninstallRecorder) UninstallReleaseContext(ctx context.Context, namespace, releaseName string, keepHistory bool, timeout time.Duration) (string, error) {
+	r.mu.Lock()
+	r.started[releaseName] = time.Now()
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.finished[releaseName] = time.Now()
+		r.mu.Unlock()
+	}()
+	return r.Client.UninstallReleaseContext(ctx, namespace, releaseName, keepHistory, timeout)
+}
+
+func TestDestroyReleaseGroup(t *testing.T) {
+	client := newStoreTestClient(t)
+	group := productGroup()
+	group.Releases = group.Releases[:3] // everything but ingress is installed
+	group.Releases[0].DependsOn = []string{"db", "iam"}
+	if _, err := ApplyReleaseGroup(context.Background(), client, group, GroupOptions{Namespace: "store-ns"}); err != nil {
+		t.Fatalf("ApplyReleaseGroup() error: %v", err)
+	}
+
+	client.OperationDelay = 5 * time.Millisecond
+	rec := &uninstallRecorder{Client: client, started: map[string]time.Time{}, finished: map[string]time.Time{}}
+	results, err := DestroyReleaseGroup(context.Background(), rec, productGroup(), GroupOptions{Namespace: "store-ns", KeepHistory: true})
+	if err != nil {
+		t.Fatalf("DestroyReleaseGroup() error: %v", err)
+	}
+	want := map[string]GroupReleaseStatus{
+		"app":     GroupReleaseUninstalled,
+		"db":      GroupReleaseUninstalled,
+		"iam":     GroupReleaseUninstalled,
+		"ingress": GroupReleaseNotFound,
+	}
+	for _, r := range results {
+		if r.Status != want[r.Name] {
+			t.Errorf("%s status = %s, want %s", r.Name, r.Status, want[r.Name])
+		}
+	}
+	rec.mu.Lock()
+	for _, pair := range [][2]string{{"app", "iam"}, {"app", "db"}, {"iam", "db"}} {
+		if !rec.finished[pair[0]].Before(rec.started[pair[1]]) {
+			t.Errorf("%s was uninstalled before %s, which depends on it", pair[1], pair[0])
+		}
+	}
+	rec.mu.Unlock()
+	if db, err := client.GetReleaseDetails("store-ns", "db"); err != nil || db.Status != release.StatusUninstalled {
+		t.Errorf("db after destroy = %+v, %v, want uninstalled with history kept", db, err)
+	}
+}
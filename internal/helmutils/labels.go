@@ -0,0 +1,75 @@
+package helmutils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// validateReleaseLabels checks that user-supplied release labels can be
+// stored as Kubernetes labels on the release record and do not clash with
+// the labels Helm's storage drivers set themselves (name, owner, status,
+// version, createdAt and modifiedAt).
+func validateReleaseLabels(lbls map[string]string) error {
+	if driver.ContainsSystemLabels(lbls) {
+		return fmt.Errorf("release labels may not use the reserved names %s: %w", strings.Join(driver.GetSystemLabels(), ", "), ErrInvalidValues)
+	}
+	keys := make([]string, 0, len(lbls))
+	for k := range lbls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid release label key %q: %s: %w", k, strings.Join(errs, "; "), ErrInvalidValues)
+		}
+		// "null" removes a label on upgrade, so it is never stored.
+		if v := lbls[k]; v != "null" {
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return fmt.Errorf("invalid value %q for release label %q: %s: %w", v, k, strings.Join(errs, "; "), ErrInvalidValues)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeReleaseLabels returns the labels of an upgraded release: those of the
+// previous revision overridden by desired, where a value of "null" removes
+// the label, as 'helm upgrade --labels' does.
+func mergeReleaseLabels(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		if v == "null" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// copyLabels returns a copy of lbls, dropping "null" values, or nil if
+// nothing is left.
+func copyLabels(lbls map[string]string) map[string]string {
+	return mergeReleaseLabels(nil, lbls)
+}
+
+// parseReleaseSelector parses a label selector such as
+// "team=payments,env!=prod" for ListOptions.Selector.
+func parseReleaseSelector(selector string) (labels.Selector, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+	}
+	return sel, nil
+}
@@ -0,0 +1,206 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/lint/support"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// LintSeverity is the severity of a LintMessage.
+type LintSeverity string
+
+const (
+	LintInfo    LintSeverity = "INFO"
+	LintWarning LintSeverity = "WARNING"
+	LintError   LintSeverity = "ERROR"
+)
+
+// LintMessage is one finding of LintChart.
+type LintMessage struct {
+	Severity LintSeverity `json:"severity"`
+	// Path is the chart file or directory the message is about, such as
+	// Chart.yaml or templates/deployment.yaml.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ChartVerification describes a chart archive whose provenance file checked
+// out against a keyring.
+type ChartVerification struct {
+	Chart       string   `json:"chart"`
+	FileHash    string   `json:"fileHash"`
+	SignedBy    []string `json:"signedBy"` // identities of the signing key
+	Fingerprint string   `json:"fingerprint"`
+}
+
+// PackageChart packages the chart directory chartPath into destDir, which is
+// created if needed, and returns the path of the archive. version and
+// appVersion, when not empty, override those in Chart.yaml. Dependencies
+// declared in Chart.yaml must already be vendored in charts/.
+func PackageChart(chartPath, destDir, version, appVersion string) (string, error) {
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read chart %s: %w", chartPath, err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("chart %s is not a directory", chartPath)
+	}
+	if destDir == "" {
+		destDir = "."
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create destination %s: %w", destDir, err)
+	}
+	p := action.NewPackage()
+	p.Version = version
+	p.AppVersion = appVersion
+	p.Destination = destDir
+	archive, err := p.Run(chartPath, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to package chart %s: %w", chartPath, err)
+	}
+	return archive, nil
+}
+
+// LintChart checks a chart directory or archive the way 'helm lint' does,
+// rendering its templates with vals. It returns every finding, errors first.
+// The error is non-nil when the chart could not be linted or a finding has
+// ERROR severity.
+func LintChart(chartPath string, vals map[string]interface{}) ([]*LintMessage, error) {
+	if vals == nil {
+		vals = map[string]interface{}{}
+	}
+	l := action.NewLint()
+	l.Namespace = "default"
+	result := l.Run([]string{chartPath}, vals)
+
+	messages := make([]*LintMessage, 0, len(result.Messages))
+	errorCount := 0
+	for _, m := range result.Messages {
+		msg := &LintMessage{Severity: lintSeverity(m.Severity), Path: m.Path, Message: m.Err.Error()}
+		if msg.Severity == LintError {
+			errorCount++
+		}
+		messages = append(messages, msg)
+	}
+	rank := map[LintSeverity]int{LintError: 0, LintWarning: 1, LintInfo: 2}
+	sort.SliceStable(messages, func(i, j int) bool { return rank[messages[i].Severity] < rank[messages[j].Severity] })
+
+	if result.TotalChartsLinted == 0 {
+		return messages, fmt.Errorf("failed to lint chart %s: %w", chartPath, result.Errors[0])
+	}
+	if errorCount > 0 {
+		return messages, fmt.Errorf("chart %s failed linting with %d error(s)", chartPath, errorCount)
+	}
+	return messages, nil
+}
+
+func lintSeverity(sev int) LintSeverity {
+	switch sev {
+	case support.ErrorSev:
+		return LintError
+	case support.WarningSev:
+		return LintWarning
+	default:
+		return LintInfo
+	}
+}
+
+// SignChart signs a chart archive with the private key in keyring whose
+// identity contains keyName and writes the provenance file next to it,
+// returning its path. passphrase unlocks the key if it is encrypted.
+func SignChart(archivePath, keyring, keyName string, passphrase []byte) (string, error) {
+	if fi, err := os.Stat(archivePath); err != nil {
+		return "", fmt.Errorf("failed to read chart archive %s: %w", archivePath, err)
+	} else if fi.IsDir() {
+		return "", fmt.Errorf("cannot sign chart directory %s: package it first", archivePath)
+	}
+	signer, err := provenance.NewFromKeyring(keyring, keyName)
+	if err != nil {
+		return "", fmt.Errorf("failed to load keyring %s: %w", keyring, err)
+	}
+	if err := signer.DecryptKey(func(string) ([]byte, error) { return passphrase, nil }); err != nil {
+		return "", fmt.Errorf("failed to unlock signing key %q: %w", keyName, err)
+	}
+	sig, err := signer.ClearSign(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign chart %s: %w", archivePath, err)
+	}
+	provPath := archivePath + ".prov"
+	if err := os.WriteFile(provPath, []byte(sig), 0644); err != nil {
+		return "", fmt.Errorf("failed to write provenance file %s: %w", provPath, err)
+	}
+	return provPath, nil
+}
+
+// VerifyChart checks a chart archive against the provenance file next to it
+// (archivePath + ".prov"): the signature must come from a key in keyring and
+// the archive must match the digest that was signed. Failures wrap
+// ErrVerificationFailed.
+func VerifyChart(archivePath, keyring string) (*ChartVerification, error) {
+	fi, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s: %w: %w", archivePath, ErrVerificationFailed, err)
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("chart %s: %w: only chart archives can be verified", archivePath, ErrVerificationFailed)
+	}
+	provPath := archivePath + ".prov"
+	if _, err := os.Stat(provPath); err != nil {
+		return nil, fmt.Errorf("chart %s: %w: no provenance file: %w", archivePath, ErrVerificationFailed, err)
+	}
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring %s: %w", keyring, err)
+	}
+	ver, err := sig.Verify(archivePath, provPath)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s: %w: %w", archivePath, ErrVerificationFailed, err)
+	}
+	v := &ChartVerification{Chart: filepath.Base(archivePath), FileHash: ver.FileHash}
+	if ver.SignedBy != nil {
+		for name := range ver.SignedBy.Identities {
+			v.SignedBy = append(v.SignedBy, name)
+		}
+		sort.Strings(v.SignedBy)
+		v.Fingerprint = strings.ToUpper(fmt.Sprintf("%x", ver.SignedBy.PrimaryKey.Fingerprint))
+	}
+	return v, nil
+}
+
+// verifyChart checks a chart the client is about to use when VerifyKeyring
+// is set.
+func (c *Client) verifyChart(chartPath string) error {
+	if c.VerifyKeyring == "" {
+		return nil
+	}
+	v, err := VerifyChart(chartPath, c.VerifyKeyring)
+	if err != nil {
+		return err
+	}
+	c.Log("Chart %s verified: signed by %s (%s)", v.Chart, strings.Join(v.SignedBy, ", "), v.Fingerprint)
+	return nil
+}
+
+// fetchProvenance downloads the provenance file published next to a chart
+// archive and saves it next to dest, when charts are being verified.
+func (c *Client) fetchProvenance(ctx context.Context, chartURL, dest, username, password string) error {
+	if c.VerifyKeyring == "" {
+		return nil
+	}
+	data, err := fetchURL(ctx, chartURL+".prov", username, password)
+	if err != nil {
+		return fmt.Errorf("chart %s: %w: failed to download provenance file: %w", chartURL, ErrVerificationFailed, err)
+	}
+	if err := os.WriteFile(dest+".prov", data, 0644); err != nil {
+		return fmt.Errorf("failed to save provenance file for %s: %w", chartURL, err)
+	}
+	return nil
+}
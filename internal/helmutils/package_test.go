@@ -0,0 +1,197 @@
+package helmutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// writeTestKeyring generates a signing key for name and writes it to a
+// secret keyring and a public keyring in dir, returning both paths.
+func writeTestKeyring(t *testing.T, dir, name string) (secring, pubring string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "test", name+"@example.com", nil)
+	if err != nil {
+		t.Fatalf("openpgp.NewEntity() error: %v", err)
+	}
+	secring = filepath.Join(dir, name+"-secring.gpg")
+	pubring = filepath.Join(dir, name+"-pubring.gpg")
+	for path, write := range map[string]func(f *os.File) error{
+		secring: func(f *os.File) error { return entity.SerializePrivate(f, nil) },
+		pubring: func(f *os.File) error { return entity.Serialize(f) },
+	} {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(f); err != nil {
+			t.Fatalf("failed to write keyring %s: %v", path, err)
+		}
+		f.Close()
+	}
+	return secring, pubring
+}
+
+func TestPackageChart(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+	dest := filepath.Join(t.TempDir(), "out")
+
+	archive, err := PackageChart(chartDir, dest, "", "")
+	if err != nil {
+		t.Fatalf("PackageChart() error: %v", err)
+	}
+	if want := filepath.Join(dest, "webapp-1.2.3.tgz"); archive != want {
+		t.Errorf("PackageChart() = %s, want %s", archive, want)
+	}
+
+	archive, err = PackageChart(chartDir, dest, "2.0.0-rc.1", "9.9")
+	if err != nil {
+		t.Fatalf("PackageChart() with overrides error: %v", err)
+	}
+	ch, err := loader.Load(archive)
+	if err != nil {
+		t.Fatalf("loader.Load() error: %v", err)
+	}
+	if ch.Metadata.Version != "2.0.0-rc.1" || ch.Metadata.AppVersion != "9.9" {
+		t.Errorf("packaged chart version %s appVersion %s, want 2.0.0-rc.1 and 9.9", ch.Metadata.Version, ch.Metadata.AppVersion)
+	}
+
+	if _, err := PackageChart(chartDir, dest, "not-semver", ""); err == nil {
+		t.Error("PackageChart() with an invalid version expected error, got nil")
+	}
+	if _, err := PackageChart(archive, dest, "", ""); err == nil {
+		t.Error("PackageChart() of an archive expected error, got nil")
+	}
+}
+
+func TestLintChart(t *testing.T) {
+	chartDir := writeTestChart(t, t.TempDir())
+
+	messages, err := LintChart(chartDir, nil)
+	if err != nil {
+		t.Fatalf("LintChart() error: %v", err)
+	}
+	found := false
+	for _, m := range messages {
+		if m.Severity == LintError {
+			t.Errorf("unexpected lint error: %+v", m)
+		}
+		if m.Severity == LintInfo && m.Path == "Chart.yaml" && strings.Contains(m.Message, "icon") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("LintChart() messages %v, want an INFO about the missing icon", messages)
+	}
+
+	broken := filepath.Join(chartDir, "templates", "broken.yaml")
+	if err := os.WriteFile(broken, []byte("kind: {{ .Values.missing.field }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	messages, err = LintChart(chartDir, map[string]interface{}{"replicaCount": 2})
+	if err == nil {
+		t.Fatal("LintChart() of a broken template expected error, got nil")
+	}
+	if len(messages) == 0 || messages[0].Severity != LintError || messages[0].Path != "templates/" {
+		t.Errorf("LintChart() messages %v, want an ERROR for templates/ first", messages)
+	}
+
+	if _, err := LintChart(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Error("LintChart() of a missing chart expected error, got nil")
+	}
+}
+
+func TestSignAndVerifyChart(t *testing.T) {
+	keyDir := t.TempDir()
+	secring, pubring := writeTestKeyring(t, keyDir, "release-bot")
+	_, otherring := writeTestKeyring(t, keyDir, "someone-else")
+	archive, err := PackageChart(writeTestChart(t, t.TempDir()), t.TempDir(), "", "")
+	if err != nil {
+		t.Fatalf("PackageChart() error: %v", err)
+	}
+
+	if _, err := VerifyChart(archive, pubring); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("VerifyChart() without a provenance file error = %v, want ErrVerificationFailed", err)
+	}
+	if _, err := SignChart(archive, secring, "nobody", nil); err == nil {
+		t.Error("SignChart() with an unknown key expected error, got nil")
+	}
+	prov, err := SignChart(archive, secring, "release-bot", nil)
+	if err != nil {
+		t.Fatalf("SignChart() error: %v", err)
+	}
+	if prov != archive+".prov" {
+		t.Errorf("SignChart() = %s, want %s.prov", prov, archive)
+	}
+
+	v, err := VerifyChart(archive, pubring)
+	if err != nil {
+		t.Fatalf("VerifyChart() error: %v", err)
+	}
+	if len(v.SignedBy) != 1 || !strings.HasPrefix(v.SignedBy[0], "release-bot") || v.Fingerprint == "" || !strings.HasPrefix(v.FileHash, "sha256:") {
+		t.Errorf("VerifyChart() = %+v, want signed by release-bot with a fingerprint and sha256 hash", v)
+	}
+
+	if _, err := VerifyChart(archive, otherring); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("VerifyChart() with another keyring error = %v, want ErrVerificationFailed", err)
+	}
+	data, _ := os.ReadFile(archive)
+	if err := os.WriteFile(archive, append(data, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyChart(archive, pubring)
+	if !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("VerifyChart() of a modified archive error = %v, want ErrVerificationFailed", err)
+	}
+	if ExitCode(err) != ExitCodeVerificationFailed {
+		t.Errorf("ExitCode() = %d, want %d", ExitCode(err), ExitCodeVerificationFailed)
+	}
+}
+
+func TestClient_VerifyKeyring(t *testing.T) {
+	keyDir := t.TempDir()
+	secring, pubring := writeTestKeyring(t, keyDir, "release-bot")
+	repoDir := t.TempDir()
+	writeTestRepo(t, repoDir, "1.0.0", "1.1.0")
+	if _, err := SignChart(filepath.Join(repoDir, "webapp-1.0.0.tgz"), secring, "release-bot", nil); err != nil {
+		t.Fatalf("SignChart() error: %v", err)
+	}
+
+	client := newRepoTestClient(t)
+	if err := client.AddRepository("local", "file://"+repoDir, "", "", false); err != nil {
+		t.Fatalf("AddRepository() error: %v", err)
+	}
+	client.VerifyKeyring = pubring
+
+	path, err := client.EnsureChart("local/webapp", "1.0.0")
+	if err != nil {
+		t.Fatalf("EnsureChart() of a signed chart error: %v", err)
+	}
+	if _, err := os.Stat(path + ".prov"); err != nil {
+		t.Errorf("provenance file not cached next to the chart: %v", err)
+	}
+	if _, err := client.InstallChart("store-ns", "signed", "local/webapp", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Errorf("InstallChart() of a signed chart error: %v", err)
+	}
+
+	if _, err := client.EnsureChart("local/webapp", "1.1.0"); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("EnsureChart() of an unsigned chart error = %v, want ErrVerificationFailed", err)
+	}
+	if _, err := client.InstallChart("store-ns", "unsigned", "local/webapp", "1.1.0", nil, false, false, time.Minute); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("InstallChart() of an unsigned chart error = %v, want ErrVerificationFailed", err)
+	}
+	if _, err := client.EnsureChart(writeTestChart(t, t.TempDir()), ""); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("EnsureChart() of a chart directory error = %v, want ErrVerificationFailed", err)
+	}
+
+	client.VerifyKeyring = ""
+	if _, err := client.EnsureChart("local/webapp", "1.1.0"); err != nil {
+		t.Errorf("EnsureChart() without verification error: %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+package helmutils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/postrender"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// PostRenderer rewrites the rendered manifest of a release before it is
+// recorded, like 'helm install --post-renderer'. It is Helm's own interface,
+// so post-renderers written for the Helm SDK can be used unchanged.
+type PostRenderer = postrender.PostRenderer
+
+// ValuesTransform rewrites the values of an install or upgrade before the
+// chart is rendered with them. It receives a copy it may modify.
+type ValuesTransform func(vals map[string]interface{}) (map[string]interface{}, error)
+
+// NewExecPostRenderer returns a PostRenderer that pipes the manifest through
+// an external binary, which must print the modified manifest on stdout. A
+// path without separators is looked up in $PATH.
+func NewExecPostRenderer(binaryPath string, args ...string) (PostRenderer, error) {
+	pr, err := postrender.NewExec(binaryPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer %s: %w", binaryPath, err)
+	}
+	return pr, nil
+}
+
+// ManifestPatch is a kustomize-style patch applied to every resource of a
+// rendered manifest: common labels, image rewrites and patches.
+type ManifestPatch struct {
+	// CommonLabels are added to every resource and to the pod templates of
+	// workloads. Selectors are left alone since they are immutable.
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// Images rewrites container images by name.
+	Images []ImageOverride `json:"images,omitempty"`
+	// Patches are strategic merge patches for built-in kinds and JSON merge
+	// patches for anything else.
+	Patches []ResourcePatch `json:"patches,omitempty"`
+}
+
+// ImageOverride replaces the name, tag or digest of every container image
+// called Name, with or without a tag.
+type ImageOverride struct {
+	Name    string `json:"name"`
+	NewName string `json:"newName,omitempty"`
+	NewTag  string `json:"newTag,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// ResourcePatch is one patch of a ManifestPatch. Without a Target it applies
+// to the resource named by the patch's own kind and metadata.name.
+type ResourcePatch struct {
+	Target *PatchTarget `json:"target,omitempty"`
+	Patch  string       `json:"patch"`
+}
+
+// PatchTarget selects the resources a patch applies to. Empty fields match
+// any value.
+type PatchTarget struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// LoadManifestPatch reads a ManifestPatch from a YAML file. A file that
+// cannot be read or is not a valid patch is reported as ErrInvalidValues.
+func LoadManifestPatch(path string) (*ManifestPatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch file %s: %w: %w", path, ErrInvalidValues, err)
+	}
+	p := &ManifestPatch{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse patch file %s: %w: %w", path, ErrInvalidValues, err)
+	}
+	for i, rp := range p.Patches {
+		if strings.TrimSpace(rp.Patch) == "" {
+			return nil, fmt.Errorf("patch file %s: patch %d is empty: %w", path, i, ErrInvalidValues)
+		}
+	}
+	return p, nil
+}
+
+// Run applies the patch to each document of the manifest. Documents keep
+// their "# Source:" comments and their order.
+func (p *ManifestPatch) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	patches, err := p.parsePatches()
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	for _, doc := range splitManifestDocs(renderedManifests.String()) {
+		header, body := splitDocHeader(doc)
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(body), &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse rendered manifest: %w", err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		if obj, err = p.apply(obj, patches); err != nil {
+			return nil, err
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "---\n%s%s", header, data)
+	}
+	return &out, nil
+}
+
+// parsedPatch is a ResourcePatch with its patch document decoded and its
+// target resolved.
+type parsedPatch struct {
+	target PatchTarget
+	patch  map[string]interface{}
+}
+
+func (p *ManifestPatch) parsePatches() ([]parsedPatch, error) {
+	parsed := make([]parsedPatch, 0, len(p.Patches))
+	for i, rp := range p.Patches {
+		patch := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(rp.Patch), &patch); err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i, err)
+		}
+		pp := parsedPatch{patch: patch}
+		if rp.Target != nil {
+			pp.target = *rp.Target
+		} else {
+			pp.target = PatchTarget{Kind: stringField(patch, "kind"), Name: stringField(patch, "metadata", "name")}
+			if pp.target.Kind == "" || pp.target.Name == "" {
+				return nil, fmt.Errorf("patch %d has no target and does not name a kind and metadata.name", i)
+			}
+		}
+		parsed = append(parsed, pp)
+	}
+	return parsed, nil
+}
+
+func (p *ManifestPatch) apply(obj map[string]interface{}, patches []parsedPatch) (map[string]interface{}, error) {
+	kind := stringField(obj, "kind")
+	name := stringField(obj, "metadata", "name")
+	namespace := stringField(obj, "metadata", "namespace")
+	for _, pp := range patches {
+		t := pp.target
+		if (t.Kind != "" && t.Kind != kind) || (t.Name != "" && t.Name != name) || (t.Namespace != "" && t.Namespace != namespace) {
+			continue
+		}
+		patched, err := patchObject(obj, pp.patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to patch %s %s: %w", kind, name, err)
+		}
+		obj = patched
+	}
+	if len(p.CommonLabels) > 0 {
+		addLabels(obj, p.CommonLabels, "metadata")
+		addLabels(obj, p.CommonLabels, "spec", "template", "metadata")
+		addLabels(obj, p.CommonLabels, "spec", "jobTemplate", "spec", "template", "metadata")
+	}
+	if len(p.Images) > 0 {
+		rewriteImages(obj, p.Images)
+	}
+	return obj, nil
+}
+
+// patchObject applies a strategic merge patch when the object's kind is
+// known to client-go, so that lists such as containers merge by name, and a
+// JSON merge patch otherwise.
+func patchObject(obj, patch map[string]interface{}) (map[string]interface{}, error) {
+	gv, err := schema.ParseGroupVersion(stringField(obj, "apiVersion"))
+	if err == nil {
+		if typed, err := scheme.Scheme.New(gv.WithKind(stringField(obj, "kind"))); err == nil {
+			return strategicpatch.StrategicMergeMapPatch(obj, patch, typed)
+		}
+	}
+	return mergePatch(obj, patch).(map[string]interface{}), nil
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch: maps merge recursively,
+// null deletes a key and anything else replaces the original value.
+func mergePatch(original, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	origMap, ok := original.(map[string]interface{})
+	if !ok {
+		origMap = map[string]interface{}{}
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(origMap, k)
+			continue
+		}
+		origMap[k] = mergePatch(origMap[k], v)
+	}
+	return origMap
+}
+
+func addLabels(obj map[string]interface{}, labels map[string]string, path ...string) {
+	m := obj
+	for i, key := range path {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			// Only metadata is created when missing; pod templates must exist.
+			if i > 0 || key != "metadata" {
+				return
+			}
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+		m = next
+	}
+	existing, _ := m["labels"].(map[string]interface{})
+	if existing == nil {
+		existing = map[string]interface{}{}
+	}
+	for k, v := range labels {
+		existing[k] = v
+	}
+	m["labels"] = existing
+}
+
+// rewriteImages walks obj and rewrites the image of every container and
+// init container it finds, wherever the pod spec is nested.
+func rewriteImages(v interface{}, overrides []ImageOverride) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			if key == "containers" || key == "initContainers" || key == "ephemeralContainers" {
+				if list, ok := child.([]interface{}); ok {
+					for _, c := range list {
+						if container, ok := c.(map[string]interface{}); ok {
+							if image, ok := container["image"].(string); ok {
+								container["image"] = overrideImage(image, overrides)
+							}
+						}
+					}
+				}
+				continue
+			}
+			rewriteImages(child, overrides)
+		}
+	case []interface{}:
+		for _, child := range t {
+			rewriteImages(child, overrides)
+		}
+	}
+}
+
+func overrideImage(image string, overrides []ImageOverride) string {
+	name, tag, digest := splitImage(image)
+	for _, o := range overrides {
+		if o.Name != name {
+			continue
+		}
+		if o.NewName != "" {
+			name = o.NewName
+		}
+		if o.NewTag != "" {
+			tag, digest = o.NewTag, ""
+		}
+		if o.Digest != "" {
+			tag, digest = "", o.Digest
+		}
+		break
+	}
+	switch {
+	case digest != "":
+		return name + "@" + digest
+	case tag != "":
+		return name + ":" + tag
+	default:
+		return name
+	}
+}
+
+// splitImage splits an image reference into name, tag and digest. A colon
+// before the last slash belongs to a registry port, not a tag.
+func splitImage(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return name, tag, digest
+}
+
+// stringField returns the string at path in obj, or "" if there is none.
+func stringField(obj map[string]interface{}, path ...string) string {
+	var v interface{} = obj
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// splitManifestDocs splits a multi-document YAML stream on "---" lines.
+func splitManifestDocs(manifest string) []string {
+	var docs []string
+	var cur strings.Builder
+	for _, line := range strings.SplitAfter(manifest, "\n") {
+		if strings.TrimRight(line, "\r\n") == "---" {
+			docs = append(docs, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteString(line)
+	}
+	return append(docs, cur.String())
+}
+
+// splitDocHeader separates the leading comment lines of a document, such as
+// Helm's "# Source:" line, from its content.
+func splitDocHeader(doc string) (header, body string) {
+	rest := doc
+	for rest != "" {
+		line, after, _ := strings.Cut(rest, "\n")
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+		header += line + "\n"
+		rest = after
+	}
+	return header, rest
+}
+
+// postRender pipes a rendered manifest through the client's post-renderers
+// in order.
+func (c *Client) postRender(manifest string) (string, error) {
+	if len(c.PostRenderers) == 0 {
+		return manifest, nil
+	}
+	buf := bytes.NewBufferString(manifest)
+	for _, pr := range c.PostRenderers {
+		var err error
+		if buf, err = pr.Run(buf); err != nil {
+			return "", fmt.Errorf("error while running post render on files: %w", err)
+		}
+		if buf == nil {
+			return "", fmt.Errorf("error while running post render on files: post-renderer returned no output")
+		}
+	}
+	return buf.String(), nil
+}
+
+// transformValues runs the client's ValuesTransform, if any, on a copy of vals.
+func (c *Client) transformValues(vals map[string]interface{}) (map[string]interface{}, error) {
+	if c.ValuesTransform == nil {
+		return vals, nil
+	}
+	in := copyValues(vals)
+	if in == nil {
+		in = map[string]interface{}{}
+	}
+	out, err := c.ValuesTransform(in)
+	if err != nil {
+		return nil, fmt.Errorf("values transform failed: %w: %w", ErrInvalidValues, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,278 @@
+package helmutils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const postRenderManifest = `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+        - name: metrics
+          image: registry.local:5000/exporter
+---
+# Source: web/templates/widget.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web-widget
+spec:
+  size: small
+  color: blue
+`
+
+// runPostRenderer runs pr on manifest and decodes the resulting documents.
+func runPostRenderer(t *testing.T, pr PostRenderer, manifest string) (string, []map[string]interface{}) {
+	t.Helper()
+	out, err := pr.Run(bytes.NewBufferString(manifest))
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	var objs []map[string]interface{}
+	for _, doc := range splitManifestDocs(out.String()) {
+		_, body := splitDocHeader(doc)
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(body), &obj); err != nil {
+			t.Fatalf("post-rendered document does not parse: %v\n%s", err, body)
+		}
+		objs = append(objs, obj)
+	}
+	return out.String(), objs
+}
+
+func TestManifestPatch_Run(t *testing.T) {
+	patchFile := filepath.Join(t.TempDir(), "patch.yaml")
+	content := `commonLabels:
+  team: payments
+images:
+  - name: nginx
+    newName: mirror.example.com/nginx
+  - name: registry.local:5000/exporter
+    newTag: "2.0"
+patches:
+  - patch: |
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: web
+      spec:
+        template:
+          spec:
+            containers:
+              - name: proxy
+                image: envoy:1.30
+  - target:
+      kind: Widget
+    patch: |
+      spec:
+        color: null
+        size: large
+`
+	if err := os.WriteFile(patchFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := LoadManifestPatch(patchFile)
+	if err != nil {
+		t.Fatalf("LoadManifestPatch() error: %v", err)
+	}
+
+	out, objs := runPostRenderer(t, patch, postRenderManifest)
+	if len(objs) != 2 {
+		t.Fatalf("Run() returned %d documents, want 2", len(objs))
+	}
+	if !strings.Contains(out, "# Source: web/templates/deployment.yaml") || !strings.Contains(out, "# Source: web/templates/widget.yaml") {
+		t.Errorf("Run() dropped the source comments:\n%s", out)
+	}
+
+	deploy, widget := objs[0], objs[1]
+	for _, path := range [][]string{{"metadata", "labels", "team"}, {"spec", "template", "metadata", "labels", "team"}} {
+		if got := stringField(deploy, path...); got != "payments" {
+			t.Errorf("Deployment %s = %q, want payments", strings.Join(path, "."), got)
+		}
+	}
+	if got := stringField(deploy, "spec", "selector", "matchLabels", "team"); got != "" {
+		t.Errorf("selector gained label team=%q, want selectors left alone", got)
+	}
+	if got := stringField(widget, "metadata", "labels", "team"); got != "payments" {
+		t.Errorf("Widget label team = %q, want payments", got)
+	}
+
+	// The strategic merge patch adds the sidecar next to the existing
+	// containers instead of replacing the list.
+	containers := deploy["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	images := map[string]string{}
+	for _, c := range containers {
+		c := c.(map[string]interface{})
+		images[c["name"].(string)] = c["image"].(string)
+	}
+	want := map[string]string{
+		"web":     "mirror.example.com/nginx:1.25",
+		"metrics": "registry.local:5000/exporter:2.0",
+		"proxy":   "envoy:1.30",
+	}
+	if len(images) != len(want) {
+		t.Errorf("containers = %v, want %v", images, want)
+	}
+	for name, image := range want {
+		if images[name] != image {
+			t.Errorf("container %s image = %q, want %q", name, images[name], image)
+		}
+	}
+
+	if stringField(widget, "spec", "size") != "large" || stringField(widget, "spec", "color") != "" {
+		t.Errorf("Widget spec = %v, want size large and no color", widget["spec"])
+	}
+
+	t.Run("invalid patch files", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"unknown field": "labels:\n  a: b\n",
+			"empty patch":   "patches:\n  - target:\n      kind: Deployment\n",
+		} {
+			if err := os.WriteFile(patchFile, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadManifestPatch(patchFile); !errors.Is(err, ErrInvalidValues) {
+				t.Errorf("LoadManifestPatch() with %s error = %v, want ErrInvalidValues", name, err)
+			}
+		}
+		if _, err := LoadManifestPatch(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, ErrInvalidValues) {
+			t.Errorf("LoadManifestPatch() with a missing file error = %v, want ErrInvalidValues", err)
+		}
+		untargeted := &ManifestPatch{Patches: []ResourcePatch{{Patch: "spec:\n  replicas: 2\n"}}}
+		if _, err := untargeted.Run(bytes.NewBufferString(postRenderManifest)); err == nil {
+			t.Error("Run() with a patch naming no resource expected error, got nil")
+		}
+	})
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, name, tag, digest string
+	}{
+		{"nginx", "nginx", "", ""},
+		{"nginx:1.25", "nginx", "1.25", ""},
+		{"registry.local:5000/team/app", "registry.local:5000/team/app", "", ""},
+		{"registry.local:5000/team/app:v2", "registry.local:5000/team/app", "v2", ""},
+		{"app@sha256:abc", "app", "", "sha256:abc"},
+	}
+	for _, tt := range tests {
+		name, tag, digest := splitImage(tt.image)
+		if name != tt.name || tag != tt.tag || digest != tt.digest {
+			t.Errorf("splitImage(%q) = %q, %q, %q, want %q, %q, %q", tt.image, name, tag, digest, tt.name, tt.tag, tt.digest)
+		}
+	}
+}
+
+// markingPostRenderer counts its runs and adds a comment line to every
+// document it sees.
+type markingPostRenderer struct {
+	mark  string
+	calls int
+}
+
+func (m *markingPostRenderer) Run(in *bytes.Buffer) (*bytes.Buffer, error) {
+	m.calls++
+	return bytes.NewBufferString(strings.ReplaceAll(in.String(), "---\n", "---\n# "+m.mark+"\n")), nil
+}
+
+func TestClient_PostRenderers(t *testing.T) {
+	client := newStoreTestClient(t)
+	chartDir := writeTestChart(t, t.TempDir())
+	first, second := &markingPostRenderer{mark: "first"}, &markingPostRenderer{mark: "second"}
+	client.PostRenderers = []PostRenderer{first, second}
+	client.ValuesTransform = func(vals map[string]interface{}) (map[string]interface{}, error) {
+		vals["replicaCount"] = 5
+		return vals, nil
+	}
+
+	userVals := map[string]interface{}{"image": map[string]interface{}{"tag": "1.25"}}
+	dry, err := client.InstallChartWithOptions(InstallOptions{Namespace: "store-ns", ReleaseName: "web", ChartName: chartDir, Values: userVals, DryRun: true})
+	if err != nil {
+		t.Fatalf("InstallChartWithOptions(DryRun) error: %v", err)
+	}
+	if !strings.Contains(dry.Manifest, "# second\n# first\n") {
+		t.Errorf("dry-run manifest was not post-rendered in order:\n%s", dry.Manifest)
+	}
+	if _, ok := userVals["replicaCount"]; ok {
+		t.Error("ValuesTransform modified the caller's values")
+	}
+
+	info, err := client.InstallChart("store-ns", "web", chartDir, "", userVals, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	if !strings.Contains(info.Manifest, `replicas: "5"`) || !strings.Contains(info.Manifest, "# second\n# first\n") {
+		t.Errorf("installed manifest not transformed and post-rendered:\n%s", info.Manifest)
+	}
+	if strings.Contains(info.Manifest, "migrate") {
+		t.Errorf("hooks ended up in the manifest:\n%s", info.Manifest)
+	}
+
+	if _, err := client.UpgradeRelease("store-ns", "web", chartDir, "", nil, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	if first.calls != 3 || second.calls != 3 {
+		t.Errorf("post-renderers called %d and %d times, want 3 each", first.calls, second.calls)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		client.ValuesTransform = func(map[string]interface{}) (map[string]interface{}, error) {
+			return nil, errors.New("no")
+		}
+		if _, err := client.UpgradeRelease("store-ns", "web", chartDir, "", nil, false, time.Minute, false, false); !errors.Is(err, ErrInvalidValues) {
+			t.Errorf("UpgradeRelease() with a failing values transform error = %v, want ErrInvalidValues", err)
+		}
+		client.ValuesTransform = nil
+
+		failing, err := NewExecPostRenderer("false")
+		if err != nil {
+			t.Skipf("no 'false' binary: %v", err)
+		}
+		client.PostRenderers = []PostRenderer{failing}
+		if _, err := client.UpgradeRelease("store-ns", "web", chartDir, "", nil, false, time.Minute, false, false); err == nil {
+			t.Error("UpgradeRelease() with a failing post-renderer expected error, got nil")
+		}
+		if history, _ := client.GetReleaseHistory("store-ns", "web"); len(history) != 2 {
+			t.Errorf("failed upgrades recorded revisions: history has %d, want 2", len(history))
+		}
+	})
+}
+
+func TestNewExecPostRenderer(t *testing.T) {
+	if _, err := NewExecPostRenderer(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewExecPostRenderer() of a missing binary expected error, got nil")
+	}
+	pr, err := NewExecPostRenderer("cat")
+	if err != nil {
+		t.Skipf("no 'cat' binary: %v", err)
+	}
+	if out, _ := runPostRenderer(t, pr, postRenderManifest); out != postRenderManifest {
+		t.Errorf("Run() through cat = %q, want the manifest unchanged", out)
+	}
+}
@@ -0,0 +1,110 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// newRegistryClient returns a Helm registry client that keeps its
+// credentials in the registry config file of the client's Helm settings.
+func (c *Client) newRegistryClient() (*registry.Client, error) {
+	opts := []registry.ClientOption{
+		registry.ClientOptWriter(io.Discard),
+		registry.ClientOptCredentialsFile(c.settings.RegistryConfig),
+	}
+	if c.RegistryPlainHTTP {
+		opts = append(opts, registry.ClientOptPlainHTTP())
+	}
+	rc, err := registry.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client: %w", err)
+	}
+	return rc, nil
+}
+
+// pullOCIChart downloads a chart from an oci:// reference into the repository
+// cache. version may be an exact tag or a semver constraint; when empty the
+// tag in the reference, or else the highest semver tag, is used.
+func (c *Client) pullOCIChart(ctx context.Context, chartRef, version string) (string, error) {
+	ref := strings.TrimPrefix(chartRef, fmt.Sprintf("%s://", registry.OCIScheme))
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		if version != "" && version != ref[i+1:] {
+			return "", fmt.Errorf("chart reference and version mismatch: %s is not %s", version, ref[i+1:])
+		}
+		version = ref[i+1:]
+		ref = ref[:i]
+	}
+
+	rc, err := c.newRegistryClient()
+	if err != nil {
+		return "", err
+	}
+	tags, err := rc.Tags(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags for %s: %w: %w", chartRef, ErrRepoUnreachable, err)
+	}
+	if len(tags) == 0 {
+		return "", fmt.Errorf("unable to locate any tags in provided repository: %s: %w", chartRef, ErrChartNotFound)
+	}
+	tag, err := registry.GetTagMatchingVersionOrConstraint(tags, version)
+	if err != nil {
+		return "", fmt.Errorf("chart %s: %w: %w", chartRef, ErrChartNotFound, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	result, err := rc.Pull(ref+":"+tag, registry.PullOptWithProv(c.VerifyKeyring != ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s:%s: %w", chartRef, tag, err)
+	}
+	if err := verifyDigest(result.Chart.Data, result.Chart.Digest); err != nil {
+		return "", fmt.Errorf("chart %s:%s: %w", chartRef, tag, err)
+	}
+	if err := os.MkdirAll(c.settings.RepositoryCache, 0755); err != nil {
+		return "", fmt.Errorf("failed to create repository cache %s: %w", c.settings.RepositoryCache, err)
+	}
+	dest := filepath.Join(c.settings.RepositoryCache, fmt.Sprintf("%s-%s.tgz", result.Chart.Meta.Name, result.Chart.Meta.Version))
+	if err := os.WriteFile(dest, result.Chart.Data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save chart %s:%s: %w", chartRef, tag, err)
+	}
+	if result.Prov != nil && result.Prov.Data != nil {
+		if err := os.WriteFile(dest+".prov", result.Prov.Data, 0644); err != nil {
+			return "", fmt.Errorf("failed to save provenance file for %s:%s: %w", chartRef, tag, err)
+		}
+	}
+	return dest, nil
+}
+
+// packageForPush returns the archive bytes of a chart directory or .tgz file.
+// Directories are packaged into a temporary archive first.
+func packageForPush(chartPath string) ([]byte, error) {
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart %s: %w", chartPath, err)
+	}
+	archive := chartPath
+	if fi.IsDir() {
+		ch, err := loader.LoadDir(chartPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chart from %s: %w", chartPath, err)
+		}
+		tmpDir, err := os.MkdirTemp("", "helmutils-push-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		if archive, err = chartutil.Save(ch, tmpDir); err != nil {
+			return nil, fmt.Errorf("failed to package chart %s: %w", chartPath, err)
+		}
+	}
+	return os.ReadFile(archive)
+}
@@ -0,0 +1,306 @@
+package helmutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// testRegistry is an in-process stand-in for an OCI distribution registry. It
+// implements just enough of the distribution API for Helm's registry client
+// to log in, push, list tags and pull: blob uploads, manifests and tag lists,
+// optionally behind HTTP basic auth.
+type testRegistry struct {
+	*httptest.Server
+	username, password string
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]testManifest // keyed by repo@digest and repo:tag
+	uploads   map[string][]byte
+	nextID    int
+}
+
+type testManifest struct {
+	mediaType string
+	data      []byte
+	digest    string
+}
+
+func newTestRegistry(t *testing.T, username, password string) *testRegistry {
+	t.Helper()
+	r := &testRegistry{
+		username:  username,
+		password:  password,
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]testManifest),
+		uploads:   make(map[string][]byte),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Host is the registry address as used in oci:// references.
+func (r *testRegistry) Host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *testRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.username != "" {
+		if u, p, ok := req.BasicAuth(); !ok || u != r.username || p != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == "" || path == req.URL.Path {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(w, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.LastIndex(path, "/blobs/uploads/")
+		r.serveUpload(w, req, path[:i], path[i+len("/blobs/uploads/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		r.serveBlob(w, req, path[i+len("/blobs/"):])
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *testRegistry) serveTags(w http.ResponseWriter, repo string) {
+	tags := []string{}
+	for key := range r.manifests {
+		if strings.HasPrefix(key, repo+":") {
+			tags = append(tags, strings.TrimPrefix(key, repo+":"))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": tags})
+}
+
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	body, _ := io.ReadAll(req.Body)
+	switch req.Method {
+	case http.MethodPost:
+		r.nextID++
+		id = fmt.Sprintf("upload-%d", r.nextID)
+		r.uploads[id] = body
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.Header().Set("Docker-Upload-UUID", id)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch:
+		r.uploads[id] = append(r.uploads[id], body...)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		data := append(r.uploads[id], body...)
+		delete(r.uploads, id)
+		digest := req.URL.Query().Get("digest")
+		if sha256Digest(data) != digest {
+			http.Error(w, "digest invalid", http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = data
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *testRegistry) serveBlob(w http.ResponseWriter, req *http.Request, digest string) {
+	data, ok := r.blobs[digest]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo, reference string) {
+	key := repo + ":" + reference
+	if strings.HasPrefix(reference, "sha256:") {
+		key = repo + "@" + reference
+	}
+	switch req.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		m := testManifest{mediaType: req.Header.Get("Content-Type"), data: data, digest: sha256Digest(data)}
+		r.manifests[key] = m
+		r.manifests[repo+"@"+m.digest] = m
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo, m.digest))
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		m, ok := r.manifests[key]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.data)))
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(m.data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newRegistryTestClient returns a client using plain HTTP, with its registry
+// credentials, repositories file and cache in a temporary directory.
+func newRegistryTestClient(t *testing.T) *Client {
+	t.Helper()
+	client := newRepoTestClient(t)
+	client.settings.RegistryConfig = filepath.Join(t.TempDir(), "registry", "config.json")
+	client.RegistryPlainHTTP = true
+	return client
+}
+
+func TestClient_PushChartAndPullFromRegistry(t *testing.T) {
+	reg := newTestRegistry(t, "", "")
+	client := newRegistryTestClient(t)
+	chartDir := writeTestChart(t, t.TempDir())
+	ociBase := "oci://" + reg.Host() + "/charts"
+
+	ref, err := client.PushChart(chartDir, ociBase)
+	if err != nil {
+		t.Fatalf("PushChart() error: %v", err)
+	}
+	if want := ociBase + "/webapp:1.2.3"; ref != want {
+		t.Errorf("PushChart() ref = %q, want %q", ref, want)
+	}
+
+	// Push a second version from an archive.
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		t.Fatalf("loader.Load() error: %v", err)
+	}
+	ch.Metadata.Version = "1.3.0"
+	archive, err := chartutil.Save(ch, t.TempDir())
+	if err != nil {
+		t.Fatalf("chartutil.Save() error: %v", err)
+	}
+	if _, err := client.PushChart(archive, ociBase); err != nil {
+		t.Fatalf("PushChart(archive) error: %v", err)
+	}
+
+	tests := []struct {
+		ref, version, want string
+	}{
+		{ociBase + "/webapp", "", "1.3.0"},
+		{ociBase + "/webapp", "1.2.3", "1.2.3"},
+		{ociBase + "/webapp", "~1.2", "1.2.3"},
+		{ociBase + "/webapp:1.2.3", "", "1.2.3"},
+	}
+	for _, tt := range tests {
+		chartPath, err := client.EnsureChart(tt.ref, tt.version)
+		if err != nil {
+			t.Fatalf("EnsureChart(%s, %q) error: %v", tt.ref, tt.version, err)
+		}
+		pulled, err := loader.Load(chartPath)
+		if err != nil {
+			t.Fatalf("EnsureChart(%s, %q) returned an unloadable chart: %v", tt.ref, tt.version, err)
+		}
+		if pulled.Metadata.Version != tt.want {
+			t.Errorf("EnsureChart(%s, %q) version = %s, want %s", tt.ref, tt.version, pulled.Metadata.Version, tt.want)
+		}
+	}
+	if _, err := client.EnsureChart(ociBase+"/webapp:1.2.3", "1.3.0"); err == nil {
+		t.Error("EnsureChart() with conflicting tag and version expected error, got nil")
+	}
+	if _, err := client.EnsureChart(ociBase+"/missing", ""); err == nil {
+		t.Error("EnsureChart() of a missing repository expected error, got nil")
+	}
+	if _, err := client.PushChart(chartDir, "https://"+reg.Host()); err == nil {
+		t.Error("PushChart() to a non-oci reference expected error, got nil")
+	}
+
+	info, err := client.InstallChart("store-ns", "from-oci", ociBase+"/webapp", "1.2.3", nil, false, false, time.Minute)
+	if err != nil {
+		t.Fatalf("InstallChart(oci) error: %v", err)
+	}
+	if info.ChartVersion != "1.2.3" || !strings.Contains(info.Manifest, "name: from-oci-config") {
+		t.Errorf("InstallChart(oci) = version %s, manifest:\n%s", info.ChartVersion, info.Manifest)
+	}
+	info, err = client.UpgradeRelease("store-ns", "from-oci", ociBase+"/webapp", "", nil, false, time.Minute, false, false)
+	if err != nil {
+		t.Fatalf("UpgradeRelease(oci) error: %v", err)
+	}
+	if info.ChartVersion != "1.3.0" {
+		t.Errorf("UpgradeRelease(oci) chart version = %s, want 1.3.0", info.ChartVersion)
+	}
+}
+
+func TestClient_RegistryLoginLogout(t *testing.T) {
+	reg := newTestRegistry(t, "admin", "s3cret")
+	client := newRegistryTestClient(t)
+	chartDir := writeTestChart(t, t.TempDir())
+	ociBase := "oci://" + reg.Host() + "/charts"
+
+	if _, err := client.PushChart(chartDir, ociBase); err == nil {
+		t.Fatal("PushChart() without credentials expected error, got nil")
+	}
+	if err := client.RegistryLogin(reg.Host(), "admin", "wrong", true); err == nil {
+		t.Error("RegistryLogin() with a wrong password expected error, got nil")
+	}
+	if err := client.RegistryLogin(reg.Host(), "admin", "s3cret", true); err != nil {
+		t.Fatalf("RegistryLogin() error: %v", err)
+	}
+	creds, err := os.ReadFile(client.settings.RegistryConfig)
+	if err != nil || !strings.Contains(string(creds), reg.Host()) {
+		t.Fatalf("credentials not stored in %s: %v", client.settings.RegistryConfig, err)
+	}
+	if _, err := client.PushChart(chartDir, ociBase); err != nil {
+		t.Fatalf("PushChart() after login error: %v", err)
+	}
+	if _, err := client.EnsureChart(ociBase+"/webapp", ""); err != nil {
+		t.Fatalf("EnsureChart() after login error: %v", err)
+	}
+
+	if err := client.RegistryLogout(reg.Host()); err != nil {
+		t.Fatalf("RegistryLogout() error: %v", err)
+	}
+	if _, err := client.EnsureChart(ociBase+"/webapp", ""); err == nil {
+		t.Error("EnsureChart() after logout expected error, got nil")
+	}
+}
@@ -0,0 +1,258 @@
+package helmutils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// releaseStore is an in-memory, namespace-scoped record of Helm releases.
+// Every revision of a release is kept so history, upgrades and uninstalls
+// with keepHistory behave like Helm's own storage.
+type releaseStore struct {
+	mu       sync.RWMutex
+	releases map[string][]*release.Release // keyed by namespace/name, ordered by revision
+	watchers map[*storeWatcher]struct{}
+	ops      map[string]*releaseOp // operations in flight, keyed by namespace/name
+	backend  *storageBackend       // when set, every update is written through to it
+}
+
+func newReleaseStore() *releaseStore {
+	return &releaseStore{
+		releases: make(map[string][]*release.Release),
+		watchers: make(map[*storeWatcher]struct{}),
+		ops:      make(map[string]*releaseOp),
+	}
+}
+
+// releaseOp is the install, upgrade, rollback or uninstall currently holding
+// a release. done is closed when it finishes.
+type releaseOp struct {
+	op   string
+	done chan struct{}
+}
+
+// lock claims a release for op so that at most one operation changes it at a
+// time. If another operation holds the release, lock waits up to wait for it
+// to finish, or not at all when wait is zero, and then fails with an
+// *OperationInProgressError. The returned unlock func releases the claim.
+func (s *releaseStore) lock(ctx context.Context, namespace, name, op string, wait time.Duration) (unlock func(), err error) {
+	key := storeKey(namespace, name)
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		s.mu.Lock()
+		if s.ops == nil {
+			s.ops = make(map[string]*releaseOp)
+		}
+		held, busy := s.ops[key]
+		if !busy {
+			mine := &releaseOp{op: op, done: make(chan struct{})}
+			s.ops[key] = mine
+			s.mu.Unlock()
+			return func() {
+				s.mu.Lock()
+				delete(s.ops, key)
+				s.mu.Unlock()
+				close(mine.done)
+			}, nil
+		}
+		s.mu.Unlock()
+
+		busyErr := &ReleaseError{Op: op, Namespace: namespace, Name: name, Err: &OperationInProgressError{Op: held.op}}
+		if deadline == nil {
+			return nil, busyErr
+		}
+		select {
+		case <-held.done:
+		case <-deadline:
+			return nil, busyErr
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// storeWatcher queues a copy of a release's revisions after every update, so
+// a slow reader sees each intermediate state instead of only the latest one.
+type storeWatcher struct {
+	key    string
+	notify chan struct{} // signalled when snapshots are queued
+
+	mu        sync.Mutex
+	snapshots [][]*release.Release
+}
+
+func (w *storeWatcher) push(revs []*release.Release) {
+	snapshot := make([]*release.Release, 0, len(revs))
+	for _, rel := range revs {
+		snapshot = append(snapshot, cloneRelease(rel))
+	}
+	w.mu.Lock()
+	w.snapshots = append(w.snapshots, snapshot)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain returns and clears the queued snapshots, oldest first.
+func (w *storeWatcher) drain() [][]*release.Release {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := w.snapshots
+	w.snapshots = nil
+	return out
+}
+
+// watch registers a watcher for a release and returns it together with the
+// current revisions. stop unregisters the watcher.
+func (s *releaseStore) watch(namespace, name string) (w *storeWatcher, current []*release.Release, stop func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[*storeWatcher]struct{})
+	}
+	w = &storeWatcher{key: storeKey(namespace, name), notify: make(chan struct{}, 1)}
+	s.watchers[w] = struct{}{}
+	for _, rel := range s.releases[w.key] {
+		current = append(current, cloneRelease(rel))
+	}
+	stop = func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}
+	return w, current, stop
+}
+
+func storeKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// history returns copies of all revisions of a release, oldest first.
+func (s *releaseStore) history(namespace, name string) []*release.Release {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs := s.releases[storeKey(namespace, name)]
+	out := make([]*release.Release, 0, len(revs))
+	for _, rel := range revs {
+		out = append(out, cloneRelease(rel))
+	}
+	return out
+}
+
+// last returns a copy of the latest revision of a release, or nil if none is recorded.
+func (s *releaseStore) last(namespace, name string) *release.Release {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs := s.releases[storeKey(namespace, name)]
+	if len(revs) == 0 {
+		return nil
+	}
+	return cloneRelease(revs[len(revs)-1])
+}
+
+// update runs fn with the recorded revisions of a release while holding the
+// write lock, and stores the slice fn returns. Returning an empty slice drops
+// the release entirely. fn may modify the revisions in place: it is given
+// copies, which replace the recorded revisions only once fn and the write to
+// the storage backend have both succeeded.
+func (s *releaseStore) update(namespace, name string, fn func(revs []*release.Release) ([]*release.Release, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := storeKey(namespace, name)
+	var before map[int]revisionState
+	if s.backend != nil {
+		before = snapshotRevisions(s.releases[key])
+	}
+	working := make([]*release.Release, 0, len(s.releases[key]))
+	for _, rel := range s.releases[key] {
+		working = append(working, cloneRelease(rel))
+	}
+	revs, err := fn(working)
+	if err != nil {
+		return err
+	}
+	if s.backend != nil {
+		if err := s.backend.sync(namespace, name, before, revs); err != nil {
+			return err
+		}
+	}
+	if len(revs) == 0 {
+		delete(s.releases, key)
+	} else {
+		s.releases[key] = revs
+	}
+	for w := range s.watchers {
+		if w.key == key {
+			w.push(revs)
+		}
+	}
+	return nil
+}
+
+// list returns copies of every recorded revision in namespace, or in all
+// namespaces when namespace is empty.
+func (s *releaseStore) list(namespace string) []*release.Release {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*release.Release
+	for _, revs := range s.releases {
+		for _, rel := range revs {
+			if namespace != "" && rel.Namespace != namespace {
+				continue
+			}
+			out = append(out, cloneRelease(rel))
+		}
+	}
+	return out
+}
+
+// cloneRelease copies the mutable parts of a stored revision so callers can
+// read it without holding the store lock.
+func cloneRelease(rel *release.Release) *release.Release {
+	out := *rel
+	if rel.Info != nil {
+		info := *rel.Info
+		out.Info = &info
+	}
+	out.Config = copyValues(rel.Config)
+	out.Labels = copyLabels(rel.Labels)
+	return &out
+}
+
+// copyValues returns a deep copy of a values map so stored revisions are not
+// affected by callers mutating the maps they passed in.
+func copyValues(vals map[string]interface{}) map[string]interface{} {
+	if vals == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(vals))
+	for k, v := range vals {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyValues(t)
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,234 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// waitForStatus polls until the latest revision of a release reaches status.
+func waitForStatus(t *testing.T, client *Client, namespace, name string, status release.Status) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		details, err := client.GetReleaseDetails(namespace, name)
+		if err == nil && details.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("release %s/%s never reached %s", namespace, name, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient_OperationLock(t *testing.T) {
+	const workers = 8
+
+	t.Run("concurrent upgrades fail fast", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart() error: %v", err)
+		}
+		client.OperationDelay = 50 * time.Millisecond
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.1.0", nil, false, time.Minute, false, false)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			var busy *OperationInProgressError
+			if !errors.As(err, &busy) || busy.Op != "upgrade" || !errors.Is(err, ErrPendingOperation) {
+				t.Errorf("UpgradeRelease() error = %v, want an upgrade in progress", err)
+			}
+			if ExitCode(err) != ExitCodePendingOperation {
+				t.Errorf("ExitCode(%v) = %d, want %d", err, ExitCode(err), ExitCodePendingOperation)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("%d upgrades succeeded, want exactly 1", succeeded)
+		}
+		if history, _ := client.GetReleaseHistory("store-ns", "app"); len(history) != 2 {
+			t.Errorf("history has %d revisions, want 2", len(history))
+		}
+	})
+
+	t.Run("readers see the pending state", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart() error: %v", err)
+		}
+		client.OperationDelay = time.Hour
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.UpgradeReleaseContext(ctx, "store-ns", "app", "repo/app", "1.1.0", nil, false, 0, false, false)
+			done <- err
+		}()
+		waitForStatus(t, client, "store-ns", "app", release.StatusPendingUpgrade)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				details, err := client.GetReleaseDetails("store-ns", "app")
+				if err != nil || details.Status != release.StatusPendingUpgrade || details.Revision != 2 {
+					t.Errorf("GetReleaseDetails() = %+v, %v, want revision 2 in %s", details, err, release.StatusPendingUpgrade)
+				}
+			}()
+		}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.RollbackRelease("store-ns", "app", 1, false, time.Minute, false); !errors.Is(err, ErrPendingOperation) {
+				t.Errorf("RollbackRelease() during an upgrade error = %v, want ErrPendingOperation", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := client.UninstallRelease("store-ns", "app", false, time.Minute); !errors.Is(err, ErrPendingOperation) {
+				t.Errorf("UninstallRelease() during an upgrade error = %v, want ErrPendingOperation", err)
+			}
+		}()
+		wg.Wait()
+
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("UpgradeRelease() error = %v, want context.Canceled", err)
+		}
+		// The interrupted upgrade no longer holds the lock, so Helm's usual
+		// recovery of rolling back works.
+		client.OperationDelay = 0
+		if _, err := client.RollbackRelease("store-ns", "app", 1, false, time.Minute, false); err != nil {
+			t.Errorf("RollbackRelease() after the upgrade was interrupted error: %v", err)
+		}
+	})
+
+	t.Run("queued operations run one at a time", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = 2 * time.Millisecond
+		client.OperationLockTimeout = time.Minute
+
+		// Every worker upgrades with Install set: one installs, the others
+		// queue behind it and upgrade in turn.
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				vals := map[string]interface{}{"worker": i}
+				if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.0.0", vals, false, time.Minute, true, false); err != nil {
+					t.Errorf("UpgradeRelease() error: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		history, err := client.GetReleaseHistory("store-ns", "app")
+		if err != nil {
+			t.Fatalf("GetReleaseHistory() error: %v", err)
+		}
+		if len(history) != workers {
+			t.Fatalf("history has %d revisions, want %d", len(history), workers)
+		}
+		deployed := 0
+		for i, rel := range history {
+			if rel.Revision != i+1 {
+				t.Errorf("revision %d recorded as %d", i+1, rel.Revision)
+			}
+			if rel.Status == release.StatusDeployed {
+				deployed++
+			}
+		}
+		if deployed != 1 {
+			t.Errorf("%d deployed revisions, want 1", deployed)
+		}
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = time.Hour
+		client.OperationLockTimeout = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go client.InstallChartContext(ctx, "store-ns", "app", "repo/app", "1.0.0", nil, false, false, 0)
+		waitForStatus(t, client, "store-ns", "app", release.StatusPendingInstall)
+
+		start := time.Now()
+		_, err := client.UninstallRelease("store-ns", "app", false, time.Minute)
+		var busy *OperationInProgressError
+		if !errors.As(err, &busy) || busy.Op != "install" {
+			t.Fatalf("UninstallRelease() error = %v, want an install in progress", err)
+		}
+		if waited := time.Since(start); waited < client.OperationLockTimeout {
+			t.Errorf("UninstallRelease() gave up after %v, want at least %v", waited, client.OperationLockTimeout)
+		}
+
+		// The context bounds the wait as well.
+		client.OperationLockTimeout = time.Hour
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer waitCancel()
+		if _, err := client.UninstallReleaseContext(waitCtx, "store-ns", "app", false, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("UninstallRelease() queued past its deadline error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("releases lock independently", func(t *testing.T) {
+		client := newStoreTestClient(t)
+		client.OperationDelay = 20 * time.Millisecond
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				name := fmt.Sprintf("app-%d", i)
+				if _, err := client.InstallChart("store-ns", name, "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+					t.Errorf("InstallChart(%s) error: %v", name, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if releases, _ := client.ListReleases("store-ns", action.ListAll); len(releases) != workers {
+			t.Errorf("ListReleases() returned %d releases, want %d", len(releases), workers)
+		}
+	})
+}
+
+func TestReleaseStore_UpdateFailure(t *testing.T) {
+	client := newStoreTestClient(t)
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	// finalizeRevision supersedes the deployed revision before it finds that
+	// revision 5 does not exist; the failed update must not keep that.
+	if _, err := client.finalizeRevision("store-ns", "app", 5, "Upgrade complete"); err == nil {
+		t.Fatal("finalizeRevision() of a missing revision expected error, got nil")
+	}
+	if rel := client.releases().last("store-ns", "app"); rel.Info.Status != release.StatusDeployed || rel.Info.Description != "Install complete" {
+		t.Errorf("revision 1 after failed update = %s %q, want deployed %q", rel.Info.Status, rel.Info.Description, "Install complete")
+	}
+}
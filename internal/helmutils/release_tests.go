@@ -0,0 +1,146 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+// ReleaseTestResult is the outcome of one chart test hook, the equivalent of
+// a test pod run by 'helm test'.
+type ReleaseTestResult struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	Phase       release.HookPhase `json:"phase"`
+	StartedAt   time.Time         `json:"startedAt"`
+	CompletedAt time.Time         `json:"completedAt"`
+	Logs        string            `json:"logs,omitempty"`
+}
+
+// Passed reports whether the test completed successfully.
+func (r *ReleaseTestResult) Passed() bool {
+	return r != nil && r.Phase == release.HookPhaseSucceeded
+}
+
+// ReleaseTestOutcome scripts how the mock client runs a test hook.
+type ReleaseTestOutcome struct {
+	// Fail makes the test finish in the Failed phase.
+	Fail bool
+	// Logs is returned as the test pod's output.
+	Logs string
+	// Duration is how long the test runs. A test still running when the
+	// timeout passes fails.
+	Duration time.Duration
+}
+
+// selectTestHooks returns the test hooks of a release in the order Helm runs
+// them: by weight, then by name. filter lists the test names to run; names
+// prefixed with "!" are skipped instead. An empty filter runs every test.
+func selectTestHooks(hooks []*release.Hook, filter []string) ([]*release.Hook, error) {
+	include := make(map[string]bool)
+	exclude := make(map[string]bool)
+	for _, f := range filter {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "":
+		case strings.HasPrefix(f, "!"):
+			exclude[strings.TrimPrefix(f, "!")] = true
+		default:
+			include[f] = true
+		}
+	}
+
+	var tests []*release.Hook
+	found := make(map[string]bool)
+	for _, h := range hooks {
+		if !hasHookEvent(h, release.HookTest) {
+			continue
+		}
+		found[h.Name] = true
+		if exclude[h.Name] || (len(include) > 0 && !include[h.Name]) {
+			continue
+		}
+		tests = append(tests, h)
+	}
+	for name := range include {
+		if !found[name] {
+			return nil, fmt.Errorf("no test named %q in release", name)
+		}
+	}
+	sort.SliceStable(tests, func(i, j int) bool {
+		if tests[i].Weight != tests[j].Weight {
+			return tests[i].Weight < tests[j].Weight
+		}
+		return tests[i].Name < tests[j].Name
+	})
+	return tests, nil
+}
+
+// runTestHook simulates running one test hook according to its configured
+// outcome. It returns ctx.Err() if ctx ends before the test completes, along
+// with a Failed result.
+func (c *Client) runTestHook(ctx context.Context, h *release.Hook) (*ReleaseTestResult, error) {
+	outcome := c.TestOutcomes[h.Name]
+	res := &ReleaseTestResult{Name: h.Name, Kind: h.Kind, StartedAt: time.Now(), Logs: outcome.Logs}
+
+	var err error
+	if outcome.Duration > 0 {
+		timer := time.NewTimer(outcome.Duration)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timer.C:
+		}
+		timer.Stop()
+	} else {
+		err = ctx.Err()
+	}
+
+	res.CompletedAt = time.Now()
+	switch {
+	case err != nil:
+		res.Phase = release.HookPhaseFailed
+	case outcome.Fail:
+		res.Phase = release.HookPhaseFailed
+	default:
+		res.Phase = release.HookPhaseSucceeded
+	}
+	return res, err
+}
+
+// recordTestRuns stores the last run of each test on the tested revision,
+// as Helm does, so it shows up in the release's hooks.
+func (c *Client) recordTestRuns(namespace, releaseName string, version int, results []*ReleaseTestResult) error {
+	runs := make(map[string]*ReleaseTestResult, len(results))
+	for _, r := range results {
+		runs[r.Name] = r
+	}
+	return c.releases().update(namespace, releaseName, func(revs []*release.Release) ([]*release.Release, error) {
+		for _, rel := range revs {
+			if rel.Version != version {
+				continue
+			}
+			// Replace rather than modify the hooks: earlier copies of the
+			// revision handed to readers share them.
+			hooks := make([]*release.Hook, len(rel.Hooks))
+			for i, h := range rel.Hooks {
+				cp := *h
+				if r, ok := runs[h.Name]; ok && hasHookEvent(h, release.HookTest) {
+					cp.LastRun = release.HookExecution{
+						StartedAt:   helmtime.Time{Time: r.StartedAt},
+						CompletedAt: helmtime.Time{Time: r.CompletedAt},
+						Phase:       r.Phase,
+					}
+				}
+				hooks[i] = &cp
+			}
+			rel.Hooks = hooks
+		}
+		return revs, nil
+	})
+}
@@ -0,0 +1,132 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// writeTestHooks adds two test pods to the chart written by writeTestChart:
+// "<release>-connection" (weight 1) and "<release>-smoke" (weight 0).
+func writeTestHooks(t *testing.T, chartDir string) {
+	t.Helper()
+	testsDir := filepath.Join(chartDir, "templates", "tests")
+	if err := os.MkdirAll(testsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, weight := range map[string]string{"connection": "1", "smoke": "0"} {
+		content := `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ .Release.Name }}-` + name + `
+  annotations:
+    "helm.sh/hook": test
+    "helm.sh/hook-weight": "` + weight + `"
+spec:
+  restartPolicy: Never
+  containers:
+    - name: ` + name + `
+      image: busybox
+`
+		if err := os.WriteFile(filepath.Join(testsDir, name+".yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClient_RunReleaseTests(t *testing.T) {
+	client := newStoreTestClient(t)
+	chartDir := writeTestChart(t, t.TempDir())
+	writeTestHooks(t, chartDir)
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	t.Run("all tests pass by default", func(t *testing.T) {
+		results, err := client.RunReleaseTests("store-ns", "web", time.Minute, nil)
+		if err != nil {
+			t.Fatalf("RunReleaseTests() error: %v", err)
+		}
+		if len(results) != 2 || results[0].Name != "web-smoke" || results[1].Name != "web-connection" {
+			t.Fatalf("RunReleaseTests() results = %+v, want web-smoke then web-connection", results)
+		}
+		for _, r := range results {
+			if !r.Passed() || r.Kind != "Pod" || r.StartedAt.IsZero() || r.CompletedAt.Before(r.StartedAt) {
+				t.Errorf("result %+v, want a completed passing Pod test", r)
+			}
+		}
+	})
+
+	t.Run("configured outcomes", func(t *testing.T) {
+		client.TestOutcomes = map[string]ReleaseTestOutcome{
+			"web-connection": {Fail: true, Logs: "connection refused"},
+			"web-smoke":      {Logs: "ok"},
+		}
+		defer func() { client.TestOutcomes = nil }()
+		results, err := client.RunReleaseTests("store-ns", "web", time.Minute, nil)
+		if err != nil {
+			t.Fatalf("RunReleaseTests() error: %v", err)
+		}
+		if !results[0].Passed() || results[0].Logs != "ok" {
+			t.Errorf("web-smoke = %+v, want passed with logs", results[0])
+		}
+		if results[1].Passed() || results[1].Phase != release.HookPhaseFailed || results[1].Logs != "connection refused" {
+			t.Errorf("web-connection = %+v, want failed with logs", results[1])
+		}
+
+		// The last run is recorded on the revision's hooks.
+		rel := client.releases().last("store-ns", "web")
+		for _, h := range rel.Hooks {
+			if h.Name == "web-connection" && h.LastRun.Phase != release.HookPhaseFailed {
+				t.Errorf("recorded phase of web-connection = %s, want Failed", h.LastRun.Phase)
+			}
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		results, err := client.RunReleaseTests("store-ns", "web", time.Minute, []string{"web-connection"})
+		if err != nil || len(results) != 1 || results[0].Name != "web-connection" {
+			t.Errorf("RunReleaseTests(include) = %+v, %v, want only web-connection", results, err)
+		}
+		results, err = client.RunReleaseTests("store-ns", "web", time.Minute, []string{"!web-connection"})
+		if err != nil || len(results) != 1 || results[0].Name != "web-smoke" {
+			t.Errorf("RunReleaseTests(exclude) = %+v, %v, want only web-smoke", results, err)
+		}
+		if _, err := client.RunReleaseTests("store-ns", "web", time.Minute, []string{"web-missing"}); err == nil {
+			t.Error("RunReleaseTests() with an unknown test expected error, got nil")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client.TestOutcomes = map[string]ReleaseTestOutcome{"web-connection": {Duration: time.Hour}}
+		defer func() { client.TestOutcomes = nil }()
+		results, err := client.RunReleaseTests("store-ns", "web", 10*time.Millisecond, nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("RunReleaseTests() error = %v, want context.DeadlineExceeded", err)
+		}
+		if len(results) != 2 || !results[0].Passed() || results[1].Phase != release.HookPhaseFailed {
+			t.Errorf("RunReleaseTests() results = %+v, want web-smoke passed and web-connection failed", results)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := client.RunReleaseTests("store-ns", "missing", time.Minute, nil); err == nil {
+			t.Error("RunReleaseTests() of a missing release expected error, got nil")
+		}
+		if _, err := client.RunReleaseTests("store-ns", "", time.Minute, nil); err == nil {
+			t.Error("RunReleaseTests() with empty name expected error, got nil")
+		}
+		if _, err := client.InstallChart("store-ns", "no-tests", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart() error: %v", err)
+		}
+		results, err := client.RunReleaseTests("store-ns", "no-tests", time.Minute, nil)
+		if err != nil || len(results) != 0 {
+			t.Errorf("RunReleaseTests() of a chart without tests = %+v, %v, want no results", results, err)
+		}
+	})
+}
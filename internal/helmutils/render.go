@@ -0,0 +1,136 @@
+package helmutils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+const notesFileSuffix = "NOTES.txt"
+
+// renderedRelease is the output of rendering a chart for a release.
+type renderedRelease struct {
+	Manifest string
+	Notes    string
+	Hooks    []*release.Hook
+}
+
+// loadChart resolves a chart reference. Local chart directories and .tgz
+// archives are loaded with Helm's chart loader; any other reference (for
+// example "repo/chart") gets placeholder metadata since nothing is downloaded.
+func loadChart(chartRef, chartVersion string) (*chart.Chart, error) {
+	if _, err := os.Stat(chartRef); err != nil {
+		return mockChart(chartRef, chartVersion), nil
+	}
+	ch, err := loader.Load(chartRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart from %s: %w", chartRef, err)
+	}
+	return ch, nil
+}
+
+// renderChart renders a chart's templates for a release through Helm's
+// template engine, with vals coalesced over the chart defaults. No cluster is
+// contacted: capabilities are Helm's defaults and lookup returns nothing.
+func renderChart(ch *chart.Chart, namespace, releaseName string, revision int, isUpgrade bool, vals map[string]interface{}) (*renderedRelease, error) {
+	if vals == nil {
+		vals = map[string]interface{}{}
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(ch, vals); err != nil {
+		return nil, fmt.Errorf("failed to process chart dependencies: %w", err)
+	}
+
+	caps := chartutil.DefaultCapabilities
+	if ch.Metadata.KubeVersion != "" && !chartutil.IsCompatibleRange(ch.Metadata.KubeVersion, caps.KubeVersion.String()) {
+		return nil, fmt.Errorf("chart requires kubeVersion: %s which is incompatible with Kubernetes %s", ch.Metadata.KubeVersion, caps.KubeVersion.String())
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  revision,
+		IsInstall: !isUpgrade,
+		IsUpgrade: isUpgrade,
+	}
+	renderVals, err := chartutil.ToRenderValues(ch, vals, options, caps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute values for chart %s: %w: %w", ch.Name(), ErrInvalidValues, err)
+	}
+
+	files, err := engine.Render(ch, renderVals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart %s: %w", ch.Name(), err)
+	}
+
+	// NOTES.txt is rendered like any other template but is neither a resource
+	// nor a hook. Only the top-level chart's notes are kept, as Helm does by default.
+	out := &renderedRelease{}
+	for name, content := range files {
+		if strings.HasSuffix(name, notesFileSuffix) {
+			if name == path.Join(ch.Name(), "templates", notesFileSuffix) {
+				out.Notes = content
+			}
+			delete(files, name)
+		}
+	}
+
+	hooks, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rendered manifests for chart %s: %w", ch.Name(), err)
+	}
+	var b bytes.Buffer
+	for _, crd := range ch.CRDObjects() {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", crd.Filename, string(crd.File.Data))
+	}
+	for _, m := range manifests {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", m.Name, m.Content)
+	}
+	out.Manifest = b.String()
+	out.Hooks = hooks
+	return out, nil
+}
+
+// computeValues coalesces user-supplied values over a chart's defaults,
+// including those of its subcharts, exactly as Helm does before rendering.
+func computeValues(ch *chart.Chart, vals map[string]interface{}) (map[string]interface{}, error) {
+	if ch == nil {
+		return copyValues(vals), nil
+	}
+	computed, err := chartutil.CoalesceValues(ch, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute values for chart %s: %w: %w", ch.Name(), ErrInvalidValues, err)
+	}
+	return computed, nil
+}
+
+// renderInto renders a release's chart with its user-supplied values and
+// stores the resulting manifest, hooks and notes on the release. The client's
+// ValuesTransform is applied to the values first, and the values it returns
+// are the ones recorded; the manifest then goes through its PostRenderers.
+func (c *Client) renderInto(rel *release.Release, isUpgrade bool) error {
+	vals, err := c.transformValues(rel.Config)
+	if err != nil {
+		return err
+	}
+	rel.Config = vals
+	rendered, err := renderChart(rel.Chart, rel.Namespace, rel.Name, rel.Version, isUpgrade, rel.Config)
+	if err != nil {
+		return err
+	}
+	manifest, err := c.postRender(rendered.Manifest)
+	if err != nil {
+		return err
+	}
+	rel.Manifest = manifest
+	rel.Hooks = rendered.Hooks
+	rel.Info.Notes = rendered.Notes
+	return nil
+}
@@ -0,0 +1,312 @@
+package helmutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// RepositoryInfo summarizes a configured chart repository. Credentials are
+// deliberately left out.
+type RepositoryInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ChartSearchResult is a chart version found in a repository index.
+type ChartSearchResult struct {
+	Name         string `json:"name"` // repo/chart
+	ChartVersion string `json:"chartVersion"`
+	AppVersion   string `json:"appVersion,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Repository   string `json:"repository"`
+}
+
+// loadRepoFile reads the repositories file, returning an empty one if it does
+// not exist yet.
+func (c *Client) loadRepoFile() (*repo.File, error) {
+	path := c.settings.RepositoryConfig
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return repo.NewFile(), nil
+	}
+	f, err := repo.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repositories file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (c *Client) writeRepoFile(f *repo.File) error {
+	path := c.settings.RepositoryConfig
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for repositories file %s: %w", path, err)
+	}
+	if err := f.WriteFile(path, 0600); err != nil {
+		return fmt.Errorf("failed to write repositories file %s: %w", path, err)
+	}
+	return nil
+}
+
+// indexCachePath is where the index of the named repository is cached,
+// following Helm's own layout.
+func (c *Client) indexCachePath(name string) string {
+	return filepath.Join(c.settings.RepositoryCache, helmpath.CacheIndexFile(name))
+}
+
+// downloadIndex fetches and validates a repository's index.yaml and stores it
+// in the repository cache.
+func (c *Client) downloadIndex(ctx context.Context, entry *repo.Entry) (*repo.IndexFile, error) {
+	indexURL, err := repo.ResolveReferenceURL(entry.URL, "index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetchURL(ctx, indexURL, entry.Username, entry.Password)
+	if err != nil {
+		return nil, fmt.Errorf("looks like %q is not a valid chart repository or cannot be reached: %w: %w", entry.URL, ErrRepoUnreachable, err)
+	}
+
+	if err := os.MkdirAll(c.settings.RepositoryCache, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create repository cache %s: %w", c.settings.RepositoryCache, err)
+	}
+	// Validate through a temporary file so a bad download never replaces a good cache.
+	tmp, err := os.CreateTemp(c.settings.RepositoryCache, entry.Name+"-index-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to cache index for repository %s: %w", entry.Name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to cache index for repository %s: %w", entry.Name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to cache index for repository %s: %w", entry.Name, err)
+	}
+	idx, err := repo.LoadIndexFile(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid index for repository %s at %s: %w", entry.Name, indexURL, err)
+	}
+	if err := os.Rename(tmp.Name(), c.indexCachePath(entry.Name)); err != nil {
+		return nil, fmt.Errorf("failed to cache index for repository %s: %w", entry.Name, err)
+	}
+	return idx, nil
+}
+
+// loadIndex returns the cached index of a repository, downloading it first
+// if it has never been fetched.
+func (c *Client) loadIndex(ctx context.Context, entry *repo.Entry) (*repo.IndexFile, error) {
+	path := c.indexCachePath(entry.Name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c.downloadIndex(ctx, entry)
+	}
+	idx, err := repo.LoadIndexFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cached index for repository %s: %w", entry.Name, err)
+	}
+	return idx, nil
+}
+
+// downloadChart fetches a chart version listed in a repository index into the
+// repository cache and checks it against the digest recorded in the index.
+// A cached archive whose digest still matches is reused.
+func (c *Client) downloadChart(ctx context.Context, entry *repo.Entry, cv *repo.ChartVersion) (string, error) {
+	if len(cv.URLs) == 0 {
+		return "", fmt.Errorf("chart %s-%s in repository %s has no download URL", cv.Name, cv.Version, entry.Name)
+	}
+	chartURL, err := repo.ResolveReferenceURL(entry.URL, cv.URLs[0])
+	if err != nil {
+		return "", err
+	}
+	// Like Helm, only send repository credentials to other hosts when asked to.
+	username, password := entry.Username, entry.Password
+	if !entry.PassCredentialsAll && !sameHost(entry.URL, chartURL) {
+		username, password = "", ""
+	}
+	dest := filepath.Join(c.settings.RepositoryCache, fmt.Sprintf("%s-%s.tgz", cv.Name, cv.Version))
+	if data, err := os.ReadFile(dest); err == nil && verifyDigest(data, cv.Digest) == nil {
+		return dest, c.fetchProvenance(ctx, chartURL, dest, username, password)
+	}
+
+	data, err := fetchURL(ctx, chartURL, username, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart %s-%s: %w: %w", cv.Name, cv.Version, ErrRepoUnreachable, err)
+	}
+	if err := verifyDigest(data, cv.Digest); err != nil {
+		return "", fmt.Errorf("chart %s-%s from %s: %w", cv.Name, cv.Version, chartURL, err)
+	}
+	if err := os.MkdirAll(c.settings.RepositoryCache, 0755); err != nil {
+		return "", fmt.Errorf("failed to create repository cache %s: %w", c.settings.RepositoryCache, err)
+	}
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save chart %s-%s: %w", cv.Name, cv.Version, err)
+	}
+	return dest, c.fetchProvenance(ctx, chartURL, dest, username, password)
+}
+
+// downloadArchive fetches a chart archive from a direct URL into the
+// repository cache. There is no index entry, so there is no digest to verify.
+func (c *Client) downloadArchive(ctx context.Context, chartURL string) (string, error) {
+	data, err := fetchURL(ctx, chartURL, "", "")
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart from %s: %w: %w", chartURL, ErrRepoUnreachable, err)
+	}
+	if err := os.MkdirAll(c.settings.RepositoryCache, 0755); err != nil {
+		return "", fmt.Errorf("failed to create repository cache %s: %w", c.settings.RepositoryCache, err)
+	}
+	dest := filepath.Join(c.settings.RepositoryCache, path.Base(chartURL))
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save chart from %s: %w", chartURL, err)
+	}
+	return dest, c.fetchProvenance(ctx, chartURL, dest, "", "")
+}
+
+// resolveChartRef turns an oci:// reference, or a <repo>/<chart> reference to a
+// configured repository, into a downloaded archive so installs render the real
+// chart. Any other reference is returned unchanged, unless charts are being
+// verified, in which case every reference must resolve to a signed archive.
+func (c *Client) resolveChartRef(ctx context.Context, chartRef, version string) (string, error) {
+	if registry.IsOCI(chartRef) || c.VerifyKeyring != "" {
+		return c.ensureChart(ctx, chartRef, version)
+	}
+	if _, err := os.Stat(chartRef); err == nil || strings.Contains(chartRef, "://") {
+		return chartRef, nil
+	}
+	repoName, _, ok := strings.Cut(chartRef, "/")
+	if !ok {
+		return chartRef, nil
+	}
+	c.repoMu.Lock()
+	f, err := c.loadRepoFile()
+	c.repoMu.Unlock()
+	if err != nil || f.Get(repoName) == nil {
+		return chartRef, nil
+	}
+	return c.ensureChart(ctx, chartRef, version)
+}
+
+// loadChartRef resolves chartRef through the configured repositories and loads it.
+func (c *Client) loadChartRef(ctx context.Context, chartRef, version string) (*chart.Chart, error) {
+	local, err := c.resolveChartRef(ctx, chartRef, version)
+	if err != nil {
+		return nil, err
+	}
+	return loadChart(local, version)
+}
+
+// searchIndex returns the newest version of each chart in idx that matches
+// keyword and constraint. An empty keyword matches every chart; a nil
+// constraint means the latest stable version.
+func searchIndex(repoName string, idx *repo.IndexFile, keyword string, constraint *semver.Constraints) []*ChartSearchResult {
+	keyword = strings.ToLower(keyword)
+	var results []*ChartSearchResult
+	for name, versions := range idx.Entries {
+		for _, cv := range versions { // newest first
+			v, err := semver.NewVersion(cv.Version)
+			if err != nil {
+				continue
+			}
+			if constraint == nil && v.Prerelease() != "" {
+				continue
+			}
+			if constraint != nil && !constraint.Check(v) {
+				continue
+			}
+			fullName := repoName + "/" + name
+			if keyword != "" && !chartMatches(fullName, cv, keyword) {
+				break
+			}
+			results = append(results, &ChartSearchResult{
+				Name:         fullName,
+				ChartVersion: cv.Version,
+				AppVersion:   cv.AppVersion,
+				Description:  cv.Description,
+				Repository:   repoName,
+			})
+			break
+		}
+	}
+	return results
+}
+
+func chartMatches(fullName string, cv *repo.ChartVersion, keyword string) bool {
+	if strings.Contains(strings.ToLower(fullName), keyword) || strings.Contains(strings.ToLower(cv.Description), keyword) {
+		return true
+	}
+	for _, k := range cv.Keywords {
+		if strings.Contains(strings.ToLower(k), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortSearchResults(results []*ChartSearchResult) {
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+}
+
+// fetchURL reads a file:// URL from disk or GETs an http(s) URL.
+func fetchURL(ctx context.Context, rawURL, username, password string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(u.Path)
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if username != "" || password != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q in %s", u.Scheme, rawURL)
+	}
+}
+
+// verifyDigest checks data against a hex-encoded sha256 digest. Indexes
+// without a digest are accepted, as Helm does.
+func verifyDigest(data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, strings.TrimPrefix(digest, "sha256:")) {
+		return fmt.Errorf("digest mismatch: index has %s, downloaded archive has %s", digest, got)
+	}
+	return nil
+}
+
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Host == ub.Host
+}
@@ -0,0 +1,231 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceHealth summarizes the state of a Kubernetes object owned by a release.
+type ResourceHealth string
+
+const (
+	// ResourceHealthy means the object exists and is ready.
+	ResourceHealthy ResourceHealth = "Healthy"
+	// ResourceProgressing means the object exists but is not ready yet, for
+	// example a rollout that is still running or an unbound claim.
+	ResourceProgressing ResourceHealth = "Progressing"
+	// ResourceFailed means the object will not become ready on its own, such
+	// as a failed Job or a lost volume claim.
+	ResourceFailed ResourceHealth = "Failed"
+	// ResourceMissing means the object is in the manifest but not in the cluster.
+	ResourceMissing ResourceHealth = "Missing"
+	// ResourceUnknown means readiness is not checked for the kind, or the
+	// object could not be read.
+	ResourceUnknown ResourceHealth = "Unknown"
+)
+
+// ReleaseResource is one Kubernetes object from a release's manifest.
+type ReleaseResource struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Namespace  string         `json:"namespace,omitempty"` // empty for cluster-scoped kinds
+	Name       string         `json:"name"`
+	Health     ResourceHealth `json:"health"`
+	Message    string         `json:"message,omitempty"`
+}
+
+// Ready reports whether the resource is healthy.
+func (r *ReleaseResource) Ready() bool {
+	return r != nil && r.Health == ResourceHealthy
+}
+
+// releaseResources parses a manifest into resources, sorted by kind,
+// namespace and name, with their health still unknown.
+func releaseResources(manifest, namespace string) ([]*ReleaseResource, error) {
+	objects, err := parseManifest(manifest, namespace)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*ReleaseResource, 0, len(objects))
+	for _, obj := range objects {
+		resources = append(resources, &ReleaseResource{
+			APIVersion: obj.apiVersion,
+			Kind:       obj.kind,
+			Namespace:  obj.namespace,
+			Name:       obj.name,
+			Health:     ResourceUnknown,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return resources, nil
+}
+
+// checkResourceHealth looks a resource up through the clientset and sets its
+// health. Kinds without a readiness rule are left Unknown without a lookup.
+func checkResourceHealth(ctx context.Context, cs kubernetes.Interface, r *ReleaseResource) error {
+	var err error
+	get := metav1.GetOptions{}
+	switch r.Kind {
+	case "Deployment":
+		var d *appsv1.Deployment
+		if d, err = cs.AppsV1().Deployments(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = deploymentHealth(d)
+		}
+	case "StatefulSet":
+		var s *appsv1.StatefulSet
+		if s, err = cs.AppsV1().StatefulSets(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = statefulSetHealth(s)
+		}
+	case "DaemonSet":
+		var d *appsv1.DaemonSet
+		if d, err = cs.AppsV1().DaemonSets(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = daemonSetHealth(d)
+		}
+	case "Job":
+		var j *batchv1.Job
+		if j, err = cs.BatchV1().Jobs(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = jobHealth(j)
+		}
+	case "Service":
+		var s *corev1.Service
+		if s, err = cs.CoreV1().Services(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = serviceHealth(s)
+		}
+	case "PersistentVolumeClaim":
+		var p *corev1.PersistentVolumeClaim
+		if p, err = cs.CoreV1().PersistentVolumeClaims(r.Namespace).Get(ctx, r.Name, get); err == nil {
+			r.Health, r.Message = pvcHealth(p)
+		}
+	default:
+		r.Message = "readiness not checked for this kind"
+		return nil
+	}
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		r.Health, r.Message = ResourceMissing, "not found in the cluster"
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		r.Health, r.Message = ResourceUnknown, err.Error()
+	}
+	return nil
+}
+
+// replicasOrDefault returns the desired replica count, which defaults to 1.
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func deploymentHealth(d *appsv1.Deployment) (ResourceHealth, string) {
+	desired := replicasOrDefault(d.Spec.Replicas)
+	msg := fmt.Sprintf("%d/%d replicas available", d.Status.AvailableReplicas, desired)
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+			return ResourceFailed, fmt.Sprintf("%s: %s", msg, c.Message)
+		}
+	}
+	if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < desired || d.Status.AvailableReplicas < desired {
+		return ResourceProgressing, msg
+	}
+	return ResourceHealthy, msg
+}
+
+func statefulSetHealth(s *appsv1.StatefulSet) (ResourceHealth, string) {
+	desired := replicasOrDefault(s.Spec.Replicas)
+	msg := fmt.Sprintf("%d/%d replicas ready", s.Status.ReadyReplicas, desired)
+	if s.Status.ObservedGeneration < s.Generation || s.Status.ReadyReplicas < desired {
+		return ResourceProgressing, msg
+	}
+	if s.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType && s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return ResourceProgressing, msg + ", rolling update in progress"
+	}
+	return ResourceHealthy, msg
+}
+
+func daemonSetHealth(d *appsv1.DaemonSet) (ResourceHealth, string) {
+	desired := d.Status.DesiredNumberScheduled
+	msg := fmt.Sprintf("%d/%d pods ready", d.Status.NumberReady, desired)
+	if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedNumberScheduled < desired || d.Status.NumberReady < desired {
+		return ResourceProgressing, msg
+	}
+	return ResourceHealthy, msg
+}
+
+func jobHealth(j *batchv1.Job) (ResourceHealth, string) {
+	completions := replicasOrDefault(j.Spec.Completions)
+	msg := fmt.Sprintf("%d/%d completions", j.Status.Succeeded, completions)
+	for _, c := range j.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobFailed:
+			return ResourceFailed, fmt.Sprintf("%s: %s", msg, c.Message)
+		case batchv1.JobComplete:
+			return ResourceHealthy, msg
+		}
+	}
+	if j.Status.Succeeded >= completions {
+		return ResourceHealthy, msg
+	}
+	return ResourceProgressing, msg
+}
+
+func serviceHealth(s *corev1.Service) (ResourceHealth, string) {
+	switch s.Spec.Type {
+	case corev1.ServiceTypeExternalName:
+		return ResourceHealthy, "external name " + s.Spec.ExternalName
+	case corev1.ServiceTypeLoadBalancer:
+		if len(s.Status.LoadBalancer.Ingress) == 0 {
+			return ResourceProgressing, "waiting for a load balancer address"
+		}
+		ingress := s.Status.LoadBalancer.Ingress[0]
+		addr := ingress.IP
+		if addr == "" {
+			addr = ingress.Hostname
+		}
+		return ResourceHealthy, "load balancer at " + addr
+	}
+	switch s.Spec.ClusterIP {
+	case "":
+		return ResourceProgressing, "waiting for a cluster IP"
+	case corev1.ClusterIPNone:
+		return ResourceHealthy, "headless"
+	}
+	return ResourceHealthy, "cluster IP " + s.Spec.ClusterIP
+}
+
+func pvcHealth(p *corev1.PersistentVolumeClaim) (ResourceHealth, string) {
+	switch p.Status.Phase {
+	case corev1.ClaimBound:
+		if p.Spec.VolumeName == "" {
+			return ResourceHealthy, "bound"
+		}
+		return ResourceHealthy, "bound to " + p.Spec.VolumeName
+	case corev1.ClaimLost:
+		return ResourceFailed, "volume lost"
+	default:
+		return ResourceProgressing, "waiting to be bound"
+	}
+}
@@ -0,0 +1,260 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// writeWorkloadChart writes a chart with one object of every kind
+// GetReleaseResources checks, plus a ConfigMap and a ClusterRole.
+func writeWorkloadChart(t *testing.T, dir string) string {
+	t.Helper()
+	chartDir := filepath.Join(dir, "workloads")
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: workloads\nversion: 0.1.0\n",
+		"templates/all.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-web
+spec:
+  replicas: 3
+  selector:
+    matchLabels: {app: web}
+  template:
+    metadata:
+      labels: {app: web}
+    spec:
+      containers: [{name: web, image: nginx}]
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: {{ .Release.Name }}-db
+spec:
+  serviceName: db
+  selector:
+    matchLabels: {app: db}
+  template:
+    metadata:
+      labels: {app: db}
+    spec:
+      containers: [{name: db, image: postgres}]
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: {{ .Release.Name }}-agent
+spec:
+  selector:
+    matchLabels: {app: agent}
+  template:
+    metadata:
+      labels: {app: agent}
+    spec:
+      containers: [{name: agent, image: busybox}]
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-seed
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers: [{name: seed, image: busybox}]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}-lb
+spec:
+  type: LoadBalancer
+  ports: [{port: 80}]
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{ .Release.Name }}-data
+spec:
+  accessModes: [ReadWriteOnce]
+  resources:
+    requests: {storage: 1Gi}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{ .Release.Name }}-reader
+`,
+	}
+	for name, content := range files {
+		full := filepath.Join(chartDir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chartDir
+}
+
+func TestClient_GetReleaseResources(t *testing.T) {
+	replicas := int32(3)
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "store-ns", Generation: 2}
+	}
+	clientset := fake.NewSimpleClientset(
+		// Rolling out: one of three replicas still unavailable.
+		&appsv1.Deployment{
+			ObjectMeta: meta("app-web"),
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 3, AvailableReplicas: 2},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: meta("app-db"),
+			Status:     appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r1"},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: meta("app-agent"),
+			Status:     appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberReady: 2},
+		},
+		&batchv1.Job{
+			ObjectMeta: meta("app-seed"),
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+			}},
+		},
+		&corev1.Service{
+			ObjectMeta: meta("app-lb"),
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ClusterIP: "10.0.0.7"},
+		},
+		// app-data (the PVC) is missing from the cluster.
+	)
+
+	client := newStoreTestClient(t)
+	client.authChecker = &MockK8sAuthChecker{
+		MockGetKubeConfig: func() (*rest.Config, error) { return &rest.Config{Host: "http://fake.cluster.local"}, nil },
+		MockGetClientset:  func() (kubernetes.Interface, error) { return clientset, nil },
+	}
+	if _, err := client.InstallChart("store-ns", "app", writeWorkloadChart(t, t.TempDir()), "", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	resources, err := client.GetReleaseResources("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseResources() error: %v", err)
+	}
+	want := []struct {
+		kind, namespace, name string
+		health                ResourceHealth
+	}{
+		{"ClusterRole", "", "app-reader", ResourceUnknown},
+		{"ConfigMap", "store-ns", "app-config", ResourceUnknown},
+		{"DaemonSet", "store-ns", "app-agent", ResourceHealthy},
+		{"Deployment", "store-ns", "app-web", ResourceProgressing},
+		{"Job", "store-ns", "app-seed", ResourceFailed},
+		{"PersistentVolumeClaim", "store-ns", "app-data", ResourceMissing},
+		{"Service", "store-ns", "app-lb", ResourceProgressing},
+		{"StatefulSet", "store-ns", "app-db", ResourceHealthy},
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("GetReleaseResources() returned %d resources, want %d: %+v", len(resources), len(want), resources)
+	}
+	for i, w := range want {
+		r := resources[i]
+		if r.Kind != w.kind || r.Namespace != w.namespace || r.Name != w.name || r.Health != w.health {
+			t.Errorf("resource %d = %s %s/%s %s, want %s %s/%s %s", i, r.Kind, r.Namespace, r.Name, r.Health, w.kind, w.namespace, w.name, w.health)
+		}
+	}
+	if web := resources[3]; web.APIVersion != "apps/v1" || web.Message != "2/3 replicas available" || web.Ready() {
+		t.Errorf("Deployment = %+v, want apps/v1 with 2/3 replicas available", web)
+	}
+
+	// Once the rollout finishes and the load balancer gets an address, both
+	// are reported healthy.
+	ctx := context.Background()
+	web, _ := clientset.AppsV1().Deployments("store-ns").Get(ctx, "app-web", metav1.GetOptions{})
+	web.Status.AvailableReplicas = 3
+	if _, err := clientset.AppsV1().Deployments("store-ns").UpdateStatus(ctx, web, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	lb, _ := clientset.CoreV1().Services("store-ns").Get(ctx, "app-lb", metav1.GetOptions{})
+	lb.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+	if _, err := clientset.CoreV1().Services("store-ns").UpdateStatus(ctx, lb, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	resources, err = client.GetReleaseResourcesContext(ctx, "store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseResources() error: %v", err)
+	}
+	if !resources[3].Ready() || !resources[6].Ready() || resources[6].Message != "load balancer at 203.0.113.10" {
+		t.Errorf("after rollout: Deployment = %+v, Service = %+v, want both healthy", resources[3], resources[6])
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := client.GetReleaseResources("store-ns", "missing"); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("GetReleaseResources() of a missing release error = %v, want ErrReleaseNotFound", err)
+		}
+		client.authChecker = getMockAuthChecker()
+		if _, err := client.GetReleaseResources("store-ns", "app"); err == nil {
+			t.Error("GetReleaseResources() without a clientset expected error, got nil")
+		}
+	})
+}
+
+func TestResourceHealthRules(t *testing.T) {
+	one := int32(1)
+	tests := []struct {
+		name   string
+		health ResourceHealth
+		got    ResourceHealth
+	}{
+		{"deployment past its progress deadline", ResourceFailed, first(deploymentHealth(&appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{Replicas: &one},
+			Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+			}},
+		}))},
+		{"deployment with an unobserved generation", ResourceProgressing, first(deploymentHealth(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Generation: 3},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}))},
+		{"statefulset mid rolling update", ResourceProgressing, first(statefulSetHealth(&appsv1.StatefulSet{
+			Status: appsv1.StatefulSetStatus{ReadyReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"},
+		}))},
+		{"daemonset with pods not ready", ResourceProgressing, first(daemonSetHealth(&appsv1.DaemonSet{
+			Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberReady: 1},
+		}))},
+		{"completed job", ResourceHealthy, first(jobHealth(&batchv1.Job{Status: batchv1.JobStatus{Succeeded: 1}}))},
+		{"running job", ResourceProgressing, first(jobHealth(&batchv1.Job{}))},
+		{"cluster IP service", ResourceHealthy, first(serviceHealth(&corev1.Service{Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"}}))},
+		{"headless service", ResourceHealthy, first(serviceHealth(&corev1.Service{Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone}}))},
+		{"bound claim", ResourceHealthy, first(pvcHealth(&corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound}}))},
+		{"pending claim", ResourceProgressing, first(pvcHealth(&corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending}}))},
+		{"lost claim", ResourceFailed, first(pvcHealth(&corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimLost}}))},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.health {
+			t.Errorf("%s: health = %s, want %s", tt.name, tt.got, tt.health)
+		}
+	}
+}
+
+func first(h ResourceHealth, _ string) ResourceHealth { return h }
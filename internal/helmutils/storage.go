@@ -0,0 +1,321 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StorageDriver names a Helm release storage backend, as HELM_DRIVER does.
+type StorageDriver string
+
+const (
+	// StorageMemory keeps releases in Helm's in-memory driver.
+	StorageMemory StorageDriver = "memory"
+	// StorageSecrets stores each revision as a Secret of type
+	// helm.sh/release.v1 in the release namespace, Helm's default.
+	StorageSecrets StorageDriver = "secret"
+	// StorageConfigMaps stores each revision as a ConfigMap in the release
+	// namespace.
+	StorageConfigMaps StorageDriver = "configmap"
+)
+
+// ParseStorageDriver accepts the driver names Helm accepts in HELM_DRIVER,
+// singular or plural. The sql driver is not supported.
+func ParseStorageDriver(name string) (StorageDriver, error) {
+	switch name {
+	case "memory":
+		return StorageMemory, nil
+	case "secret", "secrets":
+		return StorageSecrets, nil
+	case "configmap", "configmaps":
+		return StorageConfigMaps, nil
+	default:
+		return "", fmt.Errorf("unsupported storage driver %q (expected memory, secret or configmap)", name)
+	}
+}
+
+// storageBackend writes the releases of a releaseStore through to a Helm
+// storage driver. Drivers are scoped to a namespace, so one is kept for each
+// namespace the store has touched.
+type storageBackend struct {
+	name      StorageDriver
+	newDriver func(namespace string) driver.Driver // "" means all namespaces
+	drivers   map[string]driver.Driver
+}
+
+func newStorageBackend(name StorageDriver, clientset kubernetes.Interface) (*storageBackend, error) {
+	b := &storageBackend{name: name, drivers: make(map[string]driver.Driver)}
+	switch name {
+	case StorageMemory:
+		// One memory driver holds every namespace; it is pointed at the
+		// right one before each call.
+		mem := driver.NewMemory()
+		b.newDriver = func(namespace string) driver.Driver {
+			mem.SetNamespace(namespace)
+			return mem
+		}
+	case StorageSecrets, StorageConfigMaps:
+		if clientset == nil {
+			return nil, fmt.Errorf("storage driver %s needs a Kubernetes clientset", name)
+		}
+		b.newDriver = func(namespace string) driver.Driver {
+			if name == StorageSecrets {
+				return driver.NewSecrets(clientset.CoreV1().Secrets(namespace))
+			}
+			return driver.NewConfigMaps(clientset.CoreV1().ConfigMaps(namespace))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported storage driver %q", name)
+	}
+	return b, nil
+}
+
+func (b *storageBackend) driver(namespace string) driver.Driver {
+	if b.name == StorageMemory {
+		return b.newDriver(namespace)
+	}
+	d, ok := b.drivers[namespace]
+	if !ok {
+		d = b.newDriver(namespace)
+		b.drivers[namespace] = d
+	}
+	return d
+}
+
+// releaseKey is the name Helm gives the record of a release revision.
+func releaseKey(name string, version int) string {
+	return fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, version)
+}
+
+// load returns every revision recorded in the backend, in all namespaces,
+// with the labels Helm sets on its records removed again.
+func (b *storageBackend) load() ([]*release.Release, error) {
+	rels, err := b.driver("").List(func(*release.Release) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases in %s storage: %w", b.name, err)
+	}
+	for _, rel := range rels {
+		rel.Labels = withoutSystemLabels(rel.Labels)
+	}
+	return rels, nil
+}
+
+// save creates or updates one revision.
+func (b *storageBackend) save(rel *release.Release) error {
+	d := b.driver(rel.Namespace)
+	key := releaseKey(rel.Name, rel.Version)
+	err := d.Create(key, cloneRelease(rel))
+	if errors.Is(err, driver.ErrReleaseExists) {
+		err = d.Update(key, cloneRelease(rel))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store release %s revision %d in %s storage: %w", rel.Name, rel.Version, b.name, err)
+	}
+	return nil
+}
+
+// remove deletes one revision; one that is already gone is not an error.
+func (b *storageBackend) remove(namespace, name string, version int) error {
+	if _, err := b.driver(namespace).Delete(releaseKey(name, version)); err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("failed to delete release %s revision %d from %s storage: %w", name, version, b.name, err)
+	}
+	return nil
+}
+
+// revisionState is what releaseStore.update callers change on existing
+// revisions, so sync can tell which revisions need writing.
+type revisionState struct {
+	status       release.Status
+	description  string
+	lastDeployed string
+	hookRuns     string
+}
+
+func snapshotRevisions(revs []*release.Release) map[int]revisionState {
+	out := make(map[int]revisionState, len(revs))
+	for _, rel := range revs {
+		out[rel.Version] = stateOf(rel)
+	}
+	return out
+}
+
+func stateOf(rel *release.Release) revisionState {
+	var st revisionState
+	if rel.Info != nil {
+		st.status = rel.Info.Status
+		st.description = rel.Info.Description
+		st.lastDeployed = rel.Info.LastDeployed.String()
+	}
+	st.hookRuns = hookRuns(rel.Hooks)
+	return st
+}
+
+// hookRuns summarises the last run of each hook, which running the release
+// tests records on an existing revision.
+func hookRuns(hooks []*release.Hook) string {
+	var b strings.Builder
+	for _, h := range hooks {
+		fmt.Fprintf(&b, "%s:%s:%s:%s;", h.Name, h.LastRun.Phase, h.LastRun.StartedAt.String(), h.LastRun.CompletedAt.String())
+	}
+	return b.String()
+}
+
+// sync writes the revisions of a release after an update, given their state
+// before it: new and changed revisions are saved and dropped ones deleted.
+func (b *storageBackend) sync(namespace, name string, before map[int]revisionState, revs []*release.Release) error {
+	kept := make(map[int]bool, len(revs))
+	for _, rel := range revs {
+		kept[rel.Version] = true
+		if old, ok := before[rel.Version]; ok && old == stateOf(rel) {
+			continue
+		}
+		if err := b.save(rel); err != nil {
+			return err
+		}
+	}
+	for version := range before {
+		if !kept[version] {
+			if err := b.remove(namespace, name, version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func withoutSystemLabels(lbls map[string]string) map[string]string {
+	out := make(map[string]string, len(lbls))
+	for k, v := range lbls {
+		out[k] = v
+	}
+	for _, k := range driver.GetSystemLabels() {
+		delete(out, k)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// useBackend replaces the store's contents with the releases recorded in b
+// and writes every later change through to it.
+func (s *releaseStore) useBackend(b *storageBackend) error {
+	rels, err := b.load()
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string][]*release.Release)
+	for _, rel := range rels {
+		key := storeKey(rel.Namespace, rel.Name)
+		byKey[key] = append(byKey[key], rel)
+	}
+	for _, revs := range byKey {
+		sort.Slice(revs, func(i, j int) bool { return revs[i].Version < revs[j].Version })
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releases = byKey
+	s.backend = b
+	return nil
+}
+
+// migrateTo copies every recorded revision into b and switches the store to
+// it. With deleteSource set the revisions are removed from the previous
+// backend afterwards, which is refused when both backends are of the same
+// kind: they hold the same records, so nothing would be left. It returns the
+// number of revisions copied.
+func (s *releaseStore) migrateTo(ctx context.Context, b *storageBackend, deleteSource bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if deleteSource && s.backend != nil && s.backend.name == b.name {
+		return 0, fmt.Errorf("releases are already in %s storage; deleting the source would delete them", b.name)
+	}
+	keys := make([]string, 0, len(s.releases))
+	for key := range s.releases {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	copied := 0
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		for _, rel := range s.releases[key] {
+			if err := b.save(rel); err != nil {
+				return copied, err
+			}
+			copied++
+		}
+	}
+	if deleteSource && s.backend != nil {
+		for _, key := range keys {
+			for _, rel := range s.releases[key] {
+				if err := s.backend.remove(rel.Namespace, rel.Name, rel.Version); err != nil {
+					return copied, err
+				}
+			}
+		}
+	}
+	s.backend = b
+	return copied, nil
+}
+
+// UseStorageDriver points the client at a Helm storage driver: the releases
+// already recorded there replace those the client knew about, and every
+// install, upgrade, rollback and uninstall from then on is written through
+// to it. The secret and configmap drivers write to the clientset of the
+// client's K8sAuthChecker, in the release namespace, exactly as Helm does.
+// NewClient calls it with $HELM_DRIVER when that is set.
+func (c *Client) UseStorageDriver(name StorageDriver) error {
+	b, err := c.newStorageBackend(name)
+	if err != nil {
+		return err
+	}
+	if err := c.releases().useBackend(b); err != nil {
+		return err
+	}
+	c.Log("Using %s release storage", name)
+	return nil
+}
+
+// MigrateStorage copies every release revision the client knows about into
+// the storage driver to and makes it the client's storage, as
+// UseStorageDriver would. With deleteSource set, the revisions are then
+// deleted from the previous driver, unless it is the same kind as to. It
+// returns the number of revisions copied; revisions already present in the
+// target are overwritten.
+func (c *Client) MigrateStorage(ctx context.Context, to StorageDriver, deleteSource bool) (int, error) {
+	b, err := c.newStorageBackend(to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.releases().migrateTo(ctx, b, deleteSource)
+	if err != nil {
+		return n, fmt.Errorf("migration to %s storage stopped after %d revisions: %w", to, n, err)
+	}
+	c.Log("Migrated %d release revisions to %s storage", n, to)
+	return n, nil
+}
+
+func (c *Client) newStorageBackend(name StorageDriver) (*storageBackend, error) {
+	if name == StorageMemory {
+		return newStorageBackend(name, nil)
+	}
+	if c.authChecker == nil {
+		return nil, fmt.Errorf("storage driver %s needs a Kubernetes clientset, but the client has no auth checker", name)
+	}
+	clientset, err := c.authChecker.GetClientset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clientset for %s storage: %w", name, err)
+	}
+	return newStorageBackend(name, clientset)
+}
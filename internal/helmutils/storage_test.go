@@ -0,0 +1,308 @@
+package helmutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newClusterTestClient returns a client whose auth checker hands out cs, so
+// the secret and configmap storage drivers write to it.
+func newClusterTestClient(t *testing.T, cs kubernetes.Interface) *Client {
+	t.Helper()
+	auth := &MockK8sAuthChecker{
+		MockGetKubeConfig:       func() (*rest.Config, error) { return &rest.Config{Host: "http://fake.cluster.local"}, nil },
+		MockGetCurrentNamespace: func() (string, error) { return "store-ns", nil },
+		MockGetClientset:        func() (kubernetes.Interface, error) { return cs, nil },
+	}
+	hc, err := NewClient(auth, "store-ns", mockLogger)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	return hc.(*Client)
+}
+
+// storedRecords lists the Helm release Secrets, or ConfigMaps, in namespace
+// as "name status" keyed by object name.
+func storedRecords(t *testing.T, cs kubernetes.Interface, driver StorageDriver, namespace string) map[string]map[string]string {
+	t.Helper()
+	opts := metav1.ListOptions{LabelSelector: "owner=helm"}
+	out := map[string]map[string]string{}
+	if driver == StorageSecrets {
+		list, err := cs.CoreV1().Secrets(namespace).List(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range list.Items {
+			if s.Type != "helm.sh/release.v1" || len(s.Data["release"]) == 0 {
+				t.Errorf("secret %s has type %q and %d bytes of release data", s.Name, s.Type, len(s.Data["release"]))
+			}
+			out[s.Name] = s.Labels
+		}
+		return out
+	}
+	list, err := cs.CoreV1().ConfigMaps(namespace).List(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cm := range list.Items {
+		out[cm.Name] = cm.Labels
+	}
+	return out
+}
+
+func recordStatuses(records map[string]map[string]string) map[string]string {
+	out := make(map[string]string, len(records))
+	for name, lbls := range records {
+		out[name] = lbls["status"]
+	}
+	return out
+}
+
+func TestClient_SecretStorage(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	client := newClusterTestClient(t, cs)
+	if err := client.UseStorageDriver(StorageSecrets); err != nil {
+		t.Fatalf("UseStorageDriver() error: %v", err)
+	}
+
+	opts := InstallOptions{Namespace: "store-ns", ReleaseName: "app", ChartName: "repo/app", ChartVersion: "1.0.0", Labels: map[string]string{"team": "payments"}}
+	if _, err := client.InstallChartWithOptions(opts); err != nil {
+		t.Fatalf("InstallChartWithOptions() error: %v", err)
+	}
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	if _, err := client.InstallChart("other-ns", "web", "repo/web", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	records := storedRecords(t, cs, StorageSecrets, "store-ns")
+	want := map[string]string{"sh.helm.release.v1.app.v1": "superseded", "sh.helm.release.v1.app.v2": "deployed"}
+	if got := recordStatuses(records); !reflect.DeepEqual(got, want) {
+		t.Fatalf("release secrets in store-ns = %v, want %v", got, want)
+	}
+	v2 := records["sh.helm.release.v1.app.v2"]
+	if v2["name"] != "app" || v2["version"] != "2" || v2["team"] != "payments" || v2["modifiedAt"] == "" {
+		t.Errorf("revision 2 secret labels = %v, want name, version, modifiedAt and the team label", v2)
+	}
+	if got := recordStatuses(storedRecords(t, cs, StorageSecrets, "other-ns")); len(got) != 1 {
+		t.Errorf("release secrets in other-ns = %v, want one", got)
+	}
+
+	// A second client on the same cluster sees what the first one stored.
+	other := newClusterTestClient(t, cs)
+	if err := other.UseStorageDriver(StorageSecrets); err != nil {
+		t.Fatalf("UseStorageDriver() error: %v", err)
+	}
+	history, err := other.GetReleaseHistory("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() from stored secrets error: %v", err)
+	}
+	if len(history) != 2 || history[1].ChartVersion != "1.1.0" || history[1].Labels["team"] != "payments" {
+		t.Errorf("history from stored secrets = %+v, want 2 revisions, the latest 1.1.0 labelled team=payments", history)
+	}
+	for _, info := range history {
+		if _, ok := info.Labels["owner"]; ok {
+			t.Errorf("revision %d has Helm's storage labels: %v", info.Revision, info.Labels)
+		}
+	}
+
+	if _, err := other.UninstallRelease("store-ns", "app", false, time.Minute); err != nil {
+		t.Fatalf("UninstallRelease() error: %v", err)
+	}
+	if got := storedRecords(t, cs, StorageSecrets, "store-ns"); len(got) != 0 {
+		t.Errorf("release secrets after uninstall = %v, want none", recordStatuses(got))
+	}
+}
+
+func TestClient_SecretStorageWriteFailure(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	client := newClusterTestClient(t, cs)
+	if err := client.UseStorageDriver(StorageSecrets); err != nil {
+		t.Fatalf("UseStorageDriver() error: %v", err)
+	}
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+
+	// The pending revision is created, but superseding revision 1 fails.
+	cs.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("etcd unavailable")
+	})
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err == nil {
+		t.Fatal("UpgradeRelease() with failing storage expected error, got nil")
+	}
+
+	want := map[string]string{"sh.helm.release.v1.app.v1": "deployed", "sh.helm.release.v1.app.v2": "pending-upgrade"}
+	if got := recordStatuses(storedRecords(t, cs, StorageSecrets, "store-ns")); !reflect.DeepEqual(got, want) {
+		t.Errorf("release secrets = %v, want %v", got, want)
+	}
+	history, err := client.GetReleaseHistory("store-ns", "app")
+	if err != nil {
+		t.Fatalf("GetReleaseHistory() error: %v", err)
+	}
+	if len(history) != 2 || history[0].Status != release.StatusDeployed || history[1].Status != release.StatusPendingUpgrade {
+		t.Errorf("history after failed write = %+v, want revision 1 deployed and 2 pending-upgrade, as stored", history)
+	}
+}
+
+// decodeStoredRelease decodes the release data of a Helm record the way
+// Helm does: base64, then gzip, then JSON.
+func decodeStoredRelease(t *testing.T, data []byte) *release.Release {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatalf("Failed to decode release data: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to decompress release data: %v", err)
+	}
+	defer zr.Close()
+	js, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress release data: %v", err)
+	}
+	var rel release.Release
+	if err := json.Unmarshal(js, &rel); err != nil {
+		t.Fatalf("Failed to unmarshal release data: %v", err)
+	}
+	return &rel
+}
+
+func TestClient_SecretStorageTestRuns(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	client := newClusterTestClient(t, cs)
+	if err := client.UseStorageDriver(StorageSecrets); err != nil {
+		t.Fatalf("UseStorageDriver() error: %v", err)
+	}
+	chartDir := writeTestChart(t, t.TempDir())
+	writeTestHooks(t, chartDir)
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	client.TestOutcomes = map[string]ReleaseTestOutcome{"web-connection": {Fail: true}}
+	if _, err := client.RunReleaseTests("store-ns", "web", time.Minute, nil); err != nil {
+		t.Fatalf("RunReleaseTests() error: %v", err)
+	}
+
+	secret, err := cs.CoreV1().Secrets("store-ns").Get(context.Background(), "sh.helm.release.v1.web.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get release secret: %v", err)
+	}
+	rel := decodeStoredRelease(t, secret.Data["release"])
+	phases := map[string]release.HookPhase{}
+	for _, h := range rel.Hooks {
+		if !hasHookEvent(h, release.HookTest) {
+			continue
+		}
+		phases[h.Name] = h.LastRun.Phase
+		if h.LastRun.StartedAt.IsZero() {
+			t.Errorf("stored test %s has no start time", h.Name)
+		}
+	}
+	want := map[string]release.HookPhase{"web-smoke": release.HookPhaseSucceeded, "web-connection": release.HookPhaseFailed}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("stored hook phases = %v, want %v", phases, want)
+	}
+}
+
+func TestClient_MigrateStorage(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	client := newClusterTestClient(t, cs)
+	for _, name := range []string{"app", "db"} {
+		if _, err := client.InstallChart("store-ns", name, "repo/"+name, "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Fatalf("InstallChart(%s) error: %v", name, err)
+		}
+	}
+	if _, err := client.UpgradeRelease("store-ns", "app", "repo/app", "1.1.0", nil, false, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+
+	// From the client's own store into Helm's memory driver, then secrets.
+	if n, err := client.MigrateStorage(context.Background(), StorageMemory, false); err != nil || n != 3 {
+		t.Fatalf("MigrateStorage(memory) = %d, %v, want 3 revisions", n, err)
+	}
+	if n, err := client.MigrateStorage(context.Background(), StorageSecrets, true); err != nil || n != 3 {
+		t.Fatalf("MigrateStorage(secret) = %d, %v, want 3 revisions", n, err)
+	}
+	if got := storedRecords(t, cs, StorageSecrets, "store-ns"); len(got) != 3 {
+		t.Fatalf("release secrets after migration = %v, want 3", recordStatuses(got))
+	}
+
+	// Secrets to secrets would delete what it just wrote.
+	if _, err := client.MigrateStorage(context.Background(), StorageSecrets, true); err == nil {
+		t.Error("MigrateStorage(secret) from secret storage with deleteSource expected error, got nil")
+	}
+	if got := storedRecords(t, cs, StorageSecrets, "store-ns"); len(got) != 3 {
+		t.Fatalf("release secrets after refused migration = %v, want 3", recordStatuses(got))
+	}
+
+	// Secrets to configmaps, removing the secrets.
+	if n, err := client.MigrateStorage(context.Background(), StorageConfigMaps, true); err != nil || n != 3 {
+		t.Fatalf("MigrateStorage(configmap) = %d, %v, want 3 revisions", n, err)
+	}
+	if got := storedRecords(t, cs, StorageSecrets, "store-ns"); len(got) != 0 {
+		t.Errorf("release secrets left after migrating with deleteSource = %v", recordStatuses(got))
+	}
+	want := map[string]string{
+		"sh.helm.release.v1.app.v1": "superseded",
+		"sh.helm.release.v1.app.v2": "deployed",
+		"sh.helm.release.v1.db.v1":  "deployed",
+	}
+	if got := recordStatuses(storedRecords(t, cs, StorageConfigMaps, "store-ns")); !reflect.DeepEqual(got, want) {
+		t.Errorf("release configmaps = %v, want %v", got, want)
+	}
+
+	// Later changes go to the new driver only.
+	if _, err := client.RollbackRelease("store-ns", "app", 1, false, time.Minute, false); err != nil {
+		t.Fatalf("RollbackRelease() error: %v", err)
+	}
+	if got := storedRecords(t, cs, StorageConfigMaps, "store-ns"); got["sh.helm.release.v1.app.v3"]["status"] != "deployed" {
+		t.Errorf("rollback revision not stored as a configmap: %v", recordStatuses(got))
+	}
+
+	t.Setenv("HELM_DRIVER", "configmaps")
+	fresh := newClusterTestClient(t, cs)
+	releases, err := fresh.ListReleasesWithOptions(ListOptions{Namespace: "store-ns"})
+	if err != nil {
+		t.Fatalf("ListReleasesWithOptions() error: %v", err)
+	}
+	var got []string
+	for _, r := range releases {
+		got = append(got, r.Name)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"app", "db"}) {
+		t.Errorf("releases loaded from HELM_DRIVER=configmaps = %v, want [app db]", got)
+	}
+
+	// Drivers that cannot be used fall back to the in-memory store.
+	for _, name := range []string{"sql", "secret"} {
+		t.Setenv("HELM_DRIVER", name)
+		hc, err := NewClient(getMockAuthChecker(), "store-ns", mockLogger)
+		if err != nil {
+			t.Fatalf("NewClient() with HELM_DRIVER=%s error: %v", name, err)
+		}
+		if _, err := hc.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+			t.Errorf("InstallChart() with HELM_DRIVER=%s error: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ReleaseEventType identifies what a ReleaseEvent reports.
+type ReleaseEventType string
+
+const (
+	// ReleaseEventRevision reports a new revision of the release.
+	ReleaseEventRevision ReleaseEventType = "revision"
+	// ReleaseEventStatus reports a status transition of the current revision.
+	ReleaseEventStatus ReleaseEventType = "status"
+	// ReleaseEventHookStarted reports that a chart hook started running.
+	ReleaseEventHookStarted ReleaseEventType = "hook-started"
+	// ReleaseEventHookFinished reports that a chart hook completed.
+	ReleaseEventHookFinished ReleaseEventType = "hook-finished"
+	// ReleaseEventResources reports how many of the release's resources are ready.
+	ReleaseEventResources ReleaseEventType = "resources"
+	// ReleaseEventDeleted reports that the release and its history were removed.
+	ReleaseEventDeleted ReleaseEventType = "deleted"
+)
+
+// ReleaseEvent is a single progress update from WatchRelease. Only the fields
+// relevant to Type are set.
+type ReleaseEvent struct {
+	Type      ReleaseEventType `json:"type"`
+	Time      time.Time        `json:"time"`
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace"`
+	Revision  int              `json:"revision,omitempty"`
+
+	Status         release.Status `json:"status,omitempty"`
+	PreviousStatus release.Status `json:"previousStatus,omitempty"`
+
+	Hook      string            `json:"hook,omitempty"`
+	HookEvent release.HookEvent `json:"hookEvent,omitempty"`
+
+	ReadyResources int `json:"readyResources,omitempty"`
+	TotalResources int `json:"totalResources,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// Settled reports whether the event leaves the release in a state no
+// operation is working on: a non-pending status, or deletion.
+func (e ReleaseEvent) Settled() bool {
+	switch e.Type {
+	case ReleaseEventDeleted:
+		return true
+	case ReleaseEventStatus:
+		return !e.Status.IsPending() && e.Status != release.StatusUninstalling
+	default:
+		return false
+	}
+}
+
+// ScriptedReleaseEvent is one step of a scripted watch timeline: Event is
+// emitted After the previous step.
+type ScriptedReleaseEvent struct {
+	After time.Duration
+	Event ReleaseEvent
+}
+
+// ScriptedWatch returns a WatchReleaseFunc that replays script instead of
+// observing the release store, for driving consumers of WatchRelease through
+// a fixed timeline. Empty Name, Namespace and Time fields are filled in. The
+// channel is closed after the last step or when ctx is done.
+func ScriptedWatch(script []ScriptedReleaseEvent) func(ctx context.Context, namespace, releaseName string) (<-chan ReleaseEvent, error) {
+	return func(ctx context.Context, namespace, releaseName string) (<-chan ReleaseEvent, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out := make(chan ReleaseEvent)
+		go func() {
+			defer close(out)
+			for _, step := range script {
+				if step.After > 0 {
+					timer := time.NewTimer(step.After)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return
+					case <-timer.C:
+					}
+				}
+				ev := step.Event
+				if ev.Name == "" {
+					ev.Name = releaseName
+				}
+				if ev.Namespace == "" {
+					ev.Namespace = namespace
+				}
+				if ev.Time.IsZero() {
+					ev.Time = time.Now()
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case out <- ev:
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+func latestRevision(revs []*release.Release) *release.Release {
+	if len(revs) == 0 {
+		return nil
+	}
+	return revs[len(revs)-1]
+}
+
+// releaseEvents describes the change from prev to cur, either of which may be
+// nil, as a sequence of events.
+func releaseEvents(prev, cur *release.Release) []ReleaseEvent {
+	now := time.Now()
+	if cur == nil {
+		if prev == nil {
+			return nil
+		}
+		return []ReleaseEvent{{Type: ReleaseEventDeleted, Time: now, Name: prev.Name, Namespace: prev.Namespace, Revision: prev.Version, Message: "release and its history were removed"}}
+	}
+	base := ReleaseEvent{Time: now, Name: cur.Name, Namespace: cur.Namespace, Revision: cur.Version}
+
+	var events []ReleaseEvent
+	var prevStatus release.Status
+	if prev == nil || prev.Version != cur.Version {
+		ev := base
+		ev.Type = ReleaseEventRevision
+		ev.Status = cur.Info.Status
+		ev.Message = cur.Info.Description
+		events = append(events, ev)
+	} else {
+		prevStatus = prev.Info.Status
+	}
+	if prevStatus == cur.Info.Status {
+		return events
+	}
+
+	status := base
+	status.Type = ReleaseEventStatus
+	status.Status = cur.Info.Status
+	status.PreviousStatus = prevStatus
+	status.Message = cur.Info.Description
+
+	// Hooks run as an operation starts and after its resources are ready.
+	var hookPhase release.HookEvent
+	switch cur.Info.Status {
+	case release.StatusPendingInstall:
+		hookPhase = release.HookPreInstall
+	case release.StatusPendingUpgrade:
+		hookPhase = release.HookPreUpgrade
+	case release.StatusPendingRollback:
+		hookPhase = release.HookPreRollback
+	case release.StatusUninstalling:
+		hookPhase = release.HookPreDelete
+	case release.StatusUninstalled:
+		hookPhase = release.HookPostDelete
+	case release.StatusDeployed:
+		switch prevStatus {
+		case release.StatusPendingInstall:
+			hookPhase = release.HookPostInstall
+		case release.StatusPendingUpgrade:
+			hookPhase = release.HookPostUpgrade
+		case release.StatusPendingRollback:
+			hookPhase = release.HookPostRollback
+		}
+	}
+	var hooks []ReleaseEvent
+	if hookPhase != "" {
+		for _, h := range cur.Hooks {
+			if !hasHookEvent(h, hookPhase) {
+				continue
+			}
+			started := base
+			started.Type = ReleaseEventHookStarted
+			started.Hook = h.Name
+			started.HookEvent = hookPhase
+			started.Message = fmt.Sprintf("%s %s running", h.Kind, h.Name)
+			finished := started
+			finished.Type = ReleaseEventHookFinished
+			finished.Message = fmt.Sprintf("%s %s succeeded", h.Kind, h.Name)
+			hooks = append(hooks, started, finished)
+		}
+	}
+
+	var resources []ReleaseEvent
+	switch cur.Info.Status {
+	case release.StatusPendingInstall, release.StatusPendingUpgrade, release.StatusPendingRollback, release.StatusDeployed:
+		if total := countResources(cur); total > 0 {
+			ready := 0
+			if cur.Info.Status == release.StatusDeployed {
+				ready = total
+			}
+			res := base
+			res.Type = ReleaseEventResources
+			res.ReadyResources = ready
+			res.TotalResources = total
+			res.Message = fmt.Sprintf("%d/%d resources ready", ready, total)
+			resources = append(resources, res)
+		}
+	}
+
+	// An operation reports its pending status before its hooks and
+	// resources; a settled status comes last, once everything is done.
+	if status.Settled() {
+		events = append(events, resources...)
+		events = append(events, hooks...)
+		return append(events, status)
+	}
+	events = append(events, status)
+	events = append(events, hooks...)
+	return append(events, resources...)
+}
+
+func hasHookEvent(h *release.Hook, event release.HookEvent) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// countResources returns the number of objects in a release's manifest.
+func countResources(rel *release.Release) int {
+	if strings.TrimSpace(rel.Manifest) == "" {
+		return 0
+	}
+	objects, err := parseManifest(rel.Manifest, rel.Namespace)
+	if err != nil {
+		return 0
+	}
+	return len(objects)
+}
@@ -0,0 +1,191 @@
+package helmutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// collectEvents reads events until one satisfies stop, failing the test if
+// none does within a few seconds.
+func collectEvents(t *testing.T, events <-chan ReleaseEvent, stop func(ReleaseEvent) bool) []ReleaseEvent {
+	t.Helper()
+	var got []ReleaseEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("event channel closed early after %v", describeEvents(got))
+			}
+			got = append(got, ev)
+			if stop(ev) {
+				return got
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for events, got %v", describeEvents(got))
+		}
+	}
+}
+
+// describeEvents summarizes events as "type:detail" strings for comparison.
+func describeEvents(events []ReleaseEvent) []string {
+	out := make([]string, 0, len(events))
+	for _, ev := range events {
+		detail := ""
+		switch ev.Type {
+		case ReleaseEventRevision:
+			detail = fmt.Sprint(ev.Revision)
+		case ReleaseEventStatus:
+			detail = ev.Status.String()
+		case ReleaseEventHookStarted, ReleaseEventHookFinished:
+			detail = string(ev.HookEvent) + "/" + ev.Hook
+		case ReleaseEventResources:
+			detail = fmt.Sprintf("%d/%d", ev.ReadyResources, ev.TotalResources)
+		}
+		out = append(out, string(ev.Type)+":"+detail)
+	}
+	return out
+}
+
+func TestClient_WatchRelease(t *testing.T) {
+	client := newStoreTestClient(t)
+	client.OperationDelay = 5 * time.Millisecond
+	chartDir := writeTestChart(t, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Watching a release that does not exist yet reports it once installed.
+	events, err := client.WatchRelease(ctx, "store-ns", "web")
+	if err != nil {
+		t.Fatalf("WatchRelease() error: %v", err)
+	}
+	if _, err := client.InstallChart("store-ns", "web", chartDir, "", nil, false, true, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	got := describeEvents(collectEvents(t, events, ReleaseEvent.Settled))
+	want := []string{
+		"revision:1",
+		"status:pending-install",
+		"hook-started:pre-install/web-migrate",
+		"hook-finished:pre-install/web-migrate",
+		"resources:0/1",
+		"resources:1/1",
+		"status:deployed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("install events = %v, want %v", got, want)
+	}
+
+	if _, err := client.UpgradeRelease("store-ns", "web", chartDir, "", map[string]interface{}{"replicaCount": 3}, true, time.Minute, false, false); err != nil {
+		t.Fatalf("UpgradeRelease() error: %v", err)
+	}
+	got = describeEvents(collectEvents(t, events, ReleaseEvent.Settled))
+	want = []string{
+		"revision:2",
+		"status:pending-upgrade",
+		"resources:0/1",
+		"resources:1/1",
+		"status:deployed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("upgrade events = %v, want %v", got, want)
+	}
+
+	if _, err := client.UninstallRelease("store-ns", "web", false, time.Minute); err != nil {
+		t.Fatalf("UninstallRelease() error: %v", err)
+	}
+	got = describeEvents(collectEvents(t, events, ReleaseEvent.Settled))
+	if first, last := got[0], got[len(got)-1]; first != "status:uninstalling" || last != "deleted:" {
+		t.Errorf("uninstall events = %v, want status:uninstalling first and deleted: last", got)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event channel not closed after cancel")
+	}
+}
+
+func TestClient_WatchReleaseExisting(t *testing.T) {
+	client := newStoreTestClient(t)
+	if _, err := client.InstallChart("store-ns", "app", "repo/app", "1.0.0", nil, false, false, time.Minute); err != nil {
+		t.Fatalf("InstallChart() error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.WatchRelease(ctx, "store-ns", "app")
+	if err != nil {
+		t.Fatalf("WatchRelease() error: %v", err)
+	}
+	got := collectEvents(t, events, ReleaseEvent.Settled)
+	if got[0].Type != ReleaseEventRevision || got[0].Revision != 1 || got[0].Name != "app" || got[0].Namespace != "store-ns" {
+		t.Errorf("first event = %+v, want revision 1 of store-ns/app", got[0])
+	}
+	if last := got[len(got)-1]; last.Status != release.StatusDeployed {
+		t.Errorf("last event status = %s, want deployed", last.Status)
+	}
+
+	if _, err := client.WatchRelease(ctx, "store-ns", ""); err == nil {
+		t.Error("WatchRelease() with empty name expected error, got nil")
+	}
+	cancel()
+	if _, err := client.WatchRelease(ctx, "store-ns", "app"); err == nil {
+		t.Error("WatchRelease() with cancelled context expected error, got nil")
+	}
+}
+
+func TestScriptedWatch(t *testing.T) {
+	client := newStoreTestClient(t)
+	client.WatchReleaseFunc = ScriptedWatch([]ScriptedReleaseEvent{
+		{Event: ReleaseEvent{Type: ReleaseEventRevision, Revision: 4}},
+		{After: time.Millisecond, Event: ReleaseEvent{Type: ReleaseEventStatus, Status: release.StatusPendingUpgrade}},
+		{After: time.Millisecond, Event: ReleaseEvent{Type: ReleaseEventResources, ReadyResources: 1, TotalResources: 3}},
+		{After: time.Millisecond, Event: ReleaseEvent{Type: ReleaseEventStatus, Status: release.StatusFailed, Message: "timed out"}},
+	})
+
+	events, err := client.WatchRelease(context.Background(), "dash", "api")
+	if err != nil {
+		t.Fatalf("WatchRelease() error: %v", err)
+	}
+	var got []ReleaseEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	want := []string{"revision:4", "status:pending-upgrade", "resources:1/3", "status:failed"}
+	if d := describeEvents(got); !reflect.DeepEqual(d, want) {
+		t.Fatalf("scripted events = %v, want %v", d, want)
+	}
+	for _, ev := range got {
+		if ev.Name != "api" || ev.Namespace != "dash" || ev.Time.IsZero() {
+			t.Errorf("event %+v missing name, namespace or time", ev)
+		}
+	}
+	if !got[3].Settled() || got[1].Settled() {
+		t.Error("Settled() should be true only for the final failed status")
+	}
+
+	// Cancelling stops the timeline early.
+	client.WatchReleaseFunc = ScriptedWatch([]ScriptedReleaseEvent{
+		{Event: ReleaseEvent{Type: ReleaseEventRevision, Revision: 1}},
+		{After: time.Hour, Event: ReleaseEvent{Type: ReleaseEventDeleted}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err = client.WatchRelease(ctx, "dash", "api")
+	if err != nil {
+		t.Fatalf("WatchRelease() error: %v", err)
+	}
+	<-events
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("expected channel to close after cancel")
+	}
+}
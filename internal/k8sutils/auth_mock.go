@@ -3,8 +3,9 @@ package k8sutils
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	authorizationv1 "k8s.io/api/authorization/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -12,7 +13,6 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake" // Import fake clientset
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // K8sAuthChecker defines the interface for Kubernetes authentication and permission checks.
@@ -24,6 +24,10 @@ type K8sAuthChecker interface {
 	GetCurrentNamespace() (string, error)
 	CheckNamespacePermissions(ctx context.Context, namespace string, resource schema.GroupVersionResource, verbs []string) (map[string]bool, error)
 	CanPerformClusterAction(ctx context.Context, resource schema.GroupVersionResource, verb string) (bool, error)
+	CheckPermissionMatrix(ctx context.Context, namespaces []string, resources []schema.GroupVersionResource, verbs []string) (PermissionMatrix, error)
+	ListContexts() ([]string, error)
+	CurrentContext() (string, error)
+	SwitchContext(name string) error
 }
 
 // AuthUtil is the mock implementation of K8sAuthChecker.
@@ -32,7 +36,14 @@ type AuthUtil struct {
 	// Fields to mimic the original AuthUtil, allowing tests to set them up
 	clientset kubernetes.Interface
 	config    *rest.Config
-	inCluster bool
+
+	// options are the settings NewAuthUtilWithOptions was given, and context
+	// the kubeconfig context selected by them or by SwitchContext. Whether
+	// the checker runs in a cluster is worked out from the environment and
+	// options.ServiceAccountDir each time it is asked.
+	options   AuthOptions
+	contextMu sync.Mutex
+	context   string
 
 	// Customizable function fields for fine-grained mocking
 	GetKubeConfigFunc             func() (*rest.Config, error)
@@ -41,19 +52,39 @@ type AuthUtil struct {
 	GetCurrentNamespaceFunc       func() (string, error)
 	CheckNamespacePermissionsFunc func(ctx context.Context, namespace string, resource schema.GroupVersionResource, verbs []string) (map[string]bool, error)
 	CanPerformClusterActionFunc   func(ctx context.Context, resource schema.GroupVersionResource, verb string) (bool, error)
+	CheckPermissionMatrixFunc     func(ctx context.Context, namespaces []string, resources []schema.GroupVersionResource, verbs []string) (PermissionMatrix, error)
+	ListContextsFunc              func() ([]string, error)
+	CurrentContextFunc            func() (string, error)
+	SwitchContextFunc             func(name string) error
+
+	// Authorizer, when set, decides CheckNamespacePermissions and
+	// CanPerformClusterAction locally instead of sending
+	// SelfSubjectAccessReviews, which the fake clientset always denies.
+	// An RBACAuthorizer evaluates Roles and bindings for a given persona.
+	Authorizer Authorizer
+
+	// PermissionWorkers bounds how many access reviews CheckPermissionMatrix
+	// runs at once; zero means DefaultPermissionWorkers.
+	PermissionWorkers int
+	// PermissionCacheTTL is how long CheckPermissionMatrix reuses the result
+	// of a SelfSubjectAccessReview; zero means DefaultPermissionCacheTTL and a
+	// negative value disables the cache.
+	PermissionCacheTTL time.Duration
+	// UseRulesReview makes CheckPermissionMatrix ask for one
+	// SelfSubjectRulesReview per namespace and evaluate the returned rules,
+	// falling back to access reviews where the rules review fails or is
+	// incomplete.
+	UseRulesReview bool
+
+	permCache permissionCache
 }
 
 // NewAuthUtil is a mock constructor that returns an *AuthUtil instance.
 // This matches the original NewAuthUtil signature if it returned a concrete type.
+// It reads kubeconfig from KUBECONFIG or ~/.kube/config; use
+// NewAuthUtilWithOptions to choose the files, context or namespace.
 func NewAuthUtil() (K8sAuthChecker, error) {
-	// Return a new AuthUtil, which now implements K8sAuthChecker
-	// Tests can then further customize the func fields or the internal clientset/config if needed.
-	return &AuthUtil{
-		// Provide default mock values that are generally safe for tests
-		config:    &rest.Config{Host: "mock-kube-api-server"}, // A non-nil config
-		clientset: fake.NewSimpleClientset(),                  // A default fake clientset
-		inCluster: false,                                      // Default to out-of-cluster
-	}, nil
+	return NewAuthUtilWithOptions(AuthOptions{})
 }
 
 // GetKubeConfig mocks the GetKubeConfig method.
@@ -61,10 +92,46 @@ func (u *AuthUtil) GetKubeConfig() (*rest.Config, error) {
 	if u.GetKubeConfigFunc != nil {
 		return u.GetKubeConfigFunc()
 	}
-	if u.config == nil {
-		return &rest.Config{Host: "mock-host-default"}, nil
+	imp := u.options.Impersonate
+	impersonate := imp.UserName != "" || imp.UID != "" || len(imp.Groups) > 0 || len(imp.Extra) > 0
+
+	// In a pod, unless kubeconfig files or a context were asked for, talk to
+	// the API server as the pod's service account.
+	if host, ok := u.inClusterHost(); ok && !u.kubeconfigRequested() {
+		cfg, err := u.inClusterConfig(host)
+		if err != nil {
+			return nil, err
+		}
+		if impersonate {
+			cfg.Impersonate = imp
+		}
+		return cfg, nil
+	}
+
+	cfg := u.config
+	if cfg == nil {
+		cfg = &rest.Config{Host: "mock-host-default"}
+	}
+
+	// Point the config at the selected context's cluster, if the kubeconfig
+	// has one, and send requests as the impersonated identity.
+	var server string
+	if kcfg, err := u.loadKubeconfig(); err == nil {
+		if kctx := kcfg.Contexts[u.selectedContext(kcfg)]; kctx != nil && kcfg.Clusters[kctx.Cluster] != nil {
+			server = kcfg.Clusters[kctx.Cluster].Server
+		}
+	}
+	if server == "" && !impersonate {
+		return cfg, nil
 	}
-	return u.config, nil
+	cfg = rest.CopyConfig(cfg)
+	if server != "" {
+		cfg.Host = server
+	}
+	if impersonate {
+		cfg.Impersonate = imp
+	}
+	return cfg, nil
 }
 
 // GetClientset mocks the GetClientset method.
@@ -78,12 +145,15 @@ func (u *AuthUtil) GetClientset() (kubernetes.Interface, error) {
 	return u.clientset, nil
 }
 
-// IsRunningInCluster mocks the IsRunningInCluster method.
+// IsRunningInCluster mocks the IsRunningInCluster method. It reports
+// whether KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are set and a
+// service account token is mounted, as rest.InClusterConfig requires.
 func (u *AuthUtil) IsRunningInCluster() bool {
 	if u.IsRunningInClusterFunc != nil {
 		return u.IsRunningInClusterFunc()
 	}
-	return u.inCluster
+	_, ok := u.inClusterHost()
+	return ok
 }
 
 // GetCurrentNamespace mocks the GetCurrentNamespace method.
@@ -92,46 +162,28 @@ func (u *AuthUtil) GetCurrentNamespace() (string, error) {
 		return u.GetCurrentNamespaceFunc()
 	}
 
-	if u.IsRunningInCluster() {
-		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
-			return "kube-system", nil
-		}
+	if u.options.Namespace != "" {
+		return u.options.Namespace, nil
 	}
 
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		home, err := os.UserHomeDir()
+	if u.IsRunningInCluster() && !u.kubeconfigRequested() {
+		ns, err := u.serviceAccountNamespace()
 		if err != nil {
-			return "default", fmt.Errorf("mock: failed to get user home directory: %w", err)
+			return "default", fmt.Errorf("%w, falling back to \"default\"", err)
 		}
-		kubeconfigPath = filepath.Join(home, ".kube", "config")
-	}
-
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		return "default", nil
+		return ns, nil
 	}
 
-	configAccess := clientcmd.NewDefaultClientConfigLoadingRules()
-	configAccess.ExplicitPath = kubeconfigPath
-
-	kcfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		configAccess,
-		&clientcmd.ConfigOverrides{},
-	).RawConfig()
-
+	kcfg, err := u.loadKubeconfig()
 	if err != nil {
 		return "default", fmt.Errorf("mock: error loading kubeconfig for namespace: %w, falling back to \"default\"", err)
 	}
 
-	if kcfg.CurrentContext == "" || kcfg.Contexts[kcfg.CurrentContext] == nil {
+	kctx := kcfg.Contexts[u.selectedContext(kcfg)]
+	if kctx == nil || kctx.Namespace == "" {
 		return "default", nil
 	}
-
-	namespace := kcfg.Contexts[kcfg.CurrentContext].Namespace
-	if namespace == "" {
-		return "default", nil
-	}
-	return namespace, nil
+	return kctx.Namespace, nil
 }
 
 // CheckNamespacePermissions mocks the CheckNamespacePermissions method.
@@ -140,6 +192,18 @@ func (u *AuthUtil) CheckNamespacePermissions(ctx context.Context, namespace stri
 		return u.CheckNamespacePermissionsFunc(ctx, namespace, resourceGV, verbs)
 	}
 
+	if u.Authorizer != nil {
+		results := make(map[string]bool)
+		for _, verb := range verbs {
+			allowed, _, err := u.Authorizer.Authorize(ctx, resourceAttributes(namespace, resourceGV, verb))
+			if err != nil {
+				return nil, fmt.Errorf("mock AuthUtil: failed to authorize %s on %s in namespace %s: %w", verb, resourceGV.Resource, namespace, err)
+			}
+			results[verb] = allowed
+		}
+		return results, nil
+	}
+
 	cs, err := u.GetClientset()
 	if err != nil {
 		return nil, fmt.Errorf("mock AuthUtil: failed to get clientset for CheckNamespacePermissions: %w", err)
@@ -150,15 +214,10 @@ func (u *AuthUtil) CheckNamespacePermissions(ctx context.Context, namespace stri
 
 	results := make(map[string]bool)
 	for _, verb := range verbs {
+		attrs := resourceAttributes(namespace, resourceGV, verb)
 		sar := &authorizationv1.SelfSubjectAccessReview{
 			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
-				ResourceAttributes: &authorizationv1.ResourceAttributes{
-					Namespace: namespace,
-					Verb:      verb,
-					Group:     resourceGV.Group,
-					Version:   resourceGV.Version,
-					Resource:  resourceGV.Resource,
-				},
+				ResourceAttributes: &attrs,
 			},
 		}
 		response, errAuth := cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
@@ -177,6 +236,14 @@ func (u *AuthUtil) CanPerformClusterAction(ctx context.Context, resourceGV schem
 		return u.CanPerformClusterActionFunc(ctx, resourceGV, verb)
 	}
 
+	if u.Authorizer != nil {
+		allowed, _, err := u.Authorizer.Authorize(ctx, resourceAttributes("", resourceGV, verb))
+		if err != nil {
+			return false, fmt.Errorf("mock AuthUtil: failed to authorize %s on cluster resource %s: %w", verb, resourceGV.Resource, err)
+		}
+		return allowed, nil
+	}
+
 	cs, err := u.GetClientset()
 	if err != nil {
 		return false, fmt.Errorf("mock AuthUtil: failed to get clientset for CanPerformClusterAction: %w", err)
@@ -185,14 +252,10 @@ func (u *AuthUtil) CanPerformClusterAction(ctx context.Context, resourceGV schem
 		return false, fmt.Errorf("mock AuthUtil: clientset is nil in CanPerformClusterAction")
 	}
 
+	attrs := resourceAttributes("", resourceGV, verb)
 	sar := &authorizationv1.SelfSubjectAccessReview{
 		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
-			ResourceAttributes: &authorizationv1.ResourceAttributes{
-				Verb:     verb,
-				Group:    resourceGV.Group,
-				Version:  resourceGV.Version,
-				Resource: resourceGV.Resource,
-			},
+			ResourceAttributes: &attrs,
 		},
 	}
 	response, errAuth := cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
@@ -202,6 +265,20 @@ func (u *AuthUtil) CanPerformClusterAction(ctx context.Context, resourceGV schem
 	return response.Status.Allowed, nil
 }
 
+// resourceAttributes describes verb on resource for an access review. A
+// subresource may be given as part of the resource, as in "pods/log".
+func resourceAttributes(namespace string, resource schema.GroupVersionResource, verb string) authorizationv1.ResourceAttributes {
+	res, sub, _ := strings.Cut(resource.Resource, "/")
+	return authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Verb:        verb,
+		Group:       resource.Group,
+		Version:     resource.Version,
+		Resource:    res,
+		Subresource: sub,
+	}
+}
+
 // Ensure AuthUtil implements K8sAuthChecker
 var _ K8sAuthChecker = &AuthUtil{}
 
@@ -100,9 +100,27 @@ users:
 }
 
 func TestAuthUtil_IsRunningInCluster(t *testing.T) {
-	// This is implicitly tested by TestNewAuthUtil, but a direct test could be added
-	// if NewAuthUtil's logic for setting `inCluster` was more complex or configurable.
-	t.Skip("IsRunningInCluster is primarily tested via NewAuthUtil scenarios if NewAuthUtil doesn't error.")
+	saDir := t.TempDir()
+	util, err := NewAuthUtilWithOptions(AuthOptions{ServiceAccountDir: saDir})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() error: %v", err)
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	if util.IsRunningInCluster() {
+		t.Error("IsRunningInCluster() = true without a service account token, want false")
+	}
+	if err := os.WriteFile(filepath.Join(saDir, "token"), []byte("token-1"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	if !util.IsRunningInCluster() {
+		t.Error("IsRunningInCluster() = false with service env and token, want true")
+	}
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	if util.IsRunningInCluster() {
+		t.Error("IsRunningInCluster() = true without KUBERNETES_SERVICE_PORT, want false")
+	}
 }
 
 func TestAuthUtil_GetCurrentNamespace(t *testing.T) {
@@ -193,9 +211,8 @@ users:
 		}
 	}
 
-	// Scenario 3: In-cluster (requires mocking os.ReadFile and in-cluster env vars)
-	// This is more complex to unit test without a proper mocking framework for file system.
-	// Consider testing this part with integration tests or more advanced mocking.
+	// Scenario 3: In-cluster, reading the mounted service account, is covered
+	// by TestAuthUtil_InCluster with a temporary service account directory.
 
 	// Restore original KUBECONFIG and in-cluster vars
 	os.Setenv("KUBECONFIG", originalKubeconfig)
@@ -213,7 +230,7 @@ users:
 
 func TestAuthUtil_CheckNamespacePermissions(t *testing.T) {
 	fakeClientset := fake.NewSimpleClientset()
-	util := &AuthUtil{clientset: fakeClientset, inCluster: false} // Assuming out-of-cluster for this test
+	util := &AuthUtil{clientset: fakeClientset}
 
 	fakeClientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
 		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
@@ -286,7 +303,7 @@ func TestAuthUtil_CheckNamespacePermissions(t *testing.T) {
 
 func TestAuthUtil_CanPerformClusterAction(t *testing.T) {
 	fakeClientset := fake.NewSimpleClientset()
-	util := &AuthUtil{clientset: fakeClientset, inCluster: false}
+	util := &AuthUtil{clientset: fakeClientset}
 
 	fakeClientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
 		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
@@ -0,0 +1,297 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/yaml"
+)
+
+// ClusterEntry is a named cluster in a ClusterRegistry and the kubeconfig
+// settings its checker is built from.
+type ClusterEntry struct {
+	Name string `json:"name"`
+	// Kubeconfig is the kubeconfig file, or a list of files separated like
+	// KUBECONFIG entries; empty means KUBECONFIG or ~/.kube/config.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context is the kubeconfig context; empty means current-context.
+	Context string `json:"context,omitempty"`
+	// Namespace overrides the context's namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// AuthOptions returns the options a checker for e is built with.
+func (e ClusterEntry) AuthOptions() AuthOptions {
+	opts := AuthOptions{Context: e.Context, Namespace: e.Namespace}
+	if e.Kubeconfig != "" {
+		opts.KubeconfigPaths = filepath.SplitList(e.Kubeconfig)
+	}
+	return opts
+}
+
+// ClusterStatus is what ClusterRegistry.Status found out about a cluster.
+type ClusterStatus struct {
+	Name      string `json:"name"`
+	Context   string `json:"context,omitempty"`
+	Server    string `json:"server,omitempty"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ClusterRegistry holds named clusters, such as dev, uat and prod, and
+// builds one K8sAuthChecker for each the first time it is asked for. It is
+// safe for concurrent use.
+type ClusterRegistry struct {
+	// NewChecker builds the checker for an entry; nil means
+	// NewAuthUtilWithOptions with the entry's AuthOptions.
+	NewChecker func(entry ClusterEntry) (K8sAuthChecker, error)
+
+	mu       sync.Mutex
+	entries  map[string]ClusterEntry
+	checkers map[string]K8sAuthChecker
+}
+
+// NewClusterRegistry returns a registry holding entries.
+func NewClusterRegistry(entries ...ClusterEntry) (*ClusterRegistry, error) {
+	r := &ClusterRegistry{
+		entries:  make(map[string]ClusterEntry),
+		checkers: make(map[string]K8sAuthChecker),
+	}
+	for _, e := range entries {
+		if err := r.Add(e); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// LoadClusterRegistry returns a registry of the clusters in clustersFile or,
+// if it is empty, of the contexts in the kubeconfig files paths names, as
+// LoadKubeconfigContexts reads them.
+func LoadClusterRegistry(clustersFile string, kubeconfigPaths []string) (*ClusterRegistry, error) {
+	r, err := NewClusterRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if clustersFile != "" {
+		err = r.LoadFile(clustersFile)
+	} else {
+		err = r.LoadKubeconfigContexts(kubeconfigPaths)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add registers a cluster. Names must be unique.
+func (r *ClusterRegistry) Add(entry ClusterEntry) error {
+	if entry.Name == "" {
+		return fmt.Errorf("cluster entry has no name")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[entry.Name]; ok {
+		return fmt.Errorf("cluster %q is already registered", entry.Name)
+	}
+	r.entries[entry.Name] = entry
+	return nil
+}
+
+// LoadKubeconfigContexts registers one cluster per context in the kubeconfig
+// files paths names, merged as AuthOptions.KubeconfigPaths describes, each
+// named after its context.
+func (r *ClusterRegistry) LoadKubeconfigContexts(paths []string) error {
+	kcfg, err := loadKubeconfigFiles(paths)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(kcfg.Contexts))
+	for name := range kcfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	kubeconfig := joinPathList(paths)
+	for _, name := range names {
+		if err := r.Add(ClusterEntry{Name: name, Kubeconfig: kubeconfig, Context: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clustersFile is the layout of a standalone clusters file:
+//
+//	clusters:
+//	- name: prod
+//	  kubeconfig: prod.kubeconfig
+//	  context: prod-admin
+//	  namespace: platform
+type clustersFile struct {
+	Clusters []ClusterEntry `json:"clusters"`
+}
+
+// LoadFile registers the clusters listed in a YAML or JSON clusters file.
+// Relative kubeconfig paths are taken relative to the file.
+func (r *ClusterRegistry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read clusters file %s: %w", path, err)
+	}
+	var file clustersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return fmt.Errorf("failed to parse clusters file %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	for _, e := range file.Clusters {
+		if e.Kubeconfig != "" {
+			paths := filepath.SplitList(e.Kubeconfig)
+			for i, p := range paths {
+				if !filepath.IsAbs(p) {
+					paths[i] = filepath.Join(dir, p)
+				}
+			}
+			e.Kubeconfig = joinPathList(paths)
+		}
+		if err := r.Add(e); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// joinPathList is the inverse of filepath.SplitList.
+func joinPathList(paths []string) string {
+	return strings.Join(paths, string(filepath.ListSeparator))
+}
+
+// Names returns the names of the registered clusters, sorted.
+func (r *ClusterRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entry returns the registered cluster called name.
+func (r *ClusterRegistry) Entry(name string) (ClusterEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[name]
+	return e, ok
+}
+
+// Checker returns the checker for the cluster called name, building it on
+// first use and returning the same one afterwards. A checker that fails to
+// build is not cached, so a later call tries again. Checkers are built
+// without holding the registry lock, so a slow one does not hold up others.
+func (r *ClusterRegistry) Checker(name string) (K8sAuthChecker, error) {
+	r.mu.Lock()
+	if c, ok := r.checkers[name]; ok {
+		r.mu.Unlock()
+		return c, nil
+	}
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster %q", name)
+	}
+	newChecker := r.NewChecker
+	if newChecker == nil {
+		newChecker = func(e ClusterEntry) (K8sAuthChecker, error) {
+			return NewAuthUtilWithOptions(e.AuthOptions())
+		}
+	}
+	c, err := newChecker(e)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Another call may have built one meanwhile; keep the first.
+	if existing, ok := r.checkers[name]; ok {
+		return existing, nil
+	}
+	r.checkers[name] = c
+	return c, nil
+}
+
+// Status asks every registered cluster for its version, concurrently, and
+// reports which answered. A cluster whose checker cannot be built, or whose
+// API server does not answer, is unreachable, with the reason in Error. The
+// result is sorted by name.
+func (r *ClusterRegistry) Status(ctx context.Context) []ClusterStatus {
+	names := r.Names()
+	statuses := make([]ClusterStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			statuses[i] = r.status(ctx, name)
+		}(i, name)
+	}
+	wg.Wait()
+	return statuses
+}
+
+func (r *ClusterRegistry) status(ctx context.Context, name string) ClusterStatus {
+	st := ClusterStatus{Name: name}
+	e, _ := r.Entry(name)
+	st.Context = e.Context
+	c, err := r.Checker(name)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	if st.Context == "" {
+		st.Context, _ = c.CurrentContext()
+	}
+	if cfg, err := c.GetKubeConfig(); err == nil && cfg != nil {
+		st.Server = cfg.Host
+	}
+	if err := ctx.Err(); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	cs, err := c.GetClientset()
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	// ServerVersion takes no context, so the probe is abandoned rather than
+	// cancelled when ctx is done first.
+	type probe struct {
+		info *version.Info
+		err  error
+	}
+	done := make(chan probe, 1)
+	go func() {
+		info, err := cs.Discovery().ServerVersion()
+		done <- probe{info, err}
+	}()
+	select {
+	case <-ctx.Done():
+		st.Error = ctx.Err().Error()
+	case p := <-done:
+		if p.err != nil {
+			st.Error = p.err.Error()
+			break
+		}
+		st.Reachable = true
+		st.Version = p.info.GitVersion
+	}
+	return st
+}
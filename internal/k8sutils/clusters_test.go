@@ -0,0 +1,183 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClusterRegistry_LoadKubeconfigContexts(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	dev := writeKubeconfig(t, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, "prod", prodKubeconfig)
+
+	registry, err := LoadClusterRegistry("", []string{dev, prod})
+	if err != nil {
+		t.Fatalf("LoadClusterRegistry() error: %v", err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"dev", "prod"}) {
+		t.Errorf("Names() = %v, want [dev prod]", names)
+	}
+
+	checker, err := registry.Checker("prod")
+	if err != nil {
+		t.Fatalf("Checker(prod) error: %v", err)
+	}
+	if again, _ := registry.Checker("prod"); again != checker {
+		t.Error("Checker(prod) built a second checker instead of reusing the first")
+	}
+	if name, err := checker.CurrentContext(); err != nil || name != "prod" {
+		t.Errorf("CurrentContext() = %q, %v, want %q", name, err, "prod")
+	}
+	cfg, err := checker.GetKubeConfig()
+	if err != nil || cfg.Host != "https://prod.example.com" {
+		t.Errorf("GetKubeConfig() = %v, %v, want host https://prod.example.com", cfg, err)
+	}
+	if _, err := registry.Checker("uat"); err == nil {
+		t.Error("Checker(uat) expected error for unknown cluster, got nil")
+	}
+}
+
+func TestClusterRegistry_LoadFile(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dev.kubeconfig"), []byte(devKubeconfig), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	path := filepath.Join(dir, "clusters.yaml")
+	if err := os.WriteFile(path, []byte(`
+clusters:
+- name: dev
+  kubeconfig: dev.kubeconfig
+- name: dev-platform
+  kubeconfig: dev.kubeconfig
+  context: dev
+  namespace: platform
+`), 0600); err != nil {
+		t.Fatalf("Failed to write clusters file: %v", err)
+	}
+
+	registry, err := LoadClusterRegistry(path, nil)
+	if err != nil {
+		t.Fatalf("LoadClusterRegistry() error: %v", err)
+	}
+	entry, ok := registry.Entry("dev-platform")
+	if !ok {
+		t.Fatal("Entry(dev-platform) not found")
+	}
+	if want := filepath.Join(dir, "dev.kubeconfig"); entry.Kubeconfig != want {
+		t.Errorf("Entry(dev-platform).Kubeconfig = %q, want %q", entry.Kubeconfig, want)
+	}
+	for name, wantNs := range map[string]string{"dev": "team-a", "dev-platform": "platform"} {
+		checker, err := registry.Checker(name)
+		if err != nil {
+			t.Fatalf("Checker(%s) error: %v", name, err)
+		}
+		if ns, err := checker.GetCurrentNamespace(); err != nil || ns != wantNs {
+			t.Errorf("Checker(%s).GetCurrentNamespace() = %q, %v, want %q", name, ns, err, wantNs)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"duplicate": "clusters:\n- name: a\n- name: a\n",
+		"unnamed":   "clusters:\n- context: a\n",
+		"unknown":   "clusters:\n- name: a\n  server: https://a\n",
+	} {
+		bad := filepath.Join(dir, name+".yaml")
+		if err := os.WriteFile(bad, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write clusters file: %v", err)
+		}
+		if _, err := LoadClusterRegistry(bad, nil); err == nil {
+			t.Errorf("LoadClusterRegistry(%s) expected error, got nil", name)
+		}
+	}
+}
+
+func TestClusterRegistry_Status(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+	registry, err := NewClusterRegistry(
+		ClusterEntry{Name: "prod", Context: "prod"},
+		ClusterEntry{Name: "dev", Context: "dev"},
+		ClusterEntry{Name: "broken"},
+	)
+	if err != nil {
+		t.Fatalf("NewClusterRegistry() error: %v", err)
+	}
+	var mu sync.Mutex
+	built := map[string]int{}
+	registry.NewChecker = func(e ClusterEntry) (K8sAuthChecker, error) {
+		mu.Lock()
+		built[e.Name]++
+		mu.Unlock()
+		cs := fake.NewSimpleClientset()
+		switch e.Name {
+		case "prod":
+			cs.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.2"}
+		case "dev":
+			cs.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("connection refused")
+			})
+		default:
+			return nil, errors.New("no credentials")
+		}
+		return &AuthUtil{clientset: cs}, nil
+	}
+
+	statuses := registry.Status(context.Background())
+	want := []ClusterStatus{
+		{Name: "broken", Error: `cluster "broken": no credentials`},
+		{Name: "dev", Context: "dev", Server: "mock-host-default", Error: "connection refused"},
+		{Name: "prod", Context: "prod", Server: "mock-host-default", Reachable: true, Version: "v1.30.2"},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Status() = %+v, want %+v", statuses, want)
+	}
+
+	// Checkers that were built are reused; the broken one is retried.
+	registry.Status(context.Background())
+	if built["prod"] != 1 || built["dev"] != 1 || built["broken"] != 2 {
+		t.Errorf("checkers built = %v, want prod and dev once and broken twice", built)
+	}
+}
+
+func TestClusterRegistry_StatusCancelled(t *testing.T) {
+	registry, err := NewClusterRegistry(ClusterEntry{Name: "hung"})
+	if err != nil {
+		t.Fatalf("NewClusterRegistry() error: %v", err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	registry.NewChecker = func(e ClusterEntry) (K8sAuthChecker, error) {
+		cs := fake.NewSimpleClientset()
+		cs.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			<-release
+			return true, nil, errors.New("too late")
+		})
+		return &AuthUtil{clientset: cs}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan []ClusterStatus, 1)
+	go func() { done <- registry.Status(ctx) }()
+	select {
+	case statuses := <-done:
+		if len(statuses) != 1 || statuses[0].Reachable || statuses[0].Error != context.DeadlineExceeded.Error() {
+			t.Errorf("Status() = %+v, want hung unreachable with %q", statuses, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Status() did not return after the context deadline")
+	}
+}
@@ -0,0 +1,102 @@
+package k8sutils
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// DefaultServiceAccountDir is where the kubelet mounts a pod's service
+// account token, CA bundle and namespace.
+const DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Files in a service account directory.
+const (
+	serviceAccountTokenFile     = "token"
+	serviceAccountCAFile        = "ca.crt"
+	serviceAccountNamespaceFile = "namespace"
+)
+
+// serviceAccountDir returns the directory the checker reads service account
+// files from.
+func (u *AuthUtil) serviceAccountDir() string {
+	if u.options.ServiceAccountDir != "" {
+		return u.options.ServiceAccountDir
+	}
+	return DefaultServiceAccountDir
+}
+
+// inClusterHost returns the API server address the environment of a pod
+// names, and false outside a pod. Like rest.InClusterConfig, it needs
+// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT to be set and the
+// service account token to be mounted.
+func (u *AuthUtil) inClusterHost() (string, bool) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(u.serviceAccountDir(), serviceAccountTokenFile)); err != nil {
+		return "", false
+	}
+	return "https://" + net.JoinHostPort(host, port), true
+}
+
+// ServiceAccountToken returns the mounted service account token. The file
+// is read on every call, so a token the kubelet has rotated is picked up.
+func (u *AuthUtil) ServiceAccountToken() (string, error) {
+	data, err := os.ReadFile(filepath.Join(u.serviceAccountDir(), serviceAccountTokenFile))
+	if err != nil {
+		return "", fmt.Errorf("mock AuthUtil: failed to read service account token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("mock AuthUtil: service account token in %s is empty", u.serviceAccountDir())
+	}
+	return token, nil
+}
+
+// ServiceAccountCA returns the mounted CA bundle of the API server.
+func (u *AuthUtil) ServiceAccountCA() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(u.serviceAccountDir(), serviceAccountCAFile))
+	if err != nil {
+		return nil, fmt.Errorf("mock AuthUtil: failed to read service account CA: %w", err)
+	}
+	return data, nil
+}
+
+// serviceAccountNamespace returns the namespace of the pod's service account.
+func (u *AuthUtil) serviceAccountNamespace() (string, error) {
+	data, err := os.ReadFile(filepath.Join(u.serviceAccountDir(), serviceAccountNamespaceFile))
+	if err != nil {
+		return "", fmt.Errorf("mock AuthUtil: failed to read service account namespace: %w", err)
+	}
+	ns := strings.TrimSpace(string(data))
+	if ns == "" {
+		return "", fmt.Errorf("mock AuthUtil: service account namespace in %s is empty", u.serviceAccountDir())
+	}
+	return ns, nil
+}
+
+// inClusterConfig returns a config for the API server at host that
+// authenticates with the service account, as rest.InClusterConfig does. The
+// token is also given as a file, so clients re-read it when it rotates.
+func (u *AuthUtil) inClusterConfig(host string) (*rest.Config, error) {
+	token, err := u.ServiceAccountToken()
+	if err != nil {
+		return nil, err
+	}
+	dir := u.serviceAccountDir()
+	cfg := &rest.Config{
+		Host:            host,
+		BearerToken:     token,
+		BearerTokenFile: filepath.Join(dir, serviceAccountTokenFile),
+	}
+	if _, err := os.Stat(filepath.Join(dir, serviceAccountCAFile)); err == nil {
+		cfg.TLSClientConfig.CAFile = filepath.Join(dir, serviceAccountCAFile)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,115 @@
+package k8sutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// writeServiceAccount mounts a fake service account in a temporary
+// directory and makes the environment look like a pod's.
+func writeServiceAccount(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	return dir
+}
+
+func TestAuthUtil_InCluster(t *testing.T) {
+	saDir := writeServiceAccount(t, map[string]string{
+		"token":     "token-1\n",
+		"ca.crt":    "-----BEGIN CERTIFICATE-----\n",
+		"namespace": "team-a\n",
+	})
+	util, err := NewAuthUtilWithOptions(AuthOptions{
+		ServiceAccountDir: saDir,
+		Impersonate:       rest.ImpersonationConfig{UserName: "alice"},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() error: %v", err)
+	}
+	au := util.(*AuthUtil)
+
+	if !util.IsRunningInCluster() {
+		t.Fatal("IsRunningInCluster() = false, want true")
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "team-a" {
+		t.Errorf("GetCurrentNamespace() = %q, %v, want %q", ns, err, "team-a")
+	}
+	if ca, err := au.ServiceAccountCA(); err != nil || string(ca) != "-----BEGIN CERTIFICATE-----\n" {
+		t.Errorf("ServiceAccountCA() = %q, %v", ca, err)
+	}
+
+	cfg, err := util.GetKubeConfig()
+	if err != nil {
+		t.Fatalf("GetKubeConfig() error: %v", err)
+	}
+	if cfg.Host != "https://10.96.0.1:443" {
+		t.Errorf("GetKubeConfig().Host = %q, want %q", cfg.Host, "https://10.96.0.1:443")
+	}
+	if cfg.BearerToken != "token-1" || cfg.BearerTokenFile != filepath.Join(saDir, "token") {
+		t.Errorf("GetKubeConfig() token = %q from %q, want token-1 from the service account", cfg.BearerToken, cfg.BearerTokenFile)
+	}
+	if cfg.TLSClientConfig.CAFile != filepath.Join(saDir, "ca.crt") {
+		t.Errorf("GetKubeConfig().CAFile = %q, want the service account CA", cfg.TLSClientConfig.CAFile)
+	}
+	if cfg.Impersonate.UserName != "alice" {
+		t.Errorf("GetKubeConfig().Impersonate.UserName = %q, want alice", cfg.Impersonate.UserName)
+	}
+
+	// The kubelet rotates the token in place; the next read sees the new one.
+	if err := os.WriteFile(filepath.Join(saDir, "token"), []byte("token-2"), 0600); err != nil {
+		t.Fatalf("Failed to rotate token: %v", err)
+	}
+	if token, err := au.ServiceAccountToken(); err != nil || token != "token-2" {
+		t.Errorf("ServiceAccountToken() after rotation = %q, %v, want %q", token, err, "token-2")
+	}
+	if cfg, _ := util.GetKubeConfig(); cfg.BearerToken != "token-2" {
+		t.Errorf("GetKubeConfig() token after rotation = %q, want %q", cfg.BearerToken, "token-2")
+	}
+}
+
+func TestAuthUtil_InCluster_Fallbacks(t *testing.T) {
+	// Without a namespace file the namespace defaults, with an error.
+	saDir := writeServiceAccount(t, map[string]string{"token": "token-1"})
+	util, err := NewAuthUtilWithOptions(AuthOptions{ServiceAccountDir: saDir})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() error: %v", err)
+	}
+	if ns, err := util.GetCurrentNamespace(); err == nil || ns != "default" {
+		t.Errorf("GetCurrentNamespace() without namespace file = %q, %v, want %q and an error", ns, err, "default")
+	}
+	if cfg, err := util.GetKubeConfig(); err != nil || cfg.TLSClientConfig.CAFile != "" {
+		t.Errorf("GetKubeConfig() without ca.crt = %v, %v, want no CA file", cfg, err)
+	}
+
+	// An explicit kubeconfig wins over the service account.
+	dev := writeKubeconfig(t, "dev", devKubeconfig)
+	util, err = NewAuthUtilWithOptions(AuthOptions{ServiceAccountDir: saDir, KubeconfigPaths: []string{dev}})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() with kubeconfig error: %v", err)
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "team-a" {
+		t.Errorf("GetCurrentNamespace() with kubeconfig = %q, %v, want %q", ns, err, "team-a")
+	}
+	if cfg, err := util.GetKubeConfig(); err != nil || cfg.Host != "https://dev.example.com" {
+		t.Errorf("GetKubeConfig() with kubeconfig = %v, %v, want host https://dev.example.com", cfg, err)
+	}
+
+	// An explicit namespace wins over both.
+	util, err = NewAuthUtilWithOptions(AuthOptions{ServiceAccountDir: saDir, Namespace: "override"})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() with namespace error: %v", err)
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "override" {
+		t.Errorf("GetCurrentNamespace() with namespace override = %q, %v, want %q", ns, err, "override")
+	}
+}
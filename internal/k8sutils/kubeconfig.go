@@ -0,0 +1,158 @@
+package k8sutils
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// AuthOptions configures the checker returned by NewAuthUtilWithOptions. The
+// zero value behaves like NewAuthUtil: kubeconfig files are found through
+// KUBECONFIG or ~/.kube/config, and their current-context is used.
+type AuthOptions struct {
+	// KubeconfigPaths are the kubeconfig files to load, in place of KUBECONFIG
+	// and ~/.kube/config. Several files are merged as KUBECONFIG entries are:
+	// the first file to set a value wins. A single file must exist.
+	KubeconfigPaths []string
+	// Context is the kubeconfig context to use instead of current-context.
+	Context string
+	// Namespace, when set, is what GetCurrentNamespace returns, whatever the
+	// context says.
+	Namespace string
+	// Impersonate is the identity requests are sent as, like kubectl's --as
+	// and --as-group. It is applied to the config GetKubeConfig returns.
+	Impersonate rest.ImpersonationConfig
+	// ServiceAccountDir is where the pod's service account token, ca.crt
+	// and namespace files are read from; empty means
+	// DefaultServiceAccountDir.
+	ServiceAccountDir string
+}
+
+// NewAuthUtilWithOptions is a mock constructor like NewAuthUtil that reads
+// kubeconfig files and selects a context as opts says. It fails if explicit
+// kubeconfig files cannot be loaded or the requested context is not in them.
+func NewAuthUtilWithOptions(opts AuthOptions) (K8sAuthChecker, error) {
+	u := &AuthUtil{
+		config:    &rest.Config{Host: "mock-kube-api-server"},
+		clientset: fake.NewSimpleClientset(),
+		options:   opts,
+		context:   opts.Context,
+	}
+	if len(opts.KubeconfigPaths) > 0 || opts.Context != "" {
+		kcfg, err := u.loadKubeconfig()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Context != "" && kcfg.Contexts[opts.Context] == nil {
+			return nil, fmt.Errorf("mock AuthUtil: context %q not found in kubeconfig", opts.Context)
+		}
+	}
+	return u, nil
+}
+
+// loadKubeconfig merges the kubeconfig files the checker was configured
+// with.
+func (u *AuthUtil) loadKubeconfig() (*clientcmdapi.Config, error) {
+	return loadKubeconfigFiles(u.options.KubeconfigPaths)
+}
+
+// loadKubeconfigFiles merges paths as AuthOptions.KubeconfigPaths describes,
+// or with no paths the files KUBECONFIG or ~/.kube/config name. Missing files
+// found through KUBECONFIG or the home directory are skipped, so with none at
+// all the result is an empty config.
+func loadKubeconfigFiles(paths []string) (*clientcmdapi.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	switch len(paths) {
+	case 0:
+	case 1:
+		rules.ExplicitPath = paths[0]
+	default:
+		rules.Precedence = paths
+	}
+	kcfg, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("mock AuthUtil: error loading kubeconfig: %w", err)
+	}
+	return kcfg, nil
+}
+
+// kubeconfigRequested reports whether kubeconfig files or a context were
+// asked for, which in a pod take precedence over the service account.
+func (u *AuthUtil) kubeconfigRequested() bool {
+	u.contextMu.Lock()
+	defer u.contextMu.Unlock()
+	return len(u.options.KubeconfigPaths) > 0 || u.context != ""
+}
+
+// selectedContext returns the name of the context the checker uses, which
+// is empty if neither the checker nor kcfg names one.
+func (u *AuthUtil) selectedContext(kcfg *clientcmdapi.Config) string {
+	u.contextMu.Lock()
+	name := u.context
+	u.contextMu.Unlock()
+	if name == "" {
+		name = kcfg.CurrentContext
+	}
+	return name
+}
+
+// ListContexts returns the names of the contexts in the kubeconfig, sorted.
+func (u *AuthUtil) ListContexts() ([]string, error) {
+	if u.ListContextsFunc != nil {
+		return u.ListContextsFunc()
+	}
+	kcfg, err := u.loadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(kcfg.Contexts))
+	for name := range kcfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CurrentContext returns the context the checker uses: the last one passed
+// to SwitchContext, else AuthOptions.Context, else the kubeconfig's
+// current-context.
+func (u *AuthUtil) CurrentContext() (string, error) {
+	if u.CurrentContextFunc != nil {
+		return u.CurrentContextFunc()
+	}
+	kcfg, err := u.loadKubeconfig()
+	if err != nil {
+		return "", err
+	}
+	name := u.selectedContext(kcfg)
+	if name == "" {
+		return "", fmt.Errorf("mock AuthUtil: kubeconfig has no current context")
+	}
+	return name, nil
+}
+
+// SwitchContext makes the checker use the named kubeconfig context from now
+// on. Unlike kubectl config use-context, it does not write the kubeconfig.
+// Cached permission results are dropped, as they may not hold for the new
+// context.
+func (u *AuthUtil) SwitchContext(name string) error {
+	if u.SwitchContextFunc != nil {
+		return u.SwitchContextFunc(name)
+	}
+	kcfg, err := u.loadKubeconfig()
+	if err != nil {
+		return err
+	}
+	if kcfg.Contexts[name] == nil {
+		return fmt.Errorf("mock AuthUtil: context %q not found in kubeconfig", name)
+	}
+	u.contextMu.Lock()
+	u.context = name
+	u.contextMu.Unlock()
+	u.permCache.clear()
+	return nil
+}
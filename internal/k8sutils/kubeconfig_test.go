@@ -0,0 +1,165 @@
+package k8sutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+const devKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://dev.example.com
+  name: dev
+contexts:
+- context:
+    cluster: dev
+    user: dev-user
+    namespace: team-a
+  name: dev
+current-context: dev
+users:
+- name: dev-user
+  user: {}
+`
+
+const prodKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://prod.example.com
+  name: prod
+contexts:
+- context:
+    cluster: prod
+    user: prod-user
+  name: prod
+current-context: prod
+users:
+- name: prod-user
+  user: {}
+`
+
+func writeKubeconfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestNewAuthUtilWithOptions_Contexts(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	dev := writeKubeconfig(t, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, "prod", prodKubeconfig)
+
+	util, err := NewAuthUtilWithOptions(AuthOptions{KubeconfigPaths: []string{dev, prod}})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() error: %v", err)
+	}
+	contexts, err := util.ListContexts()
+	if err != nil {
+		t.Fatalf("ListContexts() error: %v", err)
+	}
+	if want := []string{"dev", "prod"}; !reflect.DeepEqual(contexts, want) {
+		t.Errorf("ListContexts() = %v, want %v", contexts, want)
+	}
+	// The first file sets current-context.
+	if name, err := util.CurrentContext(); err != nil || name != "dev" {
+		t.Errorf("CurrentContext() = %q, %v, want %q", name, err, "dev")
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "team-a" {
+		t.Errorf("GetCurrentNamespace() = %q, %v, want %q", ns, err, "team-a")
+	}
+	if cfg, err := util.GetKubeConfig(); err != nil || cfg.Host != "https://dev.example.com" {
+		t.Errorf("GetKubeConfig() host = %v, %v, want https://dev.example.com", cfg, err)
+	}
+
+	if err := util.SwitchContext("prod"); err != nil {
+		t.Fatalf("SwitchContext(prod) error: %v", err)
+	}
+	if name, err := util.CurrentContext(); err != nil || name != "prod" {
+		t.Errorf("CurrentContext() after switch = %q, %v, want %q", name, err, "prod")
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "default" {
+		t.Errorf("GetCurrentNamespace() after switch = %q, %v, want %q", ns, err, "default")
+	}
+	if cfg, err := util.GetKubeConfig(); err != nil || cfg.Host != "https://prod.example.com" {
+		t.Errorf("GetKubeConfig() host after switch = %v, %v, want https://prod.example.com", cfg, err)
+	}
+	if err := util.SwitchContext("uat"); err == nil {
+		t.Error("SwitchContext(uat) expected error for unknown context, got nil")
+	}
+	if name, _ := util.CurrentContext(); name != "prod" {
+		t.Errorf("CurrentContext() after failed switch = %q, want %q", name, "prod")
+	}
+}
+
+func TestNewAuthUtilWithOptions_Overrides(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	dev := writeKubeconfig(t, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, "prod", prodKubeconfig)
+	t.Setenv("KUBECONFIG", prod)
+
+	// An explicit path replaces KUBECONFIG, so prod is not visible.
+	util, err := NewAuthUtilWithOptions(AuthOptions{
+		KubeconfigPaths: []string{dev},
+		Namespace:       "override",
+		Impersonate:     rest.ImpersonationConfig{UserName: "alice", Groups: []string{"admins"}},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions() error: %v", err)
+	}
+	if contexts, _ := util.ListContexts(); !reflect.DeepEqual(contexts, []string{"dev"}) {
+		t.Errorf("ListContexts() = %v, want [dev]", contexts)
+	}
+	if ns, err := util.GetCurrentNamespace(); err != nil || ns != "override" {
+		t.Errorf("GetCurrentNamespace() = %q, %v, want %q", ns, err, "override")
+	}
+	cfg, err := util.GetKubeConfig()
+	if err != nil {
+		t.Fatalf("GetKubeConfig() error: %v", err)
+	}
+	if cfg.Impersonate.UserName != "alice" || !reflect.DeepEqual(cfg.Impersonate.Groups, []string{"admins"}) {
+		t.Errorf("GetKubeConfig().Impersonate = %+v, want alice in admins", cfg.Impersonate)
+	}
+
+	// Without paths, KUBECONFIG is used and a context can be chosen up front.
+	util, err = NewAuthUtilWithOptions(AuthOptions{Context: "prod"})
+	if err != nil {
+		t.Fatalf("NewAuthUtilWithOptions(Context: prod) error: %v", err)
+	}
+	if name, err := util.CurrentContext(); err != nil || name != "prod" {
+		t.Errorf("CurrentContext() = %q, %v, want %q", name, err, "prod")
+	}
+}
+
+func TestNewAuthUtilWithOptions_Errors(t *testing.T) {
+	dev := writeKubeconfig(t, "dev", devKubeconfig)
+	if _, err := NewAuthUtilWithOptions(AuthOptions{KubeconfigPaths: []string{dev}, Context: "prod"}); err == nil {
+		t.Error("NewAuthUtilWithOptions() with unknown context expected error, got nil")
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := NewAuthUtilWithOptions(AuthOptions{KubeconfigPaths: []string{missing}}); err == nil {
+		t.Error("NewAuthUtilWithOptions() with missing kubeconfig expected error, got nil")
+	}
+
+	t.Setenv("KUBECONFIG", missing)
+	util, err := NewAuthUtil()
+	if err != nil {
+		t.Fatalf("NewAuthUtil() without kubeconfig error: %v", err)
+	}
+	if contexts, err := util.ListContexts(); err != nil || len(contexts) != 0 {
+		t.Errorf("ListContexts() without kubeconfig = %v, %v, want none", contexts, err)
+	}
+	if _, err := util.CurrentContext(); err == nil {
+		t.Error("CurrentContext() without kubeconfig expected error, got nil")
+	}
+}
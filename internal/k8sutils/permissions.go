@@ -0,0 +1,284 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultPermissionWorkers is how many access reviews CheckPermissionMatrix
+	// runs at once unless AuthUtil.PermissionWorkers says otherwise.
+	DefaultPermissionWorkers = 8
+	// DefaultPermissionCacheTTL is how long CheckPermissionMatrix reuses an
+	// access review result unless AuthUtil.PermissionCacheTTL says otherwise.
+	DefaultPermissionCacheTTL = 30 * time.Second
+)
+
+// PermissionMatrix records whether each verb is allowed on each resource in
+// each namespace, as matrix[namespace][ResourceKey(resource)][verb].
+// Cluster-scoped checks use the namespace "".
+type PermissionMatrix map[string]map[string]map[string]bool
+
+// Allowed reports whether verb on resource in namespace was checked and
+// allowed.
+func (m PermissionMatrix) Allowed(namespace string, resource schema.GroupVersionResource, verb string) bool {
+	return m[namespace][ResourceKey(resource)][verb]
+}
+
+// ResourceKey names a resource as kubectl does, with its group after a dot
+// unless it is in the core group: "pods", "deployments.apps", and with a
+// subresource "pods/log" or "deployments.apps/scale". The version is left
+// out, since RBAC does not depend on it.
+func ResourceKey(resource schema.GroupVersionResource) string {
+	res, sub, _ := strings.Cut(resource.Resource, "/")
+	if resource.Group != "" {
+		res += "." + resource.Group
+	}
+	if sub != "" {
+		res += "/" + sub
+	}
+	return res
+}
+
+// ParseResourceKey is the inverse of ResourceKey. The returned resource has
+// the version "v1".
+func ParseResourceKey(key string) (schema.GroupVersionResource, error) {
+	name, sub, _ := strings.Cut(key, "/")
+	res, group, _ := strings.Cut(name, ".")
+	if res == "" || strings.Contains(sub, "/") {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q (expected <resource>[.<group>][/<subresource>])", key)
+	}
+	if sub != "" {
+		res += "/" + sub
+	}
+	return schema.GroupVersionResource{Group: group, Version: "v1", Resource: res}, nil
+}
+
+// permissionCell is one namespace, resource and verb of a matrix still to
+// be reviewed.
+type permissionCell struct {
+	attrs authorizationv1.ResourceAttributes
+	key   string
+}
+
+// permissionCache remembers access review results for a short while.
+type permissionCache struct {
+	mu      sync.Mutex
+	entries map[authorizationv1.ResourceAttributes]permissionCacheEntry
+}
+
+type permissionCacheEntry struct {
+	allowed bool
+	expires time.Time
+}
+
+func (c *permissionCache) get(attrs authorizationv1.ResourceAttributes, now time.Time) (allowed, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[attrs]
+	if !ok || now.After(e.expires) {
+		return false, false
+	}
+	return e.allowed, true
+}
+
+func (c *permissionCache) put(attrs authorizationv1.ResourceAttributes, allowed bool, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[authorizationv1.ResourceAttributes]permissionCacheEntry)
+	}
+	c.entries[attrs] = permissionCacheEntry{allowed: allowed, expires: expires}
+}
+
+func (c *permissionCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// CheckPermissionMatrix checks every verb on every resource in every
+// namespace, in one call. Access reviews are sent concurrently by at most
+// PermissionWorkers workers, and their results are cached for
+// PermissionCacheTTL; with UseRulesReview set, a SelfSubjectRulesReview per
+// namespace replaces them where the API server supports it. An empty
+// namespace checks the resources cluster-wide. When an Authorizer is set it
+// decides every cell instead. The first failed review fails the whole check.
+func (u *AuthUtil) CheckPermissionMatrix(ctx context.Context, namespaces []string, resources []schema.GroupVersionResource, verbs []string) (PermissionMatrix, error) {
+	if u.CheckPermissionMatrixFunc != nil {
+		return u.CheckPermissionMatrixFunc(ctx, namespaces, resources, verbs)
+	}
+
+	var cs kubernetes.Interface
+	if u.Authorizer == nil {
+		var err error
+		cs, err = u.GetClientset()
+		if err != nil {
+			return nil, fmt.Errorf("mock AuthUtil: failed to get clientset for CheckPermissionMatrix: %w", err)
+		}
+		if cs == nil {
+			return nil, fmt.Errorf("mock AuthUtil: clientset is nil in CheckPermissionMatrix")
+		}
+	}
+
+	matrix := make(PermissionMatrix, len(namespaces))
+	var cells []permissionCell
+	for _, ns := range namespaces {
+		var rules []authorizationv1.ResourceRule
+		reviewed := false
+		if u.UseRulesReview && u.Authorizer == nil && ns != "" {
+			rules, reviewed = rulesReview(ctx, cs, ns)
+		}
+		if matrix[ns] == nil {
+			matrix[ns] = make(map[string]map[string]bool, len(resources))
+		}
+		for _, res := range resources {
+			key := ResourceKey(res)
+			row := make(map[string]bool, len(verbs))
+			matrix[ns][key] = row
+			for _, verb := range verbs {
+				attrs := resourceAttributes(ns, res, verb)
+				if reviewed {
+					row[verb] = resourceRulesAllow(rules, attrs)
+					continue
+				}
+				cells = append(cells, permissionCell{attrs: attrs, key: key})
+			}
+		}
+	}
+
+	allowed, err := u.reviewAll(ctx, cs, cells)
+	if err != nil {
+		return nil, err
+	}
+	for i, cell := range cells {
+		matrix[cell.attrs.Namespace][cell.key][cell.attrs.Verb] = allowed[i]
+	}
+	return matrix, nil
+}
+
+// reviewAll decides cells with a bounded pool of workers, stopping at the
+// first error.
+func (u *AuthUtil) reviewAll(ctx context.Context, cs kubernetes.Interface, cells []permissionCell) ([]bool, error) {
+	allowed := make([]bool, len(cells))
+	if len(cells) == 0 {
+		return allowed, nil
+	}
+	workers := u.PermissionWorkers
+	if workers <= 0 {
+		workers = DefaultPermissionWorkers
+	}
+	if workers > len(cells) {
+		workers = len(cells)
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				ok, err := u.review(workCtx, cs, cells[i].attrs)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				allowed[i] = ok
+			}
+		}()
+	}
+feed:
+	for i := range cells {
+		select {
+		case jobs <- i:
+		case <-workCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return allowed, nil
+}
+
+// review decides one cell through the Authorizer or, failing that, a cached
+// SelfSubjectAccessReview.
+func (u *AuthUtil) review(ctx context.Context, cs kubernetes.Interface, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	if u.Authorizer != nil {
+		allowed, _, err := u.Authorizer.Authorize(ctx, attrs)
+		if err != nil {
+			return false, fmt.Errorf("mock AuthUtil: failed to authorize %s on %s in namespace %q: %w", attrs.Verb, attrs.Resource, attrs.Namespace, err)
+		}
+		return allowed, nil
+	}
+
+	ttl := u.PermissionCacheTTL
+	if ttl == 0 {
+		ttl = DefaultPermissionCacheTTL
+	}
+	if ttl > 0 {
+		if allowed, ok := u.permCache.get(attrs, time.Now()); ok {
+			return allowed, nil
+		}
+	}
+	reviewAttrs := attrs
+	sar := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &reviewAttrs},
+	}
+	response, err := cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("mock: failed to perform SelfSubjectAccessReview for verb %s on %s in namespace %q: %w", attrs.Verb, attrs.Resource, attrs.Namespace, err)
+	}
+	if ttl > 0 {
+		u.permCache.put(attrs, response.Status.Allowed, time.Now().Add(ttl))
+	}
+	return response.Status.Allowed, nil
+}
+
+// rulesReview returns the rules a SelfSubjectRulesReview reports for
+// namespace, and false if the review failed or its rules are incomplete.
+func rulesReview(ctx context.Context, cs kubernetes.Interface, namespace string) ([]authorizationv1.ResourceRule, bool) {
+	ssrr := &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}
+	response, err := cs.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, ssrr, metav1.CreateOptions{})
+	if err != nil || response.Status.Incomplete || response.Status.EvaluationError != "" {
+		return nil, false
+	}
+	return response.Status.ResourceRules, true
+}
+
+func resourceRulesAllow(rules []authorizationv1.ResourceRule, attrs authorizationv1.ResourceAttributes) bool {
+	for _, r := range rules {
+		rule := rbacv1.PolicyRule{Verbs: r.Verbs, APIGroups: r.APIGroups, Resources: r.Resources, ResourceNames: r.ResourceNames}
+		if ruleAllows(rule, attrs) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// sarReactor allows get and list everywhere and counts the reviews it sees.
+func sarReactor(calls *int32) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(calls, 1)
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		verb := sar.Spec.ResourceAttributes.Verb
+		sar.Status.Allowed = verb == "get" || verb == "list"
+		return true, sar, nil
+	}
+}
+
+func TestAuthUtil_CheckPermissionMatrix(t *testing.T) {
+	var calls int32
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "selfsubjectaccessreviews", sarReactor(&calls))
+	util := &AuthUtil{clientset: cs, PermissionWorkers: 3}
+
+	namespaces := []string{"team-a", "team-b", ""}
+	resources := []schema.GroupVersionResource{ResourcePods, ResourceDeployments, {Version: "v1", Resource: "pods/log"}}
+	verbs := []string{"get", "list", "delete"}
+	matrix, err := util.CheckPermissionMatrix(context.Background(), namespaces, resources, verbs)
+	if err != nil {
+		t.Fatalf("CheckPermissionMatrix() error: %v", err)
+	}
+	row := map[string]bool{"get": true, "list": true, "delete": false}
+	for _, ns := range namespaces {
+		for _, key := range []string{"pods", "deployments.apps", "pods/log"} {
+			if got := matrix[ns][key]; !reflect.DeepEqual(got, row) {
+				t.Errorf("matrix[%q][%q] = %v, want %v", ns, key, got, row)
+			}
+		}
+	}
+	if !matrix.Allowed("team-a", ResourceDeployments, "list") || matrix.Allowed("team-a", ResourceDeployments, "delete") {
+		t.Error("Allowed() does not agree with the matrix")
+	}
+	if calls != 27 {
+		t.Errorf("SelfSubjectAccessReviews sent = %d, want 27", calls)
+	}
+
+	// A second check within the TTL is answered from the cache.
+	if _, err := util.CheckPermissionMatrix(context.Background(), namespaces, resources, verbs); err != nil {
+		t.Fatalf("CheckPermissionMatrix() second call error: %v", err)
+	}
+	if calls != 27 {
+		t.Errorf("SelfSubjectAccessReviews sent after cached check = %d, want 27", calls)
+	}
+	util.PermissionCacheTTL = -1
+	if _, err := util.CheckPermissionMatrix(context.Background(), []string{"team-a"}, resources, verbs); err != nil {
+		t.Fatalf("CheckPermissionMatrix() without cache error: %v", err)
+	}
+	if calls != 36 {
+		t.Errorf("SelfSubjectAccessReviews sent with the cache disabled = %d, want 36", calls)
+	}
+}
+
+func TestAuthUtil_CheckPermissionMatrix_Errors(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		if sar.Spec.ResourceAttributes.Resource == "secrets" {
+			return true, nil, errors.New("forbidden")
+		}
+		sar.Status.Allowed = true
+		return true, sar, nil
+	})
+	util := &AuthUtil{clientset: cs}
+	resources := []schema.GroupVersionResource{ResourcePods, ResourceSecrets}
+	if _, err := util.CheckPermissionMatrix(context.Background(), []string{"default"}, resources, DefaultCRUDVerbs); err == nil {
+		t.Error("CheckPermissionMatrix() with a failing review expected error, got nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := util.CheckPermissionMatrix(ctx, []string{"default"}, []schema.GroupVersionResource{ResourceConfigMaps}, []string{"get"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CheckPermissionMatrix() with cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestAuthUtil_CheckPermissionMatrix_RulesReview(t *testing.T) {
+	var sars int32
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "selfsubjectaccessreviews", sarReactor(&sars))
+	cs.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ssrr := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectRulesReview)
+		if ssrr.Spec.Namespace != "team-a" {
+			ssrr.Status.Incomplete = true
+			return true, ssrr, nil
+		}
+		ssrr.Status.ResourceRules = []authorizationv1.ResourceRule{
+			{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}},
+		}
+		return true, ssrr, nil
+	})
+	util := &AuthUtil{clientset: cs, UseRulesReview: true}
+
+	resources := []schema.GroupVersionResource{ResourcePods, ResourceDeployments}
+	matrix, err := util.CheckPermissionMatrix(context.Background(), []string{"team-a", "team-b"}, resources, []string{"get", "delete"})
+	if err != nil {
+		t.Fatalf("CheckPermissionMatrix() error: %v", err)
+	}
+	want := PermissionMatrix{
+		"team-a": {"pods": {"get": true, "delete": false}, "deployments.apps": {"get": true, "delete": true}},
+		"team-b": {"pods": {"get": true, "delete": false}, "deployments.apps": {"get": true, "delete": false}},
+	}
+	if !reflect.DeepEqual(matrix, want) {
+		t.Errorf("CheckPermissionMatrix() = %v, want %v", matrix, want)
+	}
+	if sars != 4 {
+		t.Errorf("SelfSubjectAccessReviews sent = %d, want 4 for the incomplete namespace only", sars)
+	}
+}
+
+// concurrencyAuthorizer allows everything and records how many calls
+// overlapped.
+type concurrencyAuthorizer struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (a *concurrencyAuthorizer) Authorize(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	a.mu.Lock()
+	a.inFlight++
+	if a.inFlight > a.max {
+		a.max = a.inFlight
+	}
+	a.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	a.mu.Lock()
+	a.inFlight--
+	a.mu.Unlock()
+	return true, "allowed", nil
+}
+
+func TestAuthUtil_CheckPermissionMatrix_Authorizer(t *testing.T) {
+	authz := &concurrencyAuthorizer{}
+	util := &AuthUtil{Authorizer: authz, PermissionWorkers: 2}
+	resources := []schema.GroupVersionResource{ResourcePods, ResourceServices, ResourceConfigMaps, ResourceSecrets}
+	matrix, err := util.CheckPermissionMatrix(context.Background(), []string{"a", "b"}, resources, DefaultCRUDVerbs)
+	if err != nil {
+		t.Fatalf("CheckPermissionMatrix() error: %v", err)
+	}
+	if !matrix.Allowed("b", ResourceSecrets, "delete") {
+		t.Error("Allowed(b, secrets, delete) = false, want true")
+	}
+	if authz.max > 2 {
+		t.Errorf("%d reviews ran at once, want at most PermissionWorkers = 2", authz.max)
+	}
+}
+
+func TestResourceKey(t *testing.T) {
+	tests := []struct {
+		resource schema.GroupVersionResource
+		key      string
+	}{
+		{ResourcePods, "pods"},
+		{ResourceDeployments, "deployments.apps"},
+		{schema.GroupVersionResource{Version: "v1", Resource: "pods/log"}, "pods/log"},
+		{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments/scale"}, "deployments.apps/scale"},
+		{schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, "ingresses.networking.k8s.io"},
+	}
+	for _, tt := range tests {
+		if got := ResourceKey(tt.resource); got != tt.key {
+			t.Errorf("ResourceKey(%v) = %q, want %q", tt.resource, got, tt.key)
+		}
+		got, err := ParseResourceKey(tt.key)
+		if err != nil || got != tt.resource {
+			t.Errorf("ParseResourceKey(%q) = %v, %v, want %v", tt.key, got, err, tt.resource)
+		}
+	}
+	for _, bad := range []string{"", ".apps", "pods/log/x"} {
+		if _, err := ParseResourceKey(bad); err == nil {
+			t.Errorf("ParseResourceKey(%q) expected error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package k8sutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Authorizer decides access checks locally, in place of the
+// SelfSubjectAccessReviews AuthUtil otherwise sends to its clientset. reason
+// says which binding allowed the request and is empty when it is denied.
+type Authorizer interface {
+	Authorize(ctx context.Context, attrs authorizationv1.ResourceAttributes) (allowed bool, reason string, err error)
+}
+
+// RBACSubject is the identity an RBACAuthorizer evaluates requests for. A
+// service account is the user "system:serviceaccount:<namespace>:<name>", as
+// returned by ServiceAccountSubject. The groups system:authenticated, and for
+// service accounts system:serviceaccounts and system:serviceaccounts:<namespace>,
+// are implied; an empty User is system:anonymous.
+type RBACSubject struct {
+	User   string
+	Groups []string
+}
+
+// ServiceAccountSubject returns the subject of a service account.
+func ServiceAccountSubject(namespace, name string) RBACSubject {
+	return RBACSubject{User: serviceAccountPrefix + namespace + ":" + name}
+}
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// identity returns the user name and full group list of s.
+func (s RBACSubject) identity() (string, []string) {
+	groups := append([]string(nil), s.Groups...)
+	if s.User == "" {
+		return "system:anonymous", append(groups, "system:unauthenticated")
+	}
+	groups = append(groups, "system:authenticated")
+	if sa := strings.TrimPrefix(s.User, serviceAccountPrefix); sa != s.User {
+		if ns, _, ok := strings.Cut(sa, ":"); ok {
+			groups = append(groups, "system:serviceaccounts", "system:serviceaccounts:"+ns)
+		}
+	}
+	return s.User, groups
+}
+
+func (s RBACSubject) String() string {
+	if s.User == "" {
+		return "system:anonymous"
+	}
+	return s.User
+}
+
+// rbacPolicy is the set of Roles, ClusterRoles and bindings an RBACAuthorizer
+// evaluates, keyed by namespace/name (name alone for cluster objects).
+type rbacPolicy struct {
+	mu                  sync.RWMutex
+	roles               map[string]*rbacv1.Role
+	clusterRoles        map[string]*rbacv1.ClusterRole
+	roleBindings        map[string]*rbacv1.RoleBinding
+	clusterRoleBindings map[string]*rbacv1.ClusterRoleBinding
+}
+
+// RBACAuthorizer is an Authorizer that evaluates Kubernetes RBAC objects the
+// way the API server's RBAC authorizer does: ClusterRoleBindings grant their
+// ClusterRole everywhere, RoleBindings grant a Role or ClusterRole within
+// their namespace, and rules match on verbs, API groups, resources (with
+// "*", "pods/log" and "*/scale" forms) and resourceNames. Aggregated
+// ClusterRoles include the rules of every ClusterRole their selectors match.
+// Nothing is denied explicitly; a request no rule allows is denied.
+type RBACAuthorizer struct {
+	subject RBACSubject
+	policy  *rbacPolicy
+}
+
+// NewRBACAuthorizer returns an authorizer for subject holding objs, which must
+// be Roles, ClusterRoles, RoleBindings or ClusterRoleBindings.
+func NewRBACAuthorizer(subject RBACSubject, objs ...runtime.Object) (*RBACAuthorizer, error) {
+	a := &RBACAuthorizer{
+		subject: subject,
+		policy: &rbacPolicy{
+			roles:               make(map[string]*rbacv1.Role),
+			clusterRoles:        make(map[string]*rbacv1.ClusterRole),
+			roleBindings:        make(map[string]*rbacv1.RoleBinding),
+			clusterRoleBindings: make(map[string]*rbacv1.ClusterRoleBinding),
+		},
+	}
+	if err := a.Add(objs...); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// As returns an authorizer for another subject sharing a's objects, so one
+// policy can be checked for several personas. Objects added to either are
+// seen by both.
+func (a *RBACAuthorizer) As(subject RBACSubject) *RBACAuthorizer {
+	return &RBACAuthorizer{subject: subject, policy: a.policy}
+}
+
+// Subject returns the identity a evaluates requests for.
+func (a *RBACAuthorizer) Subject() RBACSubject {
+	return a.subject
+}
+
+// Add adds or replaces RBAC objects.
+func (a *RBACAuthorizer) Add(objs ...runtime.Object) error {
+	p := a.policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *rbacv1.Role:
+			p.roles[o.Namespace+"/"+o.Name] = o.DeepCopy()
+		case *rbacv1.ClusterRole:
+			p.clusterRoles[o.Name] = o.DeepCopy()
+		case *rbacv1.RoleBinding:
+			p.roleBindings[o.Namespace+"/"+o.Name] = o.DeepCopy()
+		case *rbacv1.ClusterRoleBinding:
+			p.clusterRoleBindings[o.Name] = o.DeepCopy()
+		default:
+			return fmt.Errorf("unsupported RBAC object %T", obj)
+		}
+	}
+	return nil
+}
+
+// LoadYAML adds the RBAC objects in a YAML or JSON stream, which may hold
+// several documents separated by "---" as well as v1 Lists. Objects of other
+// kinds, such as the ServiceAccounts and Namespaces of a manifest, are
+// skipped. A namespaced object without a namespace is put in "default".
+func (a *RBACAuthorizer) LoadYAML(data []byte) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for i := 1; ; i++ {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read RBAC document %d: %w", i, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		if err := a.loadDocument(doc); err != nil {
+			return fmt.Errorf("RBAC document %d: %w", i, err)
+		}
+	}
+}
+
+// LoadFile adds the RBAC objects in a YAML or JSON file, as LoadYAML does.
+func (a *RBACAuthorizer) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read RBAC file %s: %w", path, err)
+	}
+	if err := a.LoadYAML(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (a *RBACAuthorizer) loadDocument(doc []byte) error {
+	var meta metav1.TypeMeta
+	if err := yaml.Unmarshal(doc, &meta); err != nil {
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	if meta.Kind == "List" {
+		var list struct {
+			Items []runtime.RawExtension `json:"items"`
+		}
+		if err := yaml.Unmarshal(doc, &list); err != nil {
+			return fmt.Errorf("failed to parse List: %w", err)
+		}
+		for _, item := range list.Items {
+			if err := a.loadDocument(item.Raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if meta.APIVersion != rbacv1.SchemeGroupVersion.String() {
+		return nil
+	}
+
+	var obj runtime.Object
+	switch meta.Kind {
+	case "Role":
+		obj = &rbacv1.Role{}
+	case "ClusterRole":
+		obj = &rbacv1.ClusterRole{}
+	case "RoleBinding":
+		obj = &rbacv1.RoleBinding{}
+	case "ClusterRoleBinding":
+		obj = &rbacv1.ClusterRoleBinding{}
+	default:
+		return nil
+	}
+	if err := yaml.UnmarshalStrict(doc, obj); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", meta.Kind, err)
+	}
+	switch o := obj.(type) {
+	case *rbacv1.Role:
+		if o.Namespace == "" {
+			o.Namespace = "default"
+		}
+	case *rbacv1.RoleBinding:
+		if o.Namespace == "" {
+			o.Namespace = "default"
+		}
+	}
+	return a.Add(obj)
+}
+
+// LoadFromClientset adds the Roles, ClusterRoles, RoleBindings and
+// ClusterRoleBindings of every namespace in cs, for example objects seeded
+// into a fake clientset.
+func (a *RBACAuthorizer) LoadFromClientset(ctx context.Context, cs kubernetes.Interface) error {
+	rbac := cs.RbacV1()
+	var objs []runtime.Object
+	roles, err := rbac.Roles(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+	for i := range roles.Items {
+		objs = append(objs, &roles.Items[i])
+	}
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list cluster roles: %w", err)
+	}
+	for i := range clusterRoles.Items {
+		objs = append(objs, &clusterRoles.Items[i])
+	}
+	roleBindings, err := rbac.RoleBindings(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list role bindings: %w", err)
+	}
+	for i := range roleBindings.Items {
+		objs = append(objs, &roleBindings.Items[i])
+	}
+	clusterRoleBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list cluster role bindings: %w", err)
+	}
+	for i := range clusterRoleBindings.Items {
+		objs = append(objs, &clusterRoleBindings.Items[i])
+	}
+	return a.Add(objs...)
+}
+
+// Authorize reports whether a's subject may perform the request described by
+// attrs. Cluster-scoped requests have an empty Namespace. A Subresource may
+// be given separately or as part of Resource, as in "pods/log".
+func (a *RBACAuthorizer) Authorize(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, "", err
+	}
+	if attrs.Subresource == "" {
+		attrs.Resource, attrs.Subresource, _ = strings.Cut(attrs.Resource, "/")
+	}
+	user, groups := a.subject.identity()
+
+	p := a.policy
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, name := range sortedKeys(p.clusterRoleBindings) {
+		crb := p.clusterRoleBindings[name]
+		if crb.RoleRef.Kind != "ClusterRole" || !bindingAppliesTo(crb.Subjects, "", user, groups) {
+			continue
+		}
+		if rulesAllow(p.clusterRoleRules(crb.RoleRef.Name), attrs) {
+			return true, fmt.Sprintf("RBAC: allowed by ClusterRoleBinding %q of ClusterRole %q to %s", crb.Name, crb.RoleRef.Name, a.subject), nil
+		}
+	}
+	if attrs.Namespace == "" {
+		return false, "", nil
+	}
+	for _, key := range sortedKeys(p.roleBindings) {
+		rb := p.roleBindings[key]
+		if rb.Namespace != attrs.Namespace || !bindingAppliesTo(rb.Subjects, rb.Namespace, user, groups) {
+			continue
+		}
+		var rules []rbacv1.PolicyRule
+		switch rb.RoleRef.Kind {
+		case "Role":
+			if role, ok := p.roles[rb.Namespace+"/"+rb.RoleRef.Name]; ok {
+				rules = role.Rules
+			}
+		case "ClusterRole":
+			rules = p.clusterRoleRules(rb.RoleRef.Name)
+		}
+		if rulesAllow(rules, attrs) {
+			return true, fmt.Sprintf("RBAC: allowed by RoleBinding %q of %s %q to %s in namespace %q", rb.Name, rb.RoleRef.Kind, rb.RoleRef.Name, a.subject, rb.Namespace), nil
+		}
+	}
+	return false, "", nil
+}
+
+// clusterRoleRules returns the rules of a ClusterRole, including those of the
+// ClusterRoles it aggregates. A missing role grants nothing, as with the API
+// server. The caller holds p.mu.
+func (p *rbacPolicy) clusterRoleRules(name string) []rbacv1.PolicyRule {
+	role, ok := p.clusterRoles[name]
+	if !ok {
+		return nil
+	}
+	rules := role.Rules
+	if role.AggregationRule == nil {
+		return rules
+	}
+	for _, other := range sortedKeys(p.clusterRoles) {
+		if other == name {
+			continue
+		}
+		for _, sel := range role.AggregationRule.ClusterRoleSelectors {
+			selector, err := metav1.LabelSelectorAsSelector(&sel)
+			if err != nil {
+				continue
+			}
+			if selector.Matches(labels.Set(p.clusterRoles[other].Labels)) {
+				rules = append(rules[:len(rules):len(rules)], p.clusterRoles[other].Rules...)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// bindingAppliesTo reports whether one of a binding's subjects is the user or
+// one of its groups. namespace is that of a RoleBinding, the default for its
+// ServiceAccount subjects.
+func bindingAppliesTo(subjects []rbacv1.Subject, namespace, user string, groups []string) bool {
+	for _, s := range subjects {
+		switch s.Kind {
+		case rbacv1.UserKind:
+			if s.Name == user {
+				return true
+			}
+		case rbacv1.GroupKind:
+			for _, g := range groups {
+				if s.Name == g {
+					return true
+				}
+			}
+		case rbacv1.ServiceAccountKind:
+			ns := s.Namespace
+			if ns == "" {
+				ns = namespace
+			}
+			if ns != "" && serviceAccountPrefix+ns+":"+s.Name == user {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rulesAllow(rules []rbacv1.PolicyRule, attrs authorizationv1.ResourceAttributes) bool {
+	for _, rule := range rules {
+		if ruleAllows(rule, attrs) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleAllows(rule rbacv1.PolicyRule, attrs authorizationv1.ResourceAttributes) bool {
+	if !matchesOrAll(rule.Verbs, attrs.Verb) || !matchesOrAll(rule.APIGroups, attrs.Group) {
+		return false
+	}
+	if !resourceMatches(rule.Resources, attrs.Resource, attrs.Subresource) {
+		return false
+	}
+	if len(rule.ResourceNames) == 0 {
+		return true
+	}
+	for _, name := range rule.ResourceNames {
+		if name == attrs.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesOrAll(values []string, want string) bool {
+	for _, v := range values {
+		if v == want || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceMatches matches a resource and subresource against a rule's
+// resources: "*" matches everything, "pods/log" only that subresource and
+// "*/scale" the scale subresource of any resource.
+func resourceMatches(ruleResources []string, resource, subresource string) bool {
+	combined := resource
+	if subresource != "" {
+		combined += "/" + subresource
+	}
+	for _, r := range ruleResources {
+		if r == "*" || r == combined {
+			return true
+		}
+		if subresource != "" && r == "*/"+subresource {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Ensure RBACAuthorizer implements Authorizer
+var _ Authorizer = &RBACAuthorizer{}
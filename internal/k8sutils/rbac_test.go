@@ -0,0 +1,273 @@
+package k8sutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testRBACPolicy = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cluster-admin
+rules:
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admins
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: Group
+  name: platform-admins
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: view
+aggregationRule:
+  clusterRoleSelectors:
+  - matchLabels:
+      example.com/aggregate-to-view: "true"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: view-workloads
+  labels:
+    example.com/aggregate-to-view: "true"
+rules:
+- apiGroups: ["", "apps"]
+  resources: ["pods", "deployments"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: developer
+  namespace: team-a
+rules:
+- apiGroups: ["apps"]
+  resources: ["deployments", "*/scale"]
+  verbs: ["get", "list", "update", "patch"]
+- apiGroups: [""]
+  resources: ["pods", "pods/log"]
+  verbs: ["get", "list"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["app-config"]
+  verbs: ["get", "update"]
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: developers
+    namespace: team-a
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: Role
+    name: developer
+  subjects:
+  - kind: User
+    name: alice
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: viewers
+    namespace: team-a
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: ClusterRole
+    name: view
+  subjects:
+  - kind: Group
+    name: auditors
+  - kind: ServiceAccount
+    name: deployer
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: deployer
+  namespace: team-a
+`
+
+func TestRBACAuthorizer(t *testing.T) {
+	base, err := NewRBACAuthorizer(RBACSubject{})
+	if err != nil {
+		t.Fatalf("NewRBACAuthorizer() error: %v", err)
+	}
+	if err := base.LoadYAML([]byte(testRBACPolicy)); err != nil {
+		t.Fatalf("LoadYAML() error: %v", err)
+	}
+
+	admin := RBACSubject{User: "root", Groups: []string{"platform-admins"}}
+	alice := RBACSubject{User: "alice"}
+	auditor := RBACSubject{User: "bob", Groups: []string{"auditors"}}
+	deployer := ServiceAccountSubject("team-a", "deployer")
+
+	tests := []struct {
+		name    string
+		subject RBACSubject
+		attrs   authorizationv1.ResourceAttributes
+		want    bool
+	}{
+		{"admin anything cluster-wide", admin, authorizationv1.ResourceAttributes{Verb: "delete", Resource: "nodes"}, true},
+		{"admin in any namespace", admin, authorizationv1.ResourceAttributes{Namespace: "kube-system", Verb: "create", Group: "apps", Resource: "daemonsets"}, true},
+		{"developer updates deployments", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "update", Group: "apps", Resource: "deployments"}, true},
+		{"developer cannot delete deployments", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "delete", Group: "apps", Resource: "deployments"}, false},
+		{"developer only in own namespace", alice, authorizationv1.ResourceAttributes{Namespace: "team-b", Verb: "get", Group: "apps", Resource: "deployments"}, false},
+		{"developer not cluster-wide", alice, authorizationv1.ResourceAttributes{Verb: "list", Group: "apps", Resource: "deployments"}, false},
+		{"wildcard subresource", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "patch", Group: "apps", Resource: "statefulsets", Subresource: "scale"}, true},
+		{"wildcard subresource not the parent", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "patch", Group: "apps", Resource: "statefulsets"}, false},
+		{"pod logs in resource", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "pods/log"}, true},
+		{"no pod exec", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "pods", Subresource: "exec"}, false},
+		{"named configmap", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "update", Resource: "configmaps", Name: "app-config"}, true},
+		{"other configmap", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "update", Resource: "configmaps", Name: "db-config"}, false},
+		{"configmaps without a name", alice, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "configmaps"}, false},
+		{"auditor via aggregated cluster role", auditor, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "list", Resource: "pods"}, true},
+		{"auditor read only", auditor, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "delete", Resource: "pods"}, false},
+		{"service account in binding namespace", deployer, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "watch", Group: "apps", Resource: "deployments"}, true},
+		{"service account elsewhere", ServiceAccountSubject("team-b", "deployer"), authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "watch", Group: "apps", Resource: "deployments"}, false},
+		{"anonymous", RBACSubject{}, authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "pods"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := base.As(tt.subject).Authorize(context.Background(), tt.attrs)
+			if err != nil {
+				t.Fatalf("Authorize() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authorize(%+v) for %s = %t, want %t", tt.attrs, tt.subject, got, tt.want)
+			}
+			if got == (reason == "") {
+				t.Errorf("Authorize() reason = %q with allowed = %t", reason, got)
+			}
+		})
+	}
+
+	_, reason, _ := base.As(alice).Authorize(context.Background(), authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "get", Resource: "pods"})
+	if !strings.Contains(reason, `RoleBinding "developers"`) {
+		t.Errorf("reason = %q, want it to name RoleBinding developers", reason)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := base.As(admin).Authorize(ctx, authorizationv1.ResourceAttributes{Verb: "get", Resource: "nodes"}); err != context.Canceled {
+		t.Errorf("Authorize() with cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestRBACAuthorizer_LoadErrors(t *testing.T) {
+	a, err := NewRBACAuthorizer(RBACSubject{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := "apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata:\n  name: r\nrulez: []\n"
+	if err := a.LoadYAML([]byte(bad)); err == nil {
+		t.Error("LoadYAML() with an unknown Role field expected error, got nil")
+	}
+	if err := a.LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFile() of a missing file expected error, got nil")
+	}
+	if _, err := NewRBACAuthorizer(RBACSubject{}, &authorizationv1.SelfSubjectAccessReview{}); err == nil {
+		t.Error("NewRBACAuthorizer() with a non-RBAC object expected error, got nil")
+	}
+}
+
+func TestAuthUtil_Authorizer(t *testing.T) {
+	cs := fake.NewSimpleClientset(
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Namespace: "default"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}, Verbs: []string{"get", "list", "watch"}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "read-pods", Namespace: "default"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "pod-reader"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "frontend"}},
+		},
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "namespace-lister"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"list"}}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "list-namespaces"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "namespace-lister"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:default"}},
+		},
+	)
+	authz, err := NewRBACAuthorizer(ServiceAccountSubject("default", "frontend"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authz.LoadFromClientset(context.Background(), cs); err != nil {
+		t.Fatalf("LoadFromClientset() error: %v", err)
+	}
+	util := &AuthUtil{clientset: cs, Authorizer: authz}
+	ctx := context.Background()
+
+	perms, err := util.CheckNamespacePermissions(ctx, "default", ResourcePods, DefaultCRUDVerbs)
+	if err != nil {
+		t.Fatalf("CheckNamespacePermissions() error: %v", err)
+	}
+	want := map[string]bool{"get": true, "list": true, "watch": true, "create": false, "update": false, "patch": false, "delete": false}
+	if !reflect.DeepEqual(perms, want) {
+		t.Errorf("CheckNamespacePermissions(pods) = %v, want %v", perms, want)
+	}
+	podLogs := schema.GroupVersionResource{Version: "v1", Resource: "pods/log"}
+	if perms, _ := util.CheckNamespacePermissions(ctx, "default", podLogs, []string{"get"}); !perms["get"] {
+		t.Error("CheckNamespacePermissions(pods/log) get = false, want true")
+	}
+	if perms, _ := util.CheckNamespacePermissions(ctx, "other", ResourcePods, []string{"get"}); perms["get"] {
+		t.Error("CheckNamespacePermissions(pods) in another namespace get = true, want false")
+	}
+
+	if ok, err := util.CanPerformClusterAction(ctx, ResourceNamespaces, "list"); err != nil || !ok {
+		t.Errorf("CanPerformClusterAction(namespaces, list) = %t, %v, want true", ok, err)
+	}
+	if ok, _ := util.CanPerformClusterAction(ctx, ResourceNamespaces, "create"); ok {
+		t.Error("CanPerformClusterAction(namespaces, create) = true, want false")
+	}
+
+	// Func overrides still take precedence.
+	util.CanPerformClusterActionFunc = func(context.Context, schema.GroupVersionResource, string) (bool, error) { return true, nil }
+	if ok, _ := util.CanPerformClusterAction(ctx, ResourceNamespaces, "create"); !ok {
+		t.Error("CanPerformClusterActionFunc was not used before the Authorizer")
+	}
+}
+
+func TestRBACAuthorizer_LoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	if err := os.WriteFile(path, []byte(testRBACPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewRBACAuthorizer(RBACSubject{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error: %v", err)
+	}
+	if ok, _, _ := a.Authorize(context.Background(), authorizationv1.ResourceAttributes{Namespace: "team-a", Verb: "list", Resource: "pods"}); !ok {
+		t.Error("Authorize() after LoadFile = false, want true")
+	}
+}